@@ -0,0 +1,501 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/cmd/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/olekukonko/tablewriter"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	dbCommand = cli.Command{
+		Name:      "db",
+		Usage:     "Low level database operations",
+		ArgsUsage: "",
+		Category:  "DATABASE COMMANDS",
+		Subcommands: []cli.Command{
+			{
+				Name:      "freeze-status",
+				Usage:     "Inspect the ancient store of the chain database",
+				ArgsUsage: " ",
+				Action:    utils.MigrateFlags(freezeStatus),
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.AncientFlag,
+					utils.DBEngineFlag,
+					utils.AncientThresholdFlag,
+				},
+				Description: `
+Print the number of blocks moved into the ancient store, the immutability
+threshold after which blocks are frozen and the disk usage of every ancient
+data table.`,
+			},
+			{
+				Name:      "inspect",
+				Usage:     "Inspect the storage size of each type of data in the database",
+				ArgsUsage: " ",
+				Action:    utils.MigrateFlags(inspectDB),
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.AncientFlag,
+					utils.DBEngineFlag,
+				},
+				Description: `
+Iterate over the entire chain database, printing the number of entries and the
+storage size of every type of data, such as headers, bodies, receipts and trie
+nodes, followed by the tables of the ancient store.`,
+			},
+			{
+				Name:      "get",
+				Usage:     "Show the value of a database key",
+				ArgsUsage: "<key>",
+				Action:    utils.MigrateFlags(dbGet),
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.AncientFlag,
+					utils.DBEngineFlag,
+				},
+				Description: `
+Print the hex encoded value stored under a raw database key. The key is either
+hex encoded with a 0x prefix or taken as a string verbatim.`,
+			},
+			{
+				Name:      "put",
+				Usage:     "Set the value of a database key (WARNING: may corrupt your database)",
+				ArgsUsage: "<key> <value>",
+				Action:    utils.MigrateFlags(dbPut),
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.AncientFlag,
+					utils.DBEngineFlag,
+				},
+				Description: `
+Store a value under a raw database key, printing the previous value if any.
+Both the key and the value are either hex encoded with a 0x prefix or taken as
+strings verbatim.`,
+			},
+			{
+				Name:      "delete",
+				Usage:     "Delete a database key (WARNING: may corrupt your database)",
+				ArgsUsage: "<key>",
+				Action:    utils.MigrateFlags(dbDelete),
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.AncientFlag,
+					utils.DBEngineFlag,
+				},
+				Description: `
+Remove a raw database key, printing its previous value. The key is either hex
+encoded with a 0x prefix or taken as a string verbatim.`,
+			},
+			{
+				Name:      "check-canonical",
+				Usage:     "Verify the links of the canonical chain in a block range",
+				ArgsUsage: "[<blockNumFirst> [<blockNumLast>]]",
+				Action:    utils.MigrateFlags(checkCanonical),
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.AncientFlag,
+					utils.DBEngineFlag,
+				},
+				Description: `
+Walk the canonical chain over the given block range, by default from the genesis
+block up to the current fast-sync head, checking that every block number maps
+to a hash, that the hash maps back to the number, and that the header, total
+difficulty, body and receipts of the block are present and match the header and
+its parent. Every broken link found is reported.`,
+			},
+			{
+				Name:      "repair-head",
+				Usage:     "Rewind the head block to the highest block with complete data and state",
+				ArgsUsage: " ",
+				Action:    utils.MigrateFlags(repairHead),
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.AncientFlag,
+					utils.DBEngineFlag,
+				},
+				Description: `
+Walk the canonical chain back from the head block, or from the head header if
+the head block is gone, until a block with its header, body, state root and
+the children of the root present is found, and make it the new head block. The head header and the
+fast-sync head are moved down too if they point to missing blocks. Use it to
+recover a node that crashed in the middle of a database write.`,
+			},
+			{
+				Name:      "convert",
+				Usage:     "Copy the chain database into a new database of another engine",
+				ArgsUsage: "<engine> [<destination>]",
+				Action:    utils.MigrateFlags(convertDB),
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.LightModeFlag,
+					utils.CacheFlag,
+				},
+				Description: `
+Copy every entry of the chain database, opened with the engine it was created
+with, into a new database of the given engine. The destination directory must
+not hold a database yet, and defaults to "chaindata.<engine>" next to the
+source. The ancient store is not copied: to run a node on the converted
+database, swap it in for the chaindata directory and move the ancient directory
+along, or point --datadir.ancient at it.`,
+			},
+		},
+	}
+)
+
+// freezeStatus prints a summary of the ancient store backing the chain database.
+func freezeStatus(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+	db := utils.MakeChainDatabase(ctx, stack)
+	defer db.Close()
+
+	store, ok := db.(ethdb.AncientStore)
+	if !ok {
+		utils.Fatalf("Chain database has no ancient store")
+	}
+	frozen, err := store.Ancients()
+	if err != nil {
+		utils.Fatalf("Failed to retrieve frozen block count: %v", err)
+	}
+	head := core.GetBlockNumber(db, core.GetHeadBlockHash(db))
+
+	fmt.Printf("Frozen blocks:    %d\n", frozen)
+	fmt.Printf("Threshold:        %d\n", store.ImmutabilityThreshold())
+	if head != ^uint64(0) {
+		fmt.Printf("Head block:       %d\n", head)
+	}
+	var total uint64
+	for _, kind := range ethdb.FreezerTables {
+		size, err := store.AncientSize(kind)
+		if err != nil {
+			utils.Fatalf("Failed to retrieve %s table size: %v", kind, err)
+		}
+		total += size
+		fmt.Printf("%-17s %v\n", fmt.Sprintf("Table %s:", kind), common.StorageSize(size))
+	}
+	fmt.Printf("Total size:       %v\n", common.StorageSize(total))
+	return nil
+}
+
+// inspectDB prints the size breakdown of the chain database.
+func inspectDB(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+	db := utils.MakeChainDatabase(ctx, stack)
+	defer db.Close()
+
+	start := time.Now()
+	stats, err := core.InspectDatabase(db)
+	if err != nil {
+		utils.Fatalf("Failed to inspect database: %v", err)
+	}
+	var (
+		count uint64
+		total common.StorageSize
+	)
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Category", "Items", "Size"})
+	for _, stat := range stats {
+		table.Append([]string{stat.Category, strconv.FormatUint(stat.Count, 10), stat.Size.String()})
+		if !strings.HasPrefix(stat.Category, "Ancient") {
+			count += stat.Count
+		}
+		total += stat.Size
+	}
+	table.Append([]string{"Total", strconv.FormatUint(count, 10), total.String()})
+	table.Render()
+
+	log.Info("Inspected database", "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// parseDBBytes decodes a database key or value given on the command line, hex
+// encoded if it has a 0x prefix or a string verbatim otherwise.
+func parseDBBytes(arg string) []byte {
+	if !strings.HasPrefix(arg, "0x") && !strings.HasPrefix(arg, "0X") {
+		return []byte(arg)
+	}
+	blob, err := hexutil.Decode(arg)
+	if err != nil {
+		utils.Fatalf("Invalid hex %q: %v", arg, err)
+	}
+	return blob
+}
+
+// dbGet prints the value of a raw database key.
+func dbGet(ctx *cli.Context) error {
+	if len(ctx.Args()) != 1 {
+		utils.Fatalf("This command requires a key argument")
+	}
+	stack, _ := makeConfigNode(ctx)
+	db := utils.MakeChainDatabase(ctx, stack)
+	defer db.Close()
+
+	key := parseDBBytes(ctx.Args().First())
+	value, err := db.Get(key)
+	if err != nil {
+		utils.Fatalf("Failed to get key %#x: %v", key, err)
+	}
+	fmt.Printf("%#x\n", value)
+	return nil
+}
+
+// dbPut stores a value under a raw database key.
+func dbPut(ctx *cli.Context) error {
+	if len(ctx.Args()) != 2 {
+		utils.Fatalf("This command requires key and value arguments")
+	}
+	stack, _ := makeConfigNode(ctx)
+	db := utils.MakeChainDatabase(ctx, stack)
+	defer db.Close()
+
+	key, value := parseDBBytes(ctx.Args()[0]), parseDBBytes(ctx.Args()[1])
+	if prev, err := db.Get(key); err == nil {
+		fmt.Printf("Previous value: %#x\n", prev)
+	}
+	if err := db.Put(key, value); err != nil {
+		utils.Fatalf("Failed to put key %#x: %v", key, err)
+	}
+	return nil
+}
+
+// dbDelete removes a raw database key.
+func dbDelete(ctx *cli.Context) error {
+	if len(ctx.Args()) != 1 {
+		utils.Fatalf("This command requires a key argument")
+	}
+	stack, _ := makeConfigNode(ctx)
+	db := utils.MakeChainDatabase(ctx, stack)
+	defer db.Close()
+
+	key := parseDBBytes(ctx.Args().First())
+	if prev, err := db.Get(key); err == nil {
+		fmt.Printf("Previous value: %#x\n", prev)
+	}
+	if err := db.Delete(key); err != nil {
+		utils.Fatalf("Failed to delete key %#x: %v", key, err)
+	}
+	return nil
+}
+
+// checkCanonical verifies the database links of the canonical chain over a range
+// of blocks, reporting every broken one.
+func checkCanonical(ctx *cli.Context) error {
+	if len(ctx.Args()) > 2 {
+		utils.Fatalf("This command accepts at most a first and a last block number")
+	}
+	stack, _ := makeConfigNode(ctx)
+	db := utils.MakeChainDatabase(ctx, stack)
+	defer db.Close()
+
+	var first, last uint64
+	if head := core.GetHeadFastBlockHash(db); head != (common.Hash{}) {
+		last = core.GetBlockNumber(db, head)
+	}
+	if len(ctx.Args()) > 0 {
+		var err error
+		if first, err = strconv.ParseUint(ctx.Args()[0], 10, 64); err != nil {
+			utils.Fatalf("Invalid first block number: %v", err)
+		}
+		if len(ctx.Args()) > 1 {
+			if last, err = strconv.ParseUint(ctx.Args()[1], 10, 64); err != nil {
+				utils.Fatalf("Invalid last block number: %v", err)
+			}
+		}
+	}
+	if last == ^uint64(0) || last < first {
+		utils.Fatalf("Invalid block range %d-%d", first, last)
+	}
+	var (
+		broken int
+		parent common.Hash
+		start  = time.Now()
+		logged = time.Now()
+	)
+	if first > 0 {
+		parent = core.GetCanonicalHash(db, first-1)
+	}
+	for number := first; number <= last; number++ {
+		problems := checkCanonicalBlock(db, number, parent)
+		for _, problem := range problems {
+			fmt.Printf("Block #%d: %s\n", number, problem)
+		}
+		if len(problems) > 0 {
+			broken++
+		}
+		parent = core.GetCanonicalHash(db, number)
+
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Checking canonical chain", "number", number, "broken", broken, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	if broken > 0 {
+		utils.Fatalf("Found %d broken blocks in range %d-%d", broken, first, last)
+	}
+	fmt.Printf("Canonical chain intact in range %d-%d\n", first, last)
+	return nil
+}
+
+// checkCanonicalBlock verifies the links of a single canonical block, returning
+// the problems found. The parent is the canonical hash of the previous block,
+// the zero hash if it's missing or for the genesis block.
+func checkCanonicalBlock(db ethdb.Database, number uint64, parent common.Hash) []string {
+	hash := core.GetCanonicalHash(db, number)
+	if hash == (common.Hash{}) {
+		return []string{"canonical hash missing"}
+	}
+	var problems []string
+	if n := core.GetBlockNumber(db, hash); n != number {
+		problems = append(problems, fmt.Sprintf("hash %x maps to number %d", hash, int64(n)))
+	}
+	header := core.GetHeader(db, hash, number)
+	if header == nil {
+		return append(problems, fmt.Sprintf("header %x missing", hash))
+	}
+	if header.Hash() != hash || header.Number.Uint64() != number {
+		problems = append(problems, fmt.Sprintf("header %x mismatch: #%d %x", hash, header.Number, header.Hash()))
+	}
+	if number > 0 && parent != (common.Hash{}) && header.ParentHash != parent {
+		problems = append(problems, fmt.Sprintf("parent %x mismatch: canonical %x", header.ParentHash, parent))
+	}
+	if core.GetTd(db, hash, number) == nil {
+		problems = append(problems, "total difficulty missing")
+	}
+	body := core.GetBody(db, hash, number)
+	if body == nil {
+		return append(problems, "body missing")
+	}
+	if root := types.DeriveSha(types.Transactions(body.Transactions)); root != header.TxHash {
+		problems = append(problems, fmt.Sprintf("transaction root mismatch: body %x, header %x", root, header.TxHash))
+	}
+	if uncles := types.CalcUncleHash(body.Uncles); uncles != header.UncleHash {
+		problems = append(problems, fmt.Sprintf("uncle hash mismatch: body %x, header %x", uncles, header.UncleHash))
+	}
+	receipts := core.GetBlockReceipts(db, hash, number)
+	if receipts == nil && header.ReceiptHash != types.EmptyRootHash {
+		return append(problems, "receipts missing")
+	}
+	if root := types.DeriveSha(receipts); root != header.ReceiptHash {
+		problems = append(problems, fmt.Sprintf("receipt root mismatch: receipts %x, header %x", root, header.ReceiptHash))
+	}
+	return problems
+}
+
+// repairHead rewinds the head block to the highest canonical block with its data
+// and state present.
+func repairHead(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+	db := utils.MakeChainDatabase(ctx, stack)
+	defer db.Close()
+
+	head, repaired, err := core.RepairHead(db)
+	if err != nil {
+		utils.Fatalf("Failed to repair head block: %v", err)
+	}
+	if !repaired {
+		fmt.Printf("Head block #%d [%x] intact, nothing to repair\n", head.NumberU64(), head.Hash())
+		return nil
+	}
+	fmt.Printf("Rewound head block to #%d [%x]\n", head.NumberU64(), head.Hash())
+	return nil
+}
+
+// convertDB copies the key-value store of the chain database into a new database
+// of another engine.
+func convertDB(ctx *cli.Context) error {
+	if len(ctx.Args()) < 1 || len(ctx.Args()) > 2 {
+		utils.Fatalf("This command requires an engine argument and accepts a destination")
+	}
+	stack, _ := makeConfigNode(ctx)
+
+	name := "chaindata"
+	if ctx.GlobalBool(utils.LightModeFlag.Name) {
+		name = "lightchaindata"
+	}
+	engine, source := ctx.Args()[0], stack.ResolvePath(name)
+	dest := source + "." + engine
+	if len(ctx.Args()) > 1 {
+		dest = ctx.Args()[1]
+	}
+	if ethdb.DetectEngine(source) == "" {
+		utils.Fatalf("No database found at %s", source)
+	}
+	if ethdb.DetectEngine(dest) != "" {
+		utils.Fatalf("Destination %s already holds a database", dest)
+	}
+	cache := ctx.GlobalInt(utils.CacheFlag.Name)
+	srcdb, err := ethdb.OpenDatabase("", source, cache/2, 0)
+	if err != nil {
+		utils.Fatalf("Failed to open source database: %v", err)
+	}
+	defer srcdb.Close()
+
+	dstdb, err := ethdb.OpenDatabase(engine, dest, cache/2, 0)
+	if err != nil {
+		utils.Fatalf("Failed to create destination database: %v", err)
+	}
+	defer dstdb.Close()
+
+	var (
+		count  uint64
+		size   common.StorageSize
+		batch  = dstdb.NewBatch()
+		iter   = srcdb.NewIterator(nil, nil)
+		start  = time.Now()
+		logged = time.Now()
+	)
+	defer iter.Release()
+
+	for iter.Next() {
+		batch.Put(common.CopyBytes(iter.Key()), common.CopyBytes(iter.Value()))
+		count++
+		size += common.StorageSize(len(iter.Key()) + len(iter.Value()))
+
+		if batch.ValueSize() >= ethdb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				utils.Fatalf("Failed to write destination database: %v", err)
+			}
+			batch.Reset()
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Converting database", "entries", count, "size", size, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	if err := iter.Error(); err != nil {
+		utils.Fatalf("Failed to iterate source database: %v", err)
+	}
+	if err := batch.Write(); err != nil {
+		utils.Fatalf("Failed to write destination database: %v", err)
+	}
+	fmt.Printf("Copied %d entries (%v) from %s into %s database %s in %v\n", count, size, source, engine, dest, common.PrettyDuration(time.Since(start)))
+	return nil
+}
@@ -59,6 +59,8 @@ var (
 		utils.BootnodesV4Flag,
 		utils.BootnodesV5Flag,
 		utils.DataDirFlag,
+		utils.AncientFlag,
+		utils.DBEngineFlag,
 		utils.KeyStoreDirFlag,
 		utils.NoUSBFlag,
 		utils.EthashCacheDirFlag,
@@ -70,6 +72,10 @@ var (
 		utils.TxPoolNoLocalsFlag,
 		utils.TxPoolJournalFlag,
 		utils.TxPoolRejournalFlag,
+		utils.TxPoolSnapshotFlag,
+		utils.TxPoolSnapshotIntervalFlag,
+		utils.TxPoolSnapshotSizeFlag,
+		utils.TxPoolSnapshotAgeFlag,
 		utils.TxPoolPriceLimitFlag,
 		utils.TxPoolPriceBumpFlag,
 		utils.TxPoolAccountSlotsFlag,
@@ -77,6 +83,7 @@ var (
 		utils.TxPoolAccountQueueFlag,
 		utils.TxPoolGlobalQueueFlag,
 		utils.TxPoolLifetimeFlag,
+		utils.TxPoolFilterFlag,
 		utils.FastSyncFlag,
 		utils.LightModeFlag,
 		utils.SyncModeFlag,
@@ -85,6 +92,14 @@ var (
 		utils.LightKDFFlag,
 		utils.CacheFlag,
 		utils.TrieCacheGenFlag,
+		utils.GCModeFlag,
+		utils.TrieCacheFlag,
+		utils.TrieFlushFlag,
+		utils.TrieRetentionFlag,
+		utils.NoSnapshotFlag,
+		utils.TxLookupLimitFlag,
+		utils.AncientThresholdFlag,
+		utils.AncientNoCompressionFlag,
 		utils.ListenPortFlag,
 		utils.MaxPeersFlag,
 		utils.MaxPendingPeersFlag,
@@ -93,6 +108,8 @@ var (
 		utils.MinerThreadsFlag,
 		utils.MiningEnabledFlag,
 		utils.TargetGasLimitFlag,
+		utils.StratumEndpointFlag,
+		utils.StratumDifficultyFlag,
 		utils.NATFlag,
 		utils.NoDiscoverFlag,
 		utils.DiscoveryV5Flag,
@@ -109,12 +126,12 @@ var (
 		utils.MetricsEnabledFlag,
 		utils.FakePoWFlag,
 		utils.GPUPowFlag,
-		utils.GPUPortFlag,
-		utils.GPUGetFlag,
+		utils.GPUEndpointFlag,
 		utils.NoCompactionFlag,
 		utils.GpoBlocksFlag,
 		utils.GpoPercentileFlag,
 		utils.ExtraDataFlag,
+		utils.MinerStrategyFlag,
 		configFileFlag,
 	}
 
@@ -149,8 +166,14 @@ func init() {
 		initCommand,
 		importCommand,
 		exportCommand,
+		exportHistoryCommand,
+		importHistoryCommand,
 		removedbCommand,
 		dumpCommand,
+		// See dbcmd.go:
+		dbCommand,
+		// See snapshot.go:
+		snapshotCommand,
 		// See monitorcmd.go:
 		monitorCommand,
 		// See accountcmd.go:
@@ -163,6 +186,7 @@ func init() {
 		// See misccmd.go:
 		makecacheCommand,
 		makedagCommand,
+		emissionCommand,
 		versionCommand,
 		bugCommand,
 		licenseCommand,
@@ -17,13 +17,18 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"math/big"
+	"os"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/ethereum/go-ethereum/cmd/utils"
 	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/params"
 	"gopkg.in/urfave/cli.v1"
 )
@@ -53,6 +58,26 @@ The makedag command generates an ethash DAG in <outputDir>.
 
 This command exists to support the system testing project.
 Regular users do not need to execute it.
+`,
+	}
+	emissionCommand = cli.Command{
+		Action:    utils.MigrateFlags(emission),
+		Name:      "emission",
+		Usage:     "Print the block reward emission curve and supply projection",
+		ArgsUsage: "[<genesisPath>]",
+		Flags: []cli.Flag{
+			utils.TestnetFlag,
+			emissionYearsFlag,
+			emissionMasternodeFlag,
+		},
+		Category: "MISCELLANEOUS COMMANDS",
+		Description: `
+The emission command prints the block reward of every stage of the reward
+schedule, i.e. every reward tier and decay period, along with the projected
+total supply at its end. The schedule is taken from the main network, the test
+network or the given genesis file, and the supply starts out with the genesis
+allocations. The projection assumes every block is mined, by a masternode if
+requested.
 `,
 	}
 	versionCommand = cli.Command{
@@ -65,6 +90,15 @@ Regular users do not need to execute it.
 The output of this command is supposed to be machine-readable.
 `,
 	}
+	emissionYearsFlag = cli.Uint64Flag{
+		Name:  "years",
+		Usage: "Number of years to project the emission for",
+		Value: 100,
+	}
+	emissionMasternodeFlag = cli.BoolFlag{
+		Name:  "masternode",
+		Usage: "Project the emission of blocks mined by masternodes",
+	}
 	licenseCommand = cli.Command{
 		Action:    utils.MigrateFlags(license),
 		Name:      "license",
@@ -104,6 +138,91 @@ func makedag(ctx *cli.Context) error {
 	return nil
 }
 
+// blocksPerYear is the number of blocks mined in a year at the target block
+// time of 30 seconds.
+const blocksPerYear = 2 * 60 * 24 * 365
+
+// emission prints the reward emission curve of a network.
+func emission(ctx *cli.Context) error {
+	genesis := core.DefaultGenesisBlock()
+	if ctx.GlobalBool(utils.TestnetFlag.Name) {
+		genesis = core.DefaultTestnetGenesisBlock()
+	}
+	if path := ctx.Args().First(); path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			utils.Fatalf("Failed to read genesis file: %v", err)
+		}
+		defer file.Close()
+
+		genesis = new(core.Genesis)
+		if err := json.NewDecoder(file).Decode(genesis); err != nil {
+			utils.Fatalf("Invalid genesis file: %v", err)
+		}
+	}
+	config := genesis.Config
+	if config == nil {
+		config = new(params.ChainConfig)
+	}
+	schedule := config.Ethash.RewardSchedule()
+
+	balance := new(big.Int)
+	if ctx.Bool(emissionMasternodeFlag.Name) {
+		balance = schedule.MasternodeBalance
+	}
+	supply := new(big.Int)
+	for _, account := range genesis.Alloc {
+		if account.Balance != nil {
+			supply.Add(supply, account.Balance)
+		}
+	}
+	// Collect the blocks where the reward may change: the ends of the tiers, the
+	// decay periods and the exact reward fork
+	end := ctx.Uint64(emissionYearsFlag.Name) * blocksPerYear
+	stages := map[uint64]bool{1: true, end + 1: true}
+	for _, tier := range schedule.RewardTiers {
+		if next := tier.Block.Uint64() + 1; next <= end {
+			stages[next] = true
+		}
+	}
+	for period := schedule.DecayPeriod.Uint64(); period <= end; period += schedule.DecayPeriod.Uint64() {
+		stages[period] = true
+	}
+	if config.ExactRewardBlock != nil && config.ExactRewardBlock.Uint64() <= end {
+		stages[config.ExactRewardBlock.Uint64()] = true
+	}
+	starts := make(blockNumbers, 0, len(stages))
+	for start := range stages {
+		starts = append(starts, start)
+	}
+	sort.Sort(starts)
+
+	fmt.Printf("Genesis supply: %s WTC\n\n", formatWTC(supply))
+	fmt.Printf("%12s %8s %28s %32s\n", "From block", "Year", "Reward (WTC)", "Supply at end (WTC)")
+	for i := 0; i < len(starts)-1; i++ {
+		start, next := starts[i], starts[i+1]
+
+		reward := ethash.BlockReward(config, new(big.Int).SetUint64(start), balance)
+		supply.Add(supply, new(big.Int).Mul(reward, new(big.Int).SetUint64(next-start)))
+
+		year := float64(start) / blocksPerYear
+		fmt.Printf("%12d %8.2f %28s %32s\n", start, year, formatWTC(reward), formatWTC(supply))
+	}
+	return nil
+}
+
+// blockNumbers implements sort.Interface to sort block numbers ascending.
+type blockNumbers []uint64
+
+func (s blockNumbers) Len() int           { return len(s) }
+func (s blockNumbers) Less(i, j int) bool { return s[i] < s[j] }
+func (s blockNumbers) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// formatWTC formats a wei amount in WTC.
+func formatWTC(wei *big.Int) string {
+	return new(big.Rat).SetFrac(wei, big.NewInt(params.Ether)).FloatString(18)
+}
+
 func version(ctx *cli.Context) error {
 	fmt.Println(strings.Title(clientIdentifier))
 	fmt.Println("Version:", params.Version)
@@ -0,0 +1,164 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/cmd/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/state/pruner"
+	"github.com/ethereum/go-ethereum/core/state/snapshot"
+	"github.com/ethereum/go-ethereum/log"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	snapshotCommand = cli.Command{
+		Name:      "snapshot",
+		Usage:     "A set of commands based on the state snapshot",
+		ArgsUsage: "",
+		Category:  "DATABASE COMMANDS",
+		Subcommands: []cli.Command{
+			{
+				Name:      "verify-state",
+				Usage:     "Verify the state snapshot against the state trie",
+				ArgsUsage: " ",
+				Action:    utils.MigrateFlags(verifyState),
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.AncientFlag,
+					utils.DBEngineFlag,
+				},
+				Description: `
+Walk the state trie the persisted state snapshot was made from along with the
+snapshot itself, checking that every account and storage slot in the trie is
+present in the snapshot with the same value and that the snapshot contains no
+other entries. The snapshot is flattened on shutdown, so it is expected to
+match the head block state of a cleanly stopped node.`,
+			},
+			{
+				Name:      "prune-state",
+				Usage:     "Delete the trie nodes and code not reachable from the recent states",
+				ArgsUsage: " ",
+				Action:    utils.MigrateFlags(pruneState),
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.AncientFlag,
+					utils.DBEngineFlag,
+					utils.CacheFlag,
+					utils.PruneRetainFlag,
+					utils.PruneBloomSizeFlag,
+				},
+				Description: `
+Mark every trie node and contract code reachable from the states of the most
+recent --prune.retain canonical blocks and of the genesis block in a bloom
+filter of --prune.bloomsize megabytes, then delete all the other trie nodes and
+codes from the database. States of recent blocks that aren't persisted (e.g.
+because of gcmode=full) are skipped, but the state of the head block must be
+present, so the node must have been stopped cleanly.
+
+The bloom filter is persisted into the data directory before anything is
+deleted. If pruning is interrupted, it is completed by running this command
+again or by starting the node. The database must not be used meanwhile.`,
+			},
+		},
+	}
+)
+
+// verifyState cross checks the persisted state snapshot against its state trie.
+func verifyState(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+	db := utils.MakeChainDatabase(ctx, stack)
+	defer db.Close()
+
+	root := snapshot.DiskRoot(db)
+	if root == (common.Hash{}) {
+		utils.Fatalf("No state snapshot persisted")
+	}
+	hash := core.GetHeadBlockHash(db)
+	if head := core.GetBlock(db, hash, core.GetBlockNumber(db, hash)); head != nil && head.Root() != root {
+		fmt.Printf("Snapshot root %x doesn't match head block %d state %x, it will be regenerated on startup\n", root, head.NumberU64(), head.Root())
+	}
+	start := time.Now()
+	accounts, slots, err := snapshot.VerifyState(db)
+	if err != nil {
+		utils.Fatalf("State snapshot inconsistent after %d accounts and %d slots: %v", accounts, slots, err)
+	}
+	fmt.Printf("Verified state snapshot %x: %d accounts, %d storage slots in %v\n", root, accounts, slots, common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// pruneState deletes all the trie nodes and code from the database which aren't
+// reachable from the recent block states.
+func pruneState(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+	db := utils.MakeChainDatabase(ctx, stack)
+	defer db.Close()
+
+	retain := ctx.Uint64(utils.PruneRetainFlag.Name)
+	if retain < 1 {
+		utils.Fatalf("At least one state must be retained")
+	}
+	head := core.GetHeadBlockHash(db)
+	if head == (common.Hash{}) {
+		utils.Fatalf("No head block found")
+	}
+	number := core.GetBlockNumber(db, head)
+
+	// Collect the persisted states of the recent canonical blocks and genesis
+	var (
+		roots []common.Hash
+		seen  = make(map[common.Hash]bool)
+	)
+	retained := func(number uint64, required bool) {
+		header := core.GetHeader(db, core.GetCanonicalHash(db, number), number)
+		if header == nil {
+			utils.Fatalf("Canonical header #%d missing", number)
+		}
+		if seen[header.Root] {
+			return
+		}
+		if _, err := state.New(header.Root, state.NewDatabase(db)); err != nil {
+			if required {
+				utils.Fatalf("Head block #%d state %x missing, stop the node cleanly first", number, header.Root)
+			}
+			log.Debug("Skipping missing state", "number", number, "root", header.Root)
+			return
+		}
+		roots = append(roots, header.Root)
+		seen[header.Root] = true
+	}
+	for i := uint64(0); i < retain && i <= number; i++ {
+		retained(number-i, i == 0)
+	}
+	retained(0, false)
+
+	p, err := pruner.NewPruner(db, stack.ResolvePath(""), ctx.Uint64(utils.PruneBloomSizeFlag.Name)*1024*1024)
+	if err != nil {
+		utils.Fatalf("Failed to create state pruner: %v", err)
+	}
+	start := time.Now()
+	if err := p.Prune(roots); err != nil {
+		utils.Fatalf("State pruning failed: %v", err)
+	}
+	fmt.Printf("State pruning done in %v\n", common.PrettyDuration(time.Since(start)))
+	return nil
+}
@@ -67,6 +67,8 @@ var AppHelpFlagGroups = []flagGroup{
 		Flags: []cli.Flag{
 			configFileFlag,
 			utils.DataDirFlag,
+			utils.AncientFlag,
+			utils.DBEngineFlag,
 			utils.KeyStoreDirFlag,
 			utils.NoUSBFlag,
 			utils.NetworkIdFlag,
@@ -91,8 +93,7 @@ var AppHelpFlagGroups = []flagGroup{
 			utils.EthashDatasetsInMemoryFlag,
 			utils.EthashDatasetsOnDiskFlag,
 			utils.GPUPowFlag,
-			utils.GPUPortFlag,
-			utils.GPUGetFlag,
+			utils.GPUEndpointFlag,
 		},
 	},
 	{
@@ -101,6 +102,10 @@ var AppHelpFlagGroups = []flagGroup{
 			utils.TxPoolNoLocalsFlag,
 			utils.TxPoolJournalFlag,
 			utils.TxPoolRejournalFlag,
+			utils.TxPoolSnapshotFlag,
+			utils.TxPoolSnapshotIntervalFlag,
+			utils.TxPoolSnapshotSizeFlag,
+			utils.TxPoolSnapshotAgeFlag,
 			utils.TxPoolPriceLimitFlag,
 			utils.TxPoolPriceBumpFlag,
 			utils.TxPoolAccountSlotsFlag,
@@ -108,6 +113,7 @@ var AppHelpFlagGroups = []flagGroup{
 			utils.TxPoolAccountQueueFlag,
 			utils.TxPoolGlobalQueueFlag,
 			utils.TxPoolLifetimeFlag,
+			utils.TxPoolFilterFlag,
 		},
 	},
 	{
@@ -115,6 +121,14 @@ var AppHelpFlagGroups = []flagGroup{
 		Flags: []cli.Flag{
 			utils.CacheFlag,
 			utils.TrieCacheGenFlag,
+			utils.GCModeFlag,
+			utils.TrieCacheFlag,
+			utils.TrieFlushFlag,
+			utils.TrieRetentionFlag,
+			utils.NoSnapshotFlag,
+			utils.TxLookupLimitFlag,
+			utils.AncientThresholdFlag,
+			utils.AncientNoCompressionFlag,
 		},
 	},
 	{
@@ -170,6 +184,9 @@ var AppHelpFlagGroups = []flagGroup{
 			utils.TargetGasLimitFlag,
 			utils.GasPriceFlag,
 			utils.ExtraDataFlag,
+			utils.MinerStrategyFlag,
+			utils.StratumEndpointFlag,
+			utils.StratumDifficultyFlag,
 		},
 	},
 	{
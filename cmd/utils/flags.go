@@ -113,6 +113,14 @@ var (
 		Usage: "Data directory for the databases and keystore",
 		Value: DirectoryString{node.DefaultDataDir()},
 	}
+	AncientFlag = DirectoryFlag{
+		Name:  "datadir.ancient",
+		Usage: "Data directory for ancient chain segments (default = inside chaindata)",
+	}
+	DBEngineFlag = cli.StringFlag{
+		Name:  "db.engine",
+		Usage: "Backing database implementation to use ('" + strings.Join(ethdb.Engines, "' or '") + "', default = existing or " + ethdb.Engines[0] + ")",
+	}
 	KeyStoreDirFlag = DirectoryFlag{
 		Name:  "keystore",
 		Usage: "Directory for the keystore (default = inside the datadir)",
@@ -221,6 +229,25 @@ var (
 		Usage: "Time interval to regenerate the local transaction journal",
 		Value: core.DefaultTxPoolConfig.Rejournal,
 	}
+	TxPoolSnapshotFlag = cli.StringFlag{
+		Name:  "txpool.snapshot",
+		Usage: "Disk snapshot of all pooled transactions to survive node restarts (disabled if empty)",
+	}
+	TxPoolSnapshotIntervalFlag = cli.DurationFlag{
+		Name:  "txpool.snapshotinterval",
+		Usage: "Time interval to regenerate the transaction pool snapshot",
+		Value: core.DefaultTxPoolConfig.SnapshotInterval,
+	}
+	TxPoolSnapshotSizeFlag = cli.Uint64Flag{
+		Name:  "txpool.snapshotsize",
+		Usage: "Maximum number of transactions to store in and restore from the snapshot",
+		Value: core.DefaultTxPoolConfig.SnapshotSize,
+	}
+	TxPoolSnapshotAgeFlag = cli.DurationFlag{
+		Name:  "txpool.snapshotage",
+		Usage: "Maximum age of a transaction pool snapshot to restore it",
+		Value: core.DefaultTxPoolConfig.SnapshotAge,
+	}
 	TxPoolPriceLimitFlag = cli.Uint64Flag{
 		Name:  "txpool.pricelimit",
 		Usage: "Minimum gas price limit to enforce for acceptance into the pool",
@@ -256,12 +283,64 @@ var (
 		Usage: "Maximum amount of time non-executable transaction are queued",
 		Value: eth.DefaultConfig.TxPool.Lifetime,
 	}
+	TxPoolFilterFlag = cli.StringFlag{
+		Name:  "txpool.filter",
+		Usage: "JSON file of the sender and recipient allow/deny lists of the transaction pool",
+	}
 	// Performance tuning settings
 	CacheFlag = cli.IntFlag{
 		Name:  "cache",
 		Usage: "Megabytes of memory allocated to internal caching (min 16MB / database forced)",
 		Value: 128,
 	}
+	GCModeFlag = cli.StringFlag{
+		Name:  "gcmode",
+		Usage: `Blockchain garbage collection mode ("full", "archive")`,
+		Value: "full",
+	}
+	TrieCacheFlag = cli.IntFlag{
+		Name:  "trie.cache",
+		Usage: "Megabytes of memory the trie node cache may use before being flushed to disk (gcmode=full)",
+		Value: eth.DefaultConfig.TrieCache,
+	}
+	TrieFlushFlag = cli.Uint64Flag{
+		Name:  "trie.flush",
+		Usage: "Number of blocks after which the trie node cache is flushed to disk (gcmode=full)",
+		Value: eth.DefaultConfig.TrieFlushInterval,
+	}
+	TrieRetentionFlag = cli.Uint64Flag{
+		Name:  "trie.retention",
+		Usage: "Number of recent block states kept in the trie node cache (gcmode=full)",
+		Value: eth.DefaultConfig.TrieRetention,
+	}
+	NoSnapshotFlag = cli.BoolFlag{
+		Name:  "nosnapshot",
+		Usage: "Disables the flat state snapshot accelerating state reads",
+	}
+	TxLookupLimitFlag = cli.Uint64Flag{
+		Name:  "txlookuplimit",
+		Usage: "Number of recent blocks to maintain transaction lookup entries for (0 = all blocks)",
+		Value: eth.DefaultConfig.TxLookupLimit,
+	}
+	AncientThresholdFlag = cli.Uint64Flag{
+		Name:  "ancient.threshold",
+		Usage: "Number of blocks after which a chain segment is moved into the ancient store",
+		Value: eth.DefaultConfig.AncientThreshold,
+	}
+	AncientNoCompressionFlag = cli.BoolFlag{
+		Name:  "ancient.nocompress",
+		Usage: "Disables snappy compression of the ancient store",
+	}
+	PruneRetainFlag = cli.Uint64Flag{
+		Name:  "prune.retain",
+		Usage: "Number of recent block states retained by offline state pruning",
+		Value: 2,
+	}
+	PruneBloomSizeFlag = cli.Uint64Flag{
+		Name:  "prune.bloomsize",
+		Usage: "Megabytes of memory allocated to the bloom filter of offline state pruning",
+		Value: 512,
+	}
 	TrieCacheGenFlag = cli.IntFlag{
 		Name:  "trie-cache-gens",
 		Usage: "Number of trie node generations to keep in memory",
@@ -296,6 +375,20 @@ var (
 		Name:  "extradata",
 		Usage: "Block extra data set by the miner (default = client version)",
 	}
+	MinerStrategyFlag = cli.StringFlag{
+		Name:  "minerstrategy",
+		Usage: "Block building strategy of the miner (price, txcount, bundle)",
+		Value: "price",
+	}
+	StratumEndpointFlag = cli.StringFlag{
+		Name:  "stratum",
+		Usage: "Serve Stratum miners on the given TCP endpoint (e.g. 0.0.0.0:8008)",
+	}
+	StratumDifficultyFlag = cli.Uint64Flag{
+		Name:  "stratum.difficulty",
+		Usage: "Difficulty of the shares accepted from Stratum miners",
+		Value: eth.DefaultConfig.StratumDifficulty,
+	}
 	// Account settings
 	UnlockedAccountFlag = cli.StringFlag{
 		Name:  "unlock",
@@ -329,13 +422,10 @@ var (
 		Name:  "gpupow",
 		Usage: "GPU speedup",
 	}
-	GPUPortFlag = cli.Int64Flag{
-		Name:  "gpuport",
-		Usage: "Port for GPU send to miner",
-	}
-	GPUGetFlag = cli.Int64Flag{
-		Name:  "gpugetport",
-		Usage: "Port for miner send to GPU",
+	GPUEndpointFlag = cli.StringFlag{
+		Name:  "gpuendpoint",
+		Usage: "Endpoint GPU sealer workers connect to (host:port or unix socket path)",
+		Value: eth.DefaultConfig.GPUEndpoint,
 	}
 	NoCompactionFlag = cli.BoolFlag{
 		Name:  "nocompaction",
@@ -836,6 +926,13 @@ func SetNodeConfig(ctx *cli.Context, cfg *node.Config) {
 		cfg.DataDir = filepath.Join(node.DefaultDataDir(), "rinkeby")
 	}
 
+	if ctx.GlobalIsSet(DBEngineFlag.Name) {
+		engine := ctx.GlobalString(DBEngineFlag.Name)
+		if !isDBEngine(engine) {
+			Fatalf("Invalid --%s: %q, must be one of %v", DBEngineFlag.Name, engine, ethdb.Engines)
+		}
+		cfg.DBEngine = engine
+	}
 	if ctx.GlobalIsSet(KeyStoreDirFlag.Name) {
 		cfg.KeyStoreDir = ctx.GlobalString(KeyStoreDirFlag.Name)
 	}
@@ -847,6 +944,16 @@ func SetNodeConfig(ctx *cli.Context, cfg *node.Config) {
 	}
 }
 
+// isDBEngine reports whether a database engine name is supported.
+func isDBEngine(engine string) bool {
+	for _, known := range ethdb.Engines {
+		if engine == known {
+			return true
+		}
+	}
+	return false
+}
+
 func setGPO(ctx *cli.Context, cfg *gasprice.Config) {
 	if ctx.GlobalIsSet(GpoBlocksFlag.Name) {
 		cfg.Blocks = ctx.GlobalInt(GpoBlocksFlag.Name)
@@ -866,6 +973,18 @@ func setTxPool(ctx *cli.Context, cfg *core.TxPoolConfig) {
 	if ctx.GlobalIsSet(TxPoolRejournalFlag.Name) {
 		cfg.Rejournal = ctx.GlobalDuration(TxPoolRejournalFlag.Name)
 	}
+	if ctx.GlobalIsSet(TxPoolSnapshotFlag.Name) {
+		cfg.Snapshot = ctx.GlobalString(TxPoolSnapshotFlag.Name)
+	}
+	if ctx.GlobalIsSet(TxPoolSnapshotIntervalFlag.Name) {
+		cfg.SnapshotInterval = ctx.GlobalDuration(TxPoolSnapshotIntervalFlag.Name)
+	}
+	if ctx.GlobalIsSet(TxPoolSnapshotSizeFlag.Name) {
+		cfg.SnapshotSize = ctx.GlobalUint64(TxPoolSnapshotSizeFlag.Name)
+	}
+	if ctx.GlobalIsSet(TxPoolSnapshotAgeFlag.Name) {
+		cfg.SnapshotAge = ctx.GlobalDuration(TxPoolSnapshotAgeFlag.Name)
+	}
 	if ctx.GlobalIsSet(TxPoolPriceLimitFlag.Name) {
 		cfg.PriceLimit = ctx.GlobalUint64(TxPoolPriceLimitFlag.Name)
 	}
@@ -887,6 +1006,9 @@ func setTxPool(ctx *cli.Context, cfg *core.TxPoolConfig) {
 	if ctx.GlobalIsSet(TxPoolLifetimeFlag.Name) {
 		cfg.Lifetime = ctx.GlobalDuration(TxPoolLifetimeFlag.Name)
 	}
+	if ctx.GlobalIsSet(TxPoolFilterFlag.Name) {
+		cfg.Filter = ctx.GlobalString(TxPoolFilterFlag.Name)
+	}
 }
 
 func setEthash(ctx *cli.Context, cfg *eth.Config) {
@@ -911,11 +1033,8 @@ func setEthash(ctx *cli.Context, cfg *eth.Config) {
 	if ctx.GlobalIsSet(GPUPowFlag.Name) {
 		cfg.PowGPU = ctx.GlobalBool(GPUPowFlag.Name)
 	}
-	if ctx.GlobalIsSet(GPUPortFlag.Name) {
-		cfg.GPUPort = ctx.GlobalInt64(GPUPortFlag.Name)
-	}
-	if ctx.GlobalIsSet(GPUGetFlag.Name) {
-		cfg.GPUGetPort = ctx.GlobalInt64(GPUGetFlag.Name)
+	if ctx.GlobalIsSet(GPUEndpointFlag.Name) {
+		cfg.GPUEndpoint = ctx.GlobalString(GPUEndpointFlag.Name)
 	}
 }
 
@@ -976,6 +1095,34 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *eth.Config) {
 	}
 	cfg.DatabaseHandles = makeDatabaseHandles()
 
+	if ctx.GlobalIsSet(AncientFlag.Name) {
+		cfg.DatabaseFreezer = ctx.GlobalString(AncientFlag.Name)
+	}
+	if ctx.GlobalIsSet(AncientThresholdFlag.Name) {
+		cfg.AncientThreshold = ctx.GlobalUint64(AncientThresholdFlag.Name)
+	}
+	cfg.AncientNoCompression = ctx.GlobalBool(AncientNoCompressionFlag.Name)
+
+	if gcmode := ctx.GlobalString(GCModeFlag.Name); gcmode != "full" && gcmode != "archive" {
+		Fatalf("--%s must be either 'full' or 'archive'", GCModeFlag.Name)
+	}
+	cfg.NoPruning = ctx.GlobalString(GCModeFlag.Name) == "archive"
+
+	if ctx.GlobalIsSet(TrieCacheFlag.Name) {
+		cfg.TrieCache = ctx.GlobalInt(TrieCacheFlag.Name)
+	}
+	if ctx.GlobalIsSet(TrieFlushFlag.Name) {
+		cfg.TrieFlushInterval = ctx.GlobalUint64(TrieFlushFlag.Name)
+	}
+	if ctx.GlobalIsSet(TrieRetentionFlag.Name) {
+		cfg.TrieRetention = ctx.GlobalUint64(TrieRetentionFlag.Name)
+	}
+	cfg.NoSnapshot = ctx.GlobalBool(NoSnapshotFlag.Name)
+
+	if ctx.GlobalIsSet(TxLookupLimitFlag.Name) {
+		cfg.TxLookupLimit = ctx.GlobalUint64(TxLookupLimitFlag.Name)
+	}
+
 	if ctx.GlobalIsSet(MinerThreadsFlag.Name) {
 		cfg.MinerThreads = ctx.GlobalInt(MinerThreadsFlag.Name)
 	}
@@ -988,6 +1135,15 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *eth.Config) {
 	if ctx.GlobalIsSet(GasPriceFlag.Name) {
 		cfg.GasPrice = GlobalBig(ctx, GasPriceFlag.Name)
 	}
+	if ctx.GlobalIsSet(MinerStrategyFlag.Name) {
+		cfg.MinerStrategy = ctx.GlobalString(MinerStrategyFlag.Name)
+	}
+	if ctx.GlobalIsSet(StratumEndpointFlag.Name) {
+		cfg.StratumEndpoint = ctx.GlobalString(StratumEndpointFlag.Name)
+	}
+	if ctx.GlobalIsSet(StratumDifficultyFlag.Name) {
+		cfg.StratumDifficulty = ctx.GlobalUint64(StratumDifficultyFlag.Name)
+	}
 	if ctx.GlobalIsSet(VMEnableDebugFlag.Name) {
 		// TODO(fjl): force-enable this in --dev mode
 		cfg.EnablePreimageRecording = ctx.GlobalBool(VMEnableDebugFlag.Name)
@@ -1079,11 +1235,18 @@ func MakeChainDatabase(ctx *cli.Context, stack *node.Node) ethdb.Database {
 		cache   = ctx.GlobalInt(CacheFlag.Name)
 		handles = makeDatabaseHandles()
 	)
-	name := "chaindata"
+	var (
+		chainDb ethdb.Database
+		err     error
+	)
 	if ctx.GlobalBool(LightModeFlag.Name) {
-		name = "lightchaindata"
+		chainDb, err = stack.OpenDatabase("lightchaindata", cache, handles)
+	} else {
+		freezer := ctx.GlobalString(AncientFlag.Name)
+		threshold := ctx.GlobalUint64(AncientThresholdFlag.Name)
+		compress := !ctx.GlobalBool(AncientNoCompressionFlag.Name)
+		chainDb, err = stack.OpenDatabaseWithFreezer("chaindata", cache, handles, freezer, threshold, compress)
 	}
-	chainDb, err := stack.OpenDatabase(name, cache, handles)
 	if err != nil {
 		Fatalf("Could not open database: %v", err)
 	}
@@ -1113,15 +1276,25 @@ func MakeChain(ctx *cli.Context, stack *node.Node) (chain *core.BlockChain, chai
 		engine = ethash.New(
 			stack.ResolvePath(eth.DefaultConfig.EthashCacheDir), eth.DefaultConfig.EthashCachesInMem, eth.DefaultConfig.EthashCachesOnDisk,
 			stack.ResolvePath(eth.DefaultConfig.EthashDatasetDir), eth.DefaultConfig.EthashDatasetsInMem, eth.DefaultConfig.EthashDatasetsOnDisk,
-			eth.DefaultConfig.PowGPU,eth.DefaultConfig.GPUPort,eth.DefaultConfig.GPUGetPort,
+			eth.DefaultConfig.PowGPU, eth.DefaultConfig.GPUEndpoint,
 		)
 	}
 	config, _, err := core.SetupGenesisBlock(chainDb, MakeGenesis(ctx))
 	if err != nil {
 		Fatalf("%v", err)
 	}
+	if gcmode := ctx.GlobalString(GCModeFlag.Name); gcmode != "full" && gcmode != "archive" {
+		Fatalf("--%s must be either 'full' or 'archive'", GCModeFlag.Name)
+	}
+	cache := &core.CacheConfig{
+		Disabled:      ctx.GlobalString(GCModeFlag.Name) == "archive",
+		TrieNodeLimit: ctx.GlobalInt(TrieCacheFlag.Name),
+		FlushInterval: ctx.GlobalUint64(TrieFlushFlag.Name),
+		Retention:     ctx.GlobalUint64(TrieRetentionFlag.Name),
+		NoSnapshot:    ctx.GlobalBool(NoSnapshotFlag.Name),
+	}
 	vmcfg := vm.Config{EnablePreimageRecording: ctx.GlobalBool(VMEnableDebugFlag.Name)}
-	chain, err = core.NewBlockChain(chainDb, config, engine, vmcfg)
+	chain, err = core.NewBlockChain(chainDb, cache, config, engine, vmcfg)
 	if err != nil {
 		Fatalf("Can't create BlockChain: %v", err)
 	}
@@ -0,0 +1,283 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package utils
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/internal/era"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// historyCheckFreq is the frequency of verifying the header seals during a
+// history import, the last header of every epoch being verified too.
+const historyCheckFreq = 100
+
+// ExportHistory exports the blocks in the given range along with their receipts
+// and total difficulties into era archives in a directory, one per epoch. The
+// range is extended to start at an epoch boundary. The archives are listed in
+// order with their checksums in the checksums file of the directory.
+func ExportHistory(chain *core.BlockChain, db ethdb.Database, dir string, network string, first uint64, last uint64) error {
+	if first > last {
+		return fmt.Errorf("invalid range: first block #%d after last #%d", first, last)
+	}
+	head := chain.CurrentBlock().NumberU64()
+	if fast := chain.CurrentFastBlock().NumberU64(); fast > head {
+		head = fast
+	}
+	if last > head {
+		return fmt.Errorf("last block #%d beyond the chain head #%d", last, head)
+	}
+	if first%era.MaxEpochSize != 0 {
+		log.Warn("Extending export to the epoch boundary", "first", first-first%era.MaxEpochSize)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	log.Info("Exporting chain history", "dir", dir, "first", first, "last", last)
+
+	var (
+		sums  []era.Checksum
+		start = time.Now()
+	)
+	for epoch := first / era.MaxEpochSize; epoch*era.MaxEpochSize <= last; epoch++ {
+		from, to := epoch*era.MaxEpochSize, (epoch+1)*era.MaxEpochSize-1
+		if to > last {
+			to = last
+		}
+		sum, err := exportEpoch(chain, db, dir, network, epoch, from, to)
+		if err != nil {
+			return err
+		}
+		sums = append(sums, sum)
+		log.Info("Exported history epoch", "file", sum.Name, "first", from, "last", to, "elapsed", common.PrettyDuration(time.Since(start)))
+	}
+	return era.WriteChecksums(dir, sums)
+}
+
+// exportEpoch writes the blocks of an epoch into an archive, naming it after its
+// accumulator root once complete.
+func exportEpoch(chain *core.BlockChain, db ethdb.Database, dir string, network string, epoch uint64, from uint64, to uint64) (era.Checksum, error) {
+	tmp := filepath.Join(dir, fmt.Sprintf("%s-%05d.era.tmp", network, epoch))
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return era.Checksum{}, err
+	}
+	defer os.Remove(tmp) // Fails once renamed
+	defer f.Close()
+
+	var (
+		hasher  = sha256.New()
+		buf     = bufio.NewWriter(io.MultiWriter(f, hasher))
+		builder = era.NewBuilder(buf)
+	)
+	for number := from; number <= to; number++ {
+		block := chain.GetBlockByNumber(number)
+		if block == nil {
+			return era.Checksum{}, fmt.Errorf("block #%d missing", number)
+		}
+		receipts := core.GetBlockReceipts(db, block.Hash(), number)
+		if receipts == nil && len(block.Transactions()) > 0 {
+			return era.Checksum{}, fmt.Errorf("receipts of block #%d missing", number)
+		}
+		td := chain.GetTd(block.Hash(), number)
+		if td == nil {
+			return era.Checksum{}, fmt.Errorf("total difficulty of block #%d missing", number)
+		}
+		if err := builder.Add(block, receipts, td); err != nil {
+			return era.Checksum{}, err
+		}
+	}
+	root, err := builder.Finalize()
+	if err != nil {
+		return era.Checksum{}, err
+	}
+	if err := buf.Flush(); err != nil {
+		return era.Checksum{}, err
+	}
+	if err := f.Sync(); err != nil {
+		return era.Checksum{}, err
+	}
+	if err := f.Close(); err != nil {
+		return era.Checksum{}, err
+	}
+	sum := era.Checksum{Name: era.Filename(network, epoch, root)}
+	copy(sum.Sum[:], hasher.Sum(nil))
+
+	return sum, os.Rename(tmp, filepath.Join(dir, sum.Name))
+}
+
+// ImportHistory imports the era archives listed in the checksums file of a
+// directory into the chain without executing the blocks. The archives are read
+// and verified in parallel, and every epoch is checked against its checksum and
+// accumulator before its headers are inserted and completed with the bodies and
+// receipts via InsertReceiptChain. The state of the imported blocks is not
+// available afterwards.
+func ImportHistory(chain *core.BlockChain, dir string) error {
+	sums, err := era.ReadChecksums(dir)
+	if err != nil {
+		return err
+	}
+	if len(sums) == 0 {
+		return errors.New("no archives listed")
+	}
+	// Watch for Ctrl-C while the import is running.
+	// If a signal is received, the import will stop at the next epoch.
+	interrupt := make(chan os.Signal, 1)
+	stop := make(chan struct{})
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	defer close(interrupt)
+	go func() {
+		if _, ok := <-interrupt; ok {
+			log.Info("Interrupted during history import, stopping at next epoch")
+		}
+		close(stop)
+	}()
+	log.Info("Importing chain history", "dir", dir, "archives", len(sums))
+
+	// Read and verify the archives in parallel, limiting the number of decoded
+	// epochs held in memory
+	type result struct {
+		epoch *era.Epoch
+		err   error
+	}
+	var (
+		results = make([]chan result, len(sums))
+		tokens  = make(chan struct{}, runtime.NumCPU())
+		done    = make(chan struct{})
+	)
+	defer close(done)
+
+	for i := range results {
+		results[i] = make(chan result, 1)
+	}
+	go func() {
+		for i, sum := range sums {
+			select {
+			case tokens <- struct{}{}:
+			case <-done:
+				return
+			}
+			go func(i int, sum era.Checksum) {
+				epoch, err := readEpoch(dir, sum)
+				results[i] <- result{epoch, err}
+			}(i, sum)
+		}
+	}()
+	// Insert the verified epochs in order
+	var (
+		next  uint64
+		start = time.Now()
+	)
+	for i, sum := range sums {
+		var res result
+		select {
+		case res = <-results[i]:
+			<-tokens
+		case <-stop:
+			return errors.New("interrupted")
+		}
+		if res.err != nil {
+			return fmt.Errorf("invalid archive %s: %v", sum.Name, res.err)
+		}
+		if first := res.epoch.Blocks[0].NumberU64(); i > 0 && first != next {
+			return fmt.Errorf("archive %s not contiguous: first block #%d, want #%d", sum.Name, first, next)
+		}
+		next = res.epoch.Blocks[len(res.epoch.Blocks)-1].NumberU64() + 1
+
+		if err := importEpoch(chain, res.epoch); err != nil {
+			return fmt.Errorf("failed to import archive %s: %v", sum.Name, err)
+		}
+		log.Info("Imported history epoch", "file", sum.Name, "head", next-1, "elapsed", common.PrettyDuration(time.Since(start)))
+	}
+	return nil
+}
+
+// readEpoch verifies the checksum of an archive and reads its verified content.
+func readEpoch(dir string, sum era.Checksum) (*era.Epoch, error) {
+	path := filepath.Join(dir, sum.Name)
+	if err := era.VerifyChecksum(path, sum.Sum); err != nil {
+		return nil, err
+	}
+	archive, err := era.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+
+	return archive.Read()
+}
+
+// importEpoch inserts the blocks of a verified epoch missing from the chain,
+// after ensuring the epoch links to the local chain.
+func importEpoch(chain *core.BlockChain, epoch *era.Epoch) error {
+	blocks, receipts, tds := epoch.Blocks, epoch.Receipts, epoch.TDs
+
+	// The genesis block can't be imported, only checked
+	if blocks[0].NumberU64() == 0 {
+		genesis := chain.Genesis()
+		if blocks[0].Hash() != genesis.Hash() {
+			return fmt.Errorf("genesis mismatch: have %x, want %x", blocks[0].Hash(), genesis.Hash())
+		}
+		if td := chain.GetTd(genesis.Hash(), 0); tds[0].Cmp(td) != 0 {
+			return fmt.Errorf("genesis total difficulty mismatch: have %v, want %v", tds[0], td)
+		}
+		blocks, receipts, tds = blocks[1:], receipts[1:], tds[1:]
+	}
+	// Skip the blocks already known in full
+	for len(blocks) > 0 && chain.HasBlock(blocks[0].Hash(), blocks[0].NumberU64()) {
+		blocks, receipts, tds = blocks[1:], receipts[1:], tds[1:]
+	}
+	if len(blocks) == 0 {
+		return nil
+	}
+	// Ensure the first block links to the local chain with the same difficulty
+	first := blocks[0]
+	ptd := chain.GetTd(first.ParentHash(), first.NumberU64()-1)
+	if ptd == nil {
+		return fmt.Errorf("parent of block #%d unknown", first.NumberU64())
+	}
+	if td := new(big.Int).Add(ptd, first.Difficulty()); td.Cmp(tds[0]) != 0 {
+		return fmt.Errorf("total difficulty mismatch at block #%d: have %v, want %v", first.NumberU64(), tds[0], td)
+	}
+	headers := make([]*types.Header, len(blocks))
+	for i, block := range blocks {
+		headers[i] = block.Header()
+	}
+	if n, err := chain.InsertHeaders(headers, historyCheckFreq); err != nil {
+		return fmt.Errorf("invalid header #%d: %v", headers[n].Number, err)
+	}
+	if n, err := chain.InsertReceiptChain(blocks, receipts); err != nil {
+		return fmt.Errorf("invalid block #%d: %v", blocks[n].NumberU64(), err)
+	}
+	return nil
+}
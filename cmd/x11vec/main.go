@@ -0,0 +1,90 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+// x11vec generates X11 proof-of-work test vectors for external miners.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+)
+
+var (
+	countFlag = flag.Int("count", 64, "number of vectors in the generated corpus")
+	hashFlag  = flag.String("hash", "", "hex header hash to compute a single vector for")
+	nonceFlag = flag.Uint64("nonce", 0, "nonce of the single vector")
+	outFlag   = flag.String("out", "", "file to write the vectors to (default stdout)")
+)
+
+func init() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage:", os.Args[0], "[-count <n>] [-hash <hex> [-nonce <n>]] [-out <file>]")
+		flag.PrintDefaults()
+		fmt.Fprintln(os.Stderr, `
+Generates JSON (hash, order, nonce, digest, result) X11 proof-of-work vectors.
+Without -hash, the deterministic corpus of consensus/ethash/testdata is emitted.`)
+	}
+}
+
+func main() {
+	flag.Parse()
+	if flag.NArg() > 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	var vectors []*ethash.X11Vector
+	if *hashFlag != "" {
+		hash, err := hexutil.Decode(*hashFlag)
+		if err != nil {
+			die(fmt.Errorf("invalid header hash: %v", err))
+		}
+		if len(hash) != 32 {
+			die(fmt.Errorf("invalid header hash length: have %d, want 32", len(hash)))
+		}
+		vectors = append(vectors, ethash.NewX11Vector(hash, *nonceFlag))
+	} else {
+		if *countFlag <= 0 {
+			die(fmt.Errorf("invalid vector count: %d", *countFlag))
+		}
+		vectors = ethash.X11Vectors(*countFlag)
+	}
+	out := os.Stdout
+	if *outFlag != "" {
+		fd, err := os.Create(*outFlag)
+		if err != nil {
+			die(err)
+		}
+		defer fd.Close()
+		out = fd
+	}
+	blob, err := json.MarshalIndent(vectors, "", "  ")
+	if err != nil {
+		die(err)
+	}
+	if _, err := fmt.Fprintf(out, "%s\n", blob); err != nil {
+		die(err)
+	}
+}
+
+func die(args ...interface{}) {
+	fmt.Fprintln(os.Stderr, args...)
+	os.Exit(1)
+}
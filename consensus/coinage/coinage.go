@@ -0,0 +1,92 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package coinage implements the coin age model of the Waltonchain proof-of-work.
+//
+// The coin age of an account is the sum of its balance multiplied by the seconds
+// it was held. The state stores the coin age as of the time of its last update,
+// accruing the balance held since whenever the balance changes. A block sealer
+// widens its target by the coin age of the coinbase at the block time, which is
+// consumed once the block is processed.
+package coinage
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// legacyBonus is the balance the coinbase was assumed to hold on top of its own
+// until the coin age fix fork, matching no actual reward.
+var legacyBonus = big.NewInt(1e+18)
+
+// Accrue returns the coin age after holding balance from time from until time
+// to. The coin age is returned as is if to is not after from.
+func Accrue(coinage, balance, from, to *big.Int) *big.Int {
+	if from.Cmp(to) >= 0 {
+		return coinage
+	}
+	elapsed := new(big.Int).Sub(to, from)
+	return elapsed.Mul(elapsed, balance).Add(elapsed, coinage)
+}
+
+// Expected returns the coin age the coinbase of header is expected to seal
+// with, given its balance and coin age as of the block number and time of the
+// preceding state. This is the single definition sealers and verifiers share.
+//
+// Until the coin age fix fork the balance is bumped by 1 WTC for the elapsed
+// period. Afterwards the coin age is exactly the one the state accrues until the
+// block time, which is the one the block consumes.
+func Expected(config *params.ChainConfig, header *types.Header, balance, coinage, preNumber, preTime *big.Int) *big.Int {
+	if preTime.Cmp(header.Time) >= 0 || preNumber.Cmp(header.Number) >= 0 {
+		return coinage
+	}
+	if !config.IsCoinAgeFix(header.Number) {
+		balance = new(big.Int).Add(balance, legacyBonus)
+	}
+	return Accrue(coinage, balance, preTime, header.Time)
+}
+
+// ExpectedAt returns the coin age the coinbase of header is expected to seal
+// with on top of the state of parent. The coinbase coin age of statedb is
+// accrued until the parent time in the process.
+func ExpectedAt(config *params.ChainConfig, statedb *state.StateDB, header, parent *types.Header) *big.Int {
+	balance := statedb.GetBalance(header.Coinbase)
+	coinage := statedb.GetCoinAge(header.Coinbase, parent.Number, parent.Time)
+
+	return Expected(config, header, balance, coinage, parent.Number, parent.Time)
+}
+
+// Consume settles the coin age the coinbase of header sealed the block with.
+// Until the coin age fix fork the coin age of the coinbase is reset, whatever
+// the block was sealed with. Afterwards only the sealed coin age is deducted
+// from the one accrued until the block time, any surplus is carried over.
+func Consume(config *params.ChainConfig, statedb *state.StateDB, header *types.Header) {
+	if !config.IsCoinAgeFix(header.Number) {
+		statedb.SetCoinAge(header.Coinbase, big.NewInt(0))
+		return
+	}
+	remaining := new(big.Int).Set(statedb.GetCoinAge(header.Coinbase, header.Number, header.Time))
+	if header.CoinAge != nil {
+		remaining.Sub(remaining, header.CoinAge)
+	}
+	if remaining.Sign() < 0 {
+		remaining.SetUint64(0)
+	}
+	statedb.SetCoinAge(header.Coinbase, remaining)
+}
@@ -0,0 +1,168 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package coinage
+
+import (
+	"math/big"
+	"testing"
+	"testing/quick"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+var (
+	legacyConfig = &params.ChainConfig{}
+	fixConfig    = &params.ChainConfig{CoinAgeFixBlock: big.NewInt(0)}
+	coinbase     = common.HexToAddress("0x1000000000000000000000000000000000000001")
+)
+
+// coinAgeTest is a randomized coinbase account and block sealed on top of it.
+type coinAgeTest struct {
+	Balance uint64 // Balance of the coinbase in gwei
+	Stored  uint64 // Coin age stored in the parent state
+	Updated uint16 // Seconds before the parent the coin age was updated at
+	Elapsed uint16 // Seconds between the parent and the sealed block
+}
+
+// setup creates the parent state of the test and the headers of the parent and
+// the sealed block.
+func (tt coinAgeTest) setup() (*state.StateDB, *types.Header, *types.Header) {
+	db, _ := ethdb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+
+	parent := &types.Header{Number: big.NewInt(100), Time: big.NewInt(1000000)}
+	header := &types.Header{
+		Number:   big.NewInt(101),
+		Time:     new(big.Int).Add(parent.Time, big.NewInt(int64(tt.Elapsed))),
+		Coinbase: coinbase,
+	}
+	updated := new(big.Int).Sub(parent.Time, big.NewInt(int64(tt.Updated)))
+	balance := new(big.Int).Mul(new(big.Int).SetUint64(tt.Balance), big.NewInt(params.Shannon))
+
+	statedb.AddBalance(coinbase, balance, parent.Number, updated)
+	statedb.SetCoinAge(coinbase, new(big.Int).SetUint64(tt.Stored))
+
+	return statedb, parent, header
+}
+
+// Tests that accruing coin age over consecutive periods equals accruing it over
+// the whole period at once.
+func TestAccrueAdditive(t *testing.T) {
+	check := func(coinage, balance uint64, start uint32, first, second uint16) bool {
+		var (
+			c   = new(big.Int).SetUint64(coinage)
+			b   = new(big.Int).SetUint64(balance)
+			t0  = new(big.Int).SetUint64(uint64(start))
+			t1  = new(big.Int).Add(t0, big.NewInt(int64(first)))
+			t2  = new(big.Int).Add(t1, big.NewInt(int64(second)))
+			one = Accrue(Accrue(c, b, t0, t1), b, t1, t2)
+		)
+		return one.Cmp(Accrue(c, b, t0, t2)) == 0
+	}
+	if err := quick.Check(check, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+// Tests that the coin age is left untouched unless the sealed block is newer
+// than the preceding state.
+func TestExpectedNotAdvancing(t *testing.T) {
+	check := func(tt coinAgeTest) bool {
+		_, parent, header := tt.setup()
+		balance := new(big.Int).SetUint64(tt.Balance)
+		coinage := new(big.Int).SetUint64(tt.Stored)
+
+		for _, config := range []*params.ChainConfig{legacyConfig, fixConfig} {
+			if Expected(config, parent, balance, coinage, parent.Number, parent.Time).Cmp(coinage) != 0 {
+				return false
+			}
+			if Expected(config, header, balance, coinage, header.Number, parent.Time).Cmp(coinage) != 0 {
+				return false
+			}
+		}
+		return true
+	}
+	if err := quick.Check(check, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+// Tests that after the fix fork the expected coin age is exactly the one the
+// state accrues until the block time, while before it exceeds that by 1 WTC for
+// every elapsed second.
+func TestExpectedMatchesState(t *testing.T) {
+	check := func(tt coinAgeTest) bool {
+		statedb, parent, header := tt.setup()
+		accrued := new(big.Int).Set(statedb.Copy().GetCoinAge(coinbase, header.Number, header.Time))
+
+		if ExpectedAt(fixConfig, statedb.Copy(), header, parent).Cmp(accrued) != 0 {
+			return false
+		}
+		bonus := new(big.Int).Mul(legacyBonus, big.NewInt(int64(tt.Elapsed)))
+		return ExpectedAt(legacyConfig, statedb.Copy(), header, parent).Cmp(bonus.Add(bonus, accrued)) == 0
+	}
+	if err := quick.Check(check, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+// Tests that processing a block consumes exactly the coin age it was sealed
+// with after the fix fork, carrying any surplus over, while before the fork
+// the coin age is reset regardless.
+func TestConsume(t *testing.T) {
+	check := func(tt coinAgeTest, deficit uint32) bool {
+		statedb, parent, header := tt.setup()
+		expected := ExpectedAt(fixConfig, statedb.Copy(), header, parent)
+
+		// Sealing with the expected coin age consumes all of it
+		header.CoinAge = expected
+		consumed := statedb.Copy()
+		if Consume(fixConfig, consumed, header); consumed.GetStoredCoinAge(coinbase).Sign() != 0 {
+			return false
+		}
+		// Sealing with less carries the surplus over
+		surplus := new(big.Int).SetUint64(uint64(deficit))
+		if surplus.Cmp(expected) > 0 {
+			surplus.Set(expected)
+		}
+		header.CoinAge = new(big.Int).Sub(expected, surplus)
+		consumed = statedb.Copy()
+		if Consume(fixConfig, consumed, header); consumed.GetStoredCoinAge(coinbase).Cmp(surplus) != 0 {
+			return false
+		}
+		if consumed.GetFUBlock(coinbase).Cmp(header.Time) != 0 {
+			return false
+		}
+		// Sealing with more, or before the fork, leaves nothing
+		header.CoinAge = new(big.Int).Add(expected, big.NewInt(1))
+		consumed = statedb.Copy()
+		if Consume(fixConfig, consumed, header); consumed.GetStoredCoinAge(coinbase).Sign() != 0 {
+			return false
+		}
+		header.CoinAge = nil
+		consumed = statedb.Copy()
+		Consume(legacyConfig, consumed, header)
+		return consumed.GetStoredCoinAge(coinbase).Sign() == 0
+	}
+	if err := quick.Check(check, nil); err != nil {
+		t.Error(err)
+	}
+}
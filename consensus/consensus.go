@@ -49,6 +49,9 @@ type ChainReader interface {
 
 	GetBalanceAndCoinAgeByHeaderHash(addr common.Address) (*big.Int, *big.Int, *big.Int, *big.Int)
 
+	// StateAt retrieves the state database belonging to a particular state root.
+	StateAt(root common.Hash) (*state.StateDB, error)
+
 	//GetCoinAgeByHeaderHash(addr common.Address) (*big.Int,*big.Int)
 }
 
@@ -78,6 +81,14 @@ type Engine interface {
 	// the consensus rules of the given engine.
 	VerifySeal(chain ChainReader, header *types.Header) error
 
+	// VerifyCoinAge checks whether the coin age claimed by a header matches the
+	// one derived from the coinbase account in the parent block's state.
+	VerifyCoinAge(chain ChainReader, header *types.Header) error
+
+	// VerifyTxNumber checks whether the transaction number claimed by a block's
+	// header matches the one derived from its transactions.
+	VerifyTxNumber(chain ChainReader, block *types.Block) error
+
 	// Prepare initializes the consensus fields of a block header according to the
 	// rules of a particular engine. The changes are executed inline.
 	Prepare(chain ChainReader, header *types.Header) error
@@ -91,12 +102,10 @@ type Engine interface {
 
 	// Seal generates a new block for the given input block with the local miner's
 	// seal place on top.
-	Seal(chain ChainReader, block *types.Block, stop <-chan struct{}, serverFound chan uint64) (*types.Block, error)
+	Seal(chain ChainReader, block *types.Block, stop <-chan struct{}) (*types.Block, error)
 
 	// APIs returns the RPC APIs this consensus engine provides.
 	APIs(chain ChainReader) []rpc.API
-
-	IsGPU() (bool, int64, int64)
 }
 
 // PoW is a consensus engine based on proof-of-work.
@@ -23,6 +23,10 @@ var (
 	// that is unknown.
 	ErrUnknownAncestor = errors.New("unknown ancestor")
 
+	// ErrPrunedAncestor is returned when validating a block requires an ancestor
+	// that is known, but the state of which is not available.
+	ErrPrunedAncestor = errors.New("pruned ancestor")
+
 	// ErrFutureBlock is returned when a block's timestamp is in the future according
 	// to the current node.
 	ErrFutureBlock = errors.New("block in the future")
@@ -30,4 +34,12 @@ var (
 	// ErrInvalidNumber is returned if a block's number doesn't equal it's parent's
 	// plus one.
 	ErrInvalidNumber = errors.New("invalid block number")
+
+	// ErrInvalidCoinAge is returned if a block's coin age doesn't equal the one
+	// accumulated by its coinbase in the parent state.
+	ErrInvalidCoinAge = errors.New("invalid coin age")
+
+	// ErrInvalidTxNumber is returned if a block's transaction number doesn't equal
+	// the number of its transactions scaling the PoW target.
+	ErrInvalidTxNumber = errors.New("invalid transaction number")
 )
@@ -312,24 +312,32 @@ func mysha256(set []byte,nonce uint64) ([]byte,[]byte) {
 	return digest,md
 }
 
-func myx11(set []byte, nonce uint64, order []byte) ([]byte, []byte) {
-	digest := make([]byte, common.HashLength)
-	hash,out := x11.New(),[32]byte{}
-
-	var res = make([]byte, 8)
-    binary.BigEndian.PutUint64(res, nonce)
+// x11Hashers pools the reusable X11 hashers seals and shares are verified with.
+var x11Hashers = sync.Pool{New: func() interface{} { return x11.NewHasher() }}
 
+// myx11 computes the mix digest, which is unused and always zero, and the X11
+// proof-of-work value of a header hash and nonce.
+func myx11(set []byte, nonce uint64, order []byte) ([]byte, []byte) {
+	hasher := x11Hashers.Get().(*x11.Hasher)
+	defer x11Hashers.Put(hasher)
 
-	for _,v := range res {
-    	set=append(set,v)
-    }
-	for i := 0; i < 24; i++ {
-		set = append(set, 0)
-	}
-	hash.Hash(set, out[:], order)
-	return digest,out[:]
+	// The results outlive the pooled hasher, copy them out in a single allocation
+	buf := make([]byte, common.HashLength+32)
+	copy(buf[common.HashLength:], hasher.Hash(set, nonce, order))
+	return buf[:common.HashLength:common.HashLength], buf[common.HashLength:]
 }
 
+// getX11Order derives the order in which the X11 algorithms are chained from a
+// header hash. Each algorithm is named by a letter of meta: A blake, B cubehash,
+// C echo, D bmw, E jh, F groestl, G luffa, H skein, I simd, J keccak and
+// K shavite. The order is built in two consensus critical steps:
+//
+//  1. Position i takes the letter meta[hash[i] % length], so letters may repeat.
+//  2. For every letter of metaDiscard, its first occurrence is kept and all later
+//     ones are replaced by metaReplace[hash[11] % len(metaReplace)].
+//
+// The replacement letters are never discarded, so the result does not depend on
+// the order in which metaDiscard is processed.
 func getX11Order(hash []byte, length int) []byte {
 	x11Array := make([]byte, length)
 	for i := 0; i < length ; i++ {
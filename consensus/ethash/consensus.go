@@ -27,6 +27,7 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/math"
 	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/coinage"
 	"github.com/ethereum/go-ethereum/consensus/misc"
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
@@ -81,7 +82,7 @@ func (ethash *Ethash) VerifyHeader(chain consensus.ChainReader, header *types.He
 		return consensus.ErrUnknownAncestor
 	}
 	// Sanity checks passed, do a proper verification
-	return ethash.verifyHeader(chain, header, parent, false, seal)
+	return ethash.verifyHeader(chain, chain.GetHeader, header, parent, false, seal)
 }
 
 // VerifyHeaders is similar to VerifyHeader, but verifies a batch of headers
@@ -162,7 +163,16 @@ func (ethash *Ethash) verifyHeaderWorker(chain consensus.ChainReader, headers []
 	if chain.GetHeader(headers[index].Hash(), headers[index].Number.Uint64()) != nil {
 		return nil // known block
 	}
-	return ethash.verifyHeader(chain, headers[index], parent, false, seals[index])
+	// The ancestors the difficulty retarget needs may be part of the batch
+	getHeader := func(hash common.Hash, number uint64) *types.Header {
+		if first := headers[0].Number.Uint64(); number >= first && number-first < uint64(index) {
+			if header := headers[number-first]; header.Hash() == hash {
+				return header
+			}
+		}
+		return chain.GetHeader(hash, number)
+	}
+	return ethash.verifyHeader(chain, getHeader, headers[index], parent, false, seals[index])
 }
 
 // VerifyUncles verifies that the given block's uncles conform to the consensus
@@ -210,7 +220,7 @@ func (ethash *Ethash) VerifyUncles(chain consensus.ChainReader, block *types.Blo
 		if ancestors[uncle.ParentHash] == nil || uncle.ParentHash == block.ParentHash() {
 			return errDanglingUncle
 		}
-		if err := ethash.verifyHeader(chain, uncle, ancestors[uncle.ParentHash], true, true); err != nil {
+		if err := ethash.verifyHeader(chain, chain.GetHeader, uncle, ancestors[uncle.ParentHash], true, true); err != nil {
 			return err
 		}
 	}
@@ -218,9 +228,10 @@ func (ethash *Ethash) VerifyUncles(chain consensus.ChainReader, block *types.Blo
 }
 
 // verifyHeader checks whether a header conforms to the consensus rules of the
-// stock Ethereum ethash engine.
+// stock Ethereum ethash engine, retrieving the ancestors of the header the
+// difficulty retarget needs via getHeader.
 // See YP section 4.3.4. "Block Header Validity"
-func (ethash *Ethash) verifyHeader(chain consensus.ChainReader, header, parent *types.Header, uncle bool, seal bool) error {
+func (ethash *Ethash) verifyHeader(chain consensus.ChainReader, getHeader func(common.Hash, uint64) *types.Header, header, parent *types.Header, uncle bool, seal bool) error {
 	// Ensure that the header's extra-data section is of a reasonable size
 	if uint64(len(header.Extra)) > params.MaximumExtraDataSize {
 		return fmt.Errorf("extra-data too long: %d > %d", len(header.Extra), params.MaximumExtraDataSize)
@@ -239,7 +250,10 @@ func (ethash *Ethash) verifyHeader(chain consensus.ChainReader, header, parent *
 		return errZeroBlockTime
 	}
 	// Verify the block's difficulty based in it's timestamp and parent's difficulty
-	expected := CalcDifficulty(chain.Config(), header.Time.Uint64(), parent)
+	expected := CalcNextDifficulty(chain.Config(), header.Time.Uint64(), parent, getHeader)
+	if expected == nil {
+		return consensus.ErrUnknownAncestor
+	}
 	if expected.Cmp(header.Difficulty) != 0 {
 		return fmt.Errorf("invalid difficulty: have %v, want %v", header.Difficulty, expected)
 	}
@@ -300,6 +314,85 @@ func CalcDifficulty(config *params.ChainConfig, time uint64, parent *types.Heade
 	return calcDifficultyEthereum(time,parent)
 }
 
+// CalcNextDifficulty returns the difficulty that a new block should have when
+// created at time on top of parent. Unlike CalcDifficulty it takes the retarget
+// fork into account, retrieving the ancestors it needs via getHeader. It returns
+// nil if an ancestor is unavailable.
+func CalcNextDifficulty(config *params.ChainConfig, time uint64, parent *types.Header, getHeader func(common.Hash, uint64) *types.Header) *big.Int {
+	next := new(big.Int).Add(parent.Number, big1)
+	if !config.IsRetarget(next) || parent.Number.Uint64() < retargetWindow {
+		return CalcDifficulty(config, time, parent)
+	}
+	return calcDifficultyWaltonchain(parent, getHeader)
+}
+
+const (
+	retargetWindow    = 32 // Number of blocks the retarget averages over
+	retargetBlockTime = 30 // Block time in seconds the retarget aims for
+)
+
+// retargetPrecision scales the inverse seal multipliers of the retarget.
+var retargetPrecision = new(big.Int).Lsh(big1, 128)
+
+// calcDifficultyWaltonchain is the difficulty adjustment algorithm after the
+// retarget fork. Instead of the nominal difficulty, it aims the effective one
+// of the blocks, i.e. the nominal difficulty divided by the seal multipliers of
+// the coin age and transaction count, at the target block time. The last
+// retargetWindow blocks are averaged, so neither a single wealthy miner nor a
+// burst of transactions swings the difficulty:
+//
+//	hashrate   = sum(difficulty_i / multiplier_i) / timespan
+//	effective  = hashrate * retargetBlockTime
+//	difficulty = effective * retargetWindow / sum(1 / multiplier_i)
+//
+// The nominal difficulty is the effective one scaled by the harmonic mean of the
+// multipliers, which the expected block time is inversely proportional to. The
+// timespan is clamped to a third and thrice the targeted one.
+func calcDifficultyWaltonchain(parent *types.Header, getHeader func(common.Hash, uint64) *types.Header) *big.Int {
+	var (
+		effective = new(big.Int) // Sum of the effective difficulties of the window
+		inverse   = new(big.Int) // Sum of the scaled inverse multipliers of the window
+		header    = parent
+	)
+	for i := 0; i < retargetWindow; i++ {
+		multiplier := sealMultiplier(header)
+		effective.Add(effective, new(big.Int).Div(header.Difficulty, multiplier))
+		inverse.Add(inverse, new(big.Int).Div(retargetPrecision, multiplier))
+
+		if header = getHeader(header.ParentHash, header.Number.Uint64()-1); header == nil {
+			return nil
+		}
+	}
+	// Clamp the time the window took to limit the adjustment
+	timespan := new(big.Int).Sub(parent.Time, header.Time)
+	target := big.NewInt(retargetWindow * retargetBlockTime)
+	if min := new(big.Int).Div(target, big3); timespan.Cmp(min) < 0 {
+		timespan = min
+	}
+	if max := new(big.Int).Mul(target, big3); timespan.Cmp(max) > 0 {
+		timespan = max
+	}
+	diff := effective.Mul(effective, big.NewInt(retargetWindow*retargetBlockTime))
+	diff.Mul(diff, retargetPrecision)
+	diff.Div(diff, timespan.Mul(timespan, inverse))
+
+	if diff.Cmp(params.MinimumDifficulty) < 0 {
+		diff.Set(params.MinimumDifficulty)
+	}
+	return diff
+}
+
+// sealMultiplier returns the combined factor the target of a header is widened
+// by, see SealTarget.
+func sealMultiplier(header *types.Header) *big.Int {
+	coinage := header.CoinAge
+	if coinage == nil {
+		coinage = new(big.Int)
+	}
+	coinageMul, txMul := SealMultipliers(coinage, header.TxNumber)
+	return coinageMul.Mul(coinageMul, txMul)
+}
+
 // Some weird constants to avoid constant memory allocs for them.
 var (
 	expDiffPeriod = big.NewInt(100000)
@@ -534,21 +627,84 @@ func (ethash *Ethash) VerifySeal(chain consensus.ChainReader, header *types.Head
 	if !bytes.Equal(header.MixDigest[:], digest) {
 		return errInvalidMixDigest
 	}
+	target := SealTarget(header, coinage)
+	if Compare(result, FullTo32(target.Bytes()), 32) > 0 {
+		return errInvalidPoW
+	}
+	return nil
+}
+
+// SealTarget returns the target the PoW value of a header has to meet, which is
+// the difficulty based target widened by the seal multipliers of the coin age of
+// the coinbase and of the number of transactions in the block.
+func SealTarget(header *types.Header, coinage *big.Int) *big.Int {
 	target := new(big.Int).Div(maxUint256, header.Difficulty)
-	//if new(big.Int).SetBytes(result).Cmp(target) > 0 {
+
+	coinageMul, txMul := SealMultipliers(coinage, header.TxNumber)
+	target.Mul(coinageMul, target)
+	target.Mul(txMul, target)
+	return target
+}
+
+// SealMultipliers returns the factors the difficulty based target of a block is
+// widened by: the approximate sixth root (see Sqrt) of the coin age of the
+// coinbase and of 5 WTC per transaction in the block. Roots of zero leave the
+// target as is, so they are returned as a factor of one.
+func SealMultipliers(coinage *big.Int, txs uint64) (*big.Int, *big.Int) {
 	bn_coinage := new(big.Int).Mul(coinage, big.NewInt(1))
 	bn_coinage = Sqrt(bn_coinage, 6)
-	bn_txnumber := new(big.Int).Mul(new(big.Int).SetUint64(header.TxNumber), big.NewInt(5e+18))
+	bn_txnumber := new(big.Int).Mul(new(big.Int).SetUint64(txs), big.NewInt(5e+18))
 	bn_txnumber = Sqrt(bn_txnumber, 6)
-	if bn_coinage.Cmp(big.NewInt(0)) > 0 {
-		target.Mul(bn_coinage, target)
+	if bn_coinage.Sign() <= 0 {
+		bn_coinage = big.NewInt(1)
 	}
-	if bn_txnumber.Cmp(big.NewInt(0)) > 0 {
-		target.Mul(bn_txnumber, target)
+	if bn_txnumber.Sign() <= 0 {
+		bn_txnumber = big.NewInt(1)
 	}
+	return bn_coinage, bn_txnumber
+}
 
-	if Compare(result, FullTo32(target.Bytes()), 32) > 0 {
-		return errInvalidPoW
+// VerifyCoinAge implements consensus.Engine, checking whether the coin age the
+// header was sealed with matches the one its coinbase accumulated on top of the
+// parent state, as computed by the sealers.
+func (ethash *Ethash) VerifyCoinAge(chain consensus.ChainReader, header *types.Header) error {
+	// If we're running a fake PoW, accept any coin age as valid
+	if ethash.fakeMode || ethash.fakeFull {
+		return nil
+	}
+	// Blocks before the fork were sealed with unverified coin ages
+	if !chain.Config().IsCoinAge(header.Number) {
+		return nil
+	}
+	parent := chain.GetHeader(header.ParentHash, header.Number.Uint64()-1)
+	if parent == nil {
+		return consensus.ErrUnknownAncestor
+	}
+	statedb, err := chain.StateAt(parent.Root)
+	if err != nil {
+		return err
+	}
+	expected := coinage.ExpectedAt(chain.Config(), statedb, header, parent)
+	if header.CoinAge == nil || header.CoinAge.Cmp(expected) != 0 {
+		return consensus.ErrInvalidCoinAge
+	}
+	return nil
+}
+
+// VerifyTxNumber implements consensus.Engine, checking whether the transaction
+// number the header was sealed with matches the effective one of the block's
+// transactions (see TxCounter).
+func (ethash *Ethash) VerifyTxNumber(chain consensus.ChainReader, block *types.Block) error {
+	// If we're running a fake PoW, accept any transaction number as valid
+	if ethash.fakeMode || ethash.fakeFull {
+		return nil
+	}
+	// Blocks before the fork were sealed with the plain transaction count
+	if !chain.Config().IsEffectiveTx(block.Number()) {
+		return nil
+	}
+	if TxNumber(chain.Config(), block.Header(), block.Transactions()) != block.Header().TxNumber {
+		return consensus.ErrInvalidTxNumber
 	}
 	return nil
 }
@@ -560,7 +716,10 @@ func (ethash *Ethash) Prepare(chain consensus.ChainReader, header *types.Header)
 	if parent == nil {
 		return consensus.ErrUnknownAncestor
 	}
-	header.Difficulty = CalcDifficulty(chain.Config(), header.Time.Uint64(), parent)
+	header.Difficulty = CalcNextDifficulty(chain.Config(), header.Time.Uint64(), parent, chain.GetHeader)
+	if header.Difficulty == nil {
+		return consensus.ErrUnknownAncestor
+	}
 
 	return nil
 }
@@ -569,11 +728,11 @@ func (ethash *Ethash) Prepare(chain consensus.ChainReader, header *types.Header)
 // setting the final state and assembling the block.
 func (ethash *Ethash) Finalize(chain consensus.ChainReader, header *types.Header, state *state.StateDB, txs []*types.Transaction, uncles []*types.Header, receipts []*types.Receipt) (*types.Block, error) {
 	// Accumulate any block and uncle rewards and commit the final state root
-	AccumulateRewards(state, header, uncles)
+	AccumulateRewards(chain.Config(), state, header, uncles)
 	header.Root = state.IntermediateRoot(chain.Config().IsEIP158(header.Number))
 
 	// Header seems complete, assemble into a block and return
-	return types.NewBlock(header, txs, uncles, receipts), nil
+	return NewBlock(chain.Config(), header, txs, uncles, receipts), nil
 }
 
 // Some weird constants to avoid constant memory allocs for them.
@@ -583,49 +742,75 @@ var (
 )
 
 // AccumulateRewards credits the coinbase of the given block with the mining
-// reward. The total reward consists of the static block reward and rewards for
-// included uncles. The coinbase of each uncle block is also rewarded.
+// reward and settles the coin age it sealed the block with. The total reward
+// consists of the static block reward and rewards for included uncles. The
+// coinbase of each uncle block is also rewarded.
 // TODO (karalabe): Move the chain maker into this package and make this private!
-func AccumulateRewards(state *state.StateDB, header *types.Header, uncles []*types.Header) {
+func AccumulateRewards(config *params.ChainConfig, state *state.StateDB, header *types.Header, uncles []*types.Header) {
 	balance := state.GetBalance(header.Coinbase)
-	reward := getReward(header.Number, balance)
+	reward := BlockReward(config, header.Number, balance)
 
 	state.AddBalance(header.Coinbase, reward, header.Number, header.Time)
-	state.SetCoinAge(header.Coinbase, big.NewInt(0))
+	coinage.Consume(config, state, header)
 }
 
-func getReward(block, balance *big.Int) *big.Int {
-	oneyear := big.NewInt(2 * 60 * 24 * 365)
-	var reward *big.Int
-	big5000 := new(big.Int).Mul(params.AddedRewardForMN, big.NewInt(1e+18))
-	years := new(big.Int).Div(block, oneyear).Int64()
-
-	if block.Int64() <= 40000 {
-		reward = big.NewInt(1e+17)
-	}else if block.Int64() > 40000 && block.Int64() <= 100000{
-		reward = big.NewInt(1e+18)
-	}else if block.Int64() > 100000 && block.Int64() <= 200000{
-		reward = big.NewInt(2e+18)
-	}else if years < 2 {
-		reward = big.NewInt(25e+17)
-		if balance.Cmp(big5000) >= 0 {
-			reward = reward.Add(reward, big.NewInt(5e+17))
-		}
-	} else {
-		var discount float64 = 100000
-		y := years / 2
-		for i := 0; int64(i) < y; i++ {
-			discount = discount * 0.75
+// rewardPrecision is the fixed point precision the legacy decay of the block
+// reward is calculated with.
+const rewardPrecision = 100000
+
+// BlockReward returns the reward for mining the block with the given number by
+// a coinbase holding the given balance, according to the reward schedule of the
+// chain config.
+func BlockReward(config *params.ChainConfig, number, balance *big.Int) *big.Int {
+	schedule := config.Ethash.RewardSchedule()
+	for _, tier := range schedule.RewardTiers {
+		if number.Cmp(tier.Block) <= 0 {
+			return new(big.Int).Set(tier.Reward)
 		}
+	}
+	reward := new(big.Int).Set(schedule.BlockReward)
+	if balance.Cmp(schedule.MasternodeBalance) >= 0 {
+		reward.Add(reward, schedule.MasternodeBonus)
+	}
+	periods := new(big.Int).Div(number, schedule.DecayPeriod).Int64()
+	if periods == 0 {
+		return reward
+	}
+	if config.IsExactReward(number) {
+		return exactDecay(reward, periods, schedule.DecayNumerator, schedule.DecayDenominator)
+	}
+	return legacyDecay(reward, periods, schedule.DecayNumerator, schedule.DecayDenominator)
+}
 
-		reward = big.NewInt(25e+17)
-		if balance.Cmp(big5000) >= 0 {
-			reward = reward.Add(reward, big.NewInt(5e+17))
-		}
+// legacyDecay scales the reward down by the decay ratio once per period the way
+// the reward was calculated before the exact reward fork: the ratio is applied
+// to a float64 fixed point discount, which is then truncated and multiplied by
+// the truncated reward.
+func legacyDecay(reward *big.Int, periods int64, num, den uint64) *big.Int {
+	var (
+		discount float64 = rewardPrecision
+		ratio            = float64(num) / float64(den)
+	)
+	for i := int64(0); i < periods; i++ {
+		discount = discount * ratio
+	}
+	reward = new(big.Int).Div(reward, big.NewInt(rewardPrecision))
+	return reward.Mul(reward, big.NewInt(int64(discount)))
+}
 
-		reward = new(big.Int).Div(reward, big.NewInt(100000))
-		reward = new(big.Int).Mul(reward, big.NewInt(int64(discount)))
+// exactDecay scales the reward down by the decay ratio once per period, i.e. it
+// returns floor(reward * num^periods / den^periods).
+func exactDecay(reward *big.Int, periods int64, num, den uint64) *big.Int {
+	var (
+		n  = new(big.Int).Set(reward) // reward * num^i
+		d  = big.NewInt(1)            // den^i
+		bn = new(big.Int).SetUint64(num)
+		bd = new(big.Int).SetUint64(den)
+	)
+	// Once a decaying reward dropped below one wei it stays there, stop early
+	for i := int64(0); i < periods && n.Cmp(d) >= 0; i++ {
+		n.Mul(n, bn)
+		d.Mul(d, bd)
 	}
-	
-	return reward
+	return n.Div(n, d)
 }
@@ -17,14 +17,21 @@
 package ethash
 
 import (
+	"crypto/ecdsa"
 	"encoding/json"
 	"math/big"
 	"os"
 	"path/filepath"
 	"testing"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/coinage"
+	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/params"
 )
 
@@ -83,3 +90,414 @@ func TestCalcDifficulty(t *testing.T) {
 		}
 	}
 }
+
+// coinAgeChain is a minimal consensus.ChainReader serving a single parent header
+// along with its state, used to verify the coin age of its children.
+type coinAgeChain struct {
+	config *params.ChainConfig
+	parent *types.Header
+	db     state.Database
+}
+
+func (c *coinAgeChain) Config() *params.ChainConfig  { return c.config }
+func (c *coinAgeChain) CurrentHeader() *types.Header { return c.parent }
+
+func (c *coinAgeChain) GetHeader(hash common.Hash, number uint64) *types.Header {
+	if hash == c.parent.Hash() && number == c.parent.Number.Uint64() {
+		return c.parent
+	}
+	return nil
+}
+
+func (c *coinAgeChain) GetHeaderByNumber(number uint64) *types.Header {
+	return c.GetHeader(c.parent.Hash(), number)
+}
+
+func (c *coinAgeChain) GetHeaderByHash(hash common.Hash) *types.Header {
+	return c.GetHeader(hash, c.parent.Number.Uint64())
+}
+
+func (c *coinAgeChain) GetBlock(hash common.Hash, number uint64) *types.Block { return nil }
+
+func (c *coinAgeChain) GetBalanceAndCoinAgeByHeaderHash(addr common.Address) (*big.Int, *big.Int, *big.Int, *big.Int) {
+	statedb, _ := c.StateAt(c.parent.Root)
+	return statedb.GetBalance(addr), statedb.GetCoinAge(addr, c.parent.Number, c.parent.Time), c.parent.Number, c.parent.Time
+}
+
+func (c *coinAgeChain) StateAt(root common.Hash) (*state.StateDB, error) {
+	return state.New(root, c.db)
+}
+
+// Tests that headers are only accepted if their coin age matches the one the
+// sealers derive from the parent state, and only after the fork block.
+func TestVerifyCoinAge(t *testing.T) {
+	var (
+		db, _    = ethdb.NewMemDatabase()
+		coinbase = common.HexToAddress("0x1000000000000000000000000000000000000001")
+	)
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+	statedb.AddBalance(coinbase, big.NewInt(5e+18), big.NewInt(1), big.NewInt(100))
+	statedb.SetCoinAge(coinbase, big.NewInt(3e+18))
+	root, err := statedb.CommitTo(db, false)
+	if err != nil {
+		t.Fatalf("failed to commit parent state: %v", err)
+	}
+	chain := &coinAgeChain{
+		config: &params.ChainConfig{CoinAgeBlock: big.NewInt(2)},
+		parent: &types.Header{Number: big.NewInt(1), Time: big.NewInt(100), Root: root},
+		db:     state.NewDatabase(db),
+	}
+	header := &types.Header{
+		ParentHash: chain.parent.Hash(),
+		Number:     big.NewInt(2),
+		Time:       big.NewInt(110),
+		Coinbase:   coinbase,
+	}
+	// The sealers accrue the balance plus 1 WTC for every second since the parent
+	balance, age, number, time := chain.GetBalanceAndCoinAgeByHeaderHash(coinbase)
+	sealed := coinage.Expected(chain.config, header, balance, age, number, time)
+
+	want := new(big.Int).Mul(big.NewInt(6e+18), big.NewInt(10))
+	if want.Add(want, big.NewInt(3e+18)); sealed.Cmp(want) != 0 {
+		t.Fatalf("sealed coin age mismatch: have %v, want %v", sealed, want)
+	}
+	ethash := NewTester()
+
+	tests := []struct {
+		coinage *big.Int
+		fork    *big.Int
+		err     error
+	}{
+		{sealed, big.NewInt(2), nil},
+		{nil, big.NewInt(2), consensus.ErrInvalidCoinAge},
+		{new(big.Int).Add(sealed, big.NewInt(1)), big.NewInt(2), consensus.ErrInvalidCoinAge},
+		{new(big.Int).Mul(sealed, big.NewInt(1000)), big.NewInt(2), consensus.ErrInvalidCoinAge},
+		{new(big.Int).Mul(sealed, big.NewInt(1000)), big.NewInt(3), nil},
+		{new(big.Int).Mul(sealed, big.NewInt(1000)), nil, nil},
+	}
+	for i, tt := range tests {
+		chain.config.CoinAgeBlock = tt.fork
+		header.CoinAge = tt.coinage
+		if err := ethash.VerifyCoinAge(chain, header); err != tt.err {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, tt.err)
+		}
+	}
+}
+
+// Tests that block rewards follow the reward schedule of the chain config, and
+// that the main network schedule is used for fields left unset.
+func TestBlockReward(t *testing.T) {
+	masternode := new(big.Int).Mul(big.NewInt(5000), big.NewInt(1e18))
+	custom := &params.ChainConfig{
+		Ethash: &params.EthashConfig{
+			RewardTiers:       []params.RewardTier{},
+			BlockReward:       big.NewInt(1e18),
+			DecayPeriod:       big.NewInt(10),
+			DecayNumerator:    1,
+			DecayDenominator:  2,
+			MasternodeBalance: big.NewInt(1),
+		},
+	}
+	tests := []struct {
+		config  *params.ChainConfig
+		number  int64
+		balance *big.Int
+		reward  *big.Int
+	}{
+		// Main network tiers, bonus and decay
+		{params.MainnetChainConfig, 1, masternode, big.NewInt(1e17)},
+		{params.MainnetChainConfig, 40000, common.Big0, big.NewInt(1e17)},
+		{params.MainnetChainConfig, 40001, common.Big0, big.NewInt(1e18)},
+		{params.MainnetChainConfig, 100001, common.Big0, big.NewInt(2e18)},
+		{params.MainnetChainConfig, 200000, masternode, big.NewInt(2e18)},
+		{params.MainnetChainConfig, 200001, common.Big0, big.NewInt(25e17)},
+		{params.MainnetChainConfig, 200001, masternode, big.NewInt(3e18)},
+		{params.MainnetChainConfig, 2102400, common.Big0, big.NewInt(1875e15)},
+		{params.MainnetChainConfig, 2 * 2102400, masternode, big.NewInt(16875e14)},
+
+		// Unset schedules fall back to the main network one
+		{&params.ChainConfig{}, 200001, masternode, big.NewInt(3e18)},
+		{params.TestChainConfig, 2102400, common.Big0, big.NewInt(1875e15)},
+
+		// Custom schedule without tiers, halving every 10 blocks
+		{custom, 0, common.Big0, big.NewInt(1e18)},
+		{custom, 25, common.Big0, big.NewInt(25e16)},
+		{custom, 25, common.Big1, big.NewInt(375e15)},
+	}
+	for i, tt := range tests {
+		if reward := BlockReward(tt.config, big.NewInt(tt.number), tt.balance); reward.Cmp(tt.reward) != 0 {
+			t.Errorf("test %d: reward mismatch: have %v, want %v", i, reward, tt.reward)
+		}
+	}
+}
+
+// Tests that the exact reward decay matches the legacy floating point one up to
+// the precision of the latter, for every decay period of the first 100 years.
+func TestExactRewardDecay(t *testing.T) {
+	legacy := *params.MainnetChainConfig
+	exact := *params.MainnetChainConfig
+	exact.ExactRewardBlock = big.NewInt(0)
+
+	var (
+		schedule = params.MainnetEthashConfig
+		years    = int64(100 * 2 * 60 * 24 * 365)
+		periods  = years / schedule.DecayPeriod.Int64()
+	)
+	for _, balance := range []*big.Int{common.Big0, schedule.MasternodeBalance} {
+		base := BlockReward(&exact, new(big.Int).Add(schedule.RewardTiers[len(schedule.RewardTiers)-1].Block, common.Big1), balance)
+		slack := new(big.Int).Div(base, big.NewInt(rewardPrecision))
+
+		prev := base
+		for period := int64(1); period <= periods; period++ {
+			for _, number := range []*big.Int{
+				new(big.Int).Mul(big.NewInt(period), schedule.DecayPeriod),
+				new(big.Int).Sub(new(big.Int).Mul(big.NewInt(period+1), schedule.DecayPeriod), common.Big1),
+			} {
+				have := BlockReward(&exact, number, balance)
+				want := BlockReward(&legacy, number, balance)
+
+				// The legacy decay truncates the discount, so it may only fall short of
+				// the exact one, by less than one unit of its precision
+				diff := new(big.Int).Sub(have, want)
+				if diff.Sign() < 0 || diff.Cmp(slack) > 0 {
+					t.Errorf("balance %v, block %v: reward mismatch: exact %v, legacy %v", balance, number, have, want)
+				}
+				if have.Cmp(prev) > 0 || (period < 100 && have.Sign() == 0) {
+					t.Errorf("balance %v, block %v: exact reward %v not decaying from %v", balance, number, have, prev)
+				}
+				prev = have
+			}
+		}
+	}
+	// Spot check the exact decay against hand calculated values
+	number := new(big.Int).Mul(big.NewInt(3), schedule.DecayPeriod)
+	if have, want := BlockReward(&exact, number, common.Big0), big.NewInt(1054687500000000000); have.Cmp(want) != 0 {
+		t.Errorf("third period reward mismatch: have %v, want %v", have, want)
+	}
+	number = new(big.Int).Mul(big.NewInt(45), schedule.DecayPeriod)
+	if have := BlockReward(&legacy, number, common.Big0); have.Sign() != 0 {
+		t.Errorf("legacy reward after 90 years not truncated to zero: %v", have)
+	}
+	if have := BlockReward(&exact, number, common.Big0); have.Sign() <= 0 {
+		t.Errorf("exact reward after 90 years truncated to zero")
+	}
+}
+
+// Tests that the seal target is the difficulty based target widened by the seal
+// multipliers, which leave the target untouched for empty coin ages and blocks.
+func TestSealMultipliers(t *testing.T) {
+	coinageMul, txMul := SealMultipliers(common.Big0, 0)
+	if coinageMul.Cmp(common.Big1) != 0 || txMul.Cmp(common.Big1) != 0 {
+		t.Fatalf("empty multipliers mismatch: have %v and %v, want 1 and 1", coinageMul, txMul)
+	}
+	header := &types.Header{Difficulty: big.NewInt(1000000), TxNumber: 10000000}
+	coinage := new(big.Int).Mul(big.NewInt(1e18), big.NewInt(1e9))
+
+	coinageMul, txMul = SealMultipliers(coinage, header.TxNumber)
+	if coinageMul.Cmp(common.Big1) <= 0 || txMul.Cmp(common.Big1) <= 0 {
+		t.Fatalf("multipliers not widening the target: have %v and %v", coinageMul, txMul)
+	}
+	want := new(big.Int).Div(maxUint256, header.Difficulty)
+	want.Mul(want, coinageMul)
+	want.Mul(want, txMul)
+	if target := SealTarget(header, coinage); target.Cmp(want) != 0 {
+		t.Errorf("seal target mismatch: have %v, want %v", target, want)
+	}
+}
+
+// Tests that after the fork only the effective transactions of a block count
+// towards its target, so stuffing it with self-dealt or underpriced transactions
+// doesn't make it any easier to seal.
+func TestTxNumber(t *testing.T) {
+	var (
+		minerKey, _ = crypto.GenerateKey()
+		userKey, _  = crypto.GenerateKey()
+		spamKey, _  = crypto.GenerateKey()
+		coinbase    = crypto.PubkeyToAddress(minerKey.PublicKey)
+		config      = &params.ChainConfig{EffectiveTxBlock: big.NewInt(10)}
+		floor, cap  = config.Ethash.EffectiveTxRule()
+	)
+	makeTxs := func(number int64) ([]*types.Transaction, []*types.Transaction) {
+		var (
+			signer   = types.MakeSigner(config, big.NewInt(number))
+			stuffing []*types.Transaction
+			genuine  []*types.Transaction
+		)
+		sign := func(key *ecdsa.PrivateKey, nonce uint64, price *big.Int) *types.Transaction {
+			tx, _ := types.SignTx(types.NewTransaction(nonce, common.Address{0x01}, common.Big1, big.NewInt(21000), price, nil), signer, key)
+			return tx
+		}
+		// The miner sends itself transactions at the gas price floor, and floods the
+		// block with ones of another account below the floor or beyond the cap
+		for i := uint64(0); i < 20; i++ {
+			stuffing = append(stuffing, sign(minerKey, i, floor))
+			stuffing = append(stuffing, sign(spamKey, i, new(big.Int).Sub(floor, common.Big1)))
+		}
+		for i := uint64(0); i < cap+10; i++ {
+			genuine = append(genuine, sign(userKey, i, floor))
+		}
+		return stuffing, genuine
+	}
+	ethash := NewTester()
+	chain := &coinAgeChain{config: config}
+
+	tests := []struct {
+		number   int64
+		stuffing bool
+		genuine  bool
+		want     uint64
+	}{
+		{9, true, false, 40},
+		{9, true, true, 54},
+		{10, true, false, 0},
+		{10, false, true, cap},
+		{10, true, true, cap},
+	}
+	for i, tt := range tests {
+		stuffing, genuine := makeTxs(tt.number)
+
+		var txs []*types.Transaction
+		if tt.stuffing {
+			txs = append(txs, stuffing...)
+		}
+		if tt.genuine {
+			txs = append(txs, genuine...)
+		}
+		header := &types.Header{Number: big.NewInt(tt.number), Coinbase: coinbase, Difficulty: big.NewInt(1000000)}
+		if have := TxNumber(config, header, txs); have != tt.want {
+			t.Errorf("test %d: transaction number mismatch: have %d, want %d", i, have, tt.want)
+		}
+		block := NewBlock(config, header, txs, nil, nil)
+		if have := block.Header().TxNumber; have != tt.want {
+			t.Errorf("test %d: assembled transaction number mismatch: have %d, want %d", i, have, tt.want)
+		}
+		if err := ethash.VerifyTxNumber(chain, block); err != nil {
+			t.Errorf("test %d: assembled block rejected: %v", i, err)
+		}
+		// Claiming every transaction only passes before the fork
+		header = block.Header()
+		header.TxNumber = uint64(len(txs))
+
+		var want error
+		if config.IsEffectiveTx(header.Number) && uint64(len(txs)) != tt.want {
+			want = consensus.ErrInvalidTxNumber
+		}
+		if err := ethash.VerifyTxNumber(chain, block.WithSeal(header)); err != want {
+			t.Errorf("test %d: stuffed block error mismatch: have %v, want %v", i, err, want)
+		}
+	}
+	// A block holding nothing but stuffing is as hard to seal as an empty one
+	stuffing, _ := makeTxs(10)
+	header := &types.Header{Number: big.NewInt(10), Coinbase: coinbase, Difficulty: big.NewInt(1000000)}
+	stuffed := NewBlock(config, header, stuffing, nil, nil)
+	empty := NewBlock(config, header, nil, nil, nil)
+	if have, want := SealTarget(stuffed.Header(), common.Big0), SealTarget(empty.Header(), common.Big0); have.Cmp(want) != 0 {
+		t.Errorf("stuffed block target mismatch: have %v, want %v", have, want)
+	}
+}
+
+// makeRetargetHeaders creates a header chain of the given length with fixed
+// block times, difficulties and coin ages, returning the headers and a lookup
+// function for them.
+func makeRetargetHeaders(n int, blockTime int64, difficulty, coinage *big.Int) ([]*types.Header, func(common.Hash, uint64) *types.Header) {
+	headers := make([]*types.Header, n)
+	lookup := make(map[common.Hash]*types.Header)
+	for i := range headers {
+		headers[i] = &types.Header{
+			Number:     big.NewInt(int64(i)),
+			Time:       big.NewInt(int64(i) * blockTime),
+			Difficulty: difficulty,
+			CoinAge:    coinage,
+			UncleHash:  types.EmptyUncleHash,
+		}
+		if i > 0 {
+			headers[i].ParentHash = headers[i-1].Hash()
+		}
+		lookup[headers[i].Hash()] = headers[i]
+	}
+	return headers, func(hash common.Hash, number uint64) *types.Header {
+		return lookup[hash]
+	}
+}
+
+// Tests that the retarget aims the effective difficulty at the target block
+// time and only activates after the fork with a full window of ancestors.
+func TestRetargetDifficulty(t *testing.T) {
+	config := &params.ChainConfig{RetargetBlock: big.NewInt(40)}
+	difficulty := big.NewInt(1000000000)
+
+	// Blocks before the fork or without a full window use the legacy algorithm
+	headers, getHeader := makeRetargetHeaders(64, 15, difficulty, nil)
+	for _, number := range []int{30, 38} {
+		parent := headers[number]
+		want := CalcDifficulty(config, parent.Time.Uint64()+15, parent)
+		if have := CalcNextDifficulty(config, parent.Time.Uint64()+15, parent, getHeader); have.Cmp(want) != 0 {
+			t.Errorf("block #%d: legacy difficulty mismatch: have %v, want %v", number+1, have, want)
+		}
+	}
+	// Blocks twice as fast as targeted double the difficulty
+	parent := headers[50]
+	want := new(big.Int).Mul(difficulty, big2)
+	if have := CalcNextDifficulty(config, parent.Time.Uint64()+15, parent, getHeader); have.Cmp(want) != 0 {
+		t.Errorf("fast blocks difficulty mismatch: have %v, want %v", have, want)
+	}
+	// Blocks on target keep the difficulty, regardless of a constant multiplier
+	coinage := new(big.Int).Mul(big.NewInt(1e18), big.NewInt(1e9))
+	if sealMultiplier(&types.Header{CoinAge: coinage}).Cmp(common.Big1) <= 0 {
+		t.Fatalf("coin age not widening the target")
+	}
+	headers, getHeader = makeRetargetHeaders(64, retargetBlockTime, difficulty, coinage)
+	if have := CalcNextDifficulty(config, 0, headers[50], getHeader); have.Cmp(difficulty) != 0 {
+		t.Errorf("on target difficulty mismatch: have %v, want %v", have, difficulty)
+	}
+	// Very slow blocks are clamped to a third of the difficulty
+	headers, getHeader = makeRetargetHeaders(64, 100*retargetBlockTime, difficulty, nil)
+	want = new(big.Int).Div(difficulty, big3)
+	if have := CalcNextDifficulty(config, 0, headers[50], getHeader); have.Cmp(want) != 0 {
+		t.Errorf("slow blocks difficulty mismatch: have %v, want %v", have, want)
+	}
+	// Missing ancestors can't be retargeted
+	if have := CalcNextDifficulty(config, 0, headers[50], func(common.Hash, uint64) *types.Header { return nil }); have != nil {
+		t.Errorf("difficulty without ancestors: have %v, want nil", have)
+	}
+}
+
+// Tests that a batch of headers past the retarget fork verifies even though the
+// ancestors their difficulty depends on are only part of the batch itself.
+func TestVerifyHeadersRetargetBatch(t *testing.T) {
+	var (
+		config  = &params.ChainConfig{RetargetBlock: big.NewInt(0)}
+		headers = make([]*types.Header, 2*retargetWindow)
+		lookup  = make(map[common.Hash]*types.Header)
+	)
+	getHeader := func(hash common.Hash, number uint64) *types.Header {
+		return lookup[hash]
+	}
+	for i := range headers {
+		headers[i] = &types.Header{
+			Number:     big.NewInt(int64(i)),
+			Time:       big.NewInt(int64(i) * 20),
+			Difficulty: big.NewInt(1000000000),
+			GasLimit:   params.GenesisGasLimit,
+			GasUsed:    new(big.Int),
+			UncleHash:  types.EmptyUncleHash,
+		}
+		if i > 0 {
+			parent := headers[i-1]
+			headers[i].ParentHash = parent.Hash()
+			headers[i].Difficulty = CalcNextDifficulty(config, headers[i].Time.Uint64(), parent, getHeader)
+		}
+		lookup[headers[i].Hash()] = headers[i]
+	}
+	// Only the genesis header is part of the chain
+	chain := &coinAgeChain{config: config, parent: headers[0]}
+
+	abort, results := NewFaker().VerifyHeaders(chain, headers[1:], make([]bool, len(headers)-1))
+	defer close(abort)
+
+	for i := 1; i < len(headers); i++ {
+		if err := <-results; err != nil {
+			t.Errorf("header #%d: verification failed: %v", i, err)
+		}
+	}
+}
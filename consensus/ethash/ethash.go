@@ -45,7 +45,7 @@ var (
 	maxUint256 = new(big.Int).Exp(big.NewInt(2), big.NewInt(256), big.NewInt(0))
 
 	// sharedEthash is a full instance that can be shared between multiple users.
-	sharedEthash = New("", 3, 0, "", 1, 0, false, 12125, 10240)
+	sharedEthash = New("", 3, 0, "", 1, 0, false, "")
 
 	// algorithmRevision is the data structure version used for file naming.
 	algorithmRevision = 23
@@ -329,8 +329,7 @@ type Ethash struct {
 	dagdir       string // Data directory to store full mining datasets
 	dagsinmem    int    // Number of mining datasets to keep in memory
 	dagsondisk   int    // Number of mining datasets to keep on disk
-	GPUPort      int64
-	GPUGetPort   int64
+	gpuEndpoint  string // Endpoint to accept GPU sealer workers on
 
 	caches   map[uint64]*cache   // In memory caches to avoid regenerating too often
 	fcache   *cache              // Pre-generated cache for the estimated future epoch
@@ -342,6 +341,8 @@ type Ethash struct {
 	threads  int           // Number of threads to mine on if mining
 	update   chan struct{} // Notification channel to update mining parameters
 	hashrate metrics.Meter // Meter tracking the average hashrate
+	gpu      SealerBackend // External sealer backend to hand nonce searches to
+	jobs     uint64        // Number of jobs handed to the sealer backend so far
 
 	// The fields below are hooks for testing
 	tester    bool          // Flag whether to use a smaller test dataset
@@ -356,7 +357,7 @@ type Ethash struct {
 }
 
 // New creates a full sized ethash PoW scheme.
-func New(cachedir string, cachesinmem, cachesondisk int, dagdir string, dagsinmem, dagsondisk int, gpuMode bool, gpuPort int64, gpuGetPort int64) *Ethash {
+func New(cachedir string, cachesinmem, cachesondisk int, dagdir string, dagsinmem, dagsondisk int, gpuMode bool, gpuEndpoint string) *Ethash {
 	if cachesinmem <= 0 {
 		log.Warn("One ethash cache must always be in memory", "requested", cachesinmem)
 		cachesinmem = 1
@@ -378,9 +379,8 @@ func New(cachedir string, cachesinmem, cachesondisk int, dagdir string, dagsinme
 		datasets:     make(map[uint64]*dataset),
 		update:       make(chan struct{}),
 		hashrate:     metrics.NewMeter(),
+		gpuEndpoint:  gpuEndpoint,
 		GPUMode:      gpuMode,
-		GPUPort:      gpuPort,
-		GPUGetPort:   gpuGetPort,
 	}
 }
 
@@ -587,13 +587,45 @@ func (ethash *Ethash) SetThreads(threads int) {
 }
 
 // Hashrate implements PoW, returning the measured rate of the search invocations
-// per second over the last minute.
+// per second over the last minute, or the rate reported by the GPU workers.
 func (ethash *Ethash) Hashrate() float64 {
+	ethash.lock.Lock()
+	gpu := ethash.gpu
+	ethash.lock.Unlock()
+
+	if ethash.GPUMode && gpu != nil {
+		return float64(gpu.Hashrate())
+	}
 	return ethash.hashrate.Rate1()
 }
 
-func (ethash *Ethash) IsGPU() (bool, int64, int64) {
-	return ethash.GPUMode, ethash.GPUPort, ethash.GPUGetPort
+// SetSealerBackend replaces the external backend GPU mode sealing is delegated
+// to, closing the previous one if any.
+func (ethash *Ethash) SetSealerBackend(backend SealerBackend) {
+	ethash.lock.Lock()
+	defer ethash.lock.Unlock()
+
+	if ethash.gpu != nil {
+		ethash.gpu.Close()
+	}
+	ethash.gpu = backend
+}
+
+// sealerBackend returns the external sealer backend, starting a GPU server on
+// the configured endpoint if none was set yet.
+func (ethash *Ethash) sealerBackend() (SealerBackend, error) {
+	ethash.lock.Lock()
+	defer ethash.lock.Unlock()
+
+	if ethash.gpu == nil {
+		server, err := NewGPUServer(ethash.gpuEndpoint)
+		if err != nil {
+			return nil, err
+		}
+		log.Info("Started GPU sealer server", "endpoint", server.Addr())
+		ethash.gpu = server
+	}
+	return ethash.gpu, nil
 }
 
 // APIs implements consensus.Engine, returning the user facing RPC APIs. Currently
@@ -607,3 +639,15 @@ func (ethash *Ethash) APIs(chain consensus.ChainReader) []rpc.API {
 func SeedHash(block uint64) []byte {
 	return seedHash(block)
 }
+
+// X11Order returns the order in which the X11 algorithms are chained when the
+// proof-of-work of the given header hash is computed.
+func X11Order(hash []byte) []byte {
+	return getX11Order(hash, 11)
+}
+
+// X11Hash computes the mix digest and proof-of-work value of a header hash and
+// nonce, chaining the X11 algorithms in the given order.
+func X11Hash(hash []byte, nonce uint64, order []byte) ([]byte, []byte) {
+	return myx11(hash, nonce, order)
+}
@@ -0,0 +1,386 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+const (
+	gpuHandshakeTimeout = 5 * time.Second  // Maximum time allowed for a worker to say hello
+	gpuWriteTimeout     = 10 * time.Second // Maximum time allowed for a single message write
+	gpuShareBacklog     = 16               // Number of unverified shares queued per job
+	gpuNonceSpacing     = 1 << 40          // Distance between the start nonces of the workers
+)
+
+var (
+	errGPUServerClosed = errors.New("gpu server closed")
+	errShareBacklog    = errors.New("share backlog full")
+)
+
+// SealJob is a unit of nonce search work handed to a sealer backend.
+type SealJob struct {
+	ID     uint64      // Unique identifier of the job
+	Number uint64      // Number of the block being sealed
+	Hash   common.Hash // Header hash without the nonce
+	Target *big.Int    // Coin age and tx count adjusted target to meet
+	Order  []byte      // X11 algorithm order derived from the hash
+	Nonce  uint64      // Nonce to start searching from
+}
+
+// Share is a candidate nonce found by a sealer backend worker.
+type Share struct {
+	JobID  uint64 // Identifier of the job the share was found for
+	Nonce  uint64 // Nonce meeting the job's target
+	Worker string // Name of the worker that found the share
+
+	peer *gpuPeer // Connection to report the verification result on
+}
+
+// SealerBackend is an external device running the nonce search on behalf of the
+// sealer, such as a set of GPU workers. The sealer remains responsible for the
+// verification of every share the backend delivers.
+type SealerBackend interface {
+	// Submit hands a new job to the backend, superseding any previous one. Shares
+	// found for the job are delivered on the given channel until it's aborted.
+	Submit(job *SealJob, shares chan<- *Share) error
+
+	// Abort cancels a job, stopping all workers searching for it.
+	Abort(id uint64)
+
+	// Report notifies the worker that found a share whether it was accepted.
+	Report(share *Share, err error)
+
+	// Hashrate returns the aggregate hash rate of all workers in hashes/second.
+	Hashrate() uint64
+
+	// Close terminates the backend, disconnecting all workers.
+	Close() error
+}
+
+// gpuPeer is a single worker connected to the GPU server.
+type gpuPeer struct {
+	id   uint64
+	name string
+	conn net.Conn
+	rate uint64 // Last reported hash rate (atomic access)
+
+	lock sync.Mutex // Serializes writes to the connection
+}
+
+// send writes a protocol message to the worker.
+func (p *gpuPeer) send(code byte, msg interface{}) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.conn.SetWriteDeadline(time.Now().Add(gpuWriteTimeout))
+	return writeGPUMsg(p.conn, code, msg)
+}
+
+// job assembles the worker specific version of a sealing job.
+func (p *gpuPeer) job(job *SealJob) *gpuJob {
+	return &gpuJob{
+		ID:     job.ID,
+		Number: job.Number,
+		Hash:   job.Hash,
+		Target: job.Target,
+		Order:  job.Order,
+		Nonce:  job.Nonce + p.id*gpuNonceSpacing,
+	}
+}
+
+// GPUServer is a SealerBackend accepting any number of external workers speaking
+// the GPU sealer protocol over TCP or unix socket connections.
+type GPUServer struct {
+	listener net.Listener
+
+	peers  map[uint64]*gpuPeer // Currently connected workers
+	nextID uint64              // Identifier of the next connecting worker
+	job    *SealJob            // Job currently being searched, if any
+	shares chan<- *Share       // Channel to deliver the current job's shares on
+	closed bool
+
+	lock sync.Mutex
+	wg   sync.WaitGroup
+}
+
+// NewGPUServer starts listening for GPU sealer workers on the given endpoint,
+// either a host:port pair or a unix socket path.
+func NewGPUServer(endpoint string) (*GPUServer, error) {
+	listener, err := net.Listen(gpuNetwork(endpoint), endpoint)
+	if err != nil {
+		return nil, err
+	}
+	server := &GPUServer{
+		listener: listener,
+		peers:    make(map[uint64]*gpuPeer),
+	}
+	server.wg.Add(1)
+	go server.loop()
+
+	return server, nil
+}
+
+// Addr returns the address the server is listening on.
+func (s *GPUServer) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// loop accepts new worker connections until the server is closed.
+func (s *GPUServer) loop() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if tempErr, ok := err.(net.Error); ok && tempErr.Temporary() {
+				log.Debug("Temporary GPU accept error", "err", err)
+				time.Sleep(time.Second)
+				continue
+			}
+			return
+		}
+		s.wg.Add(1)
+		go s.handle(conn)
+	}
+}
+
+// handle runs the protocol session of a single worker.
+func (s *GPUServer) handle(conn net.Conn) {
+	defer s.wg.Done()
+	defer conn.Close()
+
+	hello, err := s.handshake(conn)
+	if err != nil {
+		log.Debug("GPU worker handshake failed", "addr", conn.RemoteAddr(), "err", err)
+		return
+	}
+	peer := &gpuPeer{name: hello.Name, conn: conn}
+
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		return
+	}
+	s.nextID++
+	peer.id = s.nextID
+	s.peers[peer.id] = peer
+	job := s.job
+	s.lock.Unlock()
+
+	log.Info("GPU worker connected", "id", peer.id, "name", peer.name)
+	defer func() {
+		s.lock.Lock()
+		delete(s.peers, peer.id)
+		s.lock.Unlock()
+
+		log.Info("GPU worker disconnected", "id", peer.id, "name", peer.name)
+	}()
+	// Bring (re)connecting workers up to speed with the current job
+	if job != nil {
+		if err := peer.send(gpuJobMsg, peer.job(job)); err != nil {
+			return
+		}
+	}
+	for {
+		code, payload, err := readGPUMsg(conn)
+		if err != nil {
+			if err != io.EOF {
+				log.Debug("Failed to read GPU message", "id", peer.id, "err", err)
+			}
+			return
+		}
+		switch code {
+		case gpuShareMsg:
+			var share gpuShare
+			if err := rlp.DecodeBytes(payload, &share); err != nil {
+				log.Debug("Invalid GPU share", "id", peer.id, "err", err)
+				return
+			}
+			s.deliver(peer, &share)
+
+		case gpuHashrateMsg:
+			var rate gpuHashrate
+			if err := rlp.DecodeBytes(payload, &rate); err != nil {
+				log.Debug("Invalid GPU hashrate", "id", peer.id, "err", err)
+				return
+			}
+			atomic.StoreUint64(&peer.rate, rate.Rate)
+
+		default:
+			log.Debug("Unexpected GPU message", "id", peer.id, "code", code)
+			return
+		}
+	}
+}
+
+// handshake waits for the hello message of a freshly connected worker.
+func (s *GPUServer) handshake(conn net.Conn) (*gpuHello, error) {
+	conn.SetReadDeadline(time.Now().Add(gpuHandshakeTimeout))
+	defer conn.SetReadDeadline(time.Time{})
+
+	code, payload, err := readGPUMsg(conn)
+	if err != nil {
+		return nil, err
+	}
+	if code != gpuHelloMsg {
+		return nil, errGPUNoHello
+	}
+	hello := new(gpuHello)
+	if err := rlp.DecodeBytes(payload, hello); err != nil {
+		return nil, err
+	}
+	if hello.Version != gpuProtocolVersion {
+		return nil, errGPUVersionMismatch
+	}
+	return hello, nil
+}
+
+// deliver forwards a share to the sealer waiting for the current job, rejecting
+// it straight away if it belongs to an outdated job.
+func (s *GPUServer) deliver(peer *gpuPeer, share *gpuShare) {
+	s.lock.Lock()
+	job, shares := s.job, s.shares
+	s.lock.Unlock()
+
+	result := &Share{JobID: share.ID, Nonce: share.Nonce, Worker: peer.name, peer: peer}
+	if job == nil || job.ID != share.ID {
+		s.Report(result, errStaleShare)
+		return
+	}
+	select {
+	case shares <- result:
+	default:
+		s.Report(result, errShareBacklog)
+	}
+}
+
+// Submit implements SealerBackend, pushing a new job to all connected workers.
+// Workers connecting later on receive the job after their handshake.
+func (s *GPUServer) Submit(job *SealJob, shares chan<- *Share) error {
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		return errGPUServerClosed
+	}
+	s.job, s.shares = job, shares
+	peers := s.peerList()
+	s.lock.Unlock()
+
+	if len(peers) == 0 {
+		log.Warn("No GPU workers connected, job pending", "job", job.ID, "number", job.Number)
+	}
+	for _, peer := range peers {
+		if err := peer.send(gpuJobMsg, peer.job(job)); err != nil {
+			log.Debug("Failed to send GPU job", "id", peer.id, "err", err)
+			peer.conn.Close()
+		}
+	}
+	return nil
+}
+
+// Abort implements SealerBackend, cancelling the job if it's still current.
+func (s *GPUServer) Abort(id uint64) {
+	s.lock.Lock()
+	if s.job == nil || s.job.ID != id {
+		s.lock.Unlock()
+		return
+	}
+	s.job, s.shares = nil, nil
+	peers := s.peerList()
+	s.lock.Unlock()
+
+	for _, peer := range peers {
+		if err := peer.send(gpuAbortMsg, &gpuAbort{ID: id}); err != nil {
+			log.Debug("Failed to send GPU abort", "id", peer.id, "err", err)
+			peer.conn.Close()
+		}
+	}
+}
+
+// Report implements SealerBackend, sending the share verdict to its worker.
+func (s *GPUServer) Report(share *Share, err error) {
+	if share.peer == nil {
+		return
+	}
+	result := &gpuShareResult{ID: share.JobID, Nonce: share.Nonce, Accepted: err == nil}
+	if err != nil {
+		result.Reason = err.Error()
+	}
+	if err := share.peer.send(gpuShareResultMsg, result); err != nil {
+		log.Debug("Failed to send GPU share result", "id", share.peer.id, "err", err)
+	}
+}
+
+// Hashrate implements SealerBackend, summing up the rates reported by workers.
+func (s *GPUServer) Hashrate() uint64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var rate uint64
+	for _, peer := range s.peers {
+		rate += atomic.LoadUint64(&peer.rate)
+	}
+	return rate
+}
+
+// Workers returns the number of workers currently connected.
+func (s *GPUServer) Workers() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return len(s.peers)
+}
+
+// Close implements SealerBackend, shutting down the listener and disconnecting
+// all workers.
+func (s *GPUServer) Close() error {
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		return nil
+	}
+	s.closed = true
+	err := s.listener.Close()
+	for _, peer := range s.peers {
+		peer.conn.Close()
+	}
+	s.lock.Unlock()
+
+	s.wg.Wait()
+	return err
+}
+
+// peerList returns a snapshot of the connected workers. The caller must hold the
+// server lock.
+func (s *GPUServer) peerList() []*gpuPeer {
+	peers := make([]*gpuPeer, 0, len(s.peers))
+	for _, peer := range s.peers {
+		peers = append(peers, peer)
+	}
+	return peers
+}
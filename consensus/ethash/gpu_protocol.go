@@ -0,0 +1,165 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// The GPU sealer protocol runs over a single persistent stream connection that
+// a worker dials into the node. Every message is framed as
+//
+//	length  uint32 (big endian, size of everything after this field)
+//	version uint8
+//	code    uint8
+//	payload RLP encoded message body
+//
+// A worker opens the session with a hello message, after which the node pushes
+// jobs and aborts, and the worker pushes shares and hash rate reports. Shares
+// are answered with a share result so workers learn about rejections.
+const (
+	gpuProtocolVersion = 1         // Version of the GPU sealer protocol
+	gpuMaxMsgSize      = 64 * 1024 // Maximum size of a single protocol message
+)
+
+// GPU sealer protocol message codes.
+const (
+	gpuHelloMsg       = 0x00
+	gpuJobMsg         = 0x01
+	gpuAbortMsg       = 0x02
+	gpuShareMsg       = 0x03
+	gpuShareResultMsg = 0x04
+	gpuHashrateMsg    = 0x05
+)
+
+var (
+	errGPUMsgTooLarge     = errors.New("gpu message too large")
+	errGPUVersionMismatch = errors.New("gpu protocol version mismatch")
+	errGPUNoHello         = errors.New("gpu worker did not say hello")
+	errStaleShare         = errors.New("stale share")
+	errInvalidShare       = errors.New("invalid share")
+)
+
+// gpuHello is the handshake a worker sends after connecting.
+type gpuHello struct {
+	Version uint64
+	Name    string
+}
+
+// gpuJob is a search request pushed to a worker. Every worker receives its own
+// starting nonce so that their search spaces don't overlap.
+type gpuJob struct {
+	ID     uint64
+	Number uint64
+	Hash   common.Hash // Header hash without the nonce
+	Target *big.Int    // Coin age and tx count adjusted target to meet
+	Order  []byte      // X11 algorithm order derived from the hash
+	Nonce  uint64      // Nonce to start searching from
+}
+
+// gpuAbort cancels a previously pushed job.
+type gpuAbort struct {
+	ID uint64
+}
+
+// gpuShare is a candidate nonce found by a worker for a job.
+type gpuShare struct {
+	ID    uint64
+	Nonce uint64
+}
+
+// gpuShareResult reports the verdict on a submitted share back to the worker.
+type gpuShareResult struct {
+	ID       uint64
+	Nonce    uint64
+	Accepted bool
+	Reason   string
+}
+
+// gpuHashrate is the periodic hash rate report of a worker, in hashes/second.
+type gpuHashrate struct {
+	Rate uint64
+}
+
+// writeGPUMsg frames and writes a single protocol message.
+func writeGPUMsg(w io.Writer, code byte, msg interface{}) error {
+	payload, err := rlp.EncodeToBytes(msg)
+	if err != nil {
+		return err
+	}
+	if len(payload)+2 > gpuMaxMsgSize {
+		return errGPUMsgTooLarge
+	}
+	frame := make([]byte, 6+len(payload))
+	binary.BigEndian.PutUint32(frame, uint32(2+len(payload)))
+	frame[4] = gpuProtocolVersion
+	frame[5] = code
+	copy(frame[6:], payload)
+
+	_, err = w.Write(frame)
+	return err
+}
+
+// readGPUMsg reads a single protocol message, returning its code and the still
+// RLP encoded payload.
+func readGPUMsg(r io.Reader) (byte, []byte, error) {
+	var head [6]byte
+	if _, err := io.ReadFull(r, head[:4]); err != nil {
+		return 0, nil, err
+	}
+	size := binary.BigEndian.Uint32(head[:4])
+	if size < 2 {
+		return 0, nil, fmt.Errorf("gpu message too short: %d bytes", size)
+	}
+	if size > gpuMaxMsgSize {
+		return 0, nil, errGPUMsgTooLarge
+	}
+	if _, err := io.ReadFull(r, head[4:]); err != nil {
+		return 0, nil, err
+	}
+	if head[4] != gpuProtocolVersion {
+		return 0, nil, errGPUVersionMismatch
+	}
+	payload := make([]byte, size-2)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	return head[5], payload, nil
+}
+
+// gpuNetwork returns the network type to use for a GPU sealer endpoint: paths
+// are treated as unix sockets, anything else as a TCP host:port pair.
+func gpuNetwork(endpoint string) string {
+	if strings.Contains(endpoint, "/") {
+		return "unix"
+	}
+	return "tcp"
+}
+
+// dialGPU connects to a GPU sealer endpoint.
+func dialGPU(endpoint string) (net.Conn, error) {
+	return net.Dial(gpuNetwork(endpoint), endpoint)
+}
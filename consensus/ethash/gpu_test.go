@@ -0,0 +1,213 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// Tests that GPU protocol messages survive a framing round trip and that frames
+// of foreign protocol versions are rejected.
+func TestGPUMessageFraming(t *testing.T) {
+	job := &gpuJob{
+		ID:     7,
+		Number: 1000,
+		Hash:   common.HexToHash("0xdeadbeef"),
+		Target: new(big.Int).Lsh(big.NewInt(1), 240),
+		Order:  []byte{3, 1, 4, 1, 5, 9, 2, 6, 5, 3, 5},
+		Nonce:  42,
+	}
+	buf := new(bytes.Buffer)
+	if err := writeGPUMsg(buf, gpuJobMsg, job); err != nil {
+		t.Fatalf("failed to write message: %v", err)
+	}
+	frame := common.CopyBytes(buf.Bytes())
+
+	code, payload, err := readGPUMsg(buf)
+	if err != nil {
+		t.Fatalf("failed to read message: %v", err)
+	}
+	if code != gpuJobMsg {
+		t.Fatalf("message code mismatch: have %d, want %d", code, gpuJobMsg)
+	}
+	decoded := new(gpuJob)
+	if err := rlp.DecodeBytes(payload, decoded); err != nil {
+		t.Fatalf("failed to decode message: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, job) {
+		t.Fatalf("message mismatch: have %+v, want %+v", decoded, job)
+	}
+	frame[4] = gpuProtocolVersion + 1
+	if _, _, err := readGPUMsg(bytes.NewReader(frame)); err != errGPUVersionMismatch {
+		t.Fatalf("version mismatch error mismatch: have %v, want %v", err, errGPUVersionMismatch)
+	}
+	frame[0] = 0xff
+	if _, _, err := readGPUMsg(bytes.NewReader(frame)); err != errGPUMsgTooLarge {
+		t.Fatalf("oversized message error mismatch: have %v, want %v", err, errGPUMsgTooLarge)
+	}
+}
+
+// Tests that a block can be sealed by multiple GPU workers, and the result is
+// accepted by the verifier.
+func TestGPUSeal(t *testing.T) {
+	endpoint, cleanup := gpuTestEndpoint(t)
+	defer cleanup()
+
+	server, err := NewGPUServer(endpoint)
+	if err != nil {
+		t.Fatalf("failed to start GPU server: %v", err)
+	}
+	ethash := NewTester()
+	ethash.GPUMode = true
+	ethash.SetSealerBackend(server)
+	defer server.Close()
+
+	for _, name := range []string{"alpha", "beta"} {
+		worker := NewGPUWorker(endpoint, name)
+		worker.Start()
+		defer worker.Stop()
+	}
+	chain := newGPUTestChain(t)
+	header := &types.Header{
+		ParentHash: chain.parent.Hash(),
+		Number:     big.NewInt(2),
+		Time:       big.NewInt(110),
+		Difficulty: big.NewInt(100),
+	}
+	block, err := ethash.Seal(chain, types.NewBlockWithHeader(header), make(chan struct{}))
+	if err != nil {
+		t.Fatalf("failed to seal block: %v", err)
+	}
+	if err := ethash.VerifySeal(chain, block.Header()); err != nil {
+		t.Fatalf("unexpected verification error: %v", err)
+	}
+}
+
+// Tests that workers reconnect to a restarted server and pick up the job that
+// is pending there.
+func TestGPUWorkerReconnect(t *testing.T) {
+	endpoint, cleanup := gpuTestEndpoint(t)
+	defer cleanup()
+
+	worker := NewGPUWorker(endpoint, "phoenix")
+	worker.retry = 10 * time.Millisecond
+	worker.Start()
+	defer worker.Stop()
+
+	for i := 0; i < 2; i++ {
+		server, err := NewGPUServer(endpoint)
+		if err != nil {
+			t.Fatalf("run %d: failed to start GPU server: %v", i, err)
+		}
+		shares := make(chan *Share, 1)
+		job := &SealJob{
+			ID:     uint64(i + 1),
+			Hash:   common.HexToHash("0xc0ffee"),
+			Target: new(big.Int).Lsh(big.NewInt(1), 255),
+			Order:  getX11Order(common.HexToHash("0xc0ffee").Bytes(), 11),
+		}
+		if err := server.Submit(job, shares); err != nil {
+			t.Fatalf("run %d: failed to submit job: %v", i, err)
+		}
+		select {
+		case share := <-shares:
+			if share.JobID != job.ID || share.Worker != "phoenix" {
+				t.Errorf("run %d: share mismatch: have job %d from %q, want job %d from %q", i, share.JobID, share.Worker, job.ID, "phoenix")
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("run %d: no share received", i)
+		}
+		server.Close()
+	}
+}
+
+// Tests that shares submitted for unknown jobs are rejected back to the worker.
+func TestGPUStaleShare(t *testing.T) {
+	endpoint, cleanup := gpuTestEndpoint(t)
+	defer cleanup()
+
+	server, err := NewGPUServer(endpoint)
+	if err != nil {
+		t.Fatalf("failed to start GPU server: %v", err)
+	}
+	defer server.Close()
+
+	conn, err := dialGPU(endpoint)
+	if err != nil {
+		t.Fatalf("failed to dial GPU server: %v", err)
+	}
+	defer conn.Close()
+
+	if err := writeGPUMsg(conn, gpuHelloMsg, &gpuHello{Version: gpuProtocolVersion, Name: "stale"}); err != nil {
+		t.Fatalf("failed to send hello: %v", err)
+	}
+	if err := writeGPUMsg(conn, gpuShareMsg, &gpuShare{ID: 3, Nonce: 1}); err != nil {
+		t.Fatalf("failed to send share: %v", err)
+	}
+	code, payload, err := readGPUMsg(conn)
+	if err != nil {
+		t.Fatalf("failed to read share result: %v", err)
+	}
+	var result gpuShareResult
+	if code != gpuShareResultMsg {
+		t.Fatalf("message code mismatch: have %d, want %d", code, gpuShareResultMsg)
+	}
+	if err := rlp.DecodeBytes(payload, &result); err != nil {
+		t.Fatalf("failed to decode share result: %v", err)
+	}
+	if result.Accepted || result.Reason != errStaleShare.Error() {
+		t.Fatalf("share result mismatch: have %+v, want rejection %q", result, errStaleShare)
+	}
+}
+
+// gpuTestEndpoint returns a unix socket endpoint in a fresh temporary folder.
+func gpuTestEndpoint(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "ethash-gpu-")
+	if err != nil {
+		t.Fatalf("failed to create temporary folder: %v", err)
+	}
+	return filepath.Join(dir, "gpu.ipc"), func() { os.RemoveAll(dir) }
+}
+
+// newGPUTestChain creates a chain reader with an empty parent state to seal on.
+func newGPUTestChain(t *testing.T) *coinAgeChain {
+	db, _ := ethdb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+	root, err := statedb.CommitTo(db, false)
+	if err != nil {
+		t.Fatalf("failed to commit parent state: %v", err)
+	}
+	return &coinAgeChain{
+		config: new(params.ChainConfig),
+		parent: &types.Header{Number: big.NewInt(1), Time: big.NewInt(100), Root: root},
+		db:     state.NewDatabase(db),
+	}
+}
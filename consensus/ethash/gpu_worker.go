@@ -0,0 +1,201 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// gpuHashrateInterval is the frequency at which workers report their hash rate.
+const gpuHashrateInterval = 5 * time.Second
+
+// GPUWorker is a reference implementation of a GPU sealer protocol worker, which
+// runs the nonce search on the CPU. It's meant for testing the sealer and as a
+// blueprint for real GPU miner implementations.
+type GPUWorker struct {
+	endpoint string        // Endpoint of the node to connect to
+	name     string        // Name announced to the node during the handshake
+	retry    time.Duration // Delay between reconnection attempts
+
+	hashes uint64 // Hashes computed since the last rate report (atomic access)
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewGPUWorker creates a worker that will connect to the given node endpoint.
+func NewGPUWorker(endpoint, name string) *GPUWorker {
+	return &GPUWorker{
+		endpoint: endpoint,
+		name:     name,
+		retry:    time.Second,
+		quit:     make(chan struct{}),
+	}
+}
+
+// Start connects the worker to its node, reconnecting whenever the connection
+// drops until the worker is stopped.
+func (w *GPUWorker) Start() {
+	w.wg.Add(1)
+	go w.loop()
+}
+
+// Stop disconnects the worker and aborts any running search.
+func (w *GPUWorker) Stop() {
+	close(w.quit)
+	w.wg.Wait()
+}
+
+// loop keeps a session to the node alive.
+func (w *GPUWorker) loop() {
+	defer w.wg.Done()
+
+	for {
+		conn, err := dialGPU(w.endpoint)
+		if err == nil {
+			err = w.serve(conn)
+		}
+		log.Debug("GPU worker disconnected", "name", w.name, "err", err)
+
+		select {
+		case <-w.quit:
+			return
+		case <-time.After(w.retry):
+		}
+	}
+}
+
+// serve runs a single protocol session, searching for nonces of the jobs pushed
+// by the node until the connection fails or the worker is stopped.
+func (w *GPUWorker) serve(conn net.Conn) error {
+	defer conn.Close()
+
+	var lock sync.Mutex
+	send := func(code byte, msg interface{}) error {
+		lock.Lock()
+		defer lock.Unlock()
+		return writeGPUMsg(conn, code, msg)
+	}
+	if err := send(gpuHelloMsg, &gpuHello{Version: gpuProtocolVersion, Name: w.name}); err != nil {
+		return err
+	}
+	// Tear the connection down on quit and report the hash rate periodically
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		ticker := time.NewTicker(gpuHashrateInterval)
+		defer ticker.Stop()
+
+		for last := time.Now(); ; {
+			select {
+			case <-w.quit:
+				conn.Close()
+				return
+			case <-done:
+				return
+			case now := <-ticker.C:
+				hashes := atomic.SwapUint64(&w.hashes, 0)
+				rate := uint64(float64(hashes) / now.Sub(last).Seconds())
+				if err := send(gpuHashrateMsg, &gpuHashrate{Rate: rate}); err != nil {
+					return
+				}
+				last = now
+			}
+		}
+	}()
+	// Process the jobs of the node, always searching for the latest one
+	var (
+		current uint64
+		abort   chan struct{}
+	)
+	defer func() {
+		if abort != nil {
+			close(abort)
+		}
+	}()
+	for {
+		code, payload, err := readGPUMsg(conn)
+		if err != nil {
+			return err
+		}
+		switch code {
+		case gpuJobMsg:
+			job := new(gpuJob)
+			if err := rlp.DecodeBytes(payload, job); err != nil {
+				return err
+			}
+			if abort != nil {
+				close(abort)
+			}
+			current, abort = job.ID, make(chan struct{})
+			go w.search(job, abort, send)
+
+		case gpuAbortMsg:
+			var msg gpuAbort
+			if err := rlp.DecodeBytes(payload, &msg); err != nil {
+				return err
+			}
+			if abort != nil && msg.ID == current {
+				close(abort)
+				abort = nil
+			}
+
+		case gpuShareResultMsg:
+			var result gpuShareResult
+			if err := rlp.DecodeBytes(payload, &result); err != nil {
+				return err
+			}
+			if !result.Accepted {
+				log.Warn("GPU share rejected", "job", result.ID, "nonce", result.Nonce, "reason", result.Reason)
+			}
+
+		default:
+			return fmt.Errorf("unexpected gpu message %#x", code)
+		}
+	}
+}
+
+// search iterates nonces of a job until one meets its target, submitting it as
+// a share, or until the job is aborted.
+func (w *GPUWorker) search(job *gpuJob, abort chan struct{}, send func(byte, interface{}) error) {
+	var (
+		hash   = job.Hash.Bytes()
+		target = FullTo32(job.Target.Bytes())
+	)
+	for nonce := job.Nonce; ; nonce++ {
+		select {
+		case <-abort:
+			return
+		default:
+		}
+		_, result := myx11(hash, nonce, job.Order)
+		atomic.AddUint64(&w.hashes, 1)
+
+		if Compare(result, target, 32) < 1 {
+			send(gpuShareMsg, &gpuShare{ID: job.ID, Nonce: nonce})
+			return
+		}
+	}
+}
@@ -18,40 +18,23 @@ package ethash
 
 import (
 	crand "crypto/rand"
-	"encoding/binary"
-	"fmt"
 	"math"
 	"math/big"
 	"math/rand"
-	"net"
-	"os"
-	"strconv"
-	"sync"
-	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/coinage"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/log"
 )
 
-// Seal implements consensus.Engine, attempting to find a nonce that satisfies
-// the block's difficulty requirements.
-func (ethash *Ethash) SealbyGPU(chain consensus.ChainReader, block *types.Block, stop <-chan struct{}, serverFound chan uint64, t int) (*types.Block, error) {
-	oldbalance, coinage, preNumber, preTime := chain.GetBalanceAndCoinAgeByHeaderHash(block.Header().Coinbase)
-	balance := new(big.Int).Add(oldbalance, big.NewInt(1e+18))
-	//---------------------------------	--------------
-	Time := block.Header().Time
-	Number := block.Header().Number
-	if preTime.Cmp(Time) < 0 && preNumber.Cmp(Number) < 0 {
-		t := new(big.Int).Sub(Time, preTime)
-		coinage = new(big.Int).Add(new(big.Int).Mul(balance, t), coinage)
-	}
-
-	// fmt.Println("set coinage to: ",coinage)
+// SealbyGPU implements consensus.Engine, handing the nonce search for the block
+// off to the workers of the sealer backend and verifying the shares they find.
+func (ethash *Ethash) SealbyGPU(chain consensus.ChainReader, block *types.Block, stop <-chan struct{}) (*types.Block, error) {
+	balance, age, preNumber, preTime := chain.GetBalanceAndCoinAgeByHeaderHash(block.Header().Coinbase)
+	age = coinage.Expected(chain.Config(), block.Header(), balance, age, preNumber, preTime)
 
-	fmt.Print()
-	//-----------------------------------------------
 	// If we're running a fake PoW, simply return a 0 nonce immediately
 	if ethash.fakeMode {
 		header := block.Header()
@@ -60,14 +43,14 @@ func (ethash *Ethash) SealbyGPU(chain consensus.ChainReader, block *types.Block,
 	}
 	// If we're running a shared PoW, delegate sealing to it
 	if ethash.shared != nil {
-		return ethash.shared.SealbyGPU(chain, block, stop, serverFound, 1)
+		return ethash.shared.SealbyGPU(chain, block, stop)
 	}
-	// Create a runner and the multiple search threads it directs
-	abort := make(chan struct{})
-	found := make(chan *types.Block)
-
+	backend, err := ethash.sealerBackend()
+	if err != nil {
+		return nil, err
+	}
+	// Assemble a new job for the backend and wait for its shares
 	ethash.lock.Lock()
-	threads := ethash.threads
 	if ethash.rand == nil {
 		seed, err := crand.Int(crand.Reader, big.NewInt(math.MaxInt64))
 		if err != nil {
@@ -76,163 +59,57 @@ func (ethash *Ethash) SealbyGPU(chain consensus.ChainReader, block *types.Block,
 		}
 		ethash.rand = rand.New(rand.NewSource(seed.Int64()))
 	}
+	ethash.jobs++
+	id, seed := ethash.jobs, uint64(ethash.rand.Int63())
 	ethash.lock.Unlock()
-	// if threads == 0 {
-	// 	threads = runtime.NumCPU()
-	// }
-	// if threads < 0 {
-	// 	threads = 0 // Allows disabling local mining without extra logic around local/remote
-	// }
-	threads = 1
-	var pend sync.WaitGroup
-	for i := 0; i < threads; i++ {
-		pend.Add(1)
-		go func(id int, nonce uint64, serverFound chan uint64) {
-			defer pend.Done()
-			ethash.minebyGPU(block, id, nonce, abort, found, balance, coinage, serverFound, t)
-		}(0, uint64(ethash.rand.Int63()), serverFound)
-	}
-	// Wait until sealing is terminated or a nonce is found
-	var result *types.Block
-	select {
-	case <-stop:
-		sendStop(block, ethash.GPUPort)
-		// Outside abort, stop all miner threads
-		close(abort)
-	case result = <-found:
-		// One of the threads found a block, abort all others
-		close(abort)
-	case <-ethash.update:
-		// Thread count was changed on user request, restart
-		close(abort)
-		pend.Wait()
-		return ethash.SealbyGPU(chain, block, stop, serverFound, 1)
-	}
-	// Wait for all miners to terminate and return the block
-	pend.Wait()
-	return result, nil
-}
 
-// mine is the actual proof-of-work miner that searches for a nonce starting from
-// seed that results in correct final block difficulty.
-func (ethash *Ethash) minebyGPU(block *types.Block, id int, seed uint64, abort chan struct{}, found chan *types.Block, balance *big.Int, coinage *big.Int, serverFound chan uint64, t int) {
-	// Extract some data from the header
 	var (
 		header = block.Header()
 		hash   = header.HashNoNonce().Bytes()
-		target = new(big.Int).Div(maxUint256, header.Difficulty)
-
-		//number  = header.Number.Uint64()
-		//dataset = ethash.dataset(number)
+		target = SealTarget(header, age)
+		order  = getX11Order(hash, 11)
+		shares = make(chan *Share, gpuShareBacklog)
 	)
-
-	// Start generating random nonces until we abort or find a good one
-	var (
-		// attempts = int64(0)
-		nonce = seed
-	)
-	logger := log.New("miner", id)
-	logger.Trace("Started ethash search for new nonces", "seed", seed)
-	bn_coinage := new(big.Int).Mul(coinage, big.NewInt(1))
-	bn_coinage = Sqrt(bn_coinage, 6)
-	bn_txnumber := new(big.Int).Mul(new(big.Int).SetUint64(header.TxNumber), big.NewInt(5e+18))
-	bn_txnumber = Sqrt(bn_txnumber, 6)
-	if bn_coinage.Cmp(big.NewInt(0)) > 0 {
-		target.Mul(bn_coinage, target)
+	job := &SealJob{
+		ID:     id,
+		Number: header.Number.Uint64(),
+		Hash:   common.BytesToHash(hash),
+		Target: target,
+		Order:  order,
+		Nonce:  seed,
 	}
-	if bn_txnumber.Cmp(big.NewInt(0)) > 0 {
-		target.Mul(bn_txnumber, target)
+	if err := backend.Submit(job, shares); err != nil {
+		return nil, err
 	}
-	order := getX11Order(hash, 11)
-	var servernonce uint64
+	defer backend.Abort(job.ID)
 
-	if t == 0 {
-		time.Sleep(time.Second * 2)
-		send(0, nonce, header.Number, hash, target, order, ethash.GPUPort)
-		fmt.Println("send start")
-	}
+	logger := log.New("job", job.ID)
+	logger.Trace("Started GPU search for new nonces", "number", job.Number, "seed", seed)
 	for {
 		select {
-		case <-abort:
-			//sendStop(block)
-			logger.Trace("Ethash nonce search aborted", "attempts", servernonce-seed)
-			return
-		case servernonce = <-serverFound:
-			digest, result := myx11(hash, servernonce, order)
-			if Compare(result, FullTo32(target.Bytes()), 32) < 1 {
-				// send(0, nonce, header.Number, hash, target, order)
-
-				header = types.CopyHeader(header)
-				header.Nonce = types.EncodeNonce(servernonce)
-				header.MixDigest = common.BytesToHash(digest)
-				header.CoinAge = coinage
-				select {
-				case found <- block.WithSeal(header):
-					logger.Trace("Ethash nonce found and reported", "attempts", servernonce-seed, "nonce", servernonce)
-				case <-abort:
-					logger.Trace("Ethash nonce found but discarded", "attempts", servernonce-seed, "nonce", servernonce)
-				}
-				return
-			} else {
-				send(0, nonce, header.Number, hash, target, order, ethash.GPUPort)
+		case <-stop:
+			logger.Trace("GPU nonce search aborted")
+			return nil, nil
+
+		case share := <-shares:
+			// Never trust the workers, recompute the PoW value of the share
+			digest, result := myx11(hash, share.Nonce, order)
+			if Compare(result, FullTo32(target.Bytes()), 32) > 0 {
+				logger.Debug("Rejected invalid GPU share", "worker", share.Worker, "nonce", share.Nonce)
+				backend.Report(share, errInvalidShare)
+				continue
 			}
-		default:
-			time.Sleep(time.Second * 1)
-		}
-	}
-}
+			backend.Report(share, nil)
 
-func sendStop(block *types.Block, port int64) {
-	fmt.Println("send stop")
-	var (
-		header = block.Header()
-		hash   = header.HashNoNonce().Bytes()
-		target = big.NewInt(0)
-	)
-	number := big.NewInt(0)
-	order := getX11Order(hash, 11)
-	send(1, 0, number, hash, target, order, port)
-}
-
-func send(control int, nonce uint64, number *big.Int, input []byte, target *big.Int, order []byte, port int64) {
-	server := "127.0.0.1:" + strconv.FormatInt(port, 10)
-	fmt.Println("send to ", server)
-	tcpAddr, err := net.ResolveTCPAddr("tcp4", server)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Fatal error: %s", err.Error())
-		os.Exit(1)
-	}
+			header = types.CopyHeader(header)
+			header.Nonce = types.EncodeNonce(share.Nonce)
+			header.MixDigest = common.BytesToHash(digest)
+			header.CoinAge = age
 
-	conn, err := net.DialTCP("tcp", nil, tcpAddr)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Fatal error: %s", err.Error())
-		os.Exit(1)
+			logger.Trace("GPU nonce found and reported", "worker", share.Worker, "nonce", share.Nonce)
+			return block.WithSeal(header), nil
+		}
 	}
-	defer conn.Close()
-	sender(conn, control, nonce, number, input, target, order)
-
-}
-
-func sender(conn net.Conn, control int, nonce uint64, number *big.Int, input []byte, target *big.Int, order []byte) {
-	words := encodeByte(control, number, input, nonce, target, 9e+18, order)
-	conn.Write(words)
-}
-
-func encodeByte(control int, blockNumber *big.Int, input []byte, nonce uint64, target *big.Int, count uint64, alg []byte) []byte {
-	str := make([]byte, 1)
-	str[0] = byte(control)
-	str = append(str, Int64ToBytes(blockNumber.Uint64())[4:]...)
-	str = append(str, input...)
-	str = append(str, Int64ToBytes(nonce)...)
-	str = append(str, FullTo32(target.Bytes())...)
-	str = append(str, Int64ToBytes(count)...)
-	str = append(str, alg...)
-	return str
-}
-func Int64ToBytes(i uint64) []byte {
-	var buf = make([]byte, 8)
-	binary.BigEndian.PutUint64(buf, i)
-	return buf
 }
 
 func FullTo32(word []byte) []byte {
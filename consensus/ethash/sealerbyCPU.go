@@ -27,30 +27,27 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/coinage"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto/x11"
 	"github.com/ethereum/go-ethereum/log"
 )
 
-func (ethash *Ethash) Seal(chain consensus.ChainReader, block *types.Block, stop <-chan struct{}, serverFound chan uint64) (*types.Block, error) {
+// Seal implements consensus.Engine, attempting to find a nonce that satisfies
+// the block's difficulty requirements, either locally or on the GPU workers.
+func (ethash *Ethash) Seal(chain consensus.ChainReader, block *types.Block, stop <-chan struct{}) (*types.Block, error) {
 	if ethash.GPUMode {
-		return ethash.SealbyGPU(chain, block, stop, serverFound, 0)
+		return ethash.SealbyGPU(chain, block, stop)
 	}
-	return ethash.SealbyCPU(chain, block, stop, serverFound)
+	return ethash.SealbyCPU(chain, block, stop)
 }
 
-// Seal implements consensus.Engine, attempting to find a nonce that satisfies
-// the block's difficulty requirements.
-func (ethash *Ethash) SealbyCPU(chain consensus.ChainReader, block *types.Block, stop <-chan struct{}, serverFound chan uint64) (*types.Block, error) {
-
-	oldbalance, coinage, preNumber, preTime := chain.GetBalanceAndCoinAgeByHeaderHash(block.Header().Coinbase)
-	balance := new(big.Int).Add(oldbalance, big.NewInt(1e+18))
-	//---------------------------------	--------------
-	Time := block.Header().Time
-	Number := block.Header().Number
-	if preTime.Cmp(Time) < 0 && preNumber.Cmp(Number) < 0 {
-		t := new(big.Int).Sub(Time, preTime)
-		coinage = new(big.Int).Add(new(big.Int).Mul(balance, t), coinage)
-	}
+// SealbyCPU attempts to find a nonce that satisfies the block's difficulty
+// requirements using the local mining threads.
+func (ethash *Ethash) SealbyCPU(chain consensus.ChainReader, block *types.Block, stop <-chan struct{}) (*types.Block, error) {
+
+	balance, age, preNumber, preTime := chain.GetBalanceAndCoinAgeByHeaderHash(block.Header().Coinbase)
+	age = coinage.Expected(chain.Config(), block.Header(), balance, age, preNumber, preTime)
 
 	// fmt.Println("disy.yin ====>coinage:",coinage, "log2", log2(coinage))
 
@@ -63,7 +60,7 @@ func (ethash *Ethash) SealbyCPU(chain consensus.ChainReader, block *types.Block,
 	}
 	// If we're running a shared PoW, delegate sealing to it
 	if ethash.shared != nil {
-		return ethash.shared.SealbyCPU(chain, block, stop, serverFound)
+		return ethash.shared.SealbyCPU(chain, block, stop)
 	}
 	// Create a runner and the multiple search threads it directs
 	abort := make(chan struct{})
@@ -91,7 +88,7 @@ func (ethash *Ethash) SealbyCPU(chain consensus.ChainReader, block *types.Block,
 		pend.Add(1)
 		go func(id int, nonce uint64) {
 			defer pend.Done()
-			ethash.minebyCPU(block, id, nonce, abort, found, coinage)
+			ethash.minebyCPU(block, id, nonce, abort, found, age)
 		}(i, uint64(ethash.rand.Int63()))
 	}
 	// Wait until sealing is terminated or a nonce is found
@@ -107,13 +104,17 @@ func (ethash *Ethash) SealbyCPU(chain consensus.ChainReader, block *types.Block,
 		// Thread count was changed on user request, restart
 		close(abort)
 		pend.Wait()
-		return ethash.SealbyCPU(chain, block, stop, serverFound)
+		return ethash.SealbyCPU(chain, block, stop)
 	}
 	// Wait for all miners to terminate and return the block
 	pend.Wait()
 	return result, nil
 }
 
+// cpuBatchSize is the number of nonces a CPU mining thread hashes between two
+// checks for aborts.
+const cpuBatchSize = 128
+
 // mine is the actual proof-of-work miner that searches for a nonce starting from
 // seed that results in correct final block difficulty.
 func (ethash *Ethash) minebyCPU(block *types.Block, id int, seed uint64, abort chan struct{}, found chan *types.Block, coinage *big.Int) {
@@ -122,7 +123,7 @@ func (ethash *Ethash) minebyCPU(block *types.Block, id int, seed uint64, abort c
 	var (
 		header = block.Header()
 		hash   = header.HashNoNonce().Bytes()
-		target = new(big.Int).Div(maxUint256, header.Difficulty)
+		target = SealTarget(header, coinage)
 
 		//number  = header.Number.Uint64()
 		//dataset = ethash.dataset(number)
@@ -138,19 +139,12 @@ func (ethash *Ethash) minebyCPU(block *types.Block, id int, seed uint64, abort c
 
 	logger := log.New("miner", id)
 	logger.Trace("Started ethash search for new nonces", "seed", seed)
-	bn_coinage := new(big.Int).Mul(coinage, big.NewInt(1))
-	bn_coinage = Sqrt(bn_coinage, 6)
-	bn_txnumber := new(big.Int).Mul(new(big.Int).SetUint64(header.TxNumber), big.NewInt(5e+18))
-	bn_txnumber = Sqrt(bn_txnumber, 6)
-	if bn_coinage.Cmp(big.NewInt(0)) > 0 {
-		target.Mul(bn_coinage, target)
-	}
-	if bn_txnumber.Cmp(big.NewInt(0)) > 0 {
-		target.Mul(bn_txnumber, target)
-	}
 	order := getX11Order(hash, 11)
 
-	// send(nonce, header.Number, hash, target, order)
+	// Hash batches of nonces with a reusable hasher, checking for aborts between
+	hasher := x11.NewHasher()
+	boundary := FullTo32(target.Bytes())
+
 	for {
 		select {
 		case <-abort:
@@ -161,30 +155,33 @@ func (ethash *Ethash) minebyCPU(block *types.Block, id int, seed uint64, abort c
 
 		default:
 			// We don't have to update hash rate on every nonce, so update after after 2^X nonces
-			attempts++
-			if (attempts % (1 << 15)) == 0 {
+			attempts += cpuBatchSize
+			if attempts >= (1 << 15) {
 				ethash.hashrate.Mark(attempts)
 				attempts = 0
 			}
-			// Compute the PoW value of this nonce
-			digest, result := myx11(hash, nonce, order)
-			if Compare(result, FullTo32(target.Bytes()), 32) < 1 {
-
-				// Correct nonce found, create a new header with it
-				header = types.CopyHeader(header)
-				header.Nonce = types.EncodeNonce(nonce)
-				header.MixDigest = common.BytesToHash(digest)
-				header.CoinAge = coinage
-				// Seal and return a block (if still needed)
-				select {
-				case found <- block.WithSeal(header):
-					logger.Trace("Ethash nonce found and reported", "attempts", nonce-seed, "nonce", nonce)
-				case <-abort:
-					logger.Trace("Ethash nonce found but discarded", "attempts", nonce-seed, "nonce", nonce)
+			// Compute the PoW values of the next batch of nonces
+			results := hasher.HashBatch(hash, nonce, cpuBatchSize, order)
+			for i := range results {
+				if Compare(results[i][:], boundary, 32) < 1 {
+					nonce += uint64(i)
+
+					// Correct nonce found, create a new header with it
+					header = types.CopyHeader(header)
+					header.Nonce = types.EncodeNonce(nonce)
+					header.MixDigest = common.Hash{}
+					header.CoinAge = coinage
+					// Seal and return a block (if still needed)
+					select {
+					case found <- block.WithSeal(header):
+						logger.Trace("Ethash nonce found and reported", "attempts", nonce-seed, "nonce", nonce)
+					case <-abort:
+						logger.Trace("Ethash nonce found but discarded", "attempts", nonce-seed, "nonce", nonce)
+					}
+					return
 				}
-				return
 			}
-			nonce++
+			nonce += cpuBatchSize
 		}
 	}
 }
@@ -196,9 +193,7 @@ func log2(number *big.Int) uint {
 		if x.Rsh(number, i).Cmp(big.NewInt(0)) < 1 {
 			return i
 		}
-
 	}
-	return 0
 }
 func Sqrt(oldnumber *big.Int, exp uint) *big.Int {
 	number := new(big.Int).Div(oldnumber, big.NewInt(1e+14))
@@ -0,0 +1,127 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// SimulatedBlock is a block of a header sequence replayed with a difficulty
+// algorithm other than the one it was sealed with.
+type SimulatedBlock struct {
+	Number     uint64
+	Difficulty *big.Int // Nominal difficulty assigned by the replayed algorithm
+	Multiplier *big.Int // Seal multiplier of the historic coin age and tx count
+	Effective  *big.Int // Difficulty divided by the multiplier
+	Time       uint64   // Simulated timestamp
+	BlockTime  uint64   // Simulated seconds since the parent block
+	Historic   uint64   // Historic seconds since the parent block
+}
+
+// SimulateRetarget replays a contiguous header sequence, e.g. exported from the
+// main network, under the difficulty rules of config. Every historic block time
+// is taken as a measurement of the hashrate the block was sealed with at its
+// effective difficulty. Blocks after the retarget fork are assigned the
+// difficulty of the retarget instead, and their block time is the one the same
+// hashrate would have needed for the new effective difficulty.
+//
+// Blocks before the fork keep their historic difficulty and block time, as do the
+// ones whose retarget window is not fully part of the sequence. The first header
+// only seeds the simulation, so its block time is zero.
+func SimulateRetarget(config *params.ChainConfig, headers []*types.Header) ([]*SimulatedBlock, error) {
+	if len(headers) == 0 {
+		return nil, nil
+	}
+	for i := 1; i < len(headers); i++ {
+		if headers[i].Number.Uint64() != headers[i-1].Number.Uint64()+1 {
+			return nil, fmt.Errorf("non contiguous headers: #%d after #%d", headers[i].Number, headers[i-1].Number)
+		}
+		if headers[i].Time.Cmp(headers[i-1].Time) <= 0 {
+			return nil, fmt.Errorf("non increasing timestamp of header #%d", headers[i].Number)
+		}
+	}
+	var (
+		blocks    = make([]*SimulatedBlock, 0, len(headers))
+		simulated = make(map[common.Hash]*types.Header) // Simulated headers keyed by historic hash
+		first     = headers[0].Number.Uint64()
+	)
+	getHeader := func(hash common.Hash, number uint64) *types.Header {
+		if number < first {
+			return nil
+		}
+		return simulated[hash]
+	}
+	for i, header := range headers {
+		var (
+			multiplier = sealMultiplier(header)
+			sim        = types.CopyHeader(header)
+			block      = &SimulatedBlock{Number: header.Number.Uint64(), Multiplier: multiplier}
+		)
+		if i > 0 {
+			parent := simulated[headers[i-1].Hash()]
+			block.Historic = new(big.Int).Sub(header.Time, headers[i-1].Time).Uint64()
+			block.BlockTime = block.Historic
+
+			// Only the retarget ignores the block time, so only its difficulty can
+			// be assigned ahead of the simulated time
+			if config.IsRetarget(header.Number) && i > retargetWindow {
+				if sim.Difficulty = calcDifficultyWaltonchain(parent, getHeader); sim.Difficulty == nil {
+					return nil, fmt.Errorf("missing ancestors of header #%d", header.Number)
+				}
+				// The multiplier is the historic one, so the block time scales with
+				// the nominal difficulty at the same hashrate
+				blockTime := new(big.Int).SetUint64(block.Historic)
+				blockTime.Mul(blockTime, sim.Difficulty)
+				blockTime.Div(blockTime, header.Difficulty)
+				if block.BlockTime = blockTime.Uint64(); blockTime.BitLen() > 64 || block.BlockTime == 0 {
+					block.BlockTime = 1
+				}
+			}
+			sim.Time = new(big.Int).Add(parent.Time, new(big.Int).SetUint64(block.BlockTime))
+		}
+		simulated[header.Hash()] = sim
+
+		block.Difficulty = sim.Difficulty
+		block.Effective = new(big.Int).Div(sim.Difficulty, multiplier)
+		block.Time = sim.Time.Uint64()
+		blocks = append(blocks, block)
+	}
+	return blocks, nil
+}
+
+// BlockTimeStats returns the mean and standard deviation of the simulated block
+// times of the given blocks.
+func BlockTimeStats(blocks []*SimulatedBlock) (mean float64, stddev float64) {
+	if len(blocks) == 0 {
+		return 0, 0
+	}
+	for _, block := range blocks {
+		mean += float64(block.BlockTime)
+	}
+	mean /= float64(len(blocks))
+
+	for _, block := range blocks {
+		stddev += (float64(block.BlockTime) - mean) * (float64(block.BlockTime) - mean)
+	}
+	return mean, math.Sqrt(stddev / float64(len(blocks)))
+}
@@ -0,0 +1,90 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that replaying a history in which a wealthy miner takes over, sealing
+// much faster than the nominal difficulty intends, brings the block time back
+// to the target after the retarget fork.
+func TestSimulateRetarget(t *testing.T) {
+	var (
+		hashrate   = big.NewInt(1000000) // Difficulty sealed per second
+		difficulty = new(big.Int).Mul(hashrate, big.NewInt(retargetBlockTime))
+		coinage    = new(big.Int).Mul(big.NewInt(1e18), big.NewInt(1e12))
+	)
+	multiplier := sealMultiplier(&types.Header{CoinAge: coinage})
+	if multiplier.Cmp(big.NewInt(4)) < 0 {
+		t.Fatalf("coin age multiplier too small: %v", multiplier)
+	}
+	// Assemble a history with a fixed nominal difficulty, the block times of
+	// which are determined by the effective difficulty
+	headers := make([]*types.Header, 400)
+	for i := range headers {
+		header := &types.Header{
+			Number:     big.NewInt(int64(1000 + i)),
+			Time:       big.NewInt(1000000),
+			Difficulty: difficulty,
+			UncleHash:  types.EmptyUncleHash,
+		}
+		if i >= 100 {
+			header.CoinAge = coinage
+		}
+		if i > 0 {
+			blockTime := new(big.Int).Div(new(big.Int).Div(difficulty, sealMultiplier(header)), hashrate)
+			header.Time = new(big.Int).Add(headers[i-1].Time, blockTime)
+			header.ParentHash = headers[i-1].Hash()
+		}
+		headers[i] = header
+	}
+	// Replay without the fork, which must reproduce the history
+	blocks, err := SimulateRetarget(&params.ChainConfig{}, headers)
+	if err != nil {
+		t.Fatalf("failed to replay history: %v", err)
+	}
+	for i, block := range blocks {
+		if block.Difficulty.Cmp(headers[i].Difficulty) != 0 || block.Time != headers[i].Time.Uint64() {
+			t.Fatalf("block #%d: replay mismatch: have %v/%d, want %v/%d", block.Number, block.Difficulty, block.Time, headers[i].Difficulty, headers[i].Time)
+		}
+	}
+	if mean, _ := BlockTimeStats(blocks[300:]); mean >= retargetBlockTime/2 {
+		t.Fatalf("history not drifting: mean block time %v", mean)
+	}
+	// Replay with the fork, which must restore the block time
+	blocks, err = SimulateRetarget(&params.ChainConfig{RetargetBlock: big.NewInt(1050)}, headers)
+	if err != nil {
+		t.Fatalf("failed to replay history: %v", err)
+	}
+	for i := 0; i < 50; i++ {
+		if blocks[i].Difficulty.Cmp(headers[i].Difficulty) != 0 {
+			t.Errorf("block #%d: pre-fork difficulty changed", blocks[i].Number)
+		}
+	}
+	mean, stddev := BlockTimeStats(blocks[300:])
+	if mean < retargetBlockTime*0.9 || mean > retargetBlockTime*1.1 {
+		t.Errorf("retargeted mean block time mismatch: have %v, want %v", mean, retargetBlockTime)
+	}
+	if stddev > retargetBlockTime*0.1 {
+		t.Errorf("retargeted block time deviation too high: %v", stddev)
+	}
+}
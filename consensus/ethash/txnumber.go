@@ -0,0 +1,112 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// TxCounter counts the transactions of a block its PoW target is scaled by (see
+// SealMultipliers). Before the EffectiveTx fork every transaction counts. After
+// it only the ones not sent by the coinbase and paying at least the gas price
+// floor count, and only up to a cap per sender, so a miner can't widen its own
+// target by padding its blocks with cheap self-dealt transactions.
+type TxCounter struct {
+	effective bool           // Whether the effective transaction rule applies
+	coinbase  common.Address // Coinbase whose transactions don't count
+	floor     *big.Int       // Minimum gas price of the counted transactions
+	cap       uint64         // Maximum number of counted transactions per sender
+
+	senders map[common.Address]uint64 // Number of counted transactions per sender
+	count   uint64                    // Number of counted transactions
+}
+
+// NewTxCounter creates a counter for the transactions of a block with the given
+// header.
+func NewTxCounter(config *params.ChainConfig, header *types.Header) *TxCounter {
+	counter := &TxCounter{
+		effective: config.IsEffectiveTx(header.Number),
+		coinbase:  header.Coinbase,
+	}
+	if counter.effective {
+		counter.floor, counter.cap = config.Ethash.EffectiveTxRule()
+		counter.senders = make(map[common.Address]uint64)
+	}
+	return counter
+}
+
+// Add counts a transaction sent by the given account, returning whether it
+// scales the target.
+func (c *TxCounter) Add(from common.Address, tx *types.Transaction) bool {
+	if !c.Counts(from, tx) {
+		return false
+	}
+	if c.effective {
+		c.senders[from]++
+	}
+	c.count++
+	return true
+}
+
+// Counts returns whether a transaction sent by the given account would scale the
+// target if added next, without counting it.
+func (c *TxCounter) Counts(from common.Address, tx *types.Transaction) bool {
+	if c.effective {
+		return from != c.coinbase && tx.GasPrice().Cmp(c.floor) >= 0 && c.senders[from] < c.cap
+	}
+	return true
+}
+
+// Count returns the number of transactions scaling the target.
+func (c *TxCounter) Count() uint64 {
+	return c.count
+}
+
+// TxNumber returns the transaction count the PoW target of a block with the given
+// header and transactions is scaled by. Transactions with invalid signatures
+// don't count after the EffectiveTx fork.
+func TxNumber(config *params.ChainConfig, header *types.Header, txs []*types.Transaction) uint64 {
+	if !config.IsEffectiveTx(header.Number) {
+		return uint64(len(txs))
+	}
+	var (
+		counter = NewTxCounter(config, header)
+		signer  = types.MakeSigner(config, header.Number)
+	)
+	for _, tx := range txs {
+		if from, err := types.Sender(signer, tx); err == nil {
+			counter.Add(from, tx)
+		}
+	}
+	return counter.Count()
+}
+
+// NewBlock assembles a block like types.NewBlock, but with the transaction count
+// of the header set to the one the PoW target is scaled by.
+func NewBlock(config *params.ChainConfig, header *types.Header, txs []*types.Transaction, uncles []*types.Header, receipts []*types.Receipt) *types.Block {
+	block := types.NewBlock(header, txs, uncles, receipts)
+	if !config.IsEffectiveTx(header.Number) {
+		return block
+	}
+	header = block.Header()
+	header.TxNumber = TxNumber(config, header, txs)
+	return block.WithSeal(header)
+}
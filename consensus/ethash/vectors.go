@@ -0,0 +1,80 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"encoding/binary"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// X11Vector is a proof-of-work test vector, allowing external miner
+// implementations to validate their algorithm order derivation and hashing.
+type X11Vector struct {
+	Hash   hexutil.Bytes  `json:"hash"`   // Header hash without nonce
+	Order  string         `json:"order"`  // Chained algorithms, see getX11Order
+	Nonce  hexutil.Uint64 `json:"nonce"`  // Nonce hashed with the header
+	Digest hexutil.Bytes  `json:"digest"` // Mix digest sealed into the header
+	Result hexutil.Bytes  `json:"result"` // Value compared against the target
+}
+
+// NewX11Vector computes the proof-of-work test vector of a header hash and nonce.
+func NewX11Vector(hash []byte, nonce uint64) *X11Vector {
+	order := X11Order(hash)
+	digest, result := X11Hash(hash, nonce, order)
+
+	return &X11Vector{
+		Hash:   hash,
+		Order:  string(order),
+		Nonce:  hexutil.Uint64(nonce),
+		Digest: digest,
+		Result: result,
+	}
+}
+
+// X11Vectors deterministically generates a corpus of proof-of-work test vectors.
+// The corpus starts with a few hand picked corner cases, followed by pseudo
+// random header hashes and nonces derived from a keccak256 chain.
+func X11Vectors(count int) []*X11Vector {
+	var (
+		vectors = make([]*X11Vector, 0, count)
+		hashes  [][]byte
+		nonces  []uint64
+	)
+	// Extreme hashes, the identity order and a repeated, replaced algorithm
+	identity, repeated, zero, ones := make([]byte, 32), make([]byte, 32), make([]byte, 32), make([]byte, 32)
+	for i := range identity {
+		identity[i] = byte(i)
+		repeated[i] = 2
+		ones[i] = 0xff
+	}
+	hashes = append(hashes, zero, ones, identity, repeated)
+	nonces = append(nonces, 0, ^uint64(0), 1, 1<<63)
+
+	// Pseudo random header hashes and nonces for the rest of the corpus
+	seed := crypto.Keccak256([]byte("x11 test vectors"))
+	for len(hashes) < count {
+		seed = crypto.Keccak256(seed)
+		hashes = append(hashes, seed)
+		nonces = append(nonces, binary.BigEndian.Uint64(crypto.Keccak256(seed)))
+	}
+	for i := 0; i < count; i++ {
+		vectors = append(vectors, NewX11Vector(hashes[i], nonces[i]))
+	}
+	return vectors
+}
@@ -0,0 +1,60 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethash
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// Tests that the X11 proof-of-work still matches the published test vectors.
+// The vectors are consensus critical, a failure here means a hard fork. They
+// can only be regenerated with cmd/x11vec if the change is intentional.
+func TestX11Vectors(t *testing.T) {
+	blob, err := ioutil.ReadFile(filepath.Join("testdata", "x11vectors.json"))
+	if err != nil {
+		t.Fatalf("failed to read test vectors: %v", err)
+	}
+	var vectors []*X11Vector
+	if err := json.Unmarshal(blob, &vectors); err != nil {
+		t.Fatalf("failed to decode test vectors: %v", err)
+	}
+	if len(vectors) == 0 {
+		t.Fatalf("no test vectors found")
+	}
+	for i, want := range vectors {
+		have := NewX11Vector(want.Hash, uint64(want.Nonce))
+		if have.Order != want.Order {
+			t.Errorf("vector %d: order mismatch: have %s, want %s", i, have.Order, want.Order)
+		}
+		if !bytes.Equal(have.Digest, want.Digest) {
+			t.Errorf("vector %d: digest mismatch: have %x, want %x", i, have.Digest, want.Digest)
+		}
+		if !bytes.Equal(have.Result, want.Result) {
+			t.Errorf("vector %d: result mismatch: have %x, want %x", i, have.Result, want.Result)
+		}
+	}
+	// Ensure the corpus is the one the generator emits
+	for i, vector := range X11Vectors(len(vectors)) {
+		if !bytes.Equal(vector.Hash, vectors[i].Hash) || vector.Nonce != vectors[i].Nonce {
+			t.Errorf("vector %d: input mismatch: have %x/%d, want %x/%d", i, vector.Hash, vector.Nonce, vectors[i].Hash, vectors[i].Nonce)
+		}
+	}
+}
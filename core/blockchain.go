@@ -31,6 +31,7 @@ import (
 	"github.com/ethereum/go-ethereum/common/mclock"
 	"github.com/ethereum/go-ethereum/consensus"
 	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/state/snapshot"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/crypto"
@@ -42,6 +43,7 @@ import (
 	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/ethereum/go-ethereum/trie"
 	"github.com/hashicorp/golang-lru"
+	"gopkg.in/karalabe/cookiejar.v2/collections/prque"
 )
 
 var (
@@ -61,6 +63,23 @@ const (
 	BlockChainVersion = 3
 )
 
+// CacheConfig contains the configuration values for the trie node cache that
+// resides in a blockchain.
+type CacheConfig struct {
+	Disabled      bool   // Whether to disable trie write caching (archive node)
+	TrieNodeLimit int    // Memory limit (MB) at which to flush the current in-memory trie to disk
+	FlushInterval uint64 // Number of blocks after which to flush the current in-memory trie to disk
+	Retention     uint64 // Number of recent block states to keep in memory (at least 2)
+	NoSnapshot    bool   // Whether to disable the flat state snapshot
+}
+
+// defaultCacheConfig is the trie node cache configuration used if none is given.
+var defaultCacheConfig = &CacheConfig{
+	TrieNodeLimit: 256,
+	FlushInterval: 1024,
+	Retention:     128,
+}
+
 // BlockChain represents the canonical chain given a database with a genesis
 // block. The Blockchain manages chain imports, reverts, chain reorganisations.
 //
@@ -76,7 +95,8 @@ const (
 // included in the canonical one where as GetBlockByNumber always represents the
 // canonical chain.
 type BlockChain struct {
-	config *params.ChainConfig // chain & network configuration
+	config      *params.ChainConfig // chain & network configuration
+	cacheConfig *CacheConfig        // Cache configuration for pruning
 
 	hc            *HeaderChain
 	chainDb       ethdb.Database
@@ -88,15 +108,19 @@ type BlockChain struct {
 	scope         event.SubscriptionScope
 	genesisBlock  *types.Block
 
-	mu      sync.RWMutex // global mutex for locking chain operations
-	chainmu sync.RWMutex // blockchain insertion lock
-	procmu  sync.RWMutex // block processor lock
+	mu       sync.RWMutex // global mutex for locking chain operations
+	chainmu  sync.RWMutex // blockchain insertion lock
+	procmu   sync.RWMutex // block processor lock
+	freezemu sync.Mutex   // ancient store migration lock
 
 	checkpoint       int          // checkpoint counts towards the new checkpoint
 	currentBlock     *types.Block // Current head of the block chain
 	currentFastBlock *types.Block // Current head of the fast-sync chain (may be above the block chain!)
 
 	stateCache   state.Database // State database to reuse between imports (contains state cache)
+	snaps        *snapshot.Tree // Flat state snapshot tree for fast state reads (nil if disabled)
+	triegc       *prque.Prque   // Priority queue mapping block numbers to tries to gc
+	lastFlush    uint64         // Number of the block whose state was last flushed to disk
 	bodyCache    *lru.Cache     // Cache for the most recent block bodies
 	bodyRLPCache *lru.Cache     // Cache for the most recent block bodies in RLP encoded format
 	blockCache   *lru.Cache     // Cache for the most recent entire blocks
@@ -118,8 +142,14 @@ type BlockChain struct {
 
 // NewBlockChain returns a fully initialised block chain using information
 // available in the database. It initialises the default Ethereum Validator and
-// Processor.
-func NewBlockChain(chainDb ethdb.Database, config *params.ChainConfig, engine consensus.Engine, vmConfig vm.Config) (*BlockChain, error) {
+// Processor. A nil cacheConfig selects the default trie node cache settings.
+func NewBlockChain(chainDb ethdb.Database, cacheConfig *CacheConfig, config *params.ChainConfig, engine consensus.Engine, vmConfig vm.Config) (*BlockChain, error) {
+	if cacheConfig == nil {
+		cacheConfig = defaultCacheConfig
+	}
+	if !cacheConfig.Disabled && cacheConfig.Retention < 2 {
+		return nil, fmt.Errorf("invalid state retention %d, must be at least 2 blocks", cacheConfig.Retention)
+	}
 	bodyCache, _ := lru.New(bodyCacheLimit)
 	bodyRLPCache, _ := lru.New(bodyCacheLimit)
 	blockCache, _ := lru.New(blockCacheLimit)
@@ -128,8 +158,10 @@ func NewBlockChain(chainDb ethdb.Database, config *params.ChainConfig, engine co
 
 	bc := &BlockChain{
 		config:       config,
+		cacheConfig:  cacheConfig,
 		chainDb:      chainDb,
 		stateCache:   state.NewDatabase(chainDb),
+		triegc:       prque.New(),
 		quit:         make(chan struct{}),
 		bodyCache:    bodyCache,
 		bodyRLPCache: bodyRLPCache,
@@ -154,6 +186,21 @@ func NewBlockChain(chainDb ethdb.Database, config *params.ChainConfig, engine co
 	if err := bc.loadLastState(); err != nil {
 		return nil, err
 	}
+	bc.lastFlush = bc.currentBlock.NumberU64()
+
+	// Load the flat state snapshot, regenerating it in the background if it
+	// doesn't match the head state
+	if !cacheConfig.NoSnapshot {
+		if bc.snaps, err = snapshot.New(chainDb, bc.stateCache.NodeCache(), bc.currentBlock.Root()); err != nil {
+			log.Warn("State snapshot unavailable", "err", err)
+		} else {
+			bc.stateCache = state.NewDatabaseWithSnapshots(bc.stateCache.NodeCache(), bc.snaps)
+		}
+	}
+	// Serve the state reads of the header chain from the same caches, the recent
+	// states only live in the trie node cache when pruning
+	bc.hc.stateCache = bc.stateCache
+
 	// Check the current state of the block hashes and make sure that we do not have any of the bad blocks in our chain
 	for hash := range BadHashes {
 		if header := bc.GetHeaderByHash(hash); header != nil {
@@ -169,6 +216,12 @@ func NewBlockChain(chainDb ethdb.Database, config *params.ChainConfig, engine co
 	}
 	// Take ownership of this particular state
 	go bc.update()
+
+	// Start migrating immutable chain segments if the database has an ancient store
+	if _, ok := chainDb.(ethdb.AncientStore); ok {
+		bc.wg.Add(1)
+		go bc.freeze()
+	}
 	return bc, nil
 }
 
@@ -195,9 +248,11 @@ func (bc *BlockChain) loadLastState() error {
 	}
 	// Make sure the state associated with the block is available
 	if _, err := state.New(currentBlock.Root(), bc.stateCache); err != nil {
-		// Dangling block without a state associated, init from scratch
-		log.Warn("Head state missing, resetting chain", "number", currentBlock.Number(), "hash", currentBlock.Hash())
-		return bc.Reset()
+		// Dangling block without a state associated, rewind to the last one with state
+		log.Warn("Head state missing, repairing chain", "number", currentBlock.Number(), "hash", currentBlock.Hash())
+		if err := bc.repair(&currentBlock); err != nil {
+			return err
+		}
 	}
 	// Everything seems to be fine, set as the head block
 	bc.currentBlock = currentBlock
@@ -248,6 +303,16 @@ func (bc *BlockChain) SetHead(head uint64) error {
 	bc.hc.SetHead(head, delFn)
 	currentHeader := bc.hc.CurrentHeader()
 
+	// Drop any frozen blocks above the new head, they're not immutable after all
+	if store, ok := bc.chainDb.(ethdb.AncientStore); ok {
+		bc.freezemu.Lock()
+		err := store.TruncateAncients(currentHeader.Number.Uint64() + 1)
+		bc.freezemu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+
 	// Clear out any stale content from the caches
 	bc.bodyCache.Purge()
 	bc.bodyRLPCache.Purge()
@@ -260,8 +325,11 @@ func (bc *BlockChain) SetHead(head uint64) error {
 	}
 	if bc.currentBlock != nil {
 		if _, err := state.New(bc.currentBlock.Root(), bc.stateCache); err != nil {
-			// Rewound state missing, rolled back to before pivot, reset to genesis
-			bc.currentBlock = nil
+			// Rewound state missing, roll back to the last block with state or to
+			// before the pivot, resetting to genesis
+			if err := bc.repair(&bc.currentBlock); err != nil {
+				bc.currentBlock = nil
+			}
 		}
 	}
 	// Rewind the fast block in a simpleton way to the target head
@@ -275,6 +343,10 @@ func (bc *BlockChain) SetHead(head uint64) error {
 	if bc.currentFastBlock == nil {
 		bc.currentFastBlock = bc.genesisBlock
 	}
+	// Regenerate the state snapshot if the new head is below its disk layer
+	if bc.snaps != nil && bc.snaps.Snapshot(bc.currentBlock.Root()) == nil {
+		bc.snaps.Rebuild(bc.currentBlock.Root())
+	}
 	if err := WriteHeadBlockHash(bc.chainDb, bc.currentBlock.Hash()); err != nil {
 		log.Crit("Failed to reset head full block", "err", err)
 	}
@@ -300,10 +372,40 @@ func (bc *BlockChain) FastSyncCommitHead(hash common.Hash) error {
 	bc.currentBlock = block
 	bc.mu.Unlock()
 
+	// The synced state is unknown to the state snapshot, regenerate it
+	if bc.snaps != nil {
+		bc.snaps.Rebuild(block.Root())
+	}
+
 	log.Info("Committed new head block", "number", block.Number(), "hash", hash)
 	return nil
 }
 
+// repair tries to repair the current blockchain by rolling back the current block
+// until one with associated state is found. This is needed to fix incomplete db
+// writes caused either by crashes/power outages, or simply non-committed tries.
+//
+// This method only rolls back the current block. The current header and current
+// fast block are left intact.
+func (bc *BlockChain) repair(head **types.Block) error {
+	for {
+		// Abort if we've rewound to a head block that does have associated state
+		if _, err := state.New((*head).Root(), bc.stateCache); err == nil {
+			log.Info("Rewound blockchain to past state", "number", (*head).Number(), "hash", (*head).Hash())
+			return nil
+		}
+		// Otherwise rewind one block and recheck state availability there
+		if (*head).NumberU64() == 0 {
+			return fmt.Errorf("missing genesis state [%x…]", (*head).Root().Bytes()[:4])
+		}
+		block := bc.GetBlock((*head).ParentHash(), (*head).NumberU64()-1)
+		if block == nil {
+			return fmt.Errorf("missing block %d [%x…]", (*head).NumberU64()-1, (*head).ParentHash().Bytes()[:4])
+		}
+		*head = block
+	}
+}
+
 // GasLimit returns the gas limit of the current HEAD block.
 func (bc *BlockChain) GasLimit() *big.Int {
 	bc.mu.RLock()
@@ -386,6 +488,11 @@ func (bc *BlockChain) StateAt(root common.Hash) (*state.StateDB, error) {
 	return state.New(root, bc.stateCache)
 }
 
+// StateCache returns the caching database underpinning the blockchain instance.
+func (bc *BlockChain) StateCache() state.Database {
+	return bc.stateCache
+}
+
 // Reset purges the entire blockchain, restoring it to its genesis state.
 func (bc *BlockChain) Reset() error {
 	return bc.ResetWithGenesisBlock(bc.genesisBlock)
@@ -415,6 +522,9 @@ func (bc *BlockChain) ResetWithGenesisBlock(genesis *types.Block) error {
 	bc.hc.SetCurrentHeader(bc.genesisBlock.Header())
 	bc.currentFastBlock = bc.genesisBlock
 
+	if bc.snaps != nil && bc.snaps.Snapshot(genesis.Root()) == nil {
+		bc.snaps.Rebuild(genesis.Root())
+	}
 	return nil
 }
 
@@ -520,8 +630,13 @@ func (bc *BlockChain) HasBlock(hash common.Hash, number uint64) bool {
 	if bc.blockCache.Contains(hash) {
 		return true
 	}
-	ok, _ := bc.chainDb.Has(blockBodyKey(hash, number))
-	return ok
+	return HasBody(bc.chainDb, hash, number)
+}
+
+// TrieNode retrieves a blob of data associated with a trie node (or code hash)
+// either from the trie node cache or the persistent database.
+func (bc *BlockChain) TrieNode(hash common.Hash) ([]byte, error) {
+	return bc.stateCache.NodeCache().Get(hash[:])
 }
 
 // HasBlockAndState checks if a block and associated state trie is fully present
@@ -533,7 +648,13 @@ func (bc *BlockChain) HasBlockAndState(hash common.Hash) bool {
 		return false
 	}
 	// Ensure the associated state is also present
-	_, err := bc.stateCache.OpenTrie(block.Root())
+	return bc.HasState(block.Root())
+}
+
+// HasState checks if the state trie with the given root is fully present in the
+// trie node cache or the database.
+func (bc *BlockChain) HasState(root common.Hash) bool {
+	_, err := bc.stateCache.OpenTrie(root)
 	return err == nil
 }
 
@@ -607,6 +728,35 @@ func (bc *BlockChain) Stop() {
 	atomic.StoreInt32(&bc.procInterrupt, 1)
 
 	bc.wg.Wait()
+
+	// Flatten the state snapshot into its disk layer, so it matches the head state
+	// on the next startup, and persist the progress of any generation
+	if bc.snaps != nil {
+		if err := bc.snaps.Cap(bc.CurrentBlock().Root(), 0); err != nil {
+			log.Error("Failed to flatten state snapshot", "err", err)
+		}
+		bc.snaps.Close()
+	}
+	// Ensure the state of the most recent blocks is persisted on shutdown: the head
+	// for a regular restart, its parent in case the head is reorged away and the
+	// oldest one still retained to serve deeper reorgs.
+	if !bc.cacheConfig.Disabled {
+		cache := bc.stateCache.NodeCache()
+
+		for _, offset := range []uint64{0, 1, bc.cacheConfig.Retention - 1} {
+			if number := bc.CurrentBlock().NumberU64(); number > offset {
+				recent := bc.GetBlockByNumber(number - offset)
+
+				log.Info("Writing cached state to disk", "block", recent.Number(), "hash", recent.Hash(), "root", recent.Root())
+				if err := cache.Commit(recent.Root(), true); err != nil {
+					log.Error("Failed to commit recent state trie", "err", err)
+				}
+			}
+		}
+		for !bc.triegc.Empty() {
+			cache.Dereference(bc.triegc.PopItem().(common.Hash))
+		}
+	}
 	log.Info("Blockchain manager stopped")
 }
 
@@ -783,6 +933,19 @@ func (bc *BlockChain) InsertReceiptChain(blockChain types.Blocks, receiptChain [
 	return 0, nil
 }
 
+// WriteBlockWithoutState writes only the block and its metadata to the database,
+// but does not write any state. This is used to construct competing side forks
+// up to the point where they exceed the canonical total difficulty.
+func (bc *BlockChain) WriteBlockWithoutState(block *types.Block, td *big.Int) error {
+	bc.wg.Add(1)
+	defer bc.wg.Done()
+
+	if err := bc.hc.WriteTd(block.Hash(), block.NumberU64(), td); err != nil {
+		return err
+	}
+	return WriteBlock(bc.chainDb, block)
+}
+
 // WriteBlock writes the block to the chain.
 func (bc *BlockChain) WriteBlockAndState(block *types.Block, receipts []*types.Receipt, state *state.StateDB) (status WriteStatus, err error) {
 	bc.wg.Add(1)
@@ -809,7 +972,7 @@ func (bc *BlockChain) WriteBlockAndState(block *types.Block, receipts []*types.R
 	if err := WriteBlock(batch, block); err != nil {
 		return NonStatTy, err
 	}
-	if _, err := state.CommitTo(batch, bc.config.IsEIP158(block.Number())); err != nil {
+	if err := bc.commitState(block, state); err != nil {
 		return NonStatTy, err
 	}
 	if err := WriteBlockReceipts(batch, block.Hash(), block.NumberU64(), receipts); err != nil {
@@ -845,11 +1008,82 @@ func (bc *BlockChain) WriteBlockAndState(block *types.Block, receipts []*types.R
 	// Set new head.
 	if status == CanonStatTy {
 		bc.insert(block)
+		bc.capSnapshots(block.Root())
 	}
 	bc.futureBlocks.Remove(block.Hash())
 	return status, nil
 }
 
+// commitState writes the post state of a block. Archive nodes write it to disk
+// straight away. Otherwise it is committed to the trie node cache and referenced
+// there, the state of the block at the edge of the retention window is flushed
+// to disk every flush interval or if the cache outgrew its memory limit, and the
+// state of any older block is garbage collected.
+func (bc *BlockChain) commitState(block *types.Block, statedb *state.StateDB) error {
+	deleteEmpty := bc.config.IsEIP158(block.Number())
+	if bc.cacheConfig.Disabled {
+		_, err := statedb.CommitTo(bc.chainDb, deleteEmpty)
+		return err
+	}
+	cache := bc.stateCache.NodeCache()
+	root, err := statedb.CommitTo(cache, deleteEmpty)
+	if err != nil {
+		return err
+	}
+	cache.Reference(root, common.Hash{}) // metadata reference to keep trie alive
+	bc.triegc.Push(root, -float32(block.NumberU64()))
+
+	current := block.NumberU64()
+	if current < bc.cacheConfig.Retention {
+		return nil
+	}
+	chosen := current - bc.cacheConfig.Retention + 1
+
+	limit := common.StorageSize(bc.cacheConfig.TrieNodeLimit) * 1024 * 1024
+	if chosen >= bc.lastFlush+bc.cacheConfig.FlushInterval || cache.Size() > limit {
+		// Flush the canonical state at the edge of the retention window, unless
+		// it's missing due to being reorged away in the meantime
+		if header := bc.GetHeaderByNumber(chosen); header == nil {
+			log.Warn("Reorg in progress, trie commit postponed", "number", chosen)
+		} else {
+			if chosen < bc.lastFlush+bc.cacheConfig.FlushInterval {
+				log.Info("Trie node cache over limit, committing", "size", cache.Size(), "limit", limit)
+			}
+			if err := cache.Commit(header.Root, true); err != nil {
+				return err
+			}
+			bc.lastFlush = chosen
+		}
+	}
+	// Garbage collect the state of every block older than the retention window
+	for !bc.triegc.Empty() {
+		root, number := bc.triegc.Pop()
+		if uint64(-number) >= chosen {
+			bc.triegc.Push(root, number)
+			break
+		}
+		cache.Dereference(root.(common.Hash))
+	}
+	return nil
+}
+
+// capSnapshots flattens the state snapshot diff layers below the new head block
+// into the disk layer, keeping as many layers as block states are retained in the
+// trie node cache, so the trie of the disk layer stays available for resuming
+// an interrupted snapshot generation.
+func (bc *BlockChain) capSnapshots(root common.Hash) {
+	if bc.snaps == nil {
+		return
+	}
+	layers := int(defaultCacheConfig.Retention)
+	if !bc.cacheConfig.Disabled {
+		layers = int(bc.cacheConfig.Retention) - 1
+	}
+	if err := bc.snaps.Cap(root, layers); err != nil {
+		log.Warn("Failed to cap state snapshot", "root", root, "err", err)
+	}
+}
+
 // InsertChain attempts to insert the given batch of blocks in to the canonical
 // chain or, otherwise, create a fork. If an error is returned it will return
 // the index number of the failing block as well an error describing what went
@@ -857,14 +1091,17 @@ func (bc *BlockChain) WriteBlockAndState(block *types.Block, receipts []*types.R
 //
 // After insertion is done, all accumulated events will be fired.
 func (bc *BlockChain) InsertChain(chain types.Blocks) (int, error) {
+	bc.chainmu.Lock()
 	n, events, logs, err := bc.insertChain(chain)
+	bc.chainmu.Unlock()
+
 	bc.PostChainEvents(events, logs)
 	return n, err
 }
 
 // insertChain will execute the actual chain insertion and event aggregation. The
-// only reason this method exists as a separate one is to make locking cleaner
-// with deferred statements.
+// caller must hold the chain mutex, which allows side chains with pruned states
+// to be re-executed by recursion within the same import.
 func (bc *BlockChain) insertChain(chain types.Blocks) (int, []interface{}, []*types.Log, error) {
 	// Do a sanity check that the provided chain is actually ordered and linked
 	for i := 1; i < len(chain); i++ {
@@ -881,9 +1118,6 @@ func (bc *BlockChain) insertChain(chain types.Blocks) (int, []interface{}, []*ty
 	bc.wg.Add(1)
 	defer bc.wg.Done()
 
-	bc.chainmu.Lock()
-	defer bc.chainmu.Unlock()
-
 	// A queued approach to delivering events. This is generally
 	// faster than direct delivery and requires much less mutex
 	// acquiring.
@@ -948,8 +1182,30 @@ func (bc *BlockChain) insertChain(chain types.Blocks) (int, []interface{}, []*ty
 				continue
 			}
 
-			bc.reportBlock(block, nil, err)
-			return i, events, coalescedLogs, err
+			if err == consensus.ErrPrunedAncestor {
+				// A side chain forking off below the retained states, store the block
+				// without processing it until its total difficulty beats the canonical
+				externTd := new(big.Int).Add(bc.GetTd(block.ParentHash(), block.NumberU64()-1), block.Difficulty())
+				current := bc.CurrentBlock()
+				if localTd := bc.GetTd(current.Hash(), current.NumberU64()); localTd.Cmp(externTd) > 0 {
+					if err := bc.WriteBlockWithoutState(block, externTd); err != nil {
+						return i, events, coalescedLogs, err
+					}
+					stats.ignored++
+					continue
+				}
+				// The side chain is taking over, regenerate the parent state first
+				evs, logs, rerr := bc.reexecuteSidechain(block)
+				events, coalescedLogs = append(events, evs...), append(coalescedLogs, logs...)
+				if rerr != nil {
+					return i, events, coalescedLogs, rerr
+				}
+				err = nil
+			}
+			if err != nil {
+				bc.reportBlock(block, nil, err)
+				return i, events, coalescedLogs, err
+			}
 		}
 		// Create a new statedb using the parent block and report an
 		// error if it fails.
@@ -1008,6 +1264,29 @@ func (bc *BlockChain) insertChain(chain types.Blocks) (int, []interface{}, []*ty
 	return 0, events, coalescedLogs, nil
 }
 
+// reexecuteSidechain regenerates the pruned parent state of a side chain block
+// taking over the canonical chain, by importing its ancestors again from the last
+// one with a state available. The caller must hold the chain mutex.
+func (bc *BlockChain) reexecuteSidechain(block *types.Block) ([]interface{}, []*types.Log, error) {
+	var winner []*types.Block
+
+	parent := bc.GetBlock(block.ParentHash(), block.NumberU64()-1)
+	for parent != nil && !bc.HasState(parent.Root()) {
+		winner = append(winner, parent)
+		parent = bc.GetBlock(parent.ParentHash(), parent.NumberU64()-1)
+	}
+	if parent == nil {
+		return nil, nil, consensus.ErrUnknownAncestor
+	}
+	for i := 0; i < len(winner)/2; i++ {
+		winner[i], winner[len(winner)-1-i] = winner[len(winner)-1-i], winner[i]
+	}
+	log.Info("Regenerating pruned side chain states", "from", winner[0].Number(), "count", len(winner))
+
+	_, events, logs, err := bc.insertChain(winner)
+	return events, logs, err
+}
+
 // insertStats tracks and reports on block insertion.
 type insertStats struct {
 	queued, processed, ignored int
@@ -1146,6 +1425,15 @@ func (bc *BlockChain) reorg(oldBlock, newBlock *types.Block) error {
 		}
 		addedTxs = append(addedTxs, block.Transactions()...)
 	}
+	// Make sure the state snapshot follows the new chain. Its layers are only
+	// linked up while the fork stays above the disk layer, otherwise it has to
+	// be regenerated from the new head state.
+	if bc.snaps != nil && len(newChain) > 0 {
+		if head := newChain[0]; bc.snaps.Snapshot(head.Root()) == nil {
+			log.Warn("State snapshot not linked to new chain, rebuilding", "number", head.Number(), "hash", head.Hash())
+			bc.snaps.Rebuild(head.Root())
+		}
+	}
 
 	// calculate the difference between deleted and added transactions
 	diff := types.TxDifference(deletedTxs, addedTxs)
@@ -1263,6 +1551,22 @@ func (bc *BlockChain) InsertHeaderChain(chain types.Blocks) (int, error) {
 	return bc.InsertChain(lightblocks)
 }
 
+// InsertHeaders verifies and inserts a header chain into the local chain without
+// the block bodies, which can be completed with InsertReceiptChain afterwards.
+// The seals are verified for every checkFreq'th header and the last one. If an
+// error is returned, it will return the index number of the failing header.
+func (bc *BlockChain) InsertHeaders(chain []*types.Header, checkFreq int) (int, error) {
+	start := time.Now()
+	if i, err := bc.hc.ValidateHeaderChain(chain, checkFreq); err != nil {
+		return i, err
+	}
+	// Make sure only one thread manipulates the chain at once
+	bc.chainmu.Lock()
+	defer bc.chainmu.Unlock()
+
+	return bc.hc.InsertHeaderChain(chain, bc.writeHeader, start)
+}
+
 // writeHeader writes a header into the local chain, given that its parent is
 // already known. If the total difficulty of the newly inserted header becomes
 // greater than the current known TD, the canonical chain is re-routed.
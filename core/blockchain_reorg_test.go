@@ -0,0 +1,134 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that a side chain forking off below the retained block states is stored
+// without state while lighter than the canonical chain, and re-executed from its
+// last available ancestor state once it takes over.
+func TestReorgPastRetention(t *testing.T) {
+	var (
+		gendb, _ = ethdb.NewMemDatabase()
+		db, _    = ethdb.NewMemDatabase()
+		gspec    = &Genesis{Config: params.TestChainConfig}
+		genesis  = gspec.MustCommit(gendb)
+	)
+	gspec.MustCommit(db)
+
+	blockchain, _ := NewBlockChain(db, &CacheConfig{TrieNodeLimit: 256, FlushInterval: 1024, Retention: 4}, gspec.Config, ethash.NewFaker(), vm.Config{})
+	defer blockchain.Stop()
+
+	canon, _ := GenerateChain(gspec.Config, genesis, gendb, 20, func(i int, b *BlockGen) {})
+	if _, err := blockchain.InsertChain(canon); err != nil {
+		t.Fatalf("failed to insert canonical chain: %v", err)
+	}
+	side, _ := GenerateChain(gspec.Config, canon[2], gendb, 20, func(i int, b *BlockGen) {
+		b.SetCoinbase(common.Address{0x01})
+	})
+	if blockchain.HasState(canon[2].Root()) {
+		t.Fatalf("fork point state still retained")
+	}
+	// Import a side chain prefix lighter than the canonical chain
+	if _, err := blockchain.InsertChain(side[:10]); err != nil {
+		t.Fatalf("failed to insert light side chain: %v", err)
+	}
+	if head := blockchain.CurrentBlock().Hash(); head != canon[len(canon)-1].Hash() {
+		t.Fatalf("canonical head changed: have %x, want %x", head, canon[len(canon)-1].Hash())
+	}
+	if !blockchain.HasBlock(side[9].Hash(), side[9].NumberU64()) || blockchain.HasBlockAndState(side[9].Hash()) {
+		t.Fatalf("light side chain block not stored without state")
+	}
+	// Import the rest of the side chain, taking over the canonical one
+	if _, err := blockchain.InsertChain(side[10:]); err != nil {
+		t.Fatalf("failed to insert heavy side chain: %v", err)
+	}
+	if head := blockchain.CurrentBlock().Hash(); head != side[len(side)-1].Hash() {
+		t.Fatalf("side chain not canonical: have %x, want %x", head, side[len(side)-1].Hash())
+	}
+	if !blockchain.HasBlockAndState(side[len(side)-1].Hash()) {
+		t.Fatalf("side chain head state missing")
+	}
+	for _, block := range side {
+		if have := blockchain.GetBlockByNumber(block.NumberU64()); have == nil || have.Hash() != block.Hash() {
+			t.Fatalf("block #%d not canonical", block.NumberU64())
+		}
+	}
+}
+
+// Tests that a pruned side chain taking over the canonical chain is re-executed
+// atomically, without imports running concurrently to it moving the head meanwhile.
+func TestReorgPastRetentionConcurrent(t *testing.T) {
+	var (
+		gendb, _ = ethdb.NewMemDatabase()
+		db, _    = ethdb.NewMemDatabase()
+		gspec    = &Genesis{Config: params.TestChainConfig}
+		genesis  = gspec.MustCommit(gendb)
+	)
+	gspec.MustCommit(db)
+
+	blockchain, _ := NewBlockChain(db, &CacheConfig{TrieNodeLimit: 256, FlushInterval: 1024, Retention: 4}, gspec.Config, ethash.NewFaker(), vm.Config{})
+	defer blockchain.Stop()
+
+	blocks, _ := GenerateChain(gspec.Config, genesis, gendb, 40, func(i int, b *BlockGen) {})
+	canon, extension := blocks[:20], blocks[20:]
+	if _, err := blockchain.InsertChain(canon); err != nil {
+		t.Fatalf("failed to insert canonical chain: %v", err)
+	}
+	side, _ := GenerateChain(gspec.Config, canon[2], gendb, 20, func(i int, b *BlockGen) {
+		b.SetCoinbase(common.Address{0x01})
+	})
+	if _, err := blockchain.InsertChain(side[:10]); err != nil {
+		t.Fatalf("failed to insert light side chain: %v", err)
+	}
+	// Extend the canonical chain while the side chain takes over
+	errc := make(chan error, 2)
+	go func() {
+		_, err := blockchain.InsertChain(side[10:])
+		errc <- err
+	}()
+	go func() {
+		_, err := blockchain.InsertChain(extension)
+		errc <- err
+	}()
+	for i := 0; i < 2; i++ {
+		if err := <-errc; err != nil {
+			t.Fatalf("failed to insert chain: %v", err)
+		}
+	}
+	// The longer extended canonical chain must have won
+	want := blocks
+	if head := blockchain.CurrentBlock().Hash(); head != want[len(want)-1].Hash() {
+		t.Fatalf("head mismatch: have %x, want %x", head, want[len(want)-1].Hash())
+	}
+	if !blockchain.HasBlockAndState(want[len(want)-1].Hash()) {
+		t.Fatalf("head state missing")
+	}
+	for _, block := range want {
+		if have := blockchain.GetBlockByNumber(block.NumberU64()); have == nil || have.Hash() != block.Hash() {
+			t.Fatalf("block #%d not canonical", block.NumberU64())
+		}
+	}
+}
@@ -0,0 +1,174 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const (
+	// freezerRecheckInterval is the frequency to check the key-value database for
+	// chain progression that might permit new blocks to be frozen into immutable
+	// storage.
+	freezerRecheckInterval = time.Minute
+
+	// freezerBatchLimit is the maximum number of blocks to freeze in one batch
+	// before doing an fsync and deleting them from the key-value store.
+	freezerBatchLimit = 30000
+)
+
+// FreezeAncients moves the canonical blocks older than the immutability threshold
+// of db out of its key-value store into its ancient store, at most limit blocks
+// at a time. The number of blocks frozen is returned; databases without an
+// ancient store are left untouched.
+func FreezeAncients(db ethdb.Database, limit uint64) (uint64, error) {
+	store, ok := db.(ethdb.AncientStore)
+	if !ok {
+		return 0, nil
+	}
+	// Only freeze blocks deep enough below the current head to never be reorged
+	head := GetHeadBlockHash(db)
+	if head == (common.Hash{}) {
+		return 0, nil
+	}
+	number := GetBlockNumber(db, head)
+	if number == missingNumber || number < store.ImmutabilityThreshold() {
+		return 0, nil
+	}
+	frozen, err := store.Ancients()
+	if err != nil {
+		return 0, err
+	}
+	last := number - store.ImmutabilityThreshold()
+	if frozen > last {
+		return 0, nil
+	}
+	if last-frozen+1 > limit {
+		last = frozen + limit - 1
+	}
+	// Append the canonical blocks to the ancient store and flush it to disk
+	start := time.Now()
+
+	hashes := make([]common.Hash, 0, last-frozen+1)
+	for n := frozen; n <= last; n++ {
+		hash := GetCanonicalHash(db, n)
+		if hash == (common.Hash{}) {
+			return 0, fmt.Errorf("canonical hash missing for block #%d, can't freeze", n)
+		}
+		header := GetHeaderRLP(db, hash, n)
+		if len(header) == 0 {
+			return 0, fmt.Errorf("header missing for block #%d [%x…], can't freeze", n, hash[:4])
+		}
+		body := GetBodyRLP(db, hash, n)
+		if len(body) == 0 {
+			return 0, fmt.Errorf("body missing for block #%d [%x…], can't freeze", n, hash[:4])
+		}
+		receipts := GetBlockReceiptsRLP(db, hash, n)
+		if len(receipts) == 0 {
+			return 0, fmt.Errorf("receipts missing for block #%d [%x…], can't freeze", n, hash[:4])
+		}
+		td := GetTdRLP(db, hash, n)
+		if len(td) == 0 {
+			return 0, fmt.Errorf("total difficulty missing for block #%d [%x…], can't freeze", n, hash[:4])
+		}
+		if err := store.AppendAncient(n, hash[:], header, body, receipts, td); err != nil {
+			return 0, err
+		}
+		hashes = append(hashes, hash)
+	}
+	if err := store.Sync(); err != nil {
+		return 0, err
+	}
+	// Wipe the frozen blocks from the key-value store, along with the side chain
+	// blocks at the frozen heights which can never become canonical anymore. The
+	// hash to number mappings of the canonical blocks are retained as they're
+	// needed to look blocks up by hash. Should the process crash midway, leftover
+	// entries are shadowed by the ancient store.
+	batch := db.NewBatch()
+	for i, hash := range hashes {
+		n := frozen + uint64(i)
+
+		for _, side := range numberHashes(db, n) {
+			if side != hash {
+				DeleteBlock(batch, side, n)
+			}
+		}
+		DeleteCanonicalHash(batch, n)
+		batch.Delete(headerKey(hash, n))
+		DeleteBody(batch, hash, n)
+		DeleteBlockReceipts(batch, hash, n)
+		DeleteTd(batch, hash, n)
+	}
+	if err := batch.Write(); err != nil {
+		return 0, err
+	}
+	log.Info("Deep froze chain segment", "blocks", len(hashes), "from", frozen, "to", last, "elapsed", common.PrettyDuration(time.Since(start)))
+
+	return uint64(len(hashes)), nil
+}
+
+// numberHashes returns the hashes of all the headers stored with the given block
+// number in the key-value store of db.
+func numberHashes(db ethdb.Database, number uint64) []common.Hash {
+	prefix := append(headerPrefix, encodeBlockNumber(number)...)
+
+	it := ethdb.KeyValueStore(db).NewIterator(prefix, nil)
+	defer it.Release()
+
+	var hashes []common.Hash
+	for it.Next() {
+		if key := it.Key(); len(key) == len(prefix)+common.HashLength {
+			hashes = append(hashes, common.BytesToHash(key[len(prefix):]))
+		}
+	}
+	return hashes
+}
+
+// freeze is a background loop periodically moving the immutable segment of the
+// canonical chain into the ancient store, until the chain is stopped.
+func (bc *BlockChain) freeze() {
+	defer bc.wg.Done()
+
+	for {
+		bc.freezemu.Lock()
+		frozen, err := FreezeAncients(bc.chainDb, freezerBatchLimit)
+		bc.freezemu.Unlock()
+
+		if err != nil {
+			log.Error("Failed to freeze ancient blocks", "err", err)
+		}
+		// If a full batch was frozen, there might be more pending
+		if frozen < freezerBatchLimit {
+			select {
+			case <-bc.quit:
+				return
+			case <-time.After(freezerRecheckInterval):
+			}
+		} else {
+			select {
+			case <-bc.quit:
+				return
+			default:
+			}
+		}
+	}
+}
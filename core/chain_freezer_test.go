@@ -0,0 +1,100 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that freezing a chain segment moves its canonical blocks into the ancient
+// store and wipes both them and the side chain blocks at the same heights from
+// the key-value store.
+func TestFreezeAncients(t *testing.T) {
+	var (
+		gendb, _ = ethdb.NewMemDatabase()
+		kvdb, _  = ethdb.NewMemDatabase()
+		gspec    = &Genesis{Config: params.TestChainConfig}
+		genesis  = gspec.MustCommit(gendb)
+	)
+	gspec.MustCommit(kvdb)
+
+	blockchain, _ := NewBlockChain(kvdb, nil, gspec.Config, ethash.NewFaker(), vm.Config{})
+	canon, _ := GenerateChain(gspec.Config, genesis, gendb, 12, func(i int, b *BlockGen) {})
+	if _, err := blockchain.InsertChain(canon); err != nil {
+		t.Fatalf("failed to insert canonical chain: %v", err)
+	}
+	side, _ := GenerateChain(gspec.Config, canon[2], gendb, 3, func(i int, b *BlockGen) {
+		b.SetCoinbase(common.Address{0x01})
+	})
+	if _, err := blockchain.InsertChain(side); err != nil {
+		t.Fatalf("failed to insert side chain: %v", err)
+	}
+	blockchain.Stop()
+
+	dir, err := ioutil.TempDir("", "freezer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := ethdb.NewDatabaseWithFreezer(kvdb, dir, 4, false)
+	if err != nil {
+		t.Fatalf("failed to create freezer database: %v", err)
+	}
+	defer db.Freezer.Close()
+
+	// Blocks #0 - #8 are below the threshold, freeze them all
+	frozen, err := FreezeAncients(db, 100)
+	if err != nil {
+		t.Fatalf("failed to freeze ancients: %v", err)
+	}
+	if frozen != 9 {
+		t.Fatalf("frozen block count mismatch: have %d, want 9", frozen)
+	}
+	for _, block := range canon[:8] {
+		if hash := numberHashes(db, block.NumberU64()); len(hash) != 0 {
+			t.Errorf("block #%d: headers left in key-value store: %x", block.NumberU64(), hash)
+		}
+		if have := GetBlock(db, block.Hash(), block.NumberU64()); have == nil || have.Hash() != block.Hash() {
+			t.Errorf("block #%d: frozen block not retrievable", block.NumberU64())
+		}
+		if number := GetBlockNumber(db, block.Hash()); number != block.NumberU64() {
+			t.Errorf("block #%d: number mapping mismatch: have %d", block.NumberU64(), number)
+		}
+	}
+	for _, block := range side {
+		if number := GetBlockNumber(db, block.Hash()); number != missingNumber {
+			t.Errorf("side block #%d: number mapping left in key-value store", block.NumberU64())
+		}
+		if len(GetBodyRLP(kvdb, block.Hash(), block.NumberU64())) != 0 || GetTd(kvdb, block.Hash(), block.NumberU64()) != nil {
+			t.Errorf("side block #%d: data left in key-value store", block.NumberU64())
+		}
+	}
+	for _, block := range canon[8:] {
+		if hash := numberHashes(db, block.NumberU64()); len(hash) != 1 || hash[0] != block.Hash() {
+			t.Errorf("block #%d: unfrozen header mismatch: have %x, want %x", block.NumberU64(), hash, block.Hash())
+		}
+	}
+}
@@ -44,6 +44,8 @@ type BlockGen struct {
 	header  *types.Header
 	statedb *state.StateDB
 
+	getHeader func(common.Hash, uint64) *types.Header // Retrieves ancestors for the difficulty retarget
+
 	gasPool  *GasPool
 	txs      []*types.Transaction
 	receipts []*types.Receipt
@@ -140,7 +142,7 @@ func (b *BlockGen) OffsetTime(seconds int64) {
 	if b.header.Time.Cmp(b.parent.Header().Time) <= 0 {
 		panic("block time out of range")
 	}
-	b.header.Difficulty = ethash.CalcDifficulty(b.config, b.header.Time.Uint64(), b.parent.Header())
+	b.header.Difficulty = ethash.CalcNextDifficulty(b.config, b.header.Time.Uint64(), b.parent.Header(), b.getHeader)
 }
 
 // GenerateChain creates a chain of n blocks. The first block's
@@ -160,26 +162,38 @@ func GenerateChain(config *params.ChainConfig, parent *types.Block, db ethdb.Dat
 		config = params.TestChainConfig
 	}
 	blocks, receipts := make(types.Blocks, n), make([]types.Receipts, n)
+
+	// Ancestors are looked up among the generated blocks and their parent before
+	// the database
+	origin := parent
+	getHeader := func(hash common.Hash, number uint64) *types.Header {
+		for _, block := range append(blocks, origin) {
+			if block != nil && block.Hash() == hash {
+				return block.Header()
+			}
+		}
+		return GetHeader(db, hash, number)
+	}
 	genblock := func(i int, h *types.Header, statedb *state.StateDB) (*types.Block, types.Receipts) {
-		b := &BlockGen{parent: parent, i: i, chain: blocks, header: h, statedb: statedb, config: config}
+		b := &BlockGen{parent: parent, i: i, chain: blocks, header: h, statedb: statedb, config: config, getHeader: getHeader}
 		// Execute any user modifications to the block and finalize it
 		if gen != nil {
 			gen(i, b)
 		}
-		ethash.AccumulateRewards(statedb, h, b.uncles)
+		ethash.AccumulateRewards(config, statedb, h, b.uncles)
 		root, err := statedb.CommitTo(db, config.IsEIP158(h.Number))
 		if err != nil {
 			panic(fmt.Sprintf("state write error: %v", err))
 		}
 		h.Root = root
-		return types.NewBlock(h, b.txs, b.uncles, b.receipts), b.receipts
+		return ethash.NewBlock(config, h, b.txs, b.uncles, b.receipts), b.receipts
 	}
 	for i := 0; i < n; i++ {
 		statedb, err := state.New(parent.Root(), state.NewDatabase(db))
 		if err != nil {
 			panic(err)
 		}
-		header := makeHeader(config, parent, statedb)
+		header := makeHeader(config, parent, statedb, getHeader)
 		block, receipt := genblock(i, header, statedb)
 		blocks[i] = block
 		receipts[i] = receipt
@@ -188,28 +202,37 @@ func GenerateChain(config *params.ChainConfig, parent *types.Block, db ethdb.Dat
 	return blocks, receipts
 }
 
-func makeHeader(config *params.ChainConfig, parent *types.Block, state *state.StateDB) *types.Header {
+func makeHeader(config *params.ChainConfig, parent *types.Block, state *state.StateDB, getHeader func(common.Hash, uint64) *types.Header) *types.Header {
 	var time *big.Int
 	if parent.Time() == nil {
 		time = big.NewInt(10)
 	} else {
 		time = new(big.Int).Add(parent.Time(), big.NewInt(10)) // block time is fixed at 10 seconds
 	}
-
-	return &types.Header{
-		Root:       state.IntermediateRoot(config.IsEIP158(parent.Number())),
-		ParentHash: parent.Hash(),
-		Coinbase:   parent.Coinbase(),
-		Difficulty: ethash.CalcDifficulty(config, time.Uint64(), &types.Header{
+	// The retarget averages the actual ancestors, the legacy algorithm only needs
+	// the parent difficulty and the fixed block time
+	var difficulty *big.Int
+	if config.IsRetarget(new(big.Int).Add(parent.Number(), common.Big1)) {
+		if difficulty = ethash.CalcNextDifficulty(config, time.Uint64(), parent.Header(), getHeader); difficulty == nil {
+			panic(fmt.Sprintf("missing ancestors of block #%d", parent.Number()))
+		}
+	} else {
+		difficulty = ethash.CalcDifficulty(config, time.Uint64(), &types.Header{
 			Number:     parent.Number(),
 			Time:       new(big.Int).Sub(time, big.NewInt(10)),
 			Difficulty: parent.Difficulty(),
 			UncleHash:  parent.UncleHash(),
-		}),
-		GasLimit: CalcGasLimit(parent),
-		GasUsed:  new(big.Int),
-		Number:   new(big.Int).Add(parent.Number(), common.Big1),
-		Time:     time,
+		})
+	}
+	return &types.Header{
+		Root:       state.IntermediateRoot(config.IsEIP158(parent.Number())),
+		ParentHash: parent.Hash(),
+		Coinbase:   parent.Coinbase(),
+		Difficulty: difficulty,
+		GasLimit:   CalcGasLimit(parent),
+		GasUsed:    new(big.Int),
+		Number:     new(big.Int).Add(parent.Number(), common.Big1),
+		Time:       time,
 	}
 }
 
@@ -222,7 +245,7 @@ func newCanonical(n int, full bool) (ethdb.Database, *BlockChain, error) {
 	db, _ := ethdb.NewMemDatabase()
 	genesis := gspec.MustCommit(db)
 
-	blockchain, _ := NewBlockChain(db, params.AllProtocolChanges, ethash.NewFaker(), vm.Config{})
+	blockchain, _ := NewBlockChain(db, nil, params.AllProtocolChanges, ethash.NewFaker(), vm.Config{})
 	// Create and inject the requested chain
 	if n == 0 {
 		return db, blockchain, nil
@@ -0,0 +1,209 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/state/snapshot"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// DatabaseStat is the number and the total key and value size of the database
+// entries of a kind.
+type DatabaseStat struct {
+	Category string
+	Count    uint64
+	Size     common.StorageSize
+}
+
+// Database entry categories reported by InspectDatabase, in the order reported.
+var inspectCategories = []string{
+	"Headers",
+	"Total difficulties",
+	"Canonical hashes",
+	"Block number lookups",
+	"Bodies",
+	"Receipts",
+	"Transaction lookups",
+	"Bloombit sections",
+	"Bloombit index",
+	"Preimages",
+	"Snapshot accounts",
+	"Snapshot storage",
+	"Trie nodes and code",
+	"Metadata",
+	"Unaccounted",
+}
+
+// inspectCategory returns the index of the category of a database key. The key
+// layouts are the ones documented above the data item prefixes.
+func inspectCategory(key []byte) int {
+	switch {
+	case bytes.HasPrefix(key, headerPrefix) && len(key) == len(headerPrefix)+8+common.HashLength:
+		return 0
+	case bytes.HasPrefix(key, headerPrefix) && len(key) == len(headerPrefix)+8+common.HashLength+len(tdSuffix) && bytes.HasSuffix(key, tdSuffix):
+		return 1
+	case bytes.HasPrefix(key, headerPrefix) && len(key) == len(headerPrefix)+8+len(numSuffix) && bytes.HasSuffix(key, numSuffix):
+		return 2
+	case bytes.HasPrefix(key, blockHashPrefix) && len(key) == len(blockHashPrefix)+common.HashLength:
+		return 3
+	case bytes.HasPrefix(key, bodyPrefix) && len(key) == len(bodyPrefix)+8+common.HashLength:
+		return 4
+	case bytes.HasPrefix(key, blockReceiptsPrefix) && len(key) == len(blockReceiptsPrefix)+8+common.HashLength:
+		return 5
+	case bytes.HasPrefix(key, lookupPrefix) && len(key) == len(lookupPrefix)+common.HashLength:
+		return 6
+	case bytes.HasPrefix(key, bloomBitsPrefix) && len(key) == len(bloomBitsPrefix)+2+8+common.HashLength:
+		return 7
+	case bytes.HasPrefix(key, BloomBitsIndexPrefix):
+		return 8
+	case bytes.HasPrefix(key, []byte(preimagePrefix)) && len(key) == len(preimagePrefix)+common.HashLength:
+		return 9
+	case snapshot.IsAccountKey(key):
+		return 10
+	case snapshot.IsStorageKey(key):
+		return 11
+	case len(key) == common.HashLength:
+		return 12
+	case len(key) < common.HashLength || bytes.HasPrefix(key, configPrefix):
+		return 13
+	}
+	return 14
+}
+
+// InspectDatabase iterates over the entire key-value store of a chain database,
+// tallying its entries by category, followed by the tables of the ancient store
+// if the database has one. Short keys not belonging to any data item are taken
+// for metadata, such as the head pointers and the database version.
+func InspectDatabase(db ethdb.Database) ([]*DatabaseStat, error) {
+	stats := make([]*DatabaseStat, len(inspectCategories))
+	for i, category := range inspectCategories {
+		stats[i] = &DatabaseStat{Category: category}
+	}
+	it := ethdb.KeyValueStore(db).NewIterator(nil, nil)
+	defer it.Release()
+
+	for it.Next() {
+		stat := stats[inspectCategory(it.Key())]
+		stat.Count++
+		stat.Size += common.StorageSize(len(it.Key()) + len(it.Value()))
+	}
+	if err := it.Error(); err != nil {
+		return nil, err
+	}
+	if store, ok := db.(ethdb.AncientStore); ok {
+		frozen, err := store.Ancients()
+		if err != nil {
+			return nil, err
+		}
+		for _, kind := range ethdb.FreezerTables {
+			size, err := store.AncientSize(kind)
+			if err != nil {
+				return nil, err
+			}
+			stats = append(stats, &DatabaseStat{Category: "Ancient " + kind, Count: frozen, Size: common.StorageSize(size)})
+		}
+	}
+	return stats, nil
+}
+
+var (
+	// errNoHead is returned by RepairHead if neither the head block nor the head
+	// header is known.
+	errNoHead = errors.New("neither the head block nor the head header is known")
+
+	// errNoCompleteBlock is returned by RepairHead if no canonical block has both
+	// its data and its state present.
+	errNoCompleteBlock = errors.New("no block with complete data and state found")
+)
+
+// hasStateRoot reports whether the state trie with the given root is present in
+// the database along with all the children of its root node. Walking the whole
+// trie would take hours on a large state, while a pruned or partially synced
+// state almost always misses some nodes right below the root as well.
+func hasStateRoot(db ethdb.Database, root common.Hash) bool {
+	tr, err := state.NewDatabase(db).OpenTrie(root)
+	if err != nil {
+		return false
+	}
+	it := tr.NodeIterator(nil)
+	for it.Next(len(it.Path()) == 0) {
+	}
+	return it.Error() == nil
+}
+
+// RepairHead rewinds the head block of a chain database to the highest canonical
+// block with its data and state present, walking back from the head block, or
+// from the head header if the former is gone. The head header and the fast-sync
+// head are moved down too if they point to missing blocks. It returns the new
+// head block and whether it had to be moved.
+func RepairHead(db ethdb.Database) (*types.Block, bool, error) {
+	// Start from the head block, or the head header if the former is gone
+	head := GetHeadBlockHash(db)
+	number := GetBlockNumber(db, head)
+	if number == missingNumber {
+		head = GetHeadHeaderHash(db)
+		if number = GetBlockNumber(db, head); number == missingNumber {
+			return nil, false, errNoHead
+		}
+		log.Warn("Head block missing, starting from head header", "number", number, "hash", head)
+	}
+	// Walk back along the canonical chain until a complete block is found
+	var (
+		hash  = head
+		block *types.Block
+	)
+	for {
+		if block = GetBlock(db, hash, number); block != nil {
+			if hasStateRoot(db, block.Root()) {
+				break
+			}
+			log.Warn("Block state missing", "number", number, "hash", hash, "root", block.Root())
+		} else {
+			log.Warn("Block data missing", "number", number, "hash", hash)
+		}
+		if number == 0 {
+			return nil, false, errNoCompleteBlock
+		}
+		number--
+		hash = GetCanonicalHash(db, number)
+	}
+	if hash == GetHeadBlockHash(db) {
+		return block, false, nil
+	}
+	if err := WriteHeadBlockHash(db, hash); err != nil {
+		return nil, false, err
+	}
+	// Move the other head pointers down as well if they're broken
+	if header := GetHeadHeaderHash(db); GetHeader(db, header, GetBlockNumber(db, header)) == nil {
+		if err := WriteHeadHeaderHash(db, hash); err != nil {
+			return nil, false, err
+		}
+	}
+	if fast := GetHeadFastBlockHash(db); GetBlock(db, fast, GetBlockNumber(db, fast)) == nil {
+		if err := WriteHeadFastBlockHash(db, hash); err != nil {
+			return nil, false, err
+		}
+	}
+	return block, true, nil
+}
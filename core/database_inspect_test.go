@@ -0,0 +1,165 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that the database inspection tallies the entries by category, including
+// the tables of the ancient store.
+func TestInspectDatabase(t *testing.T) {
+	dir, err := ioutil.TempDir("", "inspect")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	memdb, _ := ethdb.NewMemDatabase()
+	db, err := ethdb.NewDatabaseWithFreezer(memdb, dir, 90000, true)
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	(&Genesis{Config: params.TestChainConfig, Alloc: GenesisAlloc{common.Address{0x01}: {Balance: big.NewInt(1)}}}).MustCommit(db)
+	db.Put([]byte("unaccounted-key-of-no-known-layout"), []byte{0x01})
+	if err := db.AppendAncient(0, []byte{0x01}, []byte{0x02}, []byte{0x03}, []byte{0x04}, []byte{0x05}); err != nil {
+		t.Fatalf("failed to append ancient block: %v", err)
+	}
+	stats, err := InspectDatabase(db)
+	if err != nil {
+		t.Fatalf("failed to inspect database: %v", err)
+	}
+	if len(stats) != len(inspectCategories)+len(ethdb.FreezerTables) {
+		t.Fatalf("category count mismatch: have %d, want %d", len(stats), len(inspectCategories)+len(ethdb.FreezerTables))
+	}
+	counts := make(map[string]uint64)
+	for _, stat := range stats {
+		counts[stat.Category] = stat.Count
+		if stat.Count > 0 && stat.Size == 0 {
+			t.Errorf("%s: entries without size", stat.Category)
+		}
+	}
+	for _, category := range []string{"Headers", "Total difficulties", "Canonical hashes", "Block number lookups", "Bodies", "Receipts", "Unaccounted"} {
+		if counts[category] != 1 {
+			t.Errorf("%s: count mismatch: have %d, want 1", category, counts[category])
+		}
+	}
+	for _, category := range []string{"Trie nodes and code", "Metadata"} {
+		if counts[category] == 0 {
+			t.Errorf("%s: no entries counted", category)
+		}
+	}
+	for _, kind := range ethdb.FreezerTables {
+		if counts["Ancient "+kind] != 1 {
+			t.Errorf("ancient %s: count mismatch: have %d, want 1", kind, counts["Ancient "+kind])
+		}
+	}
+}
+
+// rootChildren returns the hashes of the nodes right below the root of a state
+// trie.
+func rootChildren(t *testing.T, db ethdb.Database, root common.Hash) map[common.Hash]bool {
+	tr, err := state.NewDatabase(db).OpenTrie(root)
+	if err != nil {
+		t.Fatalf("failed to open state trie: %v", err)
+	}
+	children := make(map[common.Hash]bool)
+	for it := tr.NodeIterator(nil); it.Next(len(it.Path()) == 0); {
+		if it.Parent() == root && it.Hash() != (common.Hash{}) {
+			children[it.Hash()] = true
+		}
+	}
+	return children
+}
+
+// Tests that repairing the head block rewinds it past blocks with missing data
+// or with a state trie missing nodes below its root.
+func TestRepairHead(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	gspec := &Genesis{Config: params.TestChainConfig, Alloc: make(GenesisAlloc)}
+	for i := 0; i < 64; i++ {
+		gspec.Alloc[common.BigToAddress(big.NewInt(int64(i+1)))] = GenesisAccount{Balance: big.NewInt(1)}
+	}
+	genesis := gspec.MustCommit(db)
+
+	blockchain, _ := NewBlockChain(db, &CacheConfig{Disabled: true}, gspec.Config, ethash.NewFaker(), vm.Config{})
+	blocks, _ := GenerateChain(gspec.Config, genesis, db, 4, func(i int, b *BlockGen) {})
+	if _, err := blockchain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	blockchain.Stop()
+
+	head, repaired, err := RepairHead(db)
+	if err != nil || repaired || head.Hash() != blocks[3].Hash() {
+		t.Fatalf("intact head repaired: have #%d, %v, %v", head.NumberU64(), repaired, err)
+	}
+	// Drop a state trie node right below the root of the head block only
+	var (
+		parents = rootChildren(t, db, blocks[2].Root())
+		dropped bool
+	)
+	for hash := range rootChildren(t, db, blocks[3].Root()) {
+		if !parents[hash] {
+			db.Delete(hash[:])
+			dropped = true
+			break
+		}
+	}
+	if !dropped {
+		t.Fatalf("no state trie node unique to the head block")
+	}
+	if _, err := state.New(blocks[3].Root(), state.NewDatabase(db)); err != nil {
+		t.Fatalf("state root node missing: %v", err)
+	}
+	if head, repaired, err = RepairHead(db); err != nil || !repaired || head.Hash() != blocks[2].Hash() {
+		t.Fatalf("incomplete state not repaired: have #%d, %v, %v", head.NumberU64(), repaired, err)
+	}
+	if hash := GetHeadBlockHash(db); hash != blocks[2].Hash() {
+		t.Errorf("head block mismatch: have %x, want %x", hash, blocks[2].Hash())
+	}
+	// Drop the body of the new head block and the head header along with it
+	DeleteBody(db, blocks[2].Hash(), blocks[2].NumberU64())
+	DeleteHeader(db, blocks[3].Hash(), blocks[3].NumberU64())
+
+	if head, repaired, err = RepairHead(db); err != nil || !repaired || head.Hash() != blocks[1].Hash() {
+		t.Fatalf("missing body not repaired: have #%d, %v, %v", head.NumberU64(), repaired, err)
+	}
+	if hash := GetHeadHeaderHash(db); hash != blocks[1].Hash() {
+		t.Errorf("head header mismatch: have %x, want %x", hash, blocks[1].Hash())
+	}
+	if hash := GetHeadFastBlockHash(db); hash != blocks[1].Hash() {
+		t.Errorf("fast-sync head mismatch: have %x, want %x", hash, blocks[1].Hash())
+	}
+	// Without any head pointer nothing can be repaired
+	db.Delete(headBlockKey)
+	db.Delete(headHeaderKey)
+	if _, _, err = RepairHead(db); err != errNoHead {
+		t.Errorf("error mismatch: have %v, want %v", err, errNoHead)
+	}
+}
@@ -48,6 +48,8 @@ var (
 	headBlockKey  = []byte("LastBlock")
 	headFastKey   = []byte("LastFast")
 
+	txIndexTailKey = []byte("TransactionIndexTail") // Number of the oldest block whose transactions are indexed
+
 	// Data item prefixes (use single byte to avoid mixing data types, avoid `i`).
 	headerPrefix        = []byte("h") // headerPrefix + num (uint64 big endian) + hash -> header
 	tdSuffix            = []byte("t") // headerPrefix + num (uint64 big endian) + hash + tdSuffix -> td
@@ -89,9 +91,36 @@ func encodeBlockNumber(number uint64) []byte {
 	return enc
 }
 
+// readAncient retrieves a blob of a frozen canonical block number from the
+// ancient store backing db, nil if db has no ancient store or the block isn't
+// frozen.
+func readAncient(db DatabaseReader, kind string, number uint64) []byte {
+	store, ok := db.(ethdb.AncientReader)
+	if !ok {
+		return nil
+	}
+	if frozen, _ := store.Ancients(); number >= frozen {
+		return nil
+	}
+	data, _ := store.Ancient(kind, number)
+	return data
+}
+
+// readFrozen retrieves a blob of the block with the given hash and number from
+// the ancient store backing db, nil if the block isn't the frozen canonical one.
+func readFrozen(db DatabaseReader, kind string, hash common.Hash, number uint64) []byte {
+	if data := readAncient(db, ethdb.FreezerHashTable, number); common.BytesToHash(data) != hash {
+		return nil
+	}
+	return readAncient(db, kind, number)
+}
+
 // GetCanonicalHash retrieves a hash assigned to a canonical block number.
 func GetCanonicalHash(db DatabaseReader, number uint64) common.Hash {
-	data, _ := db.Get(append(append(headerPrefix, encodeBlockNumber(number)...), numSuffix...))
+	data := readAncient(db, ethdb.FreezerHashTable, number)
+	if len(data) == 0 {
+		data, _ = db.Get(append(append(headerPrefix, encodeBlockNumber(number)...), numSuffix...))
+	}
 	if len(data) == 0 {
 		return common.Hash{}
 	}
@@ -146,13 +175,36 @@ func GetHeadFastBlockHash(db DatabaseReader) common.Hash {
 	return common.BytesToHash(data)
 }
 
+// GetTxIndexTail retrieves the number of the oldest block whose transaction
+// lookup entries are maintained, nil if the index was never tracked.
+func GetTxIndexTail(db DatabaseReader) *uint64 {
+	data, _ := db.Get(txIndexTailKey)
+	if len(data) != 8 {
+		return nil
+	}
+	number := binary.BigEndian.Uint64(data)
+	return &number
+}
+
 // GetHeaderRLP retrieves a block header in its raw RLP database encoding, or nil
 // if the header's not found.
 func GetHeaderRLP(db DatabaseReader, hash common.Hash, number uint64) rlp.RawValue {
+	if data := readFrozen(db, ethdb.FreezerHeaderTable, hash, number); len(data) > 0 {
+		return data
+	}
 	data, _ := db.Get(headerKey(hash, number))
 	return data
 }
 
+// HasHeader verifies the existence of a block header corresponding to the hash.
+func HasHeader(db ethdb.Database, hash common.Hash, number uint64) bool {
+	if data := readFrozen(db, ethdb.FreezerHashTable, hash, number); len(data) > 0 {
+		return true
+	}
+	ok, _ := db.Has(headerKey(hash, number))
+	return ok
+}
+
 // GetHeader retrieves the block header corresponding to the hash, nil if none
 // found.
 func GetHeader(db DatabaseReader, hash common.Hash, number uint64) *types.Header {
@@ -170,10 +222,22 @@ func GetHeader(db DatabaseReader, hash common.Hash, number uint64) *types.Header
 
 // GetBodyRLP retrieves the block body (transactions and uncles) in RLP encoding.
 func GetBodyRLP(db DatabaseReader, hash common.Hash, number uint64) rlp.RawValue {
+	if data := readFrozen(db, ethdb.FreezerBodiesTable, hash, number); len(data) > 0 {
+		return data
+	}
 	data, _ := db.Get(blockBodyKey(hash, number))
 	return data
 }
 
+// HasBody verifies the existence of a block body corresponding to the hash.
+func HasBody(db ethdb.Database, hash common.Hash, number uint64) bool {
+	if data := readFrozen(db, ethdb.FreezerHashTable, hash, number); len(data) > 0 {
+		return true
+	}
+	ok, _ := db.Has(blockBodyKey(hash, number))
+	return ok
+}
+
 func headerKey(hash common.Hash, number uint64) []byte {
 	return append(append(headerPrefix, encodeBlockNumber(number)...), hash.Bytes()...)
 }
@@ -200,7 +264,7 @@ func GetBody(db DatabaseReader, hash common.Hash, number uint64) *types.Body {
 // GetTd retrieves a block's total difficulty corresponding to the hash, nil if
 // none found.
 func GetTd(db DatabaseReader, hash common.Hash, number uint64) *big.Int {
-	data, _ := db.Get(append(append(append(headerPrefix, encodeBlockNumber(number)...), hash[:]...), tdSuffix...))
+	data := GetTdRLP(db, hash, number)
 	if len(data) == 0 {
 		return nil
 	}
@@ -235,7 +299,7 @@ func GetBlock(db DatabaseReader, hash common.Hash, number uint64) *types.Block {
 // GetBlockReceipts retrieves the receipts generated by the transactions included
 // in a block given by its hash.
 func GetBlockReceipts(db DatabaseReader, hash common.Hash, number uint64) types.Receipts {
-	data, _ := db.Get(append(append(blockReceiptsPrefix, encodeBlockNumber(number)...), hash[:]...))
+	data := GetBlockReceiptsRLP(db, hash, number)
 	if len(data) == 0 {
 		return nil
 	}
@@ -251,6 +315,26 @@ func GetBlockReceipts(db DatabaseReader, hash common.Hash, number uint64) types.
 	return receipts
 }
 
+// GetBlockReceiptsRLP retrieves the receipts of a block in their raw RLP storage
+// encoding, or nil if the receipts are not found.
+func GetBlockReceiptsRLP(db DatabaseReader, hash common.Hash, number uint64) rlp.RawValue {
+	if data := readFrozen(db, ethdb.FreezerReceiptTable, hash, number); len(data) > 0 {
+		return data
+	}
+	data, _ := db.Get(append(append(blockReceiptsPrefix, encodeBlockNumber(number)...), hash[:]...))
+	return data
+}
+
+// GetTdRLP retrieves the total difficulty of a block in its raw RLP database
+// encoding, or nil if it's not found.
+func GetTdRLP(db DatabaseReader, hash common.Hash, number uint64) rlp.RawValue {
+	if data := readFrozen(db, ethdb.FreezerDifficultyTable, hash, number); len(data) > 0 {
+		return data
+	}
+	data, _ := db.Get(append(append(append(headerPrefix, encodeBlockNumber(number)...), hash[:]...), tdSuffix...))
+	return data
+}
+
 // GetTxLookupEntry retrieves the positional metadata associated with a transaction
 // hash to allow retrieving the transaction or receipt by hash.
 func GetTxLookupEntry(db DatabaseReader, hash common.Hash) (common.Hash, uint64, uint64) {
@@ -375,6 +459,15 @@ func WriteHeadFastBlockHash(db ethdb.Putter, hash common.Hash) error {
 	return nil
 }
 
+// WriteTxIndexTail stores the number of the oldest block whose transaction
+// lookup entries are maintained.
+func WriteTxIndexTail(db ethdb.Putter, number uint64) error {
+	if err := db.Put(txIndexTailKey, encodeBlockNumber(number)); err != nil {
+		log.Crit("Failed to store transaction index tail", "err", err)
+	}
+	return nil
+}
+
 // WriteHeader serializes a block header into the database.
 func WriteHeader(db ethdb.Putter, header *types.Header) error {
 	data, err := rlp.EncodeToBytes(header)
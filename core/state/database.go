@@ -21,7 +21,9 @@ import (
 	"sync"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state/snapshot"
 	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/ethereum/go-ethereum/trie"
 	lru "github.com/hashicorp/golang-lru"
 )
@@ -50,6 +52,12 @@ type Database interface {
 	ContractCodeSize(addrHash, codeHash common.Hash) (int, error)
 	// CopyTrie returns an independent copy of the given trie.
 	CopyTrie(Trie) Trie
+	// NodeCache retrieves the trie node cache in front of the disk database,
+	// or nil if tries are accessed some other way.
+	NodeCache() *trie.NodeCache
+	// Snapshots retrieves the flat state snapshot tree accounts and storage are
+	// read through, or nil if reads always go to the tries.
+	Snapshots() *snapshot.Tree
 }
 
 // Trie is a Ethereum Merkle Trie.
@@ -58,20 +66,32 @@ type Trie interface {
 	TryUpdate(key, value []byte) error
 	TryDelete(key []byte) error
 	CommitTo(trie.DatabaseWriter) (common.Hash, error)
+	CommitToWithCallback(trie.DatabaseWriter, trie.LeafCallback) (common.Hash, error)
 	Hash() common.Hash
 	NodeIterator(startKey []byte) trie.NodeIterator
+	Prove(key []byte) ([]rlp.RawValue, error)
 	GetKey([]byte) []byte // TODO(fjl): remove this when SecureTrie is removed
 }
 
 // NewDatabase creates a backing store for state. The returned database is safe for
-// concurrent use and retains cached trie nodes in memory.
+// concurrent use and retains cached trie nodes in memory. Tries are read through
+// a trie node cache, which only holds nodes committed to it.
 func NewDatabase(db ethdb.Database) Database {
 	csc, _ := lru.New(codeSizeCacheSize)
-	return &cachingDB{db: db, codeSizeCache: csc}
+	return &cachingDB{db: trie.NewNodeCache(db), codeSizeCache: csc}
+}
+
+// NewDatabaseWithSnapshots creates a backing store for state on top of an
+// existing trie node cache, reading accounts and storage from the given state
+// snapshot tree whenever it covers the requested state.
+func NewDatabaseWithSnapshots(cache *trie.NodeCache, snaps *snapshot.Tree) Database {
+	csc, _ := lru.New(codeSizeCacheSize)
+	return &cachingDB{db: cache, snaps: snaps, codeSizeCache: csc}
 }
 
 type cachingDB struct {
-	db            ethdb.Database
+	db            *trie.NodeCache
+	snaps         *snapshot.Tree
 	mu            sync.Mutex
 	pastTries     []*trie.SecureTrie
 	codeSizeCache *lru.Cache
@@ -120,6 +140,14 @@ func (db *cachingDB) CopyTrie(t Trie) Trie {
 	}
 }
 
+func (db *cachingDB) NodeCache() *trie.NodeCache {
+	return db.db
+}
+
+func (db *cachingDB) Snapshots() *snapshot.Tree {
+	return db.snaps
+}
+
 func (db *cachingDB) ContractCode(addrHash, codeHash common.Hash) ([]byte, error) {
 	code, err := db.db.Get(codeHash[:])
 	if err == nil {
@@ -146,7 +174,11 @@ type cachedTrie struct {
 }
 
 func (m cachedTrie) CommitTo(dbw trie.DatabaseWriter) (common.Hash, error) {
-	root, err := m.SecureTrie.CommitTo(dbw)
+	return m.CommitToWithCallback(dbw, nil)
+}
+
+func (m cachedTrie) CommitToWithCallback(dbw trie.DatabaseWriter, onleaf trie.LeafCallback) (common.Hash, error) {
+	root, err := m.SecureTrie.CommitToWithCallback(dbw, onleaf)
 	if err == nil {
 		m.db.pushTrie(m.SecureTrie)
 	}
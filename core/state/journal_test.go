@@ -0,0 +1,69 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state/snapshot"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// Tests that reverting the recreation of an account also reverts the wipe of its
+// flat state snapshot entries, while keeping an earlier wipe.
+func TestSnapshotDestructRevert(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	addr := common.BytesToAddress([]byte{0x01})
+
+	state, _ := New(common.Hash{}, NewDatabase(db))
+	state.SetNonce(addr, 1)
+	root, err := state.CommitTo(db, false)
+	if err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	cache := trie.NewNodeCache(db)
+	snaps, err := snapshot.New(db, cache, root)
+	if err != nil {
+		t.Fatalf("failed to create snapshot tree: %v", err)
+	}
+	defer snaps.Close()
+
+	if state, err = New(root, NewDatabaseWithSnapshots(cache, snaps)); err != nil {
+		t.Fatalf("failed to open state: %v", err)
+	}
+	addrHash := crypto.Keccak256Hash(addr[:])
+
+	revision := state.Snapshot()
+	state.CreateAccount(addr)
+	if _, ok := state.snapDestructs[addrHash]; !ok {
+		t.Fatalf("recreated account not wiped in the snapshot")
+	}
+	state.RevertToSnapshot(revision)
+	if _, ok := state.snapDestructs[addrHash]; ok {
+		t.Fatalf("reverted account recreation still wipes the snapshot")
+	}
+	state.CreateAccount(addr)
+	revision = state.Snapshot()
+	state.CreateAccount(addr)
+	state.RevertToSnapshot(revision)
+	if _, ok := state.snapDestructs[addrHash]; !ok {
+		t.Fatalf("earlier account recreation lost by a revert")
+	}
+}
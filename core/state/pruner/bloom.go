@@ -0,0 +1,113 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package pruner
+
+import (
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"os"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// stateBloomHashes is the number of bits set in the filter per hash. The hashes
+// are split into this many 8 byte words, each selecting a bit.
+const stateBloomHashes = common.HashLength / 8
+
+// errBloomCorrupted is returned if a persisted state bloom fails to load.
+var errBloomCorrupted = errors.New("state bloom corrupted")
+
+// stateBloom is a bloom filter over the hashes of the trie nodes and contract
+// codes to retain. The keys being cryptographic hashes already, the bits are
+// taken straight from the key instead of hashing it again.
+//
+// False positives only cause some garbage to be kept, but there are no false
+// negatives, so nothing marked is ever deleted.
+type stateBloom struct {
+	bits []byte
+}
+
+// newStateBloom creates an empty state bloom of the given size in bytes.
+func newStateBloom(size uint64) *stateBloom {
+	if size < 1 {
+		size = 1
+	}
+	return &stateBloom{bits: make([]byte, size)}
+}
+
+// loadStateBloom reads a state bloom persisted by commit.
+func loadStateBloom(path string) (*stateBloom, error) {
+	blob, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(blob) <= 8 || binary.BigEndian.Uint64(blob) != uint64(len(blob)-8) {
+		return nil, errBloomCorrupted
+	}
+	return &stateBloom{bits: blob[8:]}, nil
+}
+
+// add marks a hash in the filter.
+func (b *stateBloom) add(hash []byte) {
+	size := uint64(len(b.bits)) * 8
+	for i := 0; i < stateBloomHashes; i++ {
+		bit := binary.BigEndian.Uint64(hash[i*8:]) % size
+		b.bits[bit/8] |= 1 << (bit % 8)
+	}
+}
+
+// contains returns whether a hash may have been marked in the filter.
+func (b *stateBloom) contains(hash []byte) bool {
+	size := uint64(len(b.bits)) * 8
+	for i := 0; i < stateBloomHashes; i++ {
+		bit := binary.BigEndian.Uint64(hash[i*8:]) % size
+		if b.bits[bit/8]&(1<<(bit%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// commit persists the filter to disk, prefixed with its size. The filter is
+// written to a temporary file first and moved into place once synced, so the
+// file at the path is either complete or missing.
+func (b *stateBloom) commit(path string) error {
+	tmp := path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	var size [8]byte
+	binary.BigEndian.PutUint64(size[:], uint64(len(b.bits)))
+	if _, err := file.Write(size[:]); err != nil {
+		file.Close()
+		return err
+	}
+	if _, err := file.Write(b.bits); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
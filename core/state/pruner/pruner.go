@@ -0,0 +1,223 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package pruner implements offline pruning of the state tries in a database.
+package pruner
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// stateBloomName is the file in the data directory the state bloom of a pruning
+// run is persisted into. Its presence signals that the pruning was interrupted
+// after the retained state was marked, and the deletion needs to be completed.
+const stateBloomName = "statebloom.bf"
+
+// Pruner deletes all the trie nodes and contract codes from a database which are
+// not reachable from a set of state roots to retain. It runs in two phases:
+//
+//   - The retained states are iterated in full and all their trie node and code
+//     hashes are marked in a bloom filter, which is then persisted to disk.
+//   - The entire database is iterated and every entry with the key layout of a
+//     trie node or code (a plain 32 byte hash) that's not in the filter is
+//     deleted. The persisted filter is removed once done.
+//
+// Nothing is deleted before the filter is persisted, and the deletion depends on
+// nothing but the filter, so an interrupted run is completed by redoing the
+// deletion with the persisted filter. This must happen before the database is
+// used again, since any newly written trie nodes are absent from the filter.
+type Pruner struct {
+	db        ethdb.Database // Database to prune
+	datadir   string         // Directory to persist the state bloom into
+	bloomSize uint64         // Size of the state bloom in bytes
+}
+
+// NewPruner creates a pruner for a database, allocating a state bloom of the given
+// size in bytes and persisting it into the given directory.
+func NewPruner(db ethdb.Database, datadir string, bloomSize uint64) (*Pruner, error) {
+	if datadir == "" {
+		return nil, errors.New("state pruning needs a data directory")
+	}
+	return &Pruner{
+		db:        db,
+		datadir:   datadir,
+		bloomSize: bloomSize,
+	}, nil
+}
+
+// Prune deletes all the trie nodes and contract codes not reachable from the
+// given state roots. If a previous run was interrupted, it is completed instead
+// and the given roots are ignored.
+func (p *Pruner) Prune(roots []common.Hash) error {
+	path := filepath.Join(p.datadir, stateBloomName)
+	if _, err := os.Stat(path); err == nil {
+		log.Warn("Completing interrupted state pruning, ignoring the requested states")
+		return RecoverPruning(p.datadir, p.db)
+	}
+	if len(roots) == 0 {
+		return errors.New("no state to retain")
+	}
+	start := time.Now()
+
+	bloom := newStateBloom(p.bloomSize)
+	for _, root := range roots {
+		if err := markState(p.db, bloom, root); err != nil {
+			return err
+		}
+	}
+	if err := bloom.commit(path); err != nil {
+		return err
+	}
+	log.Info("Persisted state bloom", "roots", len(roots), "bloom", common.StorageSize(len(bloom.bits)), "elapsed", common.PrettyDuration(time.Since(start)))
+
+	return sweep(p.db, bloom, path)
+}
+
+// RecoverPruning completes an interrupted pruning run if the data directory has
+// a persisted state bloom left, and is a no-op otherwise. It needs to be called
+// before the database is opened for use.
+func RecoverPruning(datadir string, db ethdb.Database) error {
+	if datadir == "" {
+		return nil
+	}
+	path := filepath.Join(datadir, stateBloomName)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+	bloom, err := loadStateBloom(path)
+	if err != nil {
+		return err
+	}
+	log.Info("Loaded interrupted state pruning", "bloom", common.StorageSize(len(bloom.bits)))
+	return sweep(db, bloom, path)
+}
+
+// markState iterates over the state with the given root, including the storage
+// tries and contract codes, marking the hash of every standalone entry.
+func markState(db ethdb.Database, bloom *stateBloom, root common.Hash) error {
+	statedb, err := state.New(root, state.NewDatabase(db))
+	if err != nil {
+		return err
+	}
+	var (
+		nodes  int
+		start  = time.Now()
+		logged = time.Now()
+	)
+	it := state.NewNodeIterator(statedb)
+	for it.Next() {
+		if it.Hash != (common.Hash{}) {
+			bloom.add(it.Hash[:])
+			nodes++
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Marking retained state", "root", root, "nodes", nodes, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	if it.Error != nil {
+		return it.Error
+	}
+	log.Info("Marked retained state", "root", root, "nodes", nodes, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// sweep deletes every trie node and code from the database that's not marked in
+// the state bloom, removes the persisted bloom and compacts the database.
+func sweep(db ethdb.Database, bloom *stateBloom, path string) error {
+	var (
+		kvdb    = ethdb.KeyValueStore(db)
+		batch   = kvdb.NewBatch()
+		deleted int
+		size    common.StorageSize
+		start   = time.Now()
+		logged  = time.Now()
+	)
+	it := kvdb.NewIterator(nil, nil)
+	for it.Next() {
+		key := it.Key()
+		if len(key) != common.HashLength {
+			continue
+		}
+		if !bloom.contains(key) {
+			batch.Delete(common.CopyBytes(key))
+			deleted++
+			size += common.StorageSize(len(key) + len(it.Value()))
+
+			if batch.ValueSize() >= ethdb.IdealBatchSize {
+				if err := batch.Write(); err != nil {
+					it.Release()
+					return err
+				}
+				batch.Reset()
+			}
+		}
+		if time.Since(logged) > 8*time.Second {
+			// The hashes are uniformly distributed, so their position in the key
+			// space approximates the progress
+			var (
+				done = float64(binary.BigEndian.Uint64(key[:8])) / math.MaxUint64
+				eta  time.Duration
+			)
+			if done > 0 {
+				eta = time.Duration(float64(time.Since(start)) / done * (1 - done))
+			}
+			log.Info("Pruning state data", "deleted", deleted, "size", size, "at", common.ToHex(key[:4]), "elapsed", common.PrettyDuration(time.Since(start)), "eta", common.PrettyDuration(eta))
+			logged = time.Now()
+		}
+	}
+	err := it.Error()
+	it.Release()
+	if err != nil {
+		return err
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	log.Info("Pruned state data", "deleted", deleted, "size", size, "elapsed", common.PrettyDuration(time.Since(start)))
+
+	// Compact the deleted entries away, in chunks to report progress
+	compactStart := time.Now()
+	for b := 0x00; b < 0x100; b += 0x10 {
+		var (
+			from = []byte{byte(b)}
+			to   = []byte{byte(b + 0x10)}
+		)
+		if b+0x10 == 0x100 {
+			to = nil
+		}
+		log.Info("Compacting database", "range", fmt.Sprintf("0x%0.2X-0x%0.2X", b, b+0x0F), "elapsed", common.PrettyDuration(time.Since(compactStart)))
+		if err := kvdb.Compact(from, to); err != nil {
+			return err
+		}
+	}
+	log.Info("Compacted database", "elapsed", common.PrettyDuration(time.Since(compactStart)))
+	return nil
+}
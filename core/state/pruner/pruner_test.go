@@ -0,0 +1,232 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package pruner
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// makeStates commits a sequence of states into a database, each modifying the
+// balances, storage and code of some accounts of the previous one, returning
+// their roots.
+func makeStates(t *testing.T, db ethdb.Database, count int) []common.Hash {
+	var (
+		roots []common.Hash
+		root  common.Hash
+	)
+	for i := 0; i < count; i++ {
+		statedb, err := state.New(root, state.NewDatabase(db))
+		if err != nil {
+			t.Fatalf("failed to open state %d: %v", i, err)
+		}
+		for j := 0; j < 50; j++ {
+			addr := common.BigToAddress(big.NewInt(int64(j)))
+			if (i+j)%3 == 0 {
+				statedb.SetBalance(addr, big.NewInt(int64(i*100+j)), big.NewInt(int64(i)), big.NewInt(0))
+			}
+			if j%5 == 0 {
+				statedb.SetState(addr, common.BigToHash(big.NewInt(int64(i%4))), common.BigToHash(big.NewInt(int64(i*100+j+1))))
+			}
+			if j%10 == 0 {
+				statedb.SetCode(addr, []byte{byte(i), byte(j), 0x60, 0x00})
+			}
+		}
+		if root, err = statedb.CommitTo(db, false); err != nil {
+			t.Fatalf("failed to commit state %d: %v", i, err)
+		}
+		roots = append(roots, root)
+	}
+	return roots
+}
+
+// stateHashes collects the hashes of all the trie nodes and codes of a state.
+func stateHashes(t *testing.T, db ethdb.Database, root common.Hash) map[common.Hash]bool {
+	statedb, err := state.New(root, state.NewDatabase(db))
+	if err != nil {
+		t.Fatalf("failed to open state %x: %v", root, err)
+	}
+	hashes := make(map[common.Hash]bool)
+	it := state.NewNodeIterator(statedb)
+	for it.Next() {
+		if it.Hash != (common.Hash{}) {
+			hashes[it.Hash] = true
+		}
+	}
+	if it.Error != nil {
+		t.Fatalf("failed to iterate state %x: %v", root, it.Error)
+	}
+	return hashes
+}
+
+// checkPruned verifies that the database holds exactly the trie nodes and codes
+// of the retained states, along with the unrelated entries.
+func checkPruned(t *testing.T, db *ethdb.MemDatabase, retained []common.Hash) {
+	want := make(map[common.Hash]bool)
+	for _, root := range retained {
+		for hash := range stateHashes(t, db, root) {
+			want[hash] = true
+		}
+	}
+	var have int
+	for _, key := range db.Keys() {
+		if len(key) != common.HashLength {
+			continue
+		}
+		if !want[common.BytesToHash(key)] {
+			t.Errorf("unreachable entry %x retained", key)
+		}
+		have++
+	}
+	if have != len(want) {
+		t.Errorf("entry count mismatch: have %d, want %d", have, len(want))
+	}
+	if data, err := db.Get([]byte("unrelated")); err != nil || string(data) != "value" {
+		t.Errorf("unrelated entry lost: %q, %v", data, err)
+	}
+}
+
+// Tests that pruning deletes the trie nodes and codes of the dropped states but
+// none of the retained ones.
+func TestPrune(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pruner-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, _ := ethdb.NewMemDatabase()
+	roots := makeStates(t, db, 8)
+	db.Put([]byte("unrelated"), []byte("value"))
+
+	before := len(db.Keys())
+	p, err := NewPruner(db, dir, 1024*1024)
+	if err != nil {
+		t.Fatalf("failed to create pruner: %v", err)
+	}
+	retained := []common.Hash{roots[7], roots[6], roots[0]}
+	if err := p.Prune(retained); err != nil {
+		t.Fatalf("pruning failed: %v", err)
+	}
+	if after := len(db.Keys()); after >= before {
+		t.Fatalf("nothing pruned: %d entries before, %d after", before, after)
+	}
+	checkPruned(t, db, retained)
+
+	if _, err := os.Stat(filepath.Join(dir, stateBloomName)); !os.IsNotExist(err) {
+		t.Fatalf("state bloom not removed: %v", err)
+	}
+	// Dropped states must be gone
+	if statedb, err := state.New(roots[3], state.NewDatabase(db)); err == nil {
+		it := state.NewNodeIterator(statedb)
+		for it.Next() {
+		}
+		if it.Error == nil {
+			t.Fatalf("dropped state still complete")
+		}
+	}
+}
+
+// Tests that a pruning run interrupted after persisting the state bloom is
+// completed by the recovery, and that a new run completes it too instead of
+// marking other states.
+func TestPruneRecovery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pruner-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, recover := range []bool{true, false} {
+		db, _ := ethdb.NewMemDatabase()
+		roots := makeStates(t, db, 4)
+		db.Put([]byte("unrelated"), []byte("value"))
+
+		// Simulate a crash right after the marking phase
+		bloom := newStateBloom(1024 * 1024)
+		if err := markState(db, bloom, roots[3]); err != nil {
+			t.Fatalf("marking failed: %v", err)
+		}
+		path := filepath.Join(dir, stateBloomName)
+		if err := bloom.commit(path); err != nil {
+			t.Fatalf("failed to persist state bloom: %v", err)
+		}
+		if recover {
+			if err := RecoverPruning(dir, db); err != nil {
+				t.Fatalf("recovery failed: %v", err)
+			}
+		} else {
+			p, _ := NewPruner(db, dir, 1024*1024)
+			if err := p.Prune([]common.Hash{roots[0]}); err != nil {
+				t.Fatalf("resumed pruning failed: %v", err)
+			}
+		}
+		checkPruned(t, db, []common.Hash{roots[3]})
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Fatalf("state bloom not removed: %v", err)
+		}
+		// Recovering without an interrupted run must be a no-op
+		if err := RecoverPruning(dir, db); err != nil {
+			t.Fatalf("idle recovery failed: %v", err)
+		}
+	}
+}
+
+// Tests that a truncated state bloom is rejected instead of deleting everything
+// missing from it.
+func TestStateBloomCorruption(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pruner-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, stateBloomName)
+	bloom := newStateBloom(1024)
+	bloom.add(common.HexToHash("0x0102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20").Bytes())
+	if err := bloom.commit(path); err != nil {
+		t.Fatalf("failed to persist state bloom: %v", err)
+	}
+	loaded, err := loadStateBloom(path)
+	if err != nil {
+		t.Fatalf("failed to load state bloom: %v", err)
+	}
+	if !loaded.contains(common.HexToHash("0x0102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20").Bytes()) {
+		t.Fatalf("marked hash missing from loaded bloom")
+	}
+	if err := os.Truncate(path, 512); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadStateBloom(path); err != errBloomCorrupted {
+		t.Fatalf("truncated bloom error mismatch: have %v, want %v", err, errBloomCorrupted)
+	}
+	db, _ := ethdb.NewMemDatabase()
+	db.Put(common.Hash{1}.Bytes(), []byte("node"))
+	if err := RecoverPruning(dir, db); err == nil {
+		t.Fatalf("recovery with truncated bloom succeeded")
+	}
+	if has, _ := db.Has(common.Hash{1}.Bytes()); !has {
+		t.Fatalf("entry deleted with truncated bloom")
+	}
+}
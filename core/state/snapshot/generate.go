@@ -0,0 +1,204 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"bytes"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// emptyRoot is the known root hash of an empty trie.
+var emptyRoot = common.HexToHash("56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421")
+
+// account mirrors the consensus representation of accounts in the state trie,
+// including the coin age fields, to resolve the storage trie of an account.
+type account struct {
+	Nonce       uint64
+	Balance     *big.Int
+	CoinAge     *big.Int
+	FUBlockTime *big.Int
+	Root        common.Hash
+	CodeHash    []byte
+}
+
+// generateSnapshot wipes any persisted snapshot and starts regenerating it from
+// the state trie with the given root on a background thread. The returned disk
+// layer serves the accounts and storage slots already covered.
+func generateSnapshot(diskdb ethdb.Database, triedb *trie.NodeCache, root common.Hash) *diskLayer {
+	wipeSnapshot(diskdb)
+
+	batch := diskdb.NewBatch()
+	if err := batch.Put(snapshotGeneratorKey, []byte{}); err != nil {
+		log.Crit("Failed to write snapshot generator marker", "err", err)
+	}
+	if err := batch.Put(SnapshotRootKey, root[:]); err != nil {
+		log.Crit("Failed to write snapshot root", "err", err)
+	}
+	if err := batch.Write(); err != nil {
+		log.Crit("Failed to initialize snapshot generation", "err", err)
+	}
+	base := &diskLayer{
+		diskdb:    diskdb,
+		triedb:    triedb,
+		root:      root,
+		genMarker: []byte{}, // Initialized but empty, nothing covered yet
+	}
+	base.startGeneration()
+	return base
+}
+
+// generate is a background thread that iterates over the state and storage tries
+// of the disk layer, constructing the state snapshot from the generation marker
+// onwards. All the other data accesses check the marker to decide whether they
+// may be served from the snapshot yet.
+//
+// The generator stops when an abort is requested, persisting its progress, or
+// when it runs out of trie nodes to iterate, e.g. because the state was pruned.
+// In both cases generation is resumed once the disk layer is flattened into.
+func (dl *diskLayer) generate(abortCh chan chan struct{}) {
+	var (
+		accounts int
+		slots    int
+		start    = time.Now()
+		logged   = time.Now()
+		batch    = dl.diskdb.NewBatch()
+	)
+	dl.lock.RLock()
+	marker := dl.genMarker
+	dl.lock.RUnlock()
+
+	log.Debug("Generating state snapshot", "root", dl.root, "at", common.ToHex(marker))
+
+	// checkAndFlush persists the generated data along with the current marker once
+	// enough accumulated or if the generation is being aborted. The abort request
+	// is returned if any.
+	checkAndFlush := func(current []byte) chan struct{} {
+		var abort chan struct{}
+		select {
+		case abort = <-abortCh:
+		default:
+		}
+		if batch.ValueSize() > ethdb.IdealBatchSize || abort != nil {
+			current = common.CopyBytes(current)
+			if err := batch.Put(snapshotGeneratorKey, current); err != nil {
+				log.Crit("Failed to write snapshot generator marker", "err", err)
+			}
+			if err := batch.Write(); err != nil {
+				log.Crit("Failed to write state snapshot", "err", err)
+			}
+			batch = dl.diskdb.NewBatch()
+
+			dl.lock.Lock()
+			dl.genMarker = current
+			dl.lock.Unlock()
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Generating state snapshot", "root", dl.root, "at", common.ToHex(current), "accounts", accounts, "slots", slots, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+		return abort
+	}
+	// fail stops the generation without persisting anything further, waiting for
+	// the layer to be flattened into or the tree to be closed.
+	fail := func(err error) {
+		log.Error("State snapshot generation interrupted", "root", dl.root, "err", err)
+		abort := <-abortCh
+		close(abort)
+	}
+	var accMarker []byte
+	if len(marker) >= common.HashLength {
+		accMarker = marker[:common.HashLength]
+	}
+	accTrie, err := trie.NewSecure(dl.root, dl.triedb, 0)
+	if err != nil {
+		fail(err)
+		return
+	}
+	it := trie.NewIterator(accTrie.NodeIterator(accMarker))
+	for it.Next() {
+		accountHash := common.BytesToHash(it.Key)
+		if err := batch.Put(accountKey(accountHash), it.Value); err != nil {
+			log.Crit("Failed to write account snapshot", "err", err)
+		}
+		accounts++
+
+		var acc account
+		if err := rlp.DecodeBytes(it.Value, &acc); err != nil {
+			log.Crit("Invalid account encountered during snapshot creation", "err", err)
+		}
+		if acc.Root != emptyRoot {
+			// Resume from within the storage of the marker account if it was
+			// interrupted midway
+			var storeMarker []byte
+			if accMarker != nil && bytes.Equal(accountHash[:], accMarker) && len(marker) > common.HashLength {
+				storeMarker = marker[common.HashLength:]
+			}
+			storeTrie, err := trie.NewSecure(acc.Root, dl.triedb, 0)
+			if err != nil {
+				fail(err)
+				return
+			}
+			storeIt := trie.NewIterator(storeTrie.NodeIterator(storeMarker))
+			for storeIt.Next() {
+				if err := batch.Put(storageKey(accountHash, common.BytesToHash(storeIt.Key)), storeIt.Value); err != nil {
+					log.Crit("Failed to write storage snapshot", "err", err)
+				}
+				slots++
+
+				if abort := checkAndFlush(append(accountHash[:], storeIt.Key...)); abort != nil {
+					close(abort)
+					return
+				}
+			}
+			if storeIt.Err != nil {
+				fail(storeIt.Err)
+				return
+			}
+		}
+		if abort := checkAndFlush(accountHash[:]); abort != nil {
+			close(abort)
+			return
+		}
+	}
+	if it.Err != nil {
+		fail(it.Err)
+		return
+	}
+	// Snapshot fully generated, persist the remainder and drop the marker
+	if err := batch.Write(); err != nil {
+		log.Crit("Failed to write state snapshot", "err", err)
+	}
+	if err := dl.diskdb.Delete(snapshotGeneratorKey); err != nil {
+		log.Crit("Failed to remove snapshot generator marker", "err", err)
+	}
+	dl.lock.Lock()
+	dl.genMarker = nil
+	dl.lock.Unlock()
+
+	log.Info("Generated state snapshot", "root", dl.root, "accounts", accounts, "slots", slots, "elapsed", common.PrettyDuration(time.Since(start)))
+
+	// Someone will be looking for us, wait it out
+	abort := <-abortCh
+	close(abort)
+}
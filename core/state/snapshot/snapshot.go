@@ -0,0 +1,455 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package snapshot implements a flat, dynamic state dump.
+//
+// The snapshot is a flat key-value copy of the accounts and storage slots of a
+// state trie, keyed by their hashes, so reading an account or a slot is a single
+// disk lookup instead of a walk down the trie. The persisted copy (disk layer)
+// tracks a state somewhat behind the chain head; the state changes of every more
+// recent block live in memory as diff layers on top of it, which are flattened
+// into the disk layer as blocks deepen.
+package snapshot
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+var (
+	// SnapshotRootKey tracks the state root of the persisted snapshot.
+	SnapshotRootKey = []byte("SnapshotRoot")
+
+	// snapshotGeneratorKey tracks the progress marker of a snapshot generation
+	// in progress. It's missing once the snapshot is fully generated.
+	snapshotGeneratorKey = []byte("SnapshotGenerator")
+
+	accountPrefix = []byte("a") // accountPrefix + account hash -> account RLP
+	storagePrefix = []byte("o") // storagePrefix + account hash + storage hash -> storage slot RLP
+)
+
+var (
+	// ErrSnapshotStale is returned from data accessors if the underlying snapshot
+	// layer had been invalidated due to the chain progressing forward far enough
+	// to not maintain the layer's original state.
+	ErrSnapshotStale = errors.New("snapshot stale")
+
+	// ErrNotCoveredYet is returned from data accessors if the underlying snapshot
+	// is being generated currently and the requested data item is not yet in the
+	// range of accounts covered.
+	ErrNotCoveredYet = errors.New("not covered yet")
+
+	// errSnapshotCycle is returned if a snapshot is attempted to be inserted
+	// that forms a cycle in the snapshot tree.
+	errSnapshotCycle = errors.New("snapshot cycle")
+)
+
+// Snapshot represents the functionality supported by a snapshot storage layer.
+// Accounts and storage slots are returned in their raw trie RLP encoding, nil
+// if they don't exist in the state the layer represents.
+type Snapshot interface {
+	// Root returns the root hash for which this snapshot was made.
+	Root() common.Hash
+
+	// Account directly retrieves the account associated with a particular hash
+	// in its trie RLP encoding.
+	Account(hash common.Hash) ([]byte, error)
+
+	// Storage directly retrieves the storage data associated with a particular
+	// hash, within a particular account.
+	Storage(accountHash, storageHash common.Hash) ([]byte, error)
+}
+
+// snapshot is the internal version of the snapshot data layer that supports some
+// additional methods compared to the public API.
+type snapshot interface {
+	Snapshot
+
+	// Stale returns whether this layer has become stale (was flattened across)
+	// or if it's still live.
+	Stale() bool
+
+	// markStale flags the layer as stale.
+	markStale()
+}
+
+// Tree is an Ethereum state snapshot tree. It consists of one persistent base
+// layer backed by a key-value store, on top of which arbitrarily many in-memory
+// diff layers are topped. The memory diffs can form a tree with branching, but
+// the disk layer is singleton and common to all. If a reorg goes deeper than the
+// disk layer, the snapshot needs to be rebuilt.
+type Tree struct {
+	diskdb ethdb.Database           // Persistent database to store the snapshot
+	triedb *trie.NodeCache          // In-memory cache to access the trie through
+	layers map[common.Hash]snapshot // Collection of all known layers
+	lock   sync.RWMutex
+}
+
+// New attempts to load an already existing snapshot from a persistent key-value
+// store, ensuring that the head of the snapshot matches the expected one. Diff
+// layers are not persisted, the tree is expected to be flattened on shutdown.
+//
+// If the snapshot is missing or inconsistent, the entirety is deleted and will
+// be reconstructed from scratch based on the tries in the key-value store, on a
+// background thread.
+func New(diskdb ethdb.Database, triedb *trie.NodeCache, root common.Hash) (*Tree, error) {
+	snap := &Tree{
+		diskdb: diskdb,
+		triedb: triedb,
+		layers: make(map[common.Hash]snapshot),
+	}
+	base := loadSnapshot(diskdb, triedb, root)
+	if base == nil {
+		log.Warn("Snapshot missing or stale, rebuilding", "root", root)
+		base = generateSnapshot(diskdb, triedb, root)
+	}
+	snap.layers[root] = base
+	return snap, nil
+}
+
+// Snapshot retrieves a snapshot belonging to the given block root, or nil if no
+// snapshot is maintained for that block.
+func (t *Tree) Snapshot(blockRoot common.Hash) Snapshot {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	if layer, ok := t.layers[blockRoot]; ok {
+		return layer
+	}
+	return nil
+}
+
+// Update adds a new snapshot into the tree, if that can be linked to an existing
+// old parent. It is disallowed to insert a disk layer (the origin of all).
+func (t *Tree) Update(blockRoot common.Hash, parentRoot common.Hash, destructs map[common.Hash]struct{}, accounts map[common.Hash][]byte, storage map[common.Hash]map[common.Hash][]byte) error {
+	// Reject noop updates to avoid self-loops in the snapshot tree. This is a
+	// special case that can only happen for blocks that don't change the state.
+	if blockRoot == parentRoot {
+		return errSnapshotCycle
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	// Blocks with identical post state share their layer
+	if _, ok := t.layers[blockRoot]; ok {
+		return nil
+	}
+	parent, ok := t.layers[parentRoot]
+	if !ok {
+		return fmt.Errorf("parent [%#x] snapshot missing", parentRoot)
+	}
+	t.layers[blockRoot] = newDiffLayer(parent, blockRoot, destructs, accounts, storage)
+	return nil
+}
+
+// Cap traverses downwards the snapshot tree from a head block hash until the
+// number of allowed layers are crossed. All layers beyond the permitted number
+// are flattened downwards into the disk layer, and all layers not descending
+// from the new disk layer are dropped. A zero layer count flattens the head
+// itself into the disk layer too.
+func (t *Tree) Cap(root common.Hash, layers int) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	snap, ok := t.layers[root]
+	if !ok {
+		return fmt.Errorf("snapshot [%#x] missing", root)
+	}
+	diff, ok := snap.(*diffLayer)
+	if !ok {
+		return nil // Already the disk layer, nothing to do
+	}
+	// Find the topmost layer to flatten, keeping the requested number of layers
+	// above it. The parent pointers are only ever modified with the tree lock
+	// held, so it's safe to traverse them without the layer locks here.
+	var keep *diffLayer
+	if layers > 0 {
+		for i := 1; i < layers; i++ {
+			if diff, ok = diff.parent.(*diffLayer); !ok {
+				return nil // Not enough layers to cap yet
+			}
+		}
+		keep = diff
+		if diff, ok = diff.parent.(*diffLayer); !ok {
+			return nil
+		}
+	}
+	// Flatten the layers below the kept one into the disk layer, oldest first
+	var flatten []*diffLayer
+	for layer := diff; ; {
+		flatten = append(flatten, layer)
+		parent, ok := layer.parent.(*diffLayer)
+		if !ok {
+			break
+		}
+		layer = parent
+	}
+	var base *diskLayer
+	for i := len(flatten) - 1; i >= 0; i-- {
+		base = diffToDisk(flatten[i])
+		if i > 0 {
+			flatten[i-1].setParent(base)
+		}
+	}
+	if keep != nil {
+		keep.setParent(base)
+	}
+	// Drop all layers not descending from the new disk layer
+	layersLeft := map[common.Hash]snapshot{base.root: base}
+	for hash, layer := range t.layers {
+		if descendsFrom(layer, base) {
+			layersLeft[hash] = layer
+		} else {
+			layer.markStale()
+		}
+	}
+	t.layers = layersLeft
+	return nil
+}
+
+// descendsFrom checks whether a live layer is built on top of the given disk layer.
+func descendsFrom(layer snapshot, base *diskLayer) bool {
+	for {
+		if layer.Stale() {
+			return false
+		}
+		diff, ok := layer.(*diffLayer)
+		if !ok {
+			return layer == base
+		}
+		layer = diff.parent
+	}
+}
+
+// Rebuild wipes all available snapshot data from the persistent database and
+// discards all caches and diff layers. Afterwards, it starts a new snapshot
+// generator with the given root hash.
+func (t *Tree) Rebuild(root common.Hash) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for _, layer := range t.layers {
+		if base, ok := layer.(*diskLayer); ok {
+			base.stopGeneration()
+		}
+		layer.markStale()
+	}
+	log.Info("Rebuilding state snapshot", "root", root)
+	t.layers = map[common.Hash]snapshot{
+		root: generateSnapshot(t.diskdb, t.triedb, root),
+	}
+}
+
+// DiskRoot returns the state root of the disk layer of the snapshot tree.
+func (t *Tree) DiskRoot() common.Hash {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	for _, layer := range t.layers {
+		if base, ok := layer.(*diskLayer); ok {
+			return base.root
+		}
+	}
+	return common.Hash{}
+}
+
+// Close stops any snapshot generation running in the background, persisting its
+// progress so it can be resumed on the next startup.
+func (t *Tree) Close() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for _, layer := range t.layers {
+		if base, ok := layer.(*diskLayer); ok {
+			base.stopGeneration()
+		}
+	}
+}
+
+// diffToDisk merges a bottom-most diff into the persistent disk layer underneath
+// it. The method will panic if called onto a non-bottom-most diff layer.
+func diffToDisk(bottom *diffLayer) *diskLayer {
+	base := bottom.parent.(*diskLayer)
+
+	// Stop any generation on the old disk layer and mark both layers stale, the
+	// diff is about to be merged into the disk content
+	base.stopGeneration()
+	base.markStale()
+	bottom.markStale()
+
+	base.lock.RLock()
+	marker := base.genMarker
+	base.lock.RUnlock()
+
+	// Invalidate the persisted root while the data is in flux, so a crash midway
+	// triggers a rebuild instead of loading a half merged snapshot
+	db := base.diskdb
+	if err := db.Delete(SnapshotRootKey); err != nil {
+		log.Crit("Failed to invalidate snapshot root", "err", err)
+	}
+	batch := db.NewBatch()
+	flush := func() {
+		if batch.ValueSize() > ethdb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				log.Crit("Failed to write snapshot data", "err", err)
+			}
+			batch.Reset()
+		}
+	}
+	// Wipe destructed accounts along with their storage. Anything beyond the
+	// generation marker doesn't exist on disk yet, the generator will take care
+	// of those from the new root.
+	for hash := range bottom.destructs {
+		if !covered(marker, hash[:], nil) {
+			continue
+		}
+		if err := batch.Delete(accountKey(hash)); err != nil {
+			log.Crit("Failed to delete account snapshot", "err", err)
+		}
+		flush()
+		wipeKeyRange(db, batch, append(storagePrefix, hash[:]...), len(storagePrefix)+2*common.HashLength)
+	}
+	for hash, data := range bottom.accounts {
+		if !covered(marker, hash[:], nil) {
+			continue
+		}
+		if err := batch.Put(accountKey(hash), data); err != nil {
+			log.Crit("Failed to write account snapshot", "err", err)
+		}
+		flush()
+	}
+	for accountHash, storage := range bottom.storage {
+		if !covered(marker, accountHash[:], nil) {
+			continue
+		}
+		for storageHash, data := range storage {
+			if !covered(marker, accountHash[:], storageHash[:]) {
+				continue
+			}
+			if len(data) == 0 {
+				if err := batch.Delete(storageKey(accountHash, storageHash)); err != nil {
+					log.Crit("Failed to delete storage snapshot", "err", err)
+				}
+			} else if err := batch.Put(storageKey(accountHash, storageHash), data); err != nil {
+				log.Crit("Failed to write storage snapshot", "err", err)
+			}
+			flush()
+		}
+	}
+	if err := batch.Put(SnapshotRootKey, bottom.root[:]); err != nil {
+		log.Crit("Failed to write snapshot root", "err", err)
+	}
+	if err := batch.Write(); err != nil {
+		log.Crit("Failed to write snapshot data", "err", err)
+	}
+	res := &diskLayer{
+		diskdb:    db,
+		triedb:    base.triedb,
+		root:      bottom.root,
+		genMarker: marker,
+	}
+	// If the snapshot was still being generated, resume it on the new root
+	if marker != nil {
+		res.startGeneration()
+	}
+	return res
+}
+
+// covered reports whether the generation marker of a snapshot covers an account,
+// or a storage slot of it if slot is non-nil. A nil marker means the snapshot is
+// fully generated, an empty one that nothing is generated yet. Otherwise every
+// account up to the marker is covered along with its storage, except for the
+// storage slots after the marker if it points into the storage of an account.
+func covered(marker []byte, account []byte, slot []byte) bool {
+	if marker == nil {
+		return true
+	}
+	if len(marker) < common.HashLength {
+		return false
+	}
+	switch bytes.Compare(account, marker[:common.HashLength]) {
+	case -1:
+		return true
+	case 1:
+		return false
+	}
+	if slot == nil || len(marker) == common.HashLength {
+		return true
+	}
+	return bytes.Compare(slot, marker[common.HashLength:]) <= 0
+}
+
+// accountKey = accountPrefix + hash
+func accountKey(hash common.Hash) []byte {
+	return append(append([]byte{}, accountPrefix...), hash[:]...)
+}
+
+// storageKey = storagePrefix + account hash + storage hash
+func storageKey(accountHash, storageHash common.Hash) []byte {
+	return append(append(append([]byte{}, storagePrefix...), accountHash[:]...), storageHash[:]...)
+}
+
+// IsAccountKey reports whether a database key holds an account snapshot entry.
+func IsAccountKey(key []byte) bool {
+	return len(key) == len(accountPrefix)+common.HashLength && bytes.HasPrefix(key, accountPrefix)
+}
+
+// IsStorageKey reports whether a database key holds a storage snapshot entry.
+func IsStorageKey(key []byte) bool {
+	return len(key) == len(storagePrefix)+2*common.HashLength && bytes.HasPrefix(key, storagePrefix)
+}
+
+// wipeSnapshot deletes all the persisted snapshot data.
+func wipeSnapshot(db ethdb.Database) {
+	if err := db.Delete(SnapshotRootKey); err != nil {
+		log.Crit("Failed to remove snapshot root", "err", err)
+	}
+	batch := db.NewBatch()
+	wipeKeyRange(db, batch, accountPrefix, len(accountPrefix)+common.HashLength)
+	wipeKeyRange(db, batch, storagePrefix, len(storagePrefix)+2*common.HashLength)
+	if err := batch.Write(); err != nil {
+		log.Crit("Failed to wipe snapshot", "err", err)
+	}
+}
+
+// wipeKeyRange deletes all the keys of the given length starting with a prefix
+// through a batch, writing it out whenever it grows past the ideal size. The
+// caller is responsible for writing out the remainder.
+func wipeKeyRange(db ethdb.Database, batch ethdb.Batch, prefix []byte, keylen int) {
+	it := ethdb.KeyValueStore(db).NewIterator(prefix, nil)
+	defer it.Release()
+
+	for it.Next() {
+		if key := it.Key(); len(key) == keylen {
+			if err := batch.Delete(common.CopyBytes(key)); err != nil {
+				log.Crit("Failed to wipe snapshot entry", "err", err)
+			}
+			if batch.ValueSize() > ethdb.IdealBatchSize {
+				if err := batch.Write(); err != nil {
+					log.Crit("Failed to wipe snapshot entries", "err", err)
+				}
+				batch.Reset()
+			}
+		}
+	}
+}
@@ -0,0 +1,303 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// makeState commits a state trie with a number of accounts, every other one of
+// them with a few storage slots, returning its root.
+func makeState(t *testing.T, db ethdb.Database, accounts int) common.Hash {
+	accTrie, _ := trie.NewSecure(common.Hash{}, db, 0)
+	for i := 0; i < accounts; i++ {
+		acc := account{
+			Nonce:       uint64(i),
+			Balance:     big.NewInt(int64(1000 + i)),
+			CoinAge:     big.NewInt(int64(i)),
+			FUBlockTime: big.NewInt(0),
+			Root:        emptyRoot,
+			CodeHash:    crypto.Keccak256(nil),
+		}
+		if i%2 == 0 {
+			storeTrie, _ := trie.NewSecure(common.Hash{}, db, 0)
+			for j := 1; j <= 3; j++ {
+				val, _ := rlp.EncodeToBytes(uint64(i*10 + j))
+				storeTrie.Update(common.BigToHash(big.NewInt(int64(j))).Bytes(), val)
+			}
+			root, err := storeTrie.CommitTo(db)
+			if err != nil {
+				t.Fatalf("failed to commit storage trie: %v", err)
+			}
+			acc.Root = root
+		}
+		blob, _ := rlp.EncodeToBytes(acc)
+		accTrie.Update(common.BigToAddress(big.NewInt(int64(i))).Bytes(), blob)
+	}
+	root, err := accTrie.CommitTo(db)
+	if err != nil {
+		t.Fatalf("failed to commit account trie: %v", err)
+	}
+	return root
+}
+
+// waitGeneration blocks until the disk layer of the tree is fully generated.
+func waitGeneration(t *testing.T, tree *Tree) {
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		base := tree.Snapshot(tree.DiskRoot()).(*diskLayer)
+
+		base.lock.RLock()
+		done := base.genMarker == nil
+		base.lock.RUnlock()
+		if done {
+			return
+		}
+	}
+	t.Fatalf("snapshot generation timed out")
+}
+
+// Tests that a snapshot generated from a state trie matches it and serves its
+// accounts and storage slots, and that it's loaded back instead of regenerated.
+func TestGenerateAndVerify(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	root := makeState(t, db, 64)
+
+	tree, err := New(db, trie.NewNodeCache(db), root)
+	if err != nil {
+		t.Fatalf("failed to create snapshot tree: %v", err)
+	}
+	waitGeneration(t, tree)
+
+	accounts, slots, err := VerifyState(db)
+	if err != nil {
+		t.Fatalf("snapshot verification failed: %v", err)
+	}
+	if accounts != 64 || slots != 32*3 {
+		t.Fatalf("verified item mismatch: have %d accounts, %d slots, want %d, %d", accounts, slots, 64, 32*3)
+	}
+	snap := tree.Snapshot(root)
+	addrHash := crypto.Keccak256Hash(common.BigToAddress(big.NewInt(2)).Bytes())
+	blob, err := snap.Account(addrHash)
+	if err != nil || len(blob) == 0 {
+		t.Fatalf("account retrieval failed: %x, %v", blob, err)
+	}
+	var acc account
+	if err := rlp.DecodeBytes(blob, &acc); err != nil {
+		t.Fatalf("failed to decode account: %v", err)
+	}
+	if acc.Balance.Int64() != 1002 || acc.CoinAge.Int64() != 2 {
+		t.Errorf("account mismatch: balance %v, coin age %v", acc.Balance, acc.CoinAge)
+	}
+	slotHash := crypto.Keccak256Hash(common.BigToHash(big.NewInt(1)).Bytes())
+	if blob, err := snap.Storage(addrHash, slotHash); err != nil || len(blob) == 0 {
+		t.Errorf("storage retrieval failed: %x, %v", blob, err)
+	}
+	tree.Close()
+
+	// Reopen the snapshot and ensure it's loaded as is
+	tree, err = New(db, trie.NewNodeCache(db), root)
+	if err != nil {
+		t.Fatalf("failed to reopen snapshot tree: %v", err)
+	}
+	defer tree.Close()
+	if marker := tree.layers[root].(*diskLayer).genMarker; marker != nil {
+		t.Errorf("generated snapshot regenerated: marker %x", marker)
+	}
+}
+
+// Tests that capping the snapshot tree flattens the layers beyond the limit into
+// the disk layer, marking them stale, and drops the layers of abandoned forks.
+func TestCap(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	base := makeState(t, db, 4)
+
+	tree, err := New(db, trie.NewNodeCache(db), base)
+	if err != nil {
+		t.Fatalf("failed to create snapshot tree: %v", err)
+	}
+	defer tree.Close()
+	waitGeneration(t, tree)
+
+	// Build a chain of layers, each modifying the same account, and a fork
+	hash := common.HexToHash("0x01")
+	roots := []common.Hash{base}
+	for i := 1; i <= 4; i++ {
+		root := common.BigToHash(big.NewInt(int64(0x100 + i)))
+		accounts := map[common.Hash][]byte{hash: {byte(i)}}
+		if err := tree.Update(root, roots[i-1], nil, accounts, nil); err != nil {
+			t.Fatalf("failed to add layer %d: %v", i, err)
+		}
+		roots = append(roots, root)
+	}
+	fork := common.HexToHash("0xf0")
+	if err := tree.Update(fork, roots[1], nil, map[common.Hash][]byte{hash: {0xff}}, nil); err != nil {
+		t.Fatalf("failed to add fork layer: %v", err)
+	}
+	stale := tree.Snapshot(roots[1])
+	forked := tree.Snapshot(fork)
+
+	// Keep two layers on top of the head's grandparent, flattening two into disk
+	if err := tree.Cap(roots[4], 2); err != nil {
+		t.Fatalf("failed to cap tree: %v", err)
+	}
+	if root := tree.DiskRoot(); root != roots[2] {
+		t.Fatalf("disk root mismatch: have %x, want %x", root, roots[2])
+	}
+	if n := len(tree.layers); n != 3 {
+		t.Errorf("layer count mismatch: have %d, want %d", n, 3)
+	}
+	if _, err := stale.Account(hash); err != ErrSnapshotStale {
+		t.Errorf("flattened layer error mismatch: have %v, want %v", err, ErrSnapshotStale)
+	}
+	if _, err := forked.Account(hash); err != ErrSnapshotStale {
+		t.Errorf("dropped fork error mismatch: have %v, want %v", err, ErrSnapshotStale)
+	}
+	if tree.Snapshot(fork) != nil {
+		t.Errorf("dropped fork still in tree")
+	}
+	if blob, _ := db.Get(accountKey(hash)); !bytes.Equal(blob, []byte{2}) {
+		t.Errorf("flattened account mismatch: have %x, want %x", blob, []byte{2})
+	}
+	if blob, err := tree.Snapshot(roots[4]).Account(hash); err != nil || !bytes.Equal(blob, []byte{4}) {
+		t.Errorf("head account mismatch: have %x, %v, want %x", blob, err, []byte{4})
+	}
+	// Flatten everything and ensure the persisted root follows
+	if err := tree.Cap(roots[4], 0); err != nil {
+		t.Fatalf("failed to flatten tree: %v", err)
+	}
+	if root := DiskRoot(db); root != roots[4] {
+		t.Errorf("persisted root mismatch: have %x, want %x", root, roots[4])
+	}
+	if blob, _ := db.Get(accountKey(hash)); !bytes.Equal(blob, []byte{4}) {
+		t.Errorf("flattened account mismatch: have %x, want %x", blob, []byte{4})
+	}
+}
+
+// Tests that destructing an account hides its storage in the diff layer and
+// wipes it from disk once flattened, while recreated storage is kept.
+func TestDestruct(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	base := makeState(t, db, 4)
+
+	tree, err := New(db, trie.NewNodeCache(db), base)
+	if err != nil {
+		t.Fatalf("failed to create snapshot tree: %v", err)
+	}
+	defer tree.Close()
+	waitGeneration(t, tree)
+
+	addrHash := crypto.Keccak256Hash(common.BigToAddress(big.NewInt(0)).Bytes())
+	slot1 := crypto.Keccak256Hash(common.BigToHash(big.NewInt(1)).Bytes())
+	slot2 := crypto.Keccak256Hash(common.BigToHash(big.NewInt(2)).Bytes())
+	if blob, _ := tree.Snapshot(base).Storage(addrHash, slot1); len(blob) == 0 {
+		t.Fatalf("storage slot missing before destruct")
+	}
+	// Destruct the account and recreate it with a single slot
+	root := common.HexToHash("0x01")
+	destructs := map[common.Hash]struct{}{addrHash: {}}
+	accounts := map[common.Hash][]byte{addrHash: {0x01}}
+	storage := map[common.Hash]map[common.Hash][]byte{addrHash: {slot2: {0x02}}}
+	if err := tree.Update(root, base, destructs, accounts, storage); err != nil {
+		t.Fatalf("failed to add layer: %v", err)
+	}
+	snap := tree.Snapshot(root)
+	if blob, err := snap.Storage(addrHash, slot1); err != nil || blob != nil {
+		t.Errorf("destructed slot mismatch: have %x, %v, want nil", blob, err)
+	}
+	if blob, err := snap.Storage(addrHash, slot2); err != nil || !bytes.Equal(blob, []byte{0x02}) {
+		t.Errorf("recreated slot mismatch: have %x, %v, want %x", blob, err, []byte{0x02})
+	}
+	if err := tree.Cap(root, 0); err != nil {
+		t.Fatalf("failed to flatten tree: %v", err)
+	}
+	if has, _ := db.Has(storageKey(addrHash, slot1)); has {
+		t.Errorf("destructed slot not wiped from disk")
+	}
+	if blob, _ := db.Get(storageKey(addrHash, slot2)); !bytes.Equal(blob, []byte{0x02}) {
+		t.Errorf("recreated slot mismatch on disk: have %x, want %x", blob, []byte{0x02})
+	}
+}
+
+// Tests that wiping a key range deletes only the keys of the given length with
+// the prefix, writing the batch out as it grows past the ideal size.
+func TestWipeKeyRange(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+
+	wiped, kept := common.Hash{0x01}, common.Hash{0x02}
+	for i := 0; i < 4096; i++ {
+		db.Put(storageKey(wiped, common.BigToHash(big.NewInt(int64(i)))), []byte{0x01})
+	}
+	db.Put(storageKey(kept, common.Hash{}), []byte{0x01})
+	db.Put(append(storagePrefix, wiped[:]...), []byte{0x01})
+
+	batch := db.NewBatch()
+	wipeKeyRange(db, batch, append(storagePrefix, wiped[:]...), len(storagePrefix)+2*common.HashLength)
+	if size := batch.ValueSize(); size > ethdb.IdealBatchSize {
+		t.Errorf("batch not written out: %d bytes pending", size)
+	}
+	if has, _ := db.Has(storageKey(wiped, common.Hash{})); has {
+		t.Errorf("first slot not wiped before the final write")
+	}
+	if err := batch.Write(); err != nil {
+		t.Fatalf("failed to write batch: %v", err)
+	}
+	for i := 0; i < 4096; i++ {
+		if has, _ := db.Has(storageKey(wiped, common.BigToHash(big.NewInt(int64(i))))); has {
+			t.Fatalf("slot %d not wiped", i)
+		}
+	}
+	if has, _ := db.Has(storageKey(kept, common.Hash{})); !has {
+		t.Errorf("slot of other account wiped")
+	}
+	if has, _ := db.Has(append(storagePrefix, wiped[:]...)); !has {
+		t.Errorf("key of other length wiped")
+	}
+}
+
+// Tests that the coverage marker of a snapshot being generated is respected.
+func TestCovered(t *testing.T) {
+	acc := common.HexToHash("0x10").Bytes()
+	tests := []struct {
+		marker  []byte
+		account []byte
+		slot    []byte
+		want    bool
+	}{
+		{nil, acc, nil, true},
+		{[]byte{}, acc, nil, false},
+		{common.HexToHash("0x20").Bytes(), acc, nil, true},
+		{common.HexToHash("0x20").Bytes(), acc, acc, true},
+		{common.HexToHash("0x08").Bytes(), acc, nil, false},
+		{acc, acc, common.HexToHash("0xff").Bytes(), true},
+		{append(common.CopyBytes(acc), common.HexToHash("0x05").Bytes()...), acc, common.HexToHash("0x04").Bytes(), true},
+		{append(common.CopyBytes(acc), common.HexToHash("0x05").Bytes()...), acc, common.HexToHash("0x06").Bytes(), false},
+	}
+	for i, tt := range tests {
+		if have := covered(tt.marker, tt.account, tt.slot); have != tt.want {
+			t.Errorf("test %d: coverage mismatch: have %v, want %v", i, have, tt.want)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// errSnapshotGenerating is returned when verifying a snapshot that isn't fully
+// generated yet.
+var errSnapshotGenerating = errors.New("snapshot generation in progress")
+
+// DiskRoot retrieves the state root of the snapshot persisted in the database,
+// or the zero hash if there's none.
+func DiskRoot(db ethdb.Database) common.Hash {
+	blob, err := db.Get(SnapshotRootKey)
+	if err != nil || len(blob) != common.HashLength {
+		return common.Hash{}
+	}
+	return common.BytesToHash(blob)
+}
+
+// VerifyState cross checks the snapshot persisted in the database against the
+// state trie it was made from, walking both in lockstep. The numbers of accounts
+// and storage slots verified are returned, or an error describing the first
+// inconsistency found.
+func VerifyState(db ethdb.Database) (accounts int, slots int, err error) {
+	root := DiskRoot(db)
+	if root == (common.Hash{}) {
+		return 0, 0, errors.New("no snapshot persisted")
+	}
+	if _, err := db.Get(snapshotGeneratorKey); err == nil {
+		return 0, 0, errSnapshotGenerating
+	}
+	accTrie, err := trie.NewSecure(root, db, 0)
+	if err != nil {
+		return 0, 0, err
+	}
+	snapIt := ethdb.KeyValueStore(db).NewIterator(accountPrefix, nil)
+	defer snapIt.Release()
+
+	accIt := trie.NewIterator(accTrie.NodeIterator(nil))
+	snapOk := snapIt.Next()
+	for accIt.Next() {
+		snapOk = skipForeign(snapIt, snapOk, accountPrefix, len(accountPrefix)+common.HashLength)
+		if err := compareEntry(snapIt, snapOk, accountPrefix, accIt.Key, accIt.Value); err != nil {
+			return accounts, slots, fmt.Errorf("account: %v", err)
+		}
+		accounts++
+		snapOk = snapIt.Next()
+
+		var acc account
+		if err := rlp.DecodeBytes(accIt.Value, &acc); err != nil {
+			return accounts, slots, fmt.Errorf("account %x: %v", accIt.Key, err)
+		}
+		n, err := verifyStorage(db, common.BytesToHash(accIt.Key), acc.Root)
+		slots += n
+		if err != nil {
+			return accounts, slots, err
+		}
+	}
+	if accIt.Err != nil {
+		return accounts, slots, accIt.Err
+	}
+	if snapOk = skipForeign(snapIt, snapOk, accountPrefix, len(accountPrefix)+common.HashLength); snapOk && bytes.HasPrefix(snapIt.Key(), accountPrefix) {
+		return accounts, slots, fmt.Errorf("account: dangling snapshot entry %x", snapIt.Key()[len(accountPrefix):])
+	}
+	return accounts, slots, nil
+}
+
+// verifyStorage cross checks the snapshot storage of an account against its
+// storage trie, returning the number of slots verified.
+func verifyStorage(db ethdb.Database, accountHash common.Hash, root common.Hash) (int, error) {
+	prefix := append(append([]byte{}, storagePrefix...), accountHash[:]...)
+
+	snapIt := ethdb.KeyValueStore(db).NewIterator(prefix, nil)
+	defer snapIt.Release()
+
+	snapOk := snapIt.Next()
+	slots := 0
+	if root != emptyRoot {
+		storeTrie, err := trie.NewSecure(root, db, 0)
+		if err != nil {
+			return 0, err
+		}
+		storeIt := trie.NewIterator(storeTrie.NodeIterator(nil))
+		for storeIt.Next() {
+			snapOk = skipForeign(snapIt, snapOk, prefix, len(prefix)+common.HashLength)
+			if err := compareEntry(snapIt, snapOk, prefix, storeIt.Key, storeIt.Value); err != nil {
+				return slots, fmt.Errorf("storage of account %x: %v", accountHash, err)
+			}
+			slots++
+			snapOk = snapIt.Next()
+		}
+		if storeIt.Err != nil {
+			return slots, storeIt.Err
+		}
+	}
+	if snapOk = skipForeign(snapIt, snapOk, prefix, len(prefix)+common.HashLength); snapOk && bytes.HasPrefix(snapIt.Key(), prefix) {
+		return slots, fmt.Errorf("storage of account %x: dangling snapshot entry %x", accountHash, snapIt.Key()[len(prefix):])
+	}
+	return slots, nil
+}
+
+// skipForeign advances the snapshot iterator past any key with the snapshot
+// prefix that is not a snapshot entry, such as keys of unrelated data which
+// happen to start with the same byte.
+func skipForeign(it ethdb.Iterator, ok bool, prefix []byte, keylen int) bool {
+	for ok && bytes.HasPrefix(it.Key(), prefix) && len(it.Key()) != keylen {
+		ok = it.Next()
+	}
+	return ok
+}
+
+// compareEntry checks that the snapshot iterator is positioned on the entry
+// matching a trie leaf.
+func compareEntry(it ethdb.Iterator, ok bool, prefix []byte, key, value []byte) error {
+	if !ok || !bytes.HasPrefix(it.Key(), prefix) {
+		return fmt.Errorf("entry %x missing from snapshot", key)
+	}
+	switch have := it.Key()[len(prefix):]; bytes.Compare(have, key) {
+	case -1:
+		return fmt.Errorf("dangling snapshot entry %x", have)
+	case 1:
+		return fmt.Errorf("entry %x missing from snapshot", key)
+	}
+	if !bytes.Equal(it.Value(), value) {
+		return fmt.Errorf("entry %x mismatch: snapshot %x, trie %x", key, it.Value(), value)
+	}
+	return nil
+}
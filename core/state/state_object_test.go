@@ -0,0 +1,69 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state/snapshot"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// Tests that a copied state object keeps the storage slots already flushed into
+// its trie, instead of reading them back from the stale snapshot layer.
+func TestStateObjectCopyCachedStorage(t *testing.T) {
+	var (
+		db, _ = ethdb.NewMemDatabase()
+		addr  = common.BytesToAddress([]byte{0x01})
+		key   = common.BytesToHash([]byte{0x02})
+	)
+	state, _ := New(common.Hash{}, NewDatabase(db))
+	state.SetState(addr, key, common.BytesToHash([]byte{0x01}))
+	root, err := state.CommitTo(db, false)
+	if err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	cache := trie.NewNodeCache(db)
+	snaps, err := snapshot.New(db, cache, root)
+	if err != nil {
+		t.Fatalf("failed to create snapshot tree: %v", err)
+	}
+	defer snaps.Close()
+
+	// Wait for the snapshot to cover the slot so it's served from there
+	for {
+		if _, err := snaps.Snapshot(root).Storage(crypto.Keccak256Hash(addr[:]), crypto.Keccak256Hash(key[:])); err != snapshot.ErrNotCoveredYet {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if state, err = New(root, NewDatabaseWithSnapshots(cache, snaps)); err != nil {
+		t.Fatalf("failed to open state: %v", err)
+	}
+	// Flush a storage change into the trie, but not yet into the snapshot tree
+	want := common.BytesToHash([]byte{0x03})
+	state.SetState(addr, key, want)
+	state.IntermediateRoot(false)
+
+	if have := state.Copy().GetState(addr, key); have != want {
+		t.Fatalf("copied storage slot mismatch: have %x, want %x", have, want)
+	}
+}
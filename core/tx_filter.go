@@ -0,0 +1,105 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"encoding/json"
+	"io/ioutil"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// TxFilter is a sender and recipient based admission filter of the transaction
+// pool. Denied accounts are always rejected, and if an allow list is non-empty,
+// only the accounts on it are accepted. With recipients allowed explicitly,
+// contract creations are rejected as they have no recipient.
+type TxFilter struct {
+	AllowSenders []common.Address `json:"allowSenders,omitempty"` // Senders accepted exclusively (empty = any)
+	DenySenders  []common.Address `json:"denySenders,omitempty"`  // Senders always rejected
+	AllowTargets []common.Address `json:"allowTargets,omitempty"` // Recipients accepted exclusively (empty = any)
+	DenyTargets  []common.Address `json:"denyTargets,omitempty"`  // Recipients always rejected
+}
+
+// LoadTxFilter reads a transaction filter from a JSON file.
+func LoadTxFilter(file string) (*TxFilter, error) {
+	blob, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	filter := new(TxFilter)
+	if err := json.Unmarshal(blob, filter); err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+// txFilter is a transaction filter compiled into sets for quick lookups.
+type txFilter struct {
+	config *TxFilter
+
+	allowSenders map[common.Address]struct{}
+	denySenders  map[common.Address]struct{}
+	allowTargets map[common.Address]struct{}
+	denyTargets  map[common.Address]struct{}
+}
+
+// compile converts the address lists of the filter into sets.
+func (f *TxFilter) compile() *txFilter {
+	set := func(addrs []common.Address) map[common.Address]struct{} {
+		set := make(map[common.Address]struct{}, len(addrs))
+		for _, addr := range addrs {
+			set[addr] = struct{}{}
+		}
+		return set
+	}
+	return &txFilter{
+		config:       f,
+		allowSenders: set(f.AllowSenders),
+		denySenders:  set(f.DenySenders),
+		allowTargets: set(f.AllowTargets),
+		denyTargets:  set(f.DenyTargets),
+	}
+}
+
+// check returns why the filter rejects a transaction from the given sender, if
+// it does. A nil filter accepts everything.
+func (f *txFilter) check(from common.Address, tx *types.Transaction) error {
+	if f == nil {
+		return nil
+	}
+	if _, ok := f.denySenders[from]; ok {
+		return ErrFilteredSender
+	}
+	if _, ok := f.allowSenders[from]; !ok && len(f.allowSenders) > 0 {
+		return ErrFilteredSender
+	}
+	to := tx.To()
+	if to == nil {
+		if len(f.allowTargets) > 0 {
+			return ErrFilteredTarget
+		}
+		return nil
+	}
+	if _, ok := f.denyTargets[*to]; ok {
+		return ErrFilteredTarget
+	}
+	if _, ok := f.allowTargets[*to]; !ok && len(f.allowTargets) > 0 {
+		return ErrFilteredTarget
+	}
+	return nil
+}
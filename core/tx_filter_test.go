@@ -0,0 +1,127 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"crypto/ecdsa"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Tests that the filter rules combine the allow and deny lists as documented.
+func TestTxFilterRules(t *testing.T) {
+	var (
+		alice    = common.Address{0x0a}
+		bob      = common.Address{0x0b}
+		contract = common.Address{0xc0}
+		other    = common.Address{0xff}
+	)
+	call := func(to common.Address) *types.Transaction {
+		return types.NewTransaction(0, to, common.Big0, big.NewInt(21000), common.Big1, nil)
+	}
+	create := types.NewContractCreation(0, common.Big0, big.NewInt(100000), common.Big1, nil)
+
+	tests := []struct {
+		filter *TxFilter
+		from   common.Address
+		tx     *types.Transaction
+		err    error
+	}{
+		{nil, alice, call(other), nil},
+		{&TxFilter{}, alice, create, nil},
+		{&TxFilter{DenySenders: []common.Address{bob}}, alice, call(other), nil},
+		{&TxFilter{DenySenders: []common.Address{bob}}, bob, call(other), ErrFilteredSender},
+		{&TxFilter{AllowSenders: []common.Address{alice}}, alice, call(other), nil},
+		{&TxFilter{AllowSenders: []common.Address{alice}}, bob, call(other), ErrFilteredSender},
+		{&TxFilter{AllowSenders: []common.Address{alice}, DenySenders: []common.Address{alice}}, alice, call(other), ErrFilteredSender},
+		{&TxFilter{DenyTargets: []common.Address{contract}}, alice, call(contract), ErrFilteredTarget},
+		{&TxFilter{DenyTargets: []common.Address{contract}}, alice, create, nil},
+		{&TxFilter{AllowTargets: []common.Address{contract}}, alice, call(contract), nil},
+		{&TxFilter{AllowTargets: []common.Address{contract}}, alice, call(other), ErrFilteredTarget},
+		{&TxFilter{AllowTargets: []common.Address{contract}}, alice, create, ErrFilteredTarget},
+	}
+	for i, tt := range tests {
+		var filter *txFilter
+		if tt.filter != nil {
+			filter = tt.filter.compile()
+		}
+		if err := filter.check(tt.from, tt.tx); err != tt.err {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, tt.err)
+		}
+	}
+}
+
+// Tests that the pool loads its filter from disk, and that updating it drops the
+// pooled transactions it rejects.
+func TestTxPoolFilter(t *testing.T) {
+	var (
+		alice, _ = crypto.GenerateKey()
+		bob, _   = crypto.GenerateKey()
+	)
+	dir, err := ioutil.TempDir("", "txfilter-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := testTxPoolConfig
+	config.Filter = filepath.Join(dir, "filter.json")
+	blob := []byte(`{"denySenders": ["` + crypto.PubkeyToAddress(bob.PublicKey).Hex() + `"]}`)
+	if err := ioutil.WriteFile(config.Filter, blob, 0644); err != nil {
+		t.Fatal(err)
+	}
+	pool, _ := setupTxPoolWithConfig(config)
+	for _, key := range []*ecdsa.PrivateKey{alice, bob} {
+		pool.currentState.AddBalance(crypto.PubkeyToAddress(key.PublicKey), big.NewInt(1000000000), common.Big0, common.Big0)
+	}
+	defer pool.Stop()
+
+	if err := pool.AddRemote(pricedTransaction(0, big.NewInt(100000), big.NewInt(1), alice)); err != nil {
+		t.Fatalf("failed to add allowed transaction: %v", err)
+	}
+	if err := pool.AddRemote(pricedTransaction(0, big.NewInt(100000), big.NewInt(1), bob)); err != ErrFilteredSender {
+		t.Fatalf("denied transaction error mismatch: have %v, want %v", err, ErrFilteredSender)
+	}
+	// Allowing only bob drops the pooled transactions of alice
+	pool.SetFilter(&TxFilter{AllowSenders: []common.Address{crypto.PubkeyToAddress(bob.PublicKey)}})
+
+	tx := pricedTransaction(0, big.NewInt(100000), big.NewInt(1), bob)
+	if err := pool.AddRemote(tx); err != nil {
+		t.Fatalf("failed to add newly allowed transaction: %v", err)
+	}
+	if pending, _ := pool.Stats(); pending != 1 {
+		t.Fatalf("pending transactions mismatch: have %d, want %d", pending, 1)
+	}
+	if pool.Filtered(tx) || !pool.Filtered(pricedTransaction(1, big.NewInt(100000), big.NewInt(1), alice)) {
+		t.Errorf("filtered transactions misreported")
+	}
+	// Removing the filter accepts everyone again
+	pool.SetFilter(nil)
+	if pool.Filter() != nil {
+		t.Errorf("filter not removed")
+	}
+	if err := pool.AddRemote(pricedTransaction(0, big.NewInt(100000), big.NewInt(1), alice)); err != nil {
+		t.Fatalf("failed to add transaction without filter: %v", err)
+	}
+}
@@ -0,0 +1,304 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// TxIndexProgress is the progress of the transaction indexer in bringing the
+// lookup entries in line with the configured block range.
+type TxIndexProgress struct {
+	Indexed   uint64 `json:"indexed"`   // Number of blocks in the range whose transactions are indexed
+	Remaining uint64 `json:"remaining"` // Number of blocks in the range whose transactions still need indexing
+	Tail      uint64 `json:"tail"`      // Number of the oldest block whose transactions are indexed
+	Limit     uint64 `json:"limit"`     // Number of recent blocks to index, 0 for all
+}
+
+// Done returns whether all the blocks in the range are indexed.
+func (p TxIndexProgress) Done() bool {
+	return p.Remaining == 0
+}
+
+// TxIndexer maintains the transaction lookup entries of the most recent blocks
+// in the background. Lookup entries of new blocks are written during import
+// by the blockchain; the indexer moves the tail of the index along with the
+// chain head, deleting the entries of the blocks falling out of the range, and
+// writes any entries missing from the range, e.g. after the range is extended.
+//
+// Like the ChainIndexer, the work is done in sections of blocks with a pause in
+// between to prevent database thrashing. Every section is committed atomically
+// along with the updated tail, so the indexer resumes where it left off after a
+// crash.
+type TxIndexer struct {
+	db         ethdb.Database // Chain database to maintain the lookup entries in
+	limit      uint64         // Number of recent blocks to index, 0 for all
+	section    uint64         // Number of blocks to (un)index in one go
+	throttling time.Duration  // Pause between two sections
+
+	active uint32          // Flag whether the event loop was started
+	quit   chan chan error // Quit channel to tear down the event loop
+
+	head uint64       // Current chain head the indexed range is relative to
+	lock sync.RWMutex // Lock protecting the chain head
+
+	logged time.Time // Time of the last progress log, zero if none since the last completion
+	log    log.Logger
+}
+
+// NewTxIndexer creates a transaction indexer keeping the lookup entries of the
+// given number of recent blocks, or of all blocks if the limit is 0.
+func NewTxIndexer(db ethdb.Database, limit uint64, section uint64, throttling time.Duration) *TxIndexer {
+	return &TxIndexer{
+		db:         db,
+		limit:      limit,
+		section:    section,
+		throttling: throttling,
+		quit:       make(chan chan error),
+		log:        log.New("type", "txindex"),
+	}
+}
+
+// Start creates a goroutine to feed chain head events into the indexer and to
+// maintain the index in the background.
+func (ti *TxIndexer) Start(currentHeader *types.Header, chainEventer func(ch chan<- ChainEvent) event.Subscription) {
+	atomic.StoreUint32(&ti.active, 1)
+	go ti.loop(currentHeader, chainEventer)
+}
+
+// Close tears down the background indexing, waiting for the section being
+// processed to be committed.
+func (ti *TxIndexer) Close() error {
+	if atomic.LoadUint32(&ti.active) == 0 {
+		return nil
+	}
+	errc := make(chan error)
+	ti.quit <- errc
+	return <-errc
+}
+
+// loop is the event loop of the indexer, processing a section whenever there's
+// work to be done and the throttling pause passed.
+func (ti *TxIndexer) loop(currentHeader *types.Header, chainEventer func(ch chan<- ChainEvent) event.Subscription) {
+	events := make(chan ChainEvent, 10)
+	sub := chainEventer(events)
+	defer sub.Unsubscribe()
+
+	ti.setHead(currentHeader.Number.Uint64())
+
+	var (
+		pending  = true           // Whether there may be work to do
+		throttle <-chan time.Time // Timer to process the next section on
+	)
+	for {
+		if pending && throttle == nil {
+			throttle = time.After(ti.throttling)
+		}
+		select {
+		case errc := <-ti.quit:
+			// Transaction indexer terminating, report no failure and abort
+			errc <- nil
+			return
+
+		case ev, ok := <-events:
+			// Received a new event, ensure it's not nil (closing) and update
+			if !ok {
+				errc := <-ti.quit
+				errc <- nil
+				return
+			}
+			ti.setHead(ev.Block.NumberU64())
+			pending = true
+
+		case <-throttle:
+			throttle, pending = nil, ti.step()
+		}
+	}
+}
+
+// setHead updates the chain head the indexed range is relative to.
+func (ti *TxIndexer) setHead(head uint64) {
+	ti.lock.Lock()
+	ti.head = head
+	ti.lock.Unlock()
+}
+
+// target returns the number of the oldest block to index for a chain head.
+func (ti *TxIndexer) target(head uint64) uint64 {
+	if ti.limit == 0 || head+1 <= ti.limit {
+		return 0
+	}
+	return head + 1 - ti.limit
+}
+
+// tail returns the number of the oldest block whose transactions are indexed.
+// Databases predating the indexer have the entire chain indexed.
+func (ti *TxIndexer) tail() (uint64, bool) {
+	if tail := GetTxIndexTail(ti.db); tail != nil {
+		return *tail, true
+	}
+	return 0, false
+}
+
+// step indexes or unindexes the next section of blocks to move the tail of the
+// index towards the target, returning whether further work remains.
+func (ti *TxIndexer) step() bool {
+	ti.lock.RLock()
+	head := ti.head
+	ti.lock.RUnlock()
+
+	var (
+		target       = ti.target(head)
+		tail, stored = ti.tail()
+		start        = time.Now()
+	)
+	switch {
+	case tail < target:
+		// Blocks fell out of the range, delete the entries from the tail up
+		end := tail + ti.section
+		if end > target {
+			end = target
+		}
+		txs, err := ti.unindex(tail, end)
+		if err != nil {
+			ti.log.Error("Transaction unindexing failed", "from", tail, "to", end, "err", err)
+			return false
+		}
+		ti.log.Debug("Unindexed transactions", "from", tail, "to", end-1, "txs", txs, "elapsed", common.PrettyDuration(time.Since(start)))
+		switch {
+		case end == target:
+			if !ti.logged.IsZero() {
+				ti.log.Info("Unindexed transactions out of range", "tail", target, "limit", ti.limit)
+				ti.logged = time.Time{}
+			}
+		case time.Since(ti.logged) > 8*time.Second:
+			ti.log.Info("Unindexing transactions out of range", "tail", end, "remaining", target-end)
+			ti.logged = time.Now()
+		}
+		return end < target
+
+	case tail > target:
+		// Blocks are missing from the range, write the entries from the tail down
+		from := target
+		if tail-target > ti.section {
+			from = tail - ti.section
+		}
+		txs, err := ti.index(from, tail)
+		if err != nil {
+			ti.log.Error("Transaction indexing failed", "from", from, "to", tail, "err", err)
+			return false
+		}
+		ti.log.Debug("Indexed transactions", "from", from, "to", tail-1, "txs", txs, "elapsed", common.PrettyDuration(time.Since(start)))
+		switch {
+		case from == target:
+			if !ti.logged.IsZero() {
+				ti.log.Info("Indexed transactions in range", "tail", target, "limit", ti.limit)
+				ti.logged = time.Time{}
+			}
+		case time.Since(ti.logged) > 8*time.Second:
+			ti.log.Info("Indexing transactions in range", "tail", from, "remaining", from-target)
+			ti.logged = time.Now()
+		}
+		return from > target
+
+	default:
+		// Index in line with the range, start tracking it if not done yet
+		if !stored {
+			WriteTxIndexTail(ti.db, tail)
+		}
+		return false
+	}
+}
+
+// index writes the lookup entries of the canonical blocks in the [from, to)
+// range, and moves the tail of the index down to from.
+func (ti *TxIndexer) index(from uint64, to uint64) (int, error) {
+	batch := ti.db.NewBatch()
+
+	txs := 0
+	for number := from; number < to; number++ {
+		hash := GetCanonicalHash(ti.db, number)
+		if hash == (common.Hash{}) {
+			continue // Above the head after a rewind
+		}
+		block := GetBlock(ti.db, hash, number)
+		if block == nil {
+			continue // Body not available, e.g. header only
+		}
+		if err := WriteTxLookupEntries(batch, block); err != nil {
+			return txs, err
+		}
+		txs += len(block.Transactions())
+	}
+	WriteTxIndexTail(batch, from)
+	return txs, batch.Write()
+}
+
+// unindex deletes the lookup entries of the canonical blocks in the [from, to)
+// range, and moves the tail of the index up to to.
+func (ti *TxIndexer) unindex(from uint64, to uint64) (int, error) {
+	batch := ti.db.NewBatch()
+
+	txs := 0
+	for number := from; number < to; number++ {
+		hash := GetCanonicalHash(ti.db, number)
+		if hash == (common.Hash{}) {
+			continue
+		}
+		body := GetBody(ti.db, hash, number)
+		if body == nil {
+			continue
+		}
+		for _, tx := range body.Transactions {
+			DeleteTxLookupEntry(batch, tx.Hash())
+		}
+		txs += len(body.Transactions)
+	}
+	WriteTxIndexTail(batch, to)
+	return txs, batch.Write()
+}
+
+// Progress returns the progress of the indexer in indexing the transactions of
+// all the blocks in the configured range.
+func (ti *TxIndexer) Progress() TxIndexProgress {
+	ti.lock.RLock()
+	head := ti.head
+	ti.lock.RUnlock()
+
+	var (
+		target  = ti.target(head)
+		tail, _ = ti.tail()
+		total   = head + 1 - target
+	)
+	progress := TxIndexProgress{Tail: tail, Limit: ti.limit}
+	if tail > target {
+		progress.Remaining = tail - target
+		if progress.Remaining > total {
+			progress.Remaining = total
+		}
+	}
+	progress.Indexed = total - progress.Remaining
+	return progress
+}
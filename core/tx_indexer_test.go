@@ -0,0 +1,126 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// makeIndexedChain writes a canonical chain of blocks with two transactions each
+// into a database, along with their lookup entries as the blockchain does.
+func makeIndexedChain(t *testing.T, db ethdb.Database, count int) []*types.Block {
+	var blocks []*types.Block
+	for i := 0; i < count; i++ {
+		txs := []*types.Transaction{
+			types.NewTransaction(uint64(2*i), common.Address{0x01}, big.NewInt(int64(i)), big.NewInt(21000), big.NewInt(1), nil),
+			types.NewTransaction(uint64(2*i+1), common.Address{0x02}, big.NewInt(int64(i)), big.NewInt(21000), big.NewInt(1), nil),
+		}
+		block := types.NewBlock(&types.Header{Number: big.NewInt(int64(i))}, txs, nil, nil)
+		if err := WriteBlock(db, block); err != nil {
+			t.Fatalf("failed to write block %d: %v", i, err)
+		}
+		if err := WriteCanonicalHash(db, block.Hash(), block.NumberU64()); err != nil {
+			t.Fatalf("failed to write canonical hash %d: %v", i, err)
+		}
+		if err := WriteTxLookupEntries(db, block); err != nil {
+			t.Fatalf("failed to write lookup entries %d: %v", i, err)
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks
+}
+
+// checkTxIndex verifies that exactly the transactions of the blocks starting at
+// tail are indexed.
+func checkTxIndex(t *testing.T, db ethdb.Database, blocks []*types.Block, tail uint64) {
+	for _, block := range blocks {
+		for _, tx := range block.Transactions() {
+			hash, number, _ := GetTxLookupEntry(db, tx.Hash())
+			switch {
+			case block.NumberU64() >= tail && hash != block.Hash():
+				t.Errorf("block %d: transaction %x not indexed", block.NumberU64(), tx.Hash())
+			case block.NumberU64() < tail && hash != (common.Hash{}):
+				t.Errorf("block %d: transaction %x indexed at %d below tail %d", block.NumberU64(), tx.Hash(), number, tail)
+			}
+		}
+	}
+	if stored := GetTxIndexTail(db); stored == nil || *stored != tail {
+		t.Errorf("stored tail mismatch: have %v, want %d", stored, tail)
+	}
+}
+
+// runTxIndexer processes sections until the indexer is in line with its range.
+func runTxIndexer(t *testing.T, indexer *TxIndexer, head uint64) {
+	indexer.setHead(head)
+	for i := 0; indexer.step(); i++ {
+		if i > 1000 {
+			t.Fatalf("indexer failed to finish")
+		}
+	}
+}
+
+// Tests that the indexer unindexes the blocks falling out of the range and
+// reindexes them when the range is extended again.
+func TestTxIndexerLimit(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	blocks := makeIndexedChain(t, db, 100)
+	head := uint64(len(blocks) - 1)
+
+	// Legacy database without a tail, everything is indexed
+	indexer := NewTxIndexer(db, 0, 16, 0)
+	indexer.setHead(head)
+	if progress := indexer.Progress(); !progress.Done() || progress.Indexed != 100 {
+		t.Fatalf("legacy progress mismatch: %+v", progress)
+	}
+	runTxIndexer(t, indexer, head)
+	checkTxIndex(t, db, blocks, 0)
+
+	// Limit the index, the old blocks must be unindexed section by section
+	indexer = NewTxIndexer(db, 30, 16, 0)
+	indexer.setHead(head)
+	if !indexer.step() {
+		t.Fatalf("unindexing finished in a single section")
+	}
+	checkTxIndex(t, db, blocks, 16)
+	runTxIndexer(t, indexer, head)
+	checkTxIndex(t, db, blocks, 70)
+
+	// Move the head, the tail must follow it
+	runTxIndexer(t, indexer, head+5)
+	checkTxIndex(t, db, blocks, 75)
+
+	// Extend the range, the missing blocks must be reindexed
+	indexer = NewTxIndexer(db, 50, 16, 0)
+	indexer.setHead(head)
+	if progress := indexer.Progress(); progress.Done() || progress.Remaining != 25 || progress.Indexed != 25 {
+		t.Fatalf("extended progress mismatch: %+v", progress)
+	}
+	runTxIndexer(t, indexer, head)
+	checkTxIndex(t, db, blocks, 50)
+
+	indexer = NewTxIndexer(db, 0, 16, 0)
+	runTxIndexer(t, indexer, head)
+	checkTxIndex(t, db, blocks, 0)
+	if progress := indexer.Progress(); !progress.Done() || progress.Indexed != 100 {
+		t.Fatalf("full progress mismatch: %+v", progress)
+	}
+}
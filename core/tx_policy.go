@@ -0,0 +1,92 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// TxPoolPolicy decides which transactions the pool admits, which ones replace
+// already pooled transactions with the same nonce, which ones are discarded first
+// once the pool fills up and when idle queued transactions are evicted.
+//
+// The transaction pool calls the policy with its lock held, so implementations
+// don't need to be safe for concurrent use as long as they aren't shared between
+// pools. Locally submitted transactions are exempt from the discard and eviction
+// rules of the pool.
+type TxPoolPolicy interface {
+	// Admit checks whether a transaction which passed the validity checks of the
+	// pool may enter it, returning the reason of a rejection.
+	Admit(from common.Address, tx *types.Transaction, local bool) error
+
+	// Replace reports whether a transaction may replace an already pooled one of
+	// the same sender with the same nonce.
+	Replace(old, tx *types.Transaction) bool
+
+	// Less reports whether a transaction has a lower priority than another, the
+	// lowest priority transactions being discarded first when the pool is full.
+	Less(a, b *types.Transaction) bool
+
+	// Expired reports whether the queued transactions of an account last heard
+	// from at the given time are to be evicted.
+	Expired(addr common.Address, beat time.Time) bool
+}
+
+// defaultTxPoolPolicy is the stock policy of the transaction pool, admitting all
+// valid transactions, requiring a price bump for replacements, discarding the
+// cheapest transactions first and evicting queued ones after a lifetime.
+type defaultTxPoolPolicy struct {
+	priceBump uint64        // Minimum price bump percentage to replace a transaction
+	lifetime  time.Duration // Maximum amount of time non-executable transactions are queued
+}
+
+// NewDefaultTxPoolPolicy creates the stock transaction pool policy with the price
+// bump and lifetime of the given configuration. Custom policies can embed it to
+// only override some of the rules.
+func NewDefaultTxPoolPolicy(config TxPoolConfig) TxPoolPolicy {
+	return &defaultTxPoolPolicy{
+		priceBump: config.PriceBump,
+		lifetime:  config.Lifetime,
+	}
+}
+
+// Admit implements TxPoolPolicy, accepting every valid transaction.
+func (p *defaultTxPoolPolicy) Admit(from common.Address, tx *types.Transaction, local bool) error {
+	return nil
+}
+
+// Replace implements TxPoolPolicy, accepting replacements paying a gas price at
+// least the price bump percentage above the old one.
+func (p *defaultTxPoolPolicy) Replace(old, tx *types.Transaction) bool {
+	threshold := new(big.Int).Div(new(big.Int).Mul(old.GasPrice(), big.NewInt(100+int64(p.priceBump))), big.NewInt(100))
+	return threshold.Cmp(tx.GasPrice()) < 0
+}
+
+// Less implements TxPoolPolicy, prioritizing transactions by gas price.
+func (p *defaultTxPoolPolicy) Less(a, b *types.Transaction) bool {
+	return a.GasPrice().Cmp(b.GasPrice()) < 0
+}
+
+// Expired implements TxPoolPolicy, evicting the queued transactions of accounts
+// idle for longer than the lifetime.
+func (p *defaultTxPoolPolicy) Expired(addr common.Address, beat time.Time) bool {
+	return time.Since(beat) > p.lifetime
+}
@@ -0,0 +1,166 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// errRateLimited is returned by the fifoPolicy for senders over their allowance.
+var errRateLimited = errors.New("sender rate limited")
+
+// fifoPolicy is a test policy serving whitelisted senders first come first served
+// ahead of everyone else, and rate limiting the other senders.
+type fifoPolicy struct {
+	TxPoolPolicy
+
+	whitelist map[common.Address]bool
+	admitted  map[common.Address]int
+	limit     int
+}
+
+func (p *fifoPolicy) Admit(from common.Address, tx *types.Transaction, local bool) error {
+	if !p.whitelist[from] {
+		if p.admitted[from] >= p.limit {
+			return errRateLimited
+		}
+		p.admitted[from]++
+	}
+	return nil
+}
+
+func (p *fifoPolicy) Replace(old, tx *types.Transaction) bool {
+	if from, _ := types.Sender(types.HomesteadSigner{}, old); p.whitelist[from] {
+		return false
+	}
+	return p.TxPoolPolicy.Replace(old, tx)
+}
+
+func (p *fifoPolicy) Less(a, b *types.Transaction) bool {
+	fromA, _ := types.Sender(types.HomesteadSigner{}, a)
+	fromB, _ := types.Sender(types.HomesteadSigner{}, b)
+	if p.whitelist[fromA] != p.whitelist[fromB] {
+		return p.whitelist[fromB]
+	}
+	return p.TxPoolPolicy.Less(a, b)
+}
+
+// Tests that the default policy implements the stock rules of the pool.
+func TestDefaultTxPoolPolicy(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	policy := NewDefaultTxPoolPolicy(TxPoolConfig{PriceBump: 10, Lifetime: time.Hour})
+
+	old := pricedTransaction(0, big.NewInt(100000), big.NewInt(100), key)
+	if policy.Replace(old, pricedTransaction(0, big.NewInt(100000), big.NewInt(110), key)) {
+		t.Errorf("replacement without the price bump accepted")
+	}
+	if !policy.Replace(old, pricedTransaction(0, big.NewInt(100000), big.NewInt(111), key)) {
+		t.Errorf("replacement with the price bump rejected")
+	}
+	if !policy.Less(old, pricedTransaction(1, big.NewInt(100000), big.NewInt(101), key)) || policy.Less(old, pricedTransaction(1, big.NewInt(100000), big.NewInt(100), key)) {
+		t.Errorf("transactions not prioritized by gas price")
+	}
+	if policy.Expired(common.Address{}, time.Now().Add(-59*time.Minute)) {
+		t.Errorf("queued transactions expired within their lifetime")
+	}
+	if !policy.Expired(common.Address{}, time.Now().Add(-61*time.Minute)) {
+		t.Errorf("queued transactions not expired after their lifetime")
+	}
+}
+
+// Tests that a custom policy configured for the pool decides on the admission,
+// replacement and discarding of transactions.
+func TestTxPoolCustomPolicy(t *testing.T) {
+	var (
+		vip, _     = crypto.GenerateKey()
+		remote, _  = crypto.GenerateKey()
+		bidder, _  = crypto.GenerateKey()
+		spammer, _ = crypto.GenerateKey()
+	)
+	config := testTxPoolConfig
+	config.GlobalSlots, config.GlobalQueue = 2, 0
+
+	// The default policy discards the cheapest transactions when the pool is full
+	pool, _ := setupTxPoolWithConfig(config)
+	for _, key := range []*ecdsa.PrivateKey{vip, remote, bidder} {
+		pool.currentState.AddBalance(crypto.PubkeyToAddress(key.PublicKey), big.NewInt(1000000000), common.Big0, common.Big0)
+	}
+	if err := pool.AddRemote(pricedTransaction(0, big.NewInt(100000), big.NewInt(1), vip)); err != nil {
+		t.Fatalf("failed to add cheap transaction: %v", err)
+	}
+	if err := pool.AddRemote(pricedTransaction(0, big.NewInt(100000), big.NewInt(5), remote)); err != nil {
+		t.Fatalf("failed to add transaction: %v", err)
+	}
+	if err := pool.AddRemote(pricedTransaction(0, big.NewInt(100000), big.NewInt(10), bidder)); err != nil {
+		t.Fatalf("failed to add expensive transaction: %v", err)
+	}
+	if pending, _ := pool.Content(); pending[crypto.PubkeyToAddress(vip.PublicKey)] != nil {
+		t.Errorf("cheapest transaction not discarded")
+	}
+	pool.Stop()
+
+	// A custom policy keeps the whitelisted transactions instead
+	policy := &fifoPolicy{
+		TxPoolPolicy: NewDefaultTxPoolPolicy(config),
+		whitelist:    map[common.Address]bool{crypto.PubkeyToAddress(vip.PublicKey): true},
+		admitted:     make(map[common.Address]int),
+		limit:        2,
+	}
+	config.Policy = policy
+
+	pool, _ = setupTxPoolWithConfig(config)
+	for _, key := range []*ecdsa.PrivateKey{vip, remote, bidder, spammer} {
+		pool.currentState.AddBalance(crypto.PubkeyToAddress(key.PublicKey), big.NewInt(1000000000), common.Big0, common.Big0)
+	}
+	defer pool.Stop()
+
+	if err := pool.AddRemote(pricedTransaction(0, big.NewInt(100000), big.NewInt(1), vip)); err != nil {
+		t.Fatalf("failed to add whitelisted transaction: %v", err)
+	}
+	if err := pool.AddRemote(pricedTransaction(0, big.NewInt(100000), big.NewInt(5), remote)); err != nil {
+		t.Fatalf("failed to add transaction: %v", err)
+	}
+	if err := pool.AddRemote(pricedTransaction(0, big.NewInt(100000), big.NewInt(10), bidder)); err != nil {
+		t.Fatalf("failed to add expensive transaction: %v", err)
+	}
+	pending, _ := pool.Content()
+	if pending[crypto.PubkeyToAddress(vip.PublicKey)] == nil {
+		t.Errorf("whitelisted transaction discarded")
+	}
+	if pending[crypto.PubkeyToAddress(remote.PublicKey)] != nil {
+		t.Errorf("lowest priority transaction not discarded")
+	}
+	// Whitelisted transactions are first come first served
+	if err := pool.AddRemote(pricedTransaction(0, big.NewInt(100000), big.NewInt(100), vip)); err != ErrReplaceUnderpriced {
+		t.Errorf("whitelisted transaction replacement error mismatch: have %v, want %v", err, ErrReplaceUnderpriced)
+	}
+	// Other senders are rate limited
+	if err := pool.AddRemote(pricedTransaction(1, big.NewInt(100000), big.NewInt(20), bidder)); err != nil {
+		t.Fatalf("failed to add transaction within the rate limit: %v", err)
+	}
+	if err := pool.AddRemote(pricedTransaction(2, big.NewInt(100000), big.NewInt(30), bidder)); err != errRateLimited {
+		t.Errorf("rate limited transaction error mismatch: have %v, want %v", err, errRateLimited)
+	}
+}
@@ -82,6 +82,14 @@ var (
 	// ErrInsufficientFundsForCreateContrct is returned if the total cost of creating a new contract of transaction
 	// is higher than the balance of the user's account.
 	ErrInvalidSenderForCreateContract = errors.New("not enough balance to create contract!")
+
+	// ErrFilteredSender is returned if the sender of a transaction is rejected by
+	// the admission filter of the transaction pool.
+	ErrFilteredSender = errors.New("sender not allowed")
+
+	// ErrFilteredTarget is returned if the recipient of a transaction (or a
+	// contract creation) is rejected by the admission filter of the pool.
+	ErrFilteredTarget = errors.New("recipient not allowed")
 )
 
 var (
@@ -101,10 +109,13 @@ var (
 	queuedReplaceCounter   = metrics.NewCounter("txpool/queued/replace")
 	queuedRateLimitCounter = metrics.NewCounter("txpool/queued/ratelimit") // Dropped due to rate limiting
 	queuedNofundsCounter   = metrics.NewCounter("txpool/queued/nofunds")   // Dropped due to out-of-funds
+	queuedEvictCounter     = metrics.NewCounter("txpool/queued/evict")     // Dropped due to expiry
 
 	// General tx metrics
 	invalidTxCounter     = metrics.NewCounter("txpool/invalid")
 	underpricedTxCounter = metrics.NewCounter("txpool/underpriced")
+	rejectedTxCounter    = metrics.NewCounter("txpool/rejected") // Dropped due to the pool policy
+	filteredTxCounter    = metrics.NewCounter("txpool/filtered") // Remote ones dropped due to the admission filter
 )
 
 // blockChain provides the state of blockchain and current gas limit to do
@@ -123,6 +134,11 @@ type TxPoolConfig struct {
 	Journal   string        // Journal of local transactions to survive node restarts
 	Rejournal time.Duration // Time interval to regenerate the local transaction journal
 
+	Snapshot         string        // Snapshot of all pooled transactions to survive node restarts (empty = disabled)
+	SnapshotInterval time.Duration // Time interval to regenerate the transaction pool snapshot
+	SnapshotSize     uint64        // Maximum number of transactions to store in and restore from the snapshot
+	SnapshotAge      time.Duration // Maximum age of a snapshot to restore its transactions
+
 	PriceLimit uint64 // Minimum gas price to enforce for acceptance into the pool
 	PriceBump  uint64 // Minimum price bump percentage to replace an already existing transaction (nonce)
 
@@ -132,6 +148,9 @@ type TxPoolConfig struct {
 	GlobalQueue  uint64 // Maximum number of non-executable transaction slots for all accounts
 
 	Lifetime time.Duration // Maximum amount of time non-executable transaction are queued
+
+	Policy TxPoolPolicy `toml:"-"` // Admission, replacement, priority and eviction rules (nil = default)
+	Filter string       // JSON file of the sender and recipient allow/deny lists (see TxFilter)
 }
 
 // DefaultTxPoolConfig contains the default configurations for the transaction
@@ -140,6 +159,10 @@ var DefaultTxPoolConfig = TxPoolConfig{
 	Journal:   "transactions.rlp",
 	Rejournal: time.Hour,
 
+	SnapshotInterval: 10 * time.Minute,
+	SnapshotSize:     5120,
+	SnapshotAge:      3 * time.Hour,
+
 	PriceLimit: 1,
 	PriceBump:  10,
 
@@ -159,6 +182,18 @@ func (config *TxPoolConfig) sanitize() TxPoolConfig {
 		log.Warn("Sanitizing invalid txpool journal time", "provided", conf.Rejournal, "updated", time.Second)
 		conf.Rejournal = time.Second
 	}
+	if conf.SnapshotInterval < time.Second {
+		log.Warn("Sanitizing invalid txpool snapshot time", "provided", conf.SnapshotInterval, "updated", time.Second)
+		conf.SnapshotInterval = time.Second
+	}
+	if conf.SnapshotSize < 1 {
+		log.Warn("Sanitizing invalid txpool snapshot size", "provided", conf.SnapshotSize, "updated", DefaultTxPoolConfig.SnapshotSize)
+		conf.SnapshotSize = DefaultTxPoolConfig.SnapshotSize
+	}
+	if conf.SnapshotAge <= 0 {
+		log.Warn("Sanitizing invalid txpool snapshot age", "provided", conf.SnapshotAge, "updated", DefaultTxPoolConfig.SnapshotAge)
+		conf.SnapshotAge = DefaultTxPoolConfig.SnapshotAge
+	}
 	if conf.PriceLimit < 1 {
 		log.Warn("Sanitizing invalid txpool price limit", "provided", conf.PriceLimit, "updated", DefaultTxPoolConfig.PriceLimit)
 		conf.PriceLimit = DefaultTxPoolConfig.PriceLimit
@@ -167,6 +202,9 @@ func (config *TxPoolConfig) sanitize() TxPoolConfig {
 		log.Warn("Sanitizing invalid txpool price bump", "provided", conf.PriceBump, "updated", DefaultTxPoolConfig.PriceBump)
 		conf.PriceBump = DefaultTxPoolConfig.PriceBump
 	}
+	if conf.Policy == nil {
+		conf.Policy = NewDefaultTxPoolPolicy(conf)
+	}
 	return conf
 }
 
@@ -195,6 +233,7 @@ type TxPool struct {
 
 	locals  *accountSet // Set of local transaction to exepmt from evicion rules
 	journal *txJournal  // Journal of local transaction to back up to disk
+	filter  *txFilter   // Sender and recipient admission filter (nil = accept all)
 
 	pending map[common.Address]*txList         // All currently processable transactions
 	queue   map[common.Address]*txList         // Queued but non-processable transactions
@@ -227,9 +266,18 @@ func NewTxPool(config TxPoolConfig, chainconfig *params.ChainConfig, chain block
 		gasPrice:    new(big.Int).SetUint64(config.PriceLimit),
 	}
 	pool.locals = newAccountSet(pool.signer)
-	pool.priced = newTxPricedList(&pool.all)
+	pool.priced = newTxPricedList(&pool.all, config.Policy)
 	pool.reset(nil, chain.CurrentBlock().Header())
 
+	// If an admission filter is configured, load it from disk, refusing to run
+	// without it rather than accepting everything
+	if config.Filter != "" {
+		filter, err := LoadTxFilter(config.Filter)
+		if err != nil {
+			log.Crit("Failed to load transaction filter", "err", err)
+		}
+		pool.filter = filter.compile()
+	}
 	// If local transactions and journaling is enabled, load from disk
 	if !config.NoLocals && config.Journal != "" {
 		pool.journal = newTxJournal(config.Journal)
@@ -241,6 +289,12 @@ func NewTxPool(config TxPoolConfig, chainconfig *params.ChainConfig, chain block
 			log.Warn("Failed to rotate transaction journal", "err", err)
 		}
 	}
+	// If the pool snapshot is enabled, restore the transactions of the last run
+	if config.Snapshot != "" {
+		if err := pool.loadSnapshot(); err != nil {
+			log.Warn("Failed to load transaction pool snapshot", "err", err)
+		}
+	}
 	// Subscribe events from blockchain
 	pool.chainHeadSub = pool.chain.SubscribeChainHeadEvent(pool.chainHeadCh)
 
@@ -269,6 +323,9 @@ func (pool *TxPool) loop() {
 	journal := time.NewTicker(pool.config.Rejournal)
 	defer journal.Stop()
 
+	snapshot := time.NewTicker(pool.config.SnapshotInterval)
+	defer snapshot.Stop()
+
 	// Track the previous head headers for transaction reorgs
 	head := pool.chain.CurrentBlock()
 
@@ -311,10 +368,11 @@ func (pool *TxPool) loop() {
 				if pool.locals.contains(addr) {
 					continue
 				}
-				// Any non-locals old enough should be removed
-				if time.Since(pool.beats[addr]) > pool.config.Lifetime {
+				// Any non-locals expired by the policy should be removed
+				if pool.config.Policy.Expired(addr, pool.beats[addr]) {
 					for _, tx := range pool.queue[addr].Flatten() {
 						pool.removeTx(tx.Hash())
+						queuedEvictCounter.Inc(1)
 					}
 				}
 			}
@@ -329,6 +387,14 @@ func (pool *TxPool) loop() {
 				}
 				pool.mu.Unlock()
 			}
+
+		// Handle transaction pool snapshot regeneration
+		case <-snapshot.C:
+			if pool.config.Snapshot != "" {
+				if err := pool.saveSnapshot(); err != nil {
+					log.Warn("Failed to save transaction pool snapshot", "err", err)
+				}
+			}
 		}
 	}
 }
@@ -437,6 +503,11 @@ func (pool *TxPool) Stop() {
 	if pool.journal != nil {
 		pool.journal.close()
 	}
+	if pool.config.Snapshot != "" {
+		if err := pool.saveSnapshot(); err != nil {
+			log.Warn("Failed to save transaction pool snapshot", "err", err)
+		}
+	}
 	log.Info("Transaction pool stopped")
 }
 
@@ -467,6 +538,57 @@ func (pool *TxPool) SetGasPrice(price *big.Int) {
 	// log.Info("Transaction pool price threshold updated", "price", price)
 }
 
+// Filter returns the admission filter of the transaction pool, nil if none is
+// set.
+func (pool *TxPool) Filter() *TxFilter {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	if pool.filter == nil {
+		return nil
+	}
+	return pool.filter.config
+}
+
+// SetFilter replaces the admission filter of the transaction pool, and drops all
+// pooled transactions it rejects. A nil filter accepts all transactions.
+func (pool *TxPool) SetFilter(filter *TxFilter) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	if filter == nil {
+		pool.filter = nil
+		log.Info("Transaction pool filter removed")
+		return
+	}
+	pool.filter = filter.compile()
+
+	var drop []common.Hash
+	for hash, tx := range pool.all {
+		from, _ := types.Sender(pool.signer, tx) // already validated
+		if pool.filter.check(from, tx) != nil {
+			drop = append(drop, hash)
+		}
+	}
+	for _, hash := range drop {
+		pool.removeTx(hash)
+	}
+	log.Info("Transaction pool filter updated", "dropped", len(drop))
+}
+
+// Filtered reports whether a transaction is rejected by the admission filter of
+// the transaction pool.
+func (pool *TxPool) Filtered(tx *types.Transaction) bool {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	from, err := types.Sender(pool.signer, tx)
+	if err != nil {
+		return true
+	}
+	return pool.filter.check(from, tx) != nil
+}
+
 // State returns the virtual managed state of the transaction pool.
 func (pool *TxPool) State() *state.ManagedState {
 	pool.mu.RLock()
@@ -545,6 +667,75 @@ func (pool *TxPool) local() map[common.Address]types.Transactions {
 	return txs
 }
 
+// snapshot collects the transactions to store in the pool snapshot, at most the
+// configured snapshot size. Local transactions go first, then the pending remote
+// ones and finally the queued remote ones, each account's in nonce order.
+func (pool *TxPool) snapshot() []txSnapshotEntry {
+	var (
+		entries = make([]txSnapshotEntry, 0, len(pool.all))
+		limit   = int(pool.config.SnapshotSize)
+	)
+	collect := func(lists map[common.Address]*txList, local bool) {
+		for addr, list := range lists {
+			if pool.locals.contains(addr) != local {
+				continue
+			}
+			for _, tx := range list.Flatten() {
+				if len(entries) >= limit {
+					return
+				}
+				entries = append(entries, txSnapshotEntry{Tx: tx, Local: local})
+			}
+		}
+	}
+	collect(pool.pending, true)
+	collect(pool.queue, true)
+	collect(pool.pending, false)
+	collect(pool.queue, false)
+
+	return entries
+}
+
+// saveSnapshot regenerates the pool snapshot from the current pool contents.
+func (pool *TxPool) saveSnapshot() error {
+	pool.mu.RLock()
+	entries := pool.snapshot()
+	pool.mu.RUnlock()
+
+	if err := writeTxSnapshot(pool.config.Snapshot, entries); err != nil {
+		return err
+	}
+	log.Debug("Saved transaction pool snapshot", "transactions", len(entries))
+	return nil
+}
+
+// loadSnapshot restores the transactions of the pool snapshot unless it's older
+// than the configured age, revalidating them against the current head.
+func (pool *TxPool) loadSnapshot() error {
+	entries, taken, err := readTxSnapshot(pool.config.Snapshot, pool.config.SnapshotSize)
+	if len(entries) == 0 {
+		return err
+	}
+	if age := time.Since(taken); age > pool.config.SnapshotAge {
+		log.Warn("Discarding stale transaction pool snapshot", "age", common.PrettyDuration(age), "transactions", len(entries))
+		return err
+	}
+	var locals, remotes []*types.Transaction
+	for _, entry := range entries {
+		if entry.Local {
+			locals = append(locals, entry.Tx)
+		} else {
+			remotes = append(remotes, entry.Tx)
+		}
+	}
+	pool.AddLocals(locals)
+	pool.AddRemotes(remotes)
+
+	pending, queued := pool.Stats()
+	log.Info("Loaded transaction pool snapshot", "transactions", len(entries), "pending", pending, "queued", queued, "age", common.PrettyDuration(time.Since(taken)))
+	return err
+}
+
 // validateTx checks whether a transaction is valid according to the consensus
 // rules and adheres to some heuristic limits of the local node (price and size).
 func (pool *TxPool) validateTx(tx *types.Transaction, local bool) error {
@@ -617,6 +808,21 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (bool, error) {
 		invalidTxCounter.Inc(1)
 		return false, err
 	}
+	// If the sender or recipient is filtered out, discard it
+	from, _ := types.Sender(pool.signer, tx) // already validated
+	if err := pool.filter.check(from, tx); err != nil {
+		log.Trace("Discarding filtered transaction", "hash", hash, "from", from, "to", tx.To(), "err", err)
+		if !local {
+			filteredTxCounter.Inc(1)
+		}
+		return false, err
+	}
+	// If the pool policy doesn't admit the transaction, discard it
+	if err := pool.config.Policy.Admit(from, tx, local || pool.locals.contains(from)); err != nil {
+		log.Trace("Discarding rejected transaction", "hash", hash, "err", err)
+		rejectedTxCounter.Inc(1)
+		return false, err
+	}
 	// If the transaction pool is full, discard underpriced transactions
 	if uint64(len(pool.all)) >= pool.config.GlobalSlots+pool.config.GlobalQueue {
 		// If the new transaction is underpriced, don't accept it
@@ -634,10 +840,9 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (bool, error) {
 		}
 	}
 	// If the transaction is replacing an already pending one, do directly
-	from, _ := types.Sender(pool.signer, tx) // already validated
 	if list := pool.pending[from]; list != nil && list.Overlaps(tx) {
 		// Nonce already pending, check if required price bump is met
-		inserted, old := list.Add(tx, pool.config.PriceBump)
+		inserted, old := list.Add(tx, pool.config.Policy)
 		if !inserted {
 			pendingDiscardCounter.Inc(1)
 			return false, ErrReplaceUnderpriced
@@ -679,7 +884,7 @@ func (pool *TxPool) enqueueTx(hash common.Hash, tx *types.Transaction) (bool, er
 	if pool.queue[from] == nil {
 		pool.queue[from] = newTxList(false)
 	}
-	inserted, old := pool.queue[from].Add(tx, pool.config.PriceBump)
+	inserted, old := pool.queue[from].Add(tx, pool.config.Policy)
 	if !inserted {
 		// An older transaction was better, discard this
 		queuedDiscardCounter.Inc(1)
@@ -718,7 +923,7 @@ func (pool *TxPool) promoteTx(addr common.Address, hash common.Hash, tx *types.T
 	}
 	list := pool.pending[addr]
 
-	inserted, old := list.Add(tx, pool.config.PriceBump)
+	inserted, old := list.Add(tx, pool.config.Policy)
 	if !inserted {
 		// An older transaction was better, discard this
 		delete(pool.all, hash)
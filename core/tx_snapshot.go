@@ -0,0 +1,110 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// txSnapshotVersion is the version of the transaction pool snapshot format.
+const txSnapshotVersion = 1
+
+// txSnapshotMeta is the header of a transaction pool snapshot.
+type txSnapshotMeta struct {
+	Version uint64
+	Time    uint64 // Unix time the snapshot was taken at
+}
+
+// txSnapshotEntry is a pooled transaction stored in a snapshot, along with its
+// local flag.
+type txSnapshotEntry struct {
+	Tx    *types.Transaction
+	Local bool
+}
+
+// writeTxSnapshot atomically replaces the transaction pool snapshot at the given
+// path with the given entries.
+func writeTxSnapshot(path string, entries []txSnapshotEntry) error {
+	out, err := os.OpenFile(path+".new", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(path + ".new") // Fails once renamed
+	defer out.Close()
+
+	buf := bufio.NewWriter(out)
+	if err := rlp.Encode(buf, &txSnapshotMeta{Version: txSnapshotVersion, Time: uint64(time.Now().Unix())}); err != nil {
+		return err
+	}
+	for i := range entries {
+		if err := rlp.Encode(buf, &entries[i]); err != nil {
+			return err
+		}
+	}
+	if err := buf.Flush(); err != nil {
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Rename(path+".new", path)
+}
+
+// readTxSnapshot reads at most limit entries of the transaction pool snapshot at
+// the given path, returning them along with the time the snapshot was taken at.
+// A missing snapshot has no entries.
+func readTxSnapshot(path string, limit uint64) ([]txSnapshotEntry, time.Time, error) {
+	in, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, time.Time{}, nil
+	}
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer in.Close()
+
+	stream := rlp.NewStream(bufio.NewReader(in), 0)
+
+	var meta txSnapshotMeta
+	if err := stream.Decode(&meta); err != nil {
+		return nil, time.Time{}, err
+	}
+	if meta.Version != txSnapshotVersion {
+		return nil, time.Time{}, fmt.Errorf("unsupported snapshot version %d", meta.Version)
+	}
+	var entries []txSnapshotEntry
+	for uint64(len(entries)) < limit {
+		var entry txSnapshotEntry
+		if err := stream.Decode(&entry); err == io.EOF {
+			break
+		} else if err != nil {
+			return entries, time.Unix(int64(meta.Time), 0), err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, time.Unix(int64(meta.Time), 0), nil
+}
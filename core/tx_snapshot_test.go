@@ -0,0 +1,129 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"crypto/ecdsa"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that the pool snapshot restores both the local and remote, pending and
+// queued transactions across restarts, revalidated against the current state and
+// within the configured size and age limits.
+func TestTxPoolSnapshot(t *testing.T) {
+	var (
+		local, _  = crypto.GenerateKey()
+		remote, _ = crypto.GenerateKey()
+		stale, _  = crypto.GenerateKey()
+	)
+	dir, err := ioutil.TempDir("", "txsnapshot-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := testTxPoolConfig
+	config.Snapshot = filepath.Join(dir, "transactions.snapshot")
+
+	// Fill a pool with pending and queued transactions and shut it down
+	db, _ := ethdb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+	blockchain := &testBlockChain{statedb, big.NewInt(1000000), new(event.Feed)}
+
+	pool := NewTxPool(config, params.TestChainConfig, blockchain)
+	for _, key := range []*ecdsa.PrivateKey{local, remote, stale} {
+		pool.currentState.AddBalance(crypto.PubkeyToAddress(key.PublicKey), big.NewInt(1000000000), common.Big0, common.Big0)
+	}
+	if err := pool.AddLocal(pricedTransaction(0, big.NewInt(100000), big.NewInt(1), local)); err != nil {
+		t.Fatalf("failed to add local transaction: %v", err)
+	}
+	if err := pool.AddLocal(pricedTransaction(2, big.NewInt(100000), big.NewInt(1), local)); err != nil {
+		t.Fatalf("failed to add queued local transaction: %v", err)
+	}
+	for _, tx := range []*types.Transaction{pricedTransaction(0, big.NewInt(100000), big.NewInt(1), remote), pricedTransaction(1, big.NewInt(100000), big.NewInt(1), remote), pricedTransaction(3, big.NewInt(100000), big.NewInt(1), remote), pricedTransaction(0, big.NewInt(100000), big.NewInt(1), stale)} {
+		if err := pool.AddRemote(tx); err != nil {
+			t.Fatalf("failed to add remote transaction: %v", err)
+		}
+	}
+	if pending, queued := pool.Stats(); pending != 4 || queued != 2 {
+		t.Fatalf("pool contents mismatch: have %d pending, %d queued, want 4 and 2", pending, queued)
+	}
+	pool.Stop()
+
+	// Restart on a state including the transaction of the stale account
+	statedb.SetNonce(crypto.PubkeyToAddress(stale.PublicKey), 1)
+	restart := func(config TxPoolConfig) *TxPool {
+		blockchain = &testBlockChain{statedb, big.NewInt(1000000), new(event.Feed)}
+		return NewTxPool(config, params.TestChainConfig, blockchain)
+	}
+	pool = restart(config)
+	if pending, queued := pool.Stats(); pending != 3 || queued != 2 {
+		t.Errorf("restored contents mismatch: have %d pending, %d queued, want 3 and 2", pending, queued)
+	}
+	if !pool.locals.contains(crypto.PubkeyToAddress(local.PublicKey)) || pool.locals.contains(crypto.PubkeyToAddress(remote.PublicKey)) {
+		t.Errorf("local flags not restored")
+	}
+	pool.Stop()
+
+	// Snapshots are only restored up to the size limit, locals first
+	limited := config
+	limited.SnapshotSize = 2
+
+	pool = restart(limited)
+	if pending, queued := pool.Stats(); pending != 1 || queued != 1 {
+		t.Errorf("size limited contents mismatch: have %d pending, %d queued, want 1 and 1", pending, queued)
+	}
+	pool.Stop()
+
+	// Snapshots older than the age limit are discarded
+	expired := config
+	expired.SnapshotAge = time.Nanosecond
+
+	pool = restart(expired)
+	if pending, queued := pool.Stats(); pending != 0 || queued != 0 {
+		t.Errorf("stale snapshot restored: have %d pending, %d queued", pending, queued)
+	}
+	pool.Stop()
+}
+
+// Tests that unset or invalid snapshot limits fall back to the defaults instead
+// of discarding every snapshot.
+func TestTxPoolSnapshotSanitize(t *testing.T) {
+	config := testTxPoolConfig
+	config.SnapshotSize, config.SnapshotAge = 0, -time.Hour
+
+	config = config.sanitize()
+	if config.SnapshotSize != DefaultTxPoolConfig.SnapshotSize {
+		t.Errorf("snapshot size mismatch: have %d, want %d", config.SnapshotSize, DefaultTxPoolConfig.SnapshotSize)
+	}
+	if config.SnapshotAge != DefaultTxPoolConfig.SnapshotAge {
+		t.Errorf("snapshot age mismatch: have %v, want %v", config.SnapshotAge, DefaultTxPoolConfig.SnapshotAge)
+	}
+}
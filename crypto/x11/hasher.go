@@ -0,0 +1,118 @@
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package x11
+
+import (
+	"encoding/binary"
+	"runtime"
+	"sync"
+)
+
+// Hasher computes the chained X11 proof-of-work hashes of a header hash and a
+// nonce. The hashed seed is the header hash followed by the big endian nonce and
+// 24 zero bytes. All state is reused between hashes, so a Hasher does not
+// allocate once created, apart from growing its batch buffer. A Hasher is not
+// safe for concurrent use, mining threads should create one each. A single
+// caller can spread a batch over all CPUs with HashBatchParallel instead.
+type Hasher struct {
+	hash    *Hash      // Per algorithm states and intermediate buffers
+	seed    []byte     // Header hash, nonce and padding
+	result  [32]byte   // Result of the last single hash
+	results [][32]byte // Results of the last batch
+	workers []*Hasher  // Hashers of the parallel batch threads, created on demand
+}
+
+// NewHasher returns a new reusable X11 hasher.
+func NewHasher() *Hasher {
+	return &Hasher{
+		hash: New(),
+		seed: make([]byte, 0, 64),
+	}
+}
+
+// reset prepares the seed for hashing nonces of the given header hash.
+func (h *Hasher) reset(header []byte) {
+	h.seed = append(h.seed[:0], header...)
+	for i := 0; i < 32; i++ {
+		h.seed = append(h.seed, 0)
+	}
+}
+
+// Hash computes the hash of the header hash and nonce, chaining the algorithms
+// in the given order. The returned slice is owned by the hasher and only valid
+// until its next use.
+func (h *Hasher) Hash(header []byte, nonce uint64, order []byte) []byte {
+	h.reset(header)
+	binary.BigEndian.PutUint64(h.seed[len(header):], nonce)
+	h.hash.Hash(h.seed, h.result[:], order)
+	return h.result[:]
+}
+
+// Sum computes the hash of the header hash and nonce, chaining the algorithms in
+// the given order, and stores it in dst.
+func (h *Hasher) Sum(header []byte, nonce uint64, order []byte, dst []byte) {
+	copy(dst, h.Hash(header, nonce, order))
+}
+
+// HashBatch computes the hashes of count consecutive nonces of the header hash,
+// starting at startNonce, chaining the algorithms in the given order. The result
+// of nonce startNonce+i is at index i. The returned slice is owned by the hasher
+// and only valid until its next use.
+func (h *Hasher) HashBatch(header []byte, startNonce uint64, count int, order []byte) [][32]byte {
+	results := h.batch(count)
+	h.hashRange(header, startNonce, results, order)
+	return results
+}
+
+// HashBatchParallel is like HashBatch, but splits the nonces evenly across one
+// thread per CPU, each hashing with a hasher of its own.
+func (h *Hasher) HashBatchParallel(header []byte, startNonce uint64, count int, order []byte) [][32]byte {
+	return h.hashBatchThreads(header, startNonce, count, order, runtime.NumCPU())
+}
+
+// hashBatchThreads computes a batch of hashes on the given number of threads.
+func (h *Hasher) hashBatchThreads(header []byte, startNonce uint64, count int, order []byte, threads int) [][32]byte {
+	if threads > count {
+		threads = count
+	}
+	if threads <= 1 {
+		return h.HashBatch(header, startNonce, count, order)
+	}
+	for len(h.workers) < threads {
+		h.workers = append(h.workers, NewHasher())
+	}
+	results := h.batch(count)
+
+	var pend sync.WaitGroup
+	pend.Add(threads)
+	for i := 0; i < threads; i++ {
+		from, to := i*count/threads, (i+1)*count/threads
+		go func(worker *Hasher, from, to int) {
+			defer pend.Done()
+			worker.hashRange(header, startNonce+uint64(from), results[from:to], order)
+		}(h.workers[i], from, to)
+	}
+	pend.Wait()
+	return results
+}
+
+// batch returns the batch result buffer sized to count.
+func (h *Hasher) batch(count int) [][32]byte {
+	if cap(h.results) < count {
+		h.results = make([][32]byte, count)
+	}
+	h.results = h.results[:count]
+	return h.results
+}
+
+// hashRange hashes consecutive nonces of the header hash from startNonce on into
+// results.
+func (h *Hasher) hashRange(header []byte, startNonce uint64, results [][32]byte, order []byte) {
+	h.reset(header)
+	nonce := h.seed[len(header) : len(header)+8]
+	for i := range results {
+		binary.BigEndian.PutUint64(nonce, startNonce+uint64(i))
+		h.hash.Hash(h.seed, results[i][:], order)
+	}
+}
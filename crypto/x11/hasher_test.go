@@ -0,0 +1,192 @@
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package x11
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"testing"
+)
+
+// hasherTests are known answers for the hash of a fixed header hash and nonce.
+// The orders place every algorithm at every position of the chain, and repeat
+// the algorithms the ethash order derivation may use more than once.
+var hasherTests = []struct {
+	order string
+	out   string
+}{
+	{"ABCDEFGHIJK", "31e944c93de1f98f6905adfebd07a43598da5ec29c1f09e54461b85db8107d37"},
+	{"BCDEFGHIJKA", "ec34f8ac77f24fc2d27f41173669d5c97c60c8daedd7d728c999e6bef4b2dfc7"},
+	{"CDEFGHIJKAB", "c6a8fca42b9873e7973881232bda97a2262a68286efe5ba18da1f8925a74d493"},
+	{"DEFGHIJKABC", "76f9a77feefdbf872da4d3df8b225f4544c2b56f6d079a236422458e096bf080"},
+	{"EFGHIJKABCD", "bc3417fe4f19e1cefb30fe6bfeb77ff8338a6c62e2c6c553bda6ec1b69789143"},
+	{"FGHIJKABCDE", "501d3d13482373a12361e1c3fd2a1ef775bc11318f667da8c5c83d95866072ce"},
+	{"GHIJKABCDEF", "4f2be2c258ba12230a8ee9d3e3fadab368e28b18ac477290ed70d0c0d94214a7"},
+	{"HIJKABCDEFG", "0a1f5d49891bc84ac55eaa6631fb15bb68a22ded748503c39943fee173d900a2"},
+	{"IJKABCDEFGH", "8d4e5456f79bd2c9aa4fddd4a30c644e320624e0f066b96b939af0ec40002bd2"},
+	{"JKABCDEFGHI", "75bcdfdd17019676598374c1bc99cf8dfade2b362b632fb218e262e3042b8450"},
+	{"KABCDEFGHIJ", "19afa67de2ea698717756792e22ab01e8447f2a3fa65f646df6ad99fb7818cd0"},
+	{"AAAAAAAAAAA", "a89444a87b5d2c58a0b6125064ba5be75d6babd8b26a12e965a9e4b8eacb6df0"},
+	{"BBBBBBBBBBB", "d6abafea97cd1a4a8bcc050c09b0c21046d17c6a186dac773b0cb3ed141b150c"},
+	{"DDDDDDDDDDD", "01ce6be5bbe432ec9c6e0379dfd0a10e0d43883c2b6956b329ed28742aad550c"},
+	{"EEEEEEEEEEE", "e54c96b679ef491cec938dce68eda02fa251674fcefc60de4514e034c39637b8"},
+	{"GGGGGGGGGGG", "9c5c3ee072c68346ec91e21f63ace83d2e3546d19ee9addb7f950990f6e31860"},
+	{"HHHHHHHHHHH", "5173021e3a69e35953416c2c0c9413d391f2a14241ce608aa11a74d365268f08"},
+	{"KJIHGFEDCBA", "70226c2e64d8797602d0a22914606d36a9d5e12726e2dd0deb89d4bb9a1d21e0"},
+	{"CAHDGEBFIJK", "5341d1c6c9a0e4cf696345548f188df617162998d08ebec784055a2a94737a59"},
+}
+
+const hasherTestNonce = 0x0123456789abcdef
+
+// hasherTestHeader returns the header hash the known answers are computed for.
+func hasherTestHeader() []byte {
+	header := make([]byte, 32)
+	for i := range header {
+		header[i] = byte(i)
+	}
+	return header
+}
+
+func TestHasherKnownAnswers(t *testing.T) {
+	hasher := NewHasher()
+	for _, tt := range hasherTests {
+		out := make([]byte, 32)
+		hasher.Sum(hasherTestHeader(), hasherTestNonce, []byte(tt.order), out)
+		if have := hex.EncodeToString(out); have != tt.out {
+			t.Errorf("order %s: hash mismatch: have %s, want %s", tt.order, have, tt.out)
+		}
+		if have := hex.EncodeToString(hasher.Hash(hasherTestHeader(), hasherTestNonce, []byte(tt.order))); have != tt.out {
+			t.Errorf("order %s: owned hash mismatch: have %s, want %s", tt.order, have, tt.out)
+		}
+	}
+}
+
+// Tests that batch hashing yields the same results as hashing nonce by nonce
+// with a fresh hasher, as the sealers did before.
+func TestHashBatch(t *testing.T) {
+	var (
+		hasher = NewHasher()
+		header = hasherTestHeader()
+		start  = uint64(hasherTestNonce - 2) // Cross a byte boundary
+	)
+	for _, tt := range hasherTests[:3] {
+		results := hasher.HashBatch(header, start, 5, []byte(tt.order))
+		if len(results) != 5 {
+			t.Fatalf("order %s: result count mismatch: have %d, want 5", tt.order, len(results))
+		}
+		for i, result := range results {
+			seed := make([]byte, 64)
+			copy(seed, header)
+			binary.BigEndian.PutUint64(seed[32:], start+uint64(i))
+
+			want := make([]byte, 32)
+			New().Hash(seed, want, []byte(tt.order))
+			if !bytes.Equal(result[:], want) {
+				t.Errorf("order %s, nonce %d: hash mismatch: have %x, want %x", tt.order, start+uint64(i), result, want)
+			}
+		}
+		if have := hex.EncodeToString(results[2][:]); have != tt.out {
+			t.Errorf("order %s: known answer mismatch: have %s, want %s", tt.order, have, tt.out)
+		}
+	}
+}
+
+// Tests that the hasher doesn't allocate once its buffers are sized.
+func TestHasherAllocs(t *testing.T) {
+	var (
+		hasher = NewHasher()
+		header = hasherTestHeader()
+		order  = []byte(hasherTests[0].order)
+		out    = make([]byte, 32)
+	)
+	hasher.HashBatch(header, 0, 16, order)
+
+	if allocs := testing.AllocsPerRun(10, func() { hasher.Hash(header, 1, order) }); allocs > 0 {
+		t.Errorf("owned hash allocations: have %v, want 0", allocs)
+	}
+	if allocs := testing.AllocsPerRun(10, func() { hasher.Sum(header, 1, order, out) }); allocs > 0 {
+		t.Errorf("single hash allocations: have %v, want 0", allocs)
+	}
+	if allocs := testing.AllocsPerRun(10, func() { hasher.HashBatch(header, 1, 16, order) }); allocs > 0 {
+		t.Errorf("batch hash allocations: have %v, want 0", allocs)
+	}
+}
+
+// The benchmarks below measure the time per hash on a single core, the inverse
+// of which is the hash rate per core.
+
+// BenchmarkHashFresh hashes nonces with a fresh hasher each, the way the sealers
+// used to.
+func BenchmarkHashFresh(b *testing.B) {
+	header, order := hasherTestHeader(), []byte(hasherTests[0].order)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		seed := append(append([]byte{}, header...), make([]byte, 32)...)
+		binary.BigEndian.PutUint64(seed[32:], uint64(i))
+
+		var out [32]byte
+		New().Hash(seed, out[:], order)
+	}
+}
+
+func BenchmarkHasherSum(b *testing.B) {
+	hasher, header, order := NewHasher(), hasherTestHeader(), []byte(hasherTests[0].order)
+	out := make([]byte, 32)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		hasher.Sum(header, uint64(i), order, out)
+	}
+}
+
+func BenchmarkHashBatch(b *testing.B) {
+	hasher, header, order := NewHasher(), hasherTestHeader(), []byte(hasherTests[0].order)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i += 128 {
+		count := 128
+		if b.N-i < count {
+			count = b.N - i
+		}
+		hasher.HashBatch(header, uint64(i), count, order)
+	}
+}
+
+// Tests that hashing a batch across all CPUs yields the same results as hashing
+// it on a single thread.
+func TestHashBatchParallel(t *testing.T) {
+	var (
+		hasher = NewHasher()
+		header = hasherTestHeader()
+		order  = []byte(hasherTests[0].order)
+	)
+	for _, count := range []int{1, 3, 64, 257} {
+		want := append([][32]byte{}, NewHasher().HashBatch(header, hasherTestNonce, count, order)...)
+		for _, threads := range []int{1, 4, 7} {
+			have := hasher.hashBatchThreads(header, hasherTestNonce, count, order, threads)
+			if len(have) != count {
+				t.Fatalf("count %d, threads %d: result count mismatch: have %d, want %d", count, threads, len(have), count)
+			}
+			for i := range want {
+				if have[i] != want[i] {
+					t.Errorf("count %d, threads %d, nonce %d: hash mismatch: have %x, want %x", count, threads, hasherTestNonce+uint64(i), have[i], want[i])
+				}
+			}
+		}
+	}
+	if have := hasher.HashBatchParallel(header, hasherTestNonce, 64, order); len(have) != 64 {
+		t.Errorf("result count mismatch: have %d, want 64", len(have))
+	}
+}
+
+func BenchmarkHashBatchParallel(b *testing.B) {
+	hasher, header, order := NewHasher(), hasherTestHeader(), []byte(hasherTests[0].order)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i += 1024 {
+		count := 1024
+		if b.N-i < count {
+			count = b.N - i
+		}
+		hasher.HashBatchParallel(header, uint64(i), count, order)
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package era
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// accumulatorDepth is the depth of the accumulator tree, fitting MaxEpochSize
+// records.
+const accumulatorDepth = 13
+
+// zeroHashes are the roots of the empty subtrees at every depth.
+var zeroHashes [accumulatorDepth + 1]common.Hash
+
+func init() {
+	if 1<<accumulatorDepth != MaxEpochSize {
+		panic("accumulator depth doesn't fit the epoch size")
+	}
+	for i := 1; i <= accumulatorDepth; i++ {
+		zeroHashes[i] = crypto.Keccak256Hash(zeroHashes[i-1][:], zeroHashes[i-1][:])
+	}
+}
+
+// ComputeAccumulator calculates the accumulator root of an epoch. The leaves are
+// the keccak256 hashes of the block hashes concatenated with the big endian
+// total difficulties, merkleized in a binary keccak256 tree padded with empty
+// leaves to MaxEpochSize. The root of the tree is hashed together with the 8
+// byte big endian number of records, so truncated epochs don't verify.
+func ComputeAccumulator(hashes []common.Hash, tds []*big.Int) (common.Hash, error) {
+	if len(hashes) != len(tds) {
+		return common.Hash{}, fmt.Errorf("record count mismatch: %d hashes, %d total difficulties", len(hashes), len(tds))
+	}
+	if len(hashes) > MaxEpochSize {
+		return common.Hash{}, fmt.Errorf("too many records: %d > %d", len(hashes), MaxEpochSize)
+	}
+	layer := make([]common.Hash, len(hashes))
+	for i, hash := range hashes {
+		if tds[i].Sign() < 0 {
+			return common.Hash{}, fmt.Errorf("negative total difficulty of record %d", i)
+		}
+		layer[i] = crypto.Keccak256Hash(hash[:], tds[i].Bytes())
+	}
+	for depth := 0; depth < accumulatorDepth; depth++ {
+		if len(layer) == 0 {
+			break
+		}
+		if len(layer)%2 == 1 {
+			layer = append(layer, zeroHashes[depth])
+		}
+		next := make([]common.Hash, len(layer)/2)
+		for i := range next {
+			next[i] = crypto.Keccak256Hash(layer[2*i][:], layer[2*i+1][:])
+		}
+		layer = next
+	}
+	root := zeroHashes[accumulatorDepth]
+	if len(layer) > 0 {
+		root = layer[0]
+	}
+	var count [8]byte
+	binary.BigEndian.PutUint64(count[:], uint64(len(hashes)))
+	return crypto.Keccak256Hash(root[:], count[:]), nil
+}
@@ -0,0 +1,104 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package era
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ChecksumsFile is the file in an export directory listing the archives in order
+// along with their sha256 checksums, in the format of sha256sum.
+const ChecksumsFile = "checksums.txt"
+
+// Checksum is the sha256 checksum of an archive.
+type Checksum struct {
+	Name string   // File name of the archive within the export directory
+	Sum  [32]byte // Checksum of the archive file
+}
+
+// ReadChecksums loads the list of archives and their checksums from an export
+// directory.
+func ReadChecksums(dir string) ([]Checksum, error) {
+	blob, err := ioutil.ReadFile(filepath.Join(dir, ChecksumsFile))
+	if err != nil {
+		return nil, err
+	}
+	var sums []Checksum
+
+	scanner := bufio.NewScanner(bytes.NewReader(blob))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: malformed line", ChecksumsFile, line)
+		}
+		sum, err := hex.DecodeString(fields[0])
+		if err != nil || len(sum) != sha256.Size {
+			return nil, fmt.Errorf("%s:%d: invalid checksum", ChecksumsFile, line)
+		}
+		name := strings.TrimPrefix(fields[1], "*")
+		if name != filepath.Base(name) {
+			return nil, fmt.Errorf("%s:%d: archive %q outside the directory", ChecksumsFile, line, name)
+		}
+		checksum := Checksum{Name: name}
+		copy(checksum.Sum[:], sum)
+		sums = append(sums, checksum)
+	}
+	return sums, scanner.Err()
+}
+
+// WriteChecksums stores the list of archives and their checksums into an export
+// directory.
+func WriteChecksums(dir string, sums []Checksum) error {
+	var buf bytes.Buffer
+	for _, sum := range sums {
+		fmt.Fprintf(&buf, "%x  %s\n", sum.Sum, sum.Name)
+	}
+	return ioutil.WriteFile(filepath.Join(dir, ChecksumsFile), buf.Bytes(), 0644)
+}
+
+// VerifyChecksum checks the sha256 checksum of a file.
+func VerifyChecksum(path string, want [32]byte) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, f); err != nil {
+		return err
+	}
+	var have [32]byte
+	copy(have[:], hasher.Sum(nil))
+	if have != want {
+		return fmt.Errorf("checksum mismatch of %s: have %x, want %x", filepath.Base(path), have, want)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package era
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// headerSize is the size of the header preceding the data of every entry.
+const headerSize = 8
+
+// e2Writer writes type-length-value entries into an output stream. Every entry
+// starts with an 8 byte header: the type in 2 bytes, the length of the data in
+// 4 bytes and 2 reserved zero bytes, all little endian.
+type e2Writer struct {
+	w      io.Writer
+	offset int64 // Number of bytes written so far
+}
+
+// write appends an entry to the stream, returning its offset.
+func (w *e2Writer) write(typ uint16, data []byte) (int64, error) {
+	if uint64(len(data)) > uint64(^uint32(0)) {
+		return 0, fmt.Errorf("entry too large: %d bytes", len(data))
+	}
+	var header [headerSize]byte
+	binary.LittleEndian.PutUint16(header[0:], typ)
+	binary.LittleEndian.PutUint32(header[2:], uint32(len(data)))
+
+	offset := w.offset
+	if _, err := w.w.Write(header[:]); err != nil {
+		return 0, err
+	}
+	if _, err := w.w.Write(data); err != nil {
+		return 0, err
+	}
+	w.offset += int64(headerSize + len(data))
+	return offset, nil
+}
+
+// e2Reader reads type-length-value entries from random positions of a stream.
+type e2Reader struct {
+	r    io.ReaderAt
+	size int64 // Size of the stream, bounding the entry lengths
+}
+
+// read retrieves the entry at the given offset, returning its type, data and
+// the offset of the next entry.
+func (r *e2Reader) read(offset int64) (uint16, []byte, int64, error) {
+	if offset < 0 || offset+headerSize > r.size {
+		return 0, nil, 0, fmt.Errorf("entry offset %d out of bounds", offset)
+	}
+	var header [headerSize]byte
+	if _, err := r.r.ReadAt(header[:], offset); err != nil {
+		return 0, nil, 0, err
+	}
+	if header[6] != 0 || header[7] != 0 {
+		return 0, nil, 0, errors.New("reserved entry header bytes not zero")
+	}
+	var (
+		typ    = binary.LittleEndian.Uint16(header[0:])
+		length = int64(binary.LittleEndian.Uint32(header[2:]))
+		next   = offset + headerSize + length
+	)
+	if next > r.size {
+		return 0, nil, 0, fmt.Errorf("entry at %d exceeds the stream: %d bytes", offset, length)
+	}
+	data := make([]byte, length)
+	if _, err := r.r.ReadAt(data, offset+headerSize); err != nil {
+		return 0, nil, 0, err
+	}
+	return typ, data, next, nil
+}
+
+// readType retrieves the entry at the given offset, ensuring it's of the given
+// type.
+func (r *e2Reader) readType(offset int64, want uint16) ([]byte, int64, error) {
+	typ, data, next, err := r.read(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	if typ != want {
+		return nil, 0, fmt.Errorf("entry at %d type mismatch: have %#x, want %#x", offset, typ, want)
+	}
+	return data, next, nil
+}
@@ -0,0 +1,367 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package era implements the era archive format for exporting and importing
+// the chain history in fixed-size epochs.
+//
+// An archive holds the blocks of one epoch as a sequence of type-length-value
+// entries:
+//
+//	Version | (Block | Receipts | TotalDifficulty)* | Accumulator | BlockIndex
+//
+// Blocks and receipts are snappy compressed RLP, receipts in their consensus
+// encoding, and total difficulties are big endian integers. The accumulator is
+// the root of a merkle tree over the block hashes and total difficulties,
+// committing to the content of the epoch. The block index at the end holds the
+// number of the first block, the offsets of the block entries relative to the
+// index entry and the number of blocks, each in 8 bytes little endian,
+// permitting random access to the blocks of the epoch.
+package era
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/golang/snappy"
+)
+
+// MaxEpochSize is the number of blocks in an epoch. Every archive but the last
+// one of an export holds exactly this many blocks.
+const MaxEpochSize = 8192
+
+// Entry types of an archive.
+const (
+	TypeVersion            uint16 = 0x3265
+	TypeCompressedBlock    uint16 = 0x03
+	TypeCompressedReceipts uint16 = 0x05
+	TypeTotalDifficulty    uint16 = 0x06
+	TypeAccumulator        uint16 = 0x07
+	TypeBlockIndex         uint16 = 0x3266
+)
+
+// Filename returns the name of the archive of an epoch: the network name, the
+// epoch number and the first 4 bytes of the accumulator root.
+func Filename(network string, epoch uint64, root common.Hash) string {
+	return fmt.Sprintf("%s-%05d-%x.era", network, epoch, root[:4])
+}
+
+// Builder writes the blocks of an epoch into an archive.
+type Builder struct {
+	w *e2Writer
+
+	start   uint64        // Number of the first block
+	offsets []int64       // Offsets of the block entries
+	hashes  []common.Hash // Hashes of the blocks for the accumulator
+	tds     []*big.Int    // Total difficulties of the blocks for the accumulator
+}
+
+// NewBuilder creates a builder writing an archive into the given stream.
+func NewBuilder(w io.Writer) *Builder {
+	return &Builder{w: &e2Writer{w: w}}
+}
+
+// Add appends a block with its receipts and total difficulty to the archive.
+// The blocks need to be added in order.
+func (b *Builder) Add(block *types.Block, receipts types.Receipts, td *big.Int) error {
+	if len(b.offsets) == 0 {
+		if _, err := b.w.write(TypeVersion, nil); err != nil {
+			return err
+		}
+		b.start = block.NumberU64()
+	}
+	if len(b.offsets) == MaxEpochSize {
+		return fmt.Errorf("epoch full: %d blocks", MaxEpochSize)
+	}
+	if want := b.start + uint64(len(b.offsets)); block.NumberU64() != want {
+		return fmt.Errorf("non contiguous block: have #%d, want #%d", block.NumberU64(), want)
+	}
+	if td.Sign() < 0 {
+		return fmt.Errorf("negative total difficulty of block #%d", block.NumberU64())
+	}
+	blob, err := rlp.EncodeToBytes(block)
+	if err != nil {
+		return err
+	}
+	offset, err := b.w.write(TypeCompressedBlock, snappy.Encode(nil, blob))
+	if err != nil {
+		return err
+	}
+	if receipts == nil {
+		receipts = types.Receipts{}
+	}
+	if blob, err = rlp.EncodeToBytes(receipts); err != nil {
+		return err
+	}
+	if _, err := b.w.write(TypeCompressedReceipts, snappy.Encode(nil, blob)); err != nil {
+		return err
+	}
+	if _, err := b.w.write(TypeTotalDifficulty, td.Bytes()); err != nil {
+		return err
+	}
+	b.offsets = append(b.offsets, offset)
+	b.hashes = append(b.hashes, block.Hash())
+	b.tds = append(b.tds, new(big.Int).Set(td))
+	return nil
+}
+
+// Finalize writes the accumulator and the block index of the added blocks,
+// completing the archive. It returns the accumulator root.
+func (b *Builder) Finalize() (common.Hash, error) {
+	if len(b.offsets) == 0 {
+		return common.Hash{}, errors.New("empty epoch")
+	}
+	root, err := ComputeAccumulator(b.hashes, b.tds)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if _, err := b.w.write(TypeAccumulator, root.Bytes()); err != nil {
+		return common.Hash{}, err
+	}
+	index := make([]byte, 8+8*len(b.offsets)+8)
+	binary.LittleEndian.PutUint64(index, b.start)
+	for i, offset := range b.offsets {
+		binary.LittleEndian.PutUint64(index[8+8*i:], uint64(offset-b.w.offset))
+	}
+	binary.LittleEndian.PutUint64(index[len(index)-8:], uint64(len(b.offsets)))
+	if _, err := b.w.write(TypeBlockIndex, index); err != nil {
+		return common.Hash{}, err
+	}
+	return root, nil
+}
+
+// Era is an archive opened for reading.
+type Era struct {
+	r      *e2Reader
+	closer io.Closer
+
+	start   uint64      // Number of the first block
+	offsets []int64     // Offsets of the block entries
+	root    common.Hash // Accumulator root stored in the archive
+}
+
+// Open opens the archive at the given path.
+func Open(path string) (*Era, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	e, err := From(f, stat.Size())
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	e.closer = f
+	return e, nil
+}
+
+// From opens an archive from a stream of the given size, loading its index.
+func From(r io.ReaderAt, size int64) (*Era, error) {
+	e := &Era{r: &e2Reader{r: r, size: size}}
+
+	if _, _, err := e.r.readType(0, TypeVersion); err != nil {
+		return nil, fmt.Errorf("invalid version entry: %v", err)
+	}
+	// Locate the block index from the block count at the very end
+	if size < 2*headerSize+16 {
+		return nil, errors.New("archive too short")
+	}
+	var count [8]byte
+	if _, err := r.ReadAt(count[:], size-8); err != nil {
+		return nil, err
+	}
+	n := binary.LittleEndian.Uint64(count[:])
+	if n == 0 || n > MaxEpochSize {
+		return nil, fmt.Errorf("invalid block count %d", n)
+	}
+	indexOffset := size - headerSize - int64(8+8*n+8)
+	index, next, err := e.r.readType(indexOffset, TypeBlockIndex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid block index: %v", err)
+	}
+	if next != size {
+		return nil, errors.New("block index not at the end of the archive")
+	}
+	e.start = binary.LittleEndian.Uint64(index)
+	e.offsets = make([]int64, n)
+	for i := range e.offsets {
+		e.offsets[i] = indexOffset + int64(binary.LittleEndian.Uint64(index[8+8*i:]))
+	}
+	// The accumulator immediately precedes the index
+	root, next, err := e.r.readType(indexOffset-headerSize-common.HashLength, TypeAccumulator)
+	if err != nil || next != indexOffset {
+		return nil, fmt.Errorf("invalid accumulator entry: %v", err)
+	}
+	e.root = common.BytesToHash(root)
+	return e, nil
+}
+
+// Close closes the underlying file if the archive was opened from a path.
+func (e *Era) Close() error {
+	if e.closer != nil {
+		return e.closer.Close()
+	}
+	return nil
+}
+
+// Start returns the number of the first block in the archive.
+func (e *Era) Start() uint64 { return e.start }
+
+// Count returns the number of blocks in the archive.
+func (e *Era) Count() uint64 { return uint64(len(e.offsets)) }
+
+// Accumulator returns the accumulator root stored in the archive.
+func (e *Era) Accumulator() common.Hash { return e.root }
+
+// entries reads the block, receipts and total difficulty entries of a block.
+func (e *Era) entries(number uint64) (block []byte, receipts []byte, td []byte, err error) {
+	if number < e.start || number-e.start >= uint64(len(e.offsets)) {
+		return nil, nil, nil, fmt.Errorf("block #%d not in archive", number)
+	}
+	offset := e.offsets[number-e.start]
+	if block, offset, err = e.r.readType(offset, TypeCompressedBlock); err != nil {
+		return nil, nil, nil, err
+	}
+	if receipts, offset, err = e.r.readType(offset, TypeCompressedReceipts); err != nil {
+		return nil, nil, nil, err
+	}
+	if td, _, err = e.r.readType(offset, TypeTotalDifficulty); err != nil {
+		return nil, nil, nil, err
+	}
+	return block, receipts, td, nil
+}
+
+// decode decompresses and decodes an RLP entry into the given value.
+func decode(data []byte, val interface{}) error {
+	blob, err := snappy.Decode(nil, data)
+	if err != nil {
+		return err
+	}
+	return rlp.DecodeBytes(blob, val)
+}
+
+// Block retrieves a block from the archive.
+func (e *Era) Block(number uint64) (*types.Block, error) {
+	data, _, _, err := e.entries(number)
+	if err != nil {
+		return nil, err
+	}
+	block := new(types.Block)
+	if err := decode(data, block); err != nil {
+		return nil, fmt.Errorf("invalid block #%d: %v", number, err)
+	}
+	return block, nil
+}
+
+// Receipts retrieves the receipts of a block from the archive.
+func (e *Era) Receipts(number uint64) (types.Receipts, error) {
+	_, data, _, err := e.entries(number)
+	if err != nil {
+		return nil, err
+	}
+	var receipts types.Receipts
+	if err := decode(data, &receipts); err != nil {
+		return nil, fmt.Errorf("invalid receipts of block #%d: %v", number, err)
+	}
+	return receipts, nil
+}
+
+// TotalDifficulty retrieves the total difficulty of a block from the archive.
+func (e *Era) TotalDifficulty(number uint64) (*big.Int, error) {
+	_, _, data, err := e.entries(number)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(data), nil
+}
+
+// Epoch is the verified content of an archive.
+type Epoch struct {
+	Blocks   []*types.Block
+	Receipts []types.Receipts
+	TDs      []*big.Int
+}
+
+// Read decodes all the blocks of the archive and verifies their integrity: the
+// blocks need to be linked, their transactions, uncles and receipts need to
+// match the roots in their headers, the total difficulties need to add up and
+// the accumulator needs to match the one in the archive. Whether the first block
+// links to a known chain is up to the caller to check.
+func (e *Era) Read() (*Epoch, error) {
+	var (
+		count  = len(e.offsets)
+		epoch  = &Epoch{Blocks: make([]*types.Block, count), Receipts: make([]types.Receipts, count), TDs: make([]*big.Int, count)}
+		hashes = make([]common.Hash, count)
+	)
+	for i := 0; i < count; i++ {
+		number := e.start + uint64(i)
+
+		blockData, receiptData, tdData, err := e.entries(number)
+		if err != nil {
+			return nil, err
+		}
+		block := new(types.Block)
+		if err := decode(blockData, block); err != nil {
+			return nil, fmt.Errorf("invalid block #%d: %v", number, err)
+		}
+		var receipts types.Receipts
+		if err := decode(receiptData, &receipts); err != nil {
+			return nil, fmt.Errorf("invalid receipts of block #%d: %v", number, err)
+		}
+		td := new(big.Int).SetBytes(tdData)
+
+		header := block.Header()
+		switch {
+		case block.NumberU64() != number:
+			return nil, fmt.Errorf("block number mismatch: have #%d, want #%d", block.NumberU64(), number)
+		case i > 0 && header.ParentHash != hashes[i-1]:
+			return nil, fmt.Errorf("block #%d not linked to its parent", number)
+		case types.DeriveSha(block.Transactions()) != header.TxHash:
+			return nil, fmt.Errorf("block #%d transaction root mismatch", number)
+		case types.CalcUncleHash(block.Uncles()) != header.UncleHash:
+			return nil, fmt.Errorf("block #%d uncle root mismatch", number)
+		case len(receipts) != len(block.Transactions()):
+			return nil, fmt.Errorf("block #%d receipt count mismatch: have %d, want %d", number, len(receipts), len(block.Transactions()))
+		case types.DeriveSha(receipts) != header.ReceiptHash:
+			return nil, fmt.Errorf("block #%d receipt root mismatch", number)
+		case types.CreateBloom(receipts) != header.Bloom:
+			return nil, fmt.Errorf("block #%d bloom mismatch", number)
+		case i > 0 && new(big.Int).Add(epoch.TDs[i-1], header.Difficulty).Cmp(td) != 0:
+			return nil, fmt.Errorf("block #%d total difficulty mismatch", number)
+		}
+		hashes[i] = block.Hash()
+		epoch.Blocks[i], epoch.Receipts[i], epoch.TDs[i] = block, receipts, td
+	}
+	root, err := ComputeAccumulator(hashes, epoch.TDs)
+	if err != nil {
+		return nil, err
+	}
+	if root != e.root {
+		return nil, fmt.Errorf("accumulator mismatch: have %x, want %x", root, e.root)
+	}
+	return epoch, nil
+}
@@ -0,0 +1,238 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package era
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// makeEpoch creates a linked chain segment with a transaction and receipt per
+// block, along with the total difficulties.
+func makeEpoch(start uint64, count int) ([]*types.Block, []types.Receipts, []*big.Int) {
+	var (
+		blocks   []*types.Block
+		receipts []types.Receipts
+		tds      []*big.Int
+		parent   common.Hash
+		td       = big.NewInt(int64(start) * 1000)
+	)
+	for i := 0; i < count; i++ {
+		number := start + uint64(i)
+		tx := types.NewTransaction(number, common.Address{0x01}, big.NewInt(int64(number)), big.NewInt(21000), big.NewInt(1), nil)
+		receipt := types.NewReceipt(nil, false, big.NewInt(21000))
+		receipt.Logs = []*types.Log{{Address: common.Address{0x02}, Data: []byte{byte(i)}}}
+		receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
+
+		header := &types.Header{
+			ParentHash: parent,
+			Number:     new(big.Int).SetUint64(number),
+			Difficulty: big.NewInt(1000 + int64(i)),
+			GasLimit:   big.NewInt(1000000),
+			GasUsed:    big.NewInt(21000),
+			Time:       big.NewInt(int64(number)),
+		}
+		block := types.NewBlock(header, []*types.Transaction{tx}, nil, types.Receipts{receipt})
+		td = new(big.Int).Add(td, header.Difficulty)
+
+		blocks = append(blocks, block)
+		receipts = append(receipts, types.Receipts{receipt})
+		tds = append(tds, td)
+		parent = block.Hash()
+	}
+	return blocks, receipts, tds
+}
+
+// buildArchive writes the given blocks into an in-memory archive.
+func buildArchive(t *testing.T, blocks []*types.Block, receipts []types.Receipts, tds []*big.Int) ([]byte, common.Hash) {
+	var buf bytes.Buffer
+	builder := NewBuilder(&buf)
+	for i, block := range blocks {
+		if err := builder.Add(block, receipts[i], tds[i]); err != nil {
+			t.Fatalf("failed to add block %d: %v", i, err)
+		}
+	}
+	root, err := builder.Finalize()
+	if err != nil {
+		t.Fatalf("failed to finalize archive: %v", err)
+	}
+	return buf.Bytes(), root
+}
+
+// Tests that an archive can be read back in full and randomly accessed.
+func TestArchiveRoundtrip(t *testing.T) {
+	blocks, receipts, tds := makeEpoch(MaxEpochSize, 100)
+	blob, root := buildArchive(t, blocks, receipts, tds)
+
+	archive, err := From(bytes.NewReader(blob), int64(len(blob)))
+	if err != nil {
+		t.Fatalf("failed to open archive: %v", err)
+	}
+	if archive.Start() != MaxEpochSize || archive.Count() != 100 || archive.Accumulator() != root {
+		t.Fatalf("archive metadata mismatch: start %d, count %d, root %x", archive.Start(), archive.Count(), archive.Accumulator())
+	}
+	epoch, err := archive.Read()
+	if err != nil {
+		t.Fatalf("failed to read archive: %v", err)
+	}
+	for i, block := range blocks {
+		if epoch.Blocks[i].Hash() != block.Hash() {
+			t.Errorf("block %d hash mismatch", i)
+		}
+		if types.DeriveSha(epoch.Receipts[i]) != block.ReceiptHash() {
+			t.Errorf("block %d receipts mismatch", i)
+		}
+		if epoch.TDs[i].Cmp(tds[i]) != 0 {
+			t.Errorf("block %d total difficulty mismatch: have %v, want %v", i, epoch.TDs[i], tds[i])
+		}
+	}
+	number := uint64(MaxEpochSize + 42)
+	if block, err := archive.Block(number); err != nil || block.Hash() != blocks[42].Hash() {
+		t.Errorf("random block access failed: %v", err)
+	}
+	if receipts, err := archive.Receipts(number); err != nil || len(receipts) != 1 || !bytes.Equal(receipts[0].Logs[0].Data, []byte{42}) {
+		t.Errorf("random receipts access failed: %v", err)
+	}
+	if td, err := archive.TotalDifficulty(number); err != nil || td.Cmp(tds[42]) != 0 {
+		t.Errorf("random total difficulty access failed: %v", err)
+	}
+	if _, err := archive.Block(MaxEpochSize + 100); err == nil {
+		t.Errorf("block beyond the archive retrieved")
+	}
+}
+
+// Tests that the builder rejects non contiguous blocks.
+func TestBuilderContiguity(t *testing.T) {
+	blocks, receipts, tds := makeEpoch(0, 3)
+
+	builder := NewBuilder(new(bytes.Buffer))
+	if err := builder.Add(blocks[0], receipts[0], tds[0]); err != nil {
+		t.Fatalf("failed to add first block: %v", err)
+	}
+	if err := builder.Add(blocks[2], receipts[2], tds[2]); err == nil {
+		t.Fatalf("gapped block accepted")
+	}
+	if _, err := NewBuilder(new(bytes.Buffer)).Finalize(); err == nil {
+		t.Fatalf("empty archive finalized")
+	}
+}
+
+// Tests that tampered archives fail to open or verify.
+func TestArchiveCorruption(t *testing.T) {
+	blocks, receipts, tds := makeEpoch(0, 16)
+	blob, _ := buildArchive(t, blocks, receipts, tds)
+
+	// Truncated archives have no valid index
+	if _, err := From(bytes.NewReader(blob[:len(blob)-1]), int64(len(blob)-1)); err == nil {
+		t.Errorf("truncated archive opened")
+	}
+	// A different total difficulty breaks the accumulation
+	tampered := make([]*big.Int, len(tds))
+	copy(tampered, tds)
+	tampered[7] = new(big.Int).Add(tds[7], common.Big1)
+	blob, _ = buildArchive(t, blocks, receipts, tampered)
+	archive, err := From(bytes.NewReader(blob), int64(len(blob)))
+	if err != nil {
+		t.Fatalf("failed to open archive: %v", err)
+	}
+	if _, err := archive.Read(); err == nil {
+		t.Errorf("archive with tampered total difficulty verified")
+	}
+	// A flipped accumulator root fails the verification
+	blob, root := buildArchive(t, blocks, receipts, tds)
+	pos := bytes.Index(blob, root[:])
+	blob[pos] ^= 0xff
+	if archive, err = From(bytes.NewReader(blob), int64(len(blob))); err != nil {
+		t.Fatalf("failed to open archive: %v", err)
+	}
+	if _, err := archive.Read(); err == nil {
+		t.Errorf("archive with tampered accumulator verified")
+	}
+	// Receipts not matching the header fail the verification
+	swapped := make([]types.Receipts, len(receipts))
+	copy(swapped, receipts)
+	swapped[3], swapped[4] = receipts[4], receipts[3]
+	blob, _ = buildArchive(t, blocks, swapped, tds)
+	if archive, err = From(bytes.NewReader(blob), int64(len(blob))); err != nil {
+		t.Fatalf("failed to open archive: %v", err)
+	}
+	if _, err := archive.Read(); err == nil {
+		t.Errorf("archive with swapped receipts verified")
+	}
+}
+
+// Tests that the accumulator commits to the order and number of records.
+func TestAccumulator(t *testing.T) {
+	hashes := []common.Hash{{0x01}, {0x02}, {0x03}}
+	tds := []*big.Int{big.NewInt(1), big.NewInt(2), big.NewInt(3)}
+
+	root, err := ComputeAccumulator(hashes, tds)
+	if err != nil {
+		t.Fatalf("failed to compute accumulator: %v", err)
+	}
+	if other, _ := ComputeAccumulator([]common.Hash{{0x02}, {0x01}, {0x03}}, tds); other == root {
+		t.Errorf("accumulator ignores the record order")
+	}
+	if other, _ := ComputeAccumulator(append(hashes, common.Hash{}), append(tds, new(big.Int))); other == root {
+		t.Errorf("accumulator ignores the record count")
+	}
+	if _, err := ComputeAccumulator(make([]common.Hash, MaxEpochSize+1), make([]*big.Int, MaxEpochSize+1)); err == nil {
+		t.Errorf("oversized epoch accumulated")
+	}
+}
+
+// Tests that the checksums file round trips and catches modified archives.
+func TestChecksums(t *testing.T) {
+	dir, err := ioutil.TempDir("", "era-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "test-00000-01020304.era")
+	if err := ioutil.WriteFile(path, []byte("archive"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sums := []Checksum{{Name: filepath.Base(path), Sum: sha256.Sum256([]byte("archive"))}}
+	if err := WriteChecksums(dir, sums); err != nil {
+		t.Fatalf("failed to write checksums: %v", err)
+	}
+	loaded, err := ReadChecksums(dir)
+	if err != nil {
+		t.Fatalf("failed to read checksums: %v", err)
+	}
+	if len(loaded) != 1 || loaded[0] != sums[0] {
+		t.Fatalf("checksums mismatch: have %v, want %v", loaded, sums)
+	}
+	if err := VerifyChecksum(path, loaded[0].Sum); err != nil {
+		t.Fatalf("checksum verification failed: %v", err)
+	}
+	if err := ioutil.WriteFile(path, []byte("archivf"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyChecksum(path, loaded[0].Sum); err == nil {
+		t.Fatalf("modified archive verified")
+	}
+}
@@ -34,13 +34,12 @@ import (
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/p2p"
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/ethereum/go-ethereum/rpc"
-	"github.com/syndtr/goleveldb/leveldb"
-	"github.com/syndtr/goleveldb/leveldb/util"
 )
 
 const (
@@ -78,18 +77,21 @@ func (s *PublicEthereumAPI) ProtocolVersion() hexutil.Uint {
 // - knownStates:   number of known state entries that still need to be pulled
 func (s *PublicEthereumAPI) Syncing() (interface{}, error) {
 	progress := s.b.Downloader().Progress()
+	txIndex := s.b.TxIndexProgress()
 
-	// Return not syncing if the synchronisation already completed
-	if progress.CurrentBlock >= progress.HighestBlock {
+	// Return not syncing if the synchronisation and transaction indexing completed
+	if progress.CurrentBlock >= progress.HighestBlock && txIndex.Done() {
 		return false, nil
 	}
 	// Otherwise gather the block sync stats
 	return map[string]interface{}{
-		"startingBlock": hexutil.Uint64(progress.StartingBlock),
-		"currentBlock":  hexutil.Uint64(progress.CurrentBlock),
-		"highestBlock":  hexutil.Uint64(progress.HighestBlock),
-		"pulledStates":  hexutil.Uint64(progress.PulledStates),
-		"knownStates":   hexutil.Uint64(progress.KnownStates),
+		"startingBlock":          hexutil.Uint64(progress.StartingBlock),
+		"currentBlock":           hexutil.Uint64(progress.CurrentBlock),
+		"highestBlock":           hexutil.Uint64(progress.HighestBlock),
+		"pulledStates":           hexutil.Uint64(progress.PulledStates),
+		"knownStates":            hexutil.Uint64(progress.KnownStates),
+		"txIndexFinishedBlocks":  hexutil.Uint64(txIndex.Indexed),
+		"txIndexRemainingBlocks": hexutil.Uint64(txIndex.Remaining),
 	}, nil
 }
 
@@ -570,6 +572,76 @@ func (s *PublicBlockChainAPI) GetStorageAt(ctx context.Context, address common.A
 	return res[:], state.Error()
 }
 
+// AccountResult is the result of an eth_getProof call: the fields of an account
+// as encoded in the state trie, including its coin age, along with the Merkle
+// proofs of the account and of the requested storage slots.
+type AccountResult struct {
+	Address      common.Address  `json:"address"`
+	AccountProof []hexutil.Bytes `json:"accountProof"`
+	Nonce        hexutil.Uint64  `json:"nonce"`
+	Balance      *hexutil.Big    `json:"balance"`
+	CoinAge      *hexutil.Big    `json:"coinAge"`
+	FUBlock      *hexutil.Big    `json:"fuBlock"`
+	StorageHash  common.Hash     `json:"storageHash"`
+	CodeHash     common.Hash     `json:"codeHash"`
+	StorageProof []StorageResult `json:"storageProof"`
+}
+
+// StorageResult is the value and Merkle proof of a storage slot.
+type StorageResult struct {
+	Key   string          `json:"key"`
+	Value *hexutil.Big    `json:"value"`
+	Proof []hexutil.Bytes `json:"proof"`
+}
+
+// GetProof returns the account and storage values of the specified account in
+// the state of the given block number, along with their Merkle proofs against
+// the state root of the block. The coin age and its last update time are the
+// values stored in the state, not accrued up to the block.
+func (s *PublicBlockChainAPI) GetProof(ctx context.Context, address common.Address, storageKeys []string, blockNr rpc.BlockNumber) (*AccountResult, error) {
+	state, _, err := s.b.StateAndHeaderByNumber(ctx, blockNr)
+	if state == nil || err != nil {
+		return nil, err
+	}
+	storageHash := types.EmptyRootHash
+	if storageTrie := state.StorageTrie(address); storageTrie != nil {
+		storageHash = storageTrie.Hash()
+	}
+	storageProof := make([]StorageResult, len(storageKeys))
+	for i, key := range storageKeys {
+		proof, err := state.GetStorageProof(address, common.HexToHash(key))
+		if err != nil {
+			return nil, err
+		}
+		value := state.GetState(address, common.HexToHash(key)).Big()
+		storageProof[i] = StorageResult{key, (*hexutil.Big)(value), toHexSlice(proof)}
+	}
+	accountProof, err := state.GetProof(address)
+	if err != nil {
+		return nil, err
+	}
+	return &AccountResult{
+		Address:      address,
+		AccountProof: toHexSlice(accountProof),
+		Nonce:        hexutil.Uint64(state.GetNonce(address)),
+		Balance:      (*hexutil.Big)(state.GetBalance(address)),
+		CoinAge:      (*hexutil.Big)(state.GetStoredCoinAge(address)),
+		FUBlock:      (*hexutil.Big)(state.GetFUBlock(address)),
+		StorageHash:  storageHash,
+		CodeHash:     state.GetCodeHash(address),
+		StorageProof: storageProof,
+	}, state.Error()
+}
+
+// toHexSlice converts the nodes of a Merkle proof into their hex representation.
+func toHexSlice(proof []rlp.RawValue) []hexutil.Bytes {
+	res := make([]hexutil.Bytes, len(proof))
+	for i, node := range proof {
+		res[i] = hexutil.Bytes(node)
+	}
+	return res
+}
+
 // CallArgs represents the arguments for a call.
 type CallArgs struct {
 	From     common.Address  `json:"from"`
@@ -1325,33 +1397,27 @@ func NewPrivateDebugAPI(b Backend) *PrivateDebugAPI {
 	return &PrivateDebugAPI{b: b}
 }
 
-// ChaindbProperty returns leveldb properties of the chain database.
+// ChaindbProperty returns properties of the chain database, the LevelDB or the
+// LSM stats by default.
 func (api *PrivateDebugAPI) ChaindbProperty(property string) (string, error) {
-	ldb, ok := api.b.ChainDb().(interface {
-		LDB() *leveldb.DB
-	})
-	if !ok {
-		return "", fmt.Errorf("chaindbProperty does not work for memory databases")
-	}
+	db := ethdb.KeyValueStore(api.b.ChainDb())
 	if property == "" {
-		property = "leveldb.stats"
-	} else if !strings.HasPrefix(property, "leveldb.") {
+		if stats, err := db.Stat("leveldb.stats"); err == nil {
+			return stats, nil
+		}
+		return db.Stat("lsm.stats")
+	}
+	if !strings.Contains(property, ".") {
 		property = "leveldb." + property
 	}
-	return ldb.LDB().GetProperty(property)
+	return db.Stat(property)
 }
 
 func (api *PrivateDebugAPI) ChaindbCompact() error {
-	ldb, ok := api.b.ChainDb().(interface {
-		LDB() *leveldb.DB
-	})
-	if !ok {
-		return fmt.Errorf("chaindbCompact does not work for memory databases")
-	}
+	db := ethdb.KeyValueStore(api.b.ChainDb())
 	for b := byte(0); b < 255; b++ {
 		log.Info("Compacting chain database", "range", fmt.Sprintf("0x%0.2X-0x%0.2X", b, b+1))
-		err := ldb.LDB().CompactRange(util.Range{Start: []byte{b}, Limit: []byte{b + 1}})
-		if err != nil {
+		if err := db.Compact([]byte{b}, []byte{b + 1}); err != nil {
 			log.Error("Database compaction failed", "err", err)
 			return err
 		}
@@ -40,6 +40,7 @@ type Backend interface {
 	// general Ethereum API
 	Downloader() *downloader.Downloader
 	ProtocolVersion() int
+	TxIndexProgress() core.TxIndexProgress
 	SuggestPrice(ctx context.Context) (*big.Int, error)
 	ChainDb() ethdb.Database
 	EventMux() *event.TypeMux
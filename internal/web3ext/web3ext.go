@@ -29,6 +29,7 @@ var Modules = map[string]string{
 	"shh":        Shh_JS,
 	"swarmfs":    SWARMFS_JS,
 	"txpool":     TxPool_JS,
+	"wtc":        Wtc_JS,
 }
 
 const Chequebook_JS = `
@@ -87,6 +88,11 @@ web3._extend({
 			call: 'admin_importChain',
 			params: 1
 		}),
+		new web3._extend.Method({
+			name: 'txpoolSetFilter',
+			call: 'admin_txpoolSetFilter',
+			params: 1
+		}),
 		new web3._extend.Method({
 			name: 'sleepBlocks',
 			call: 'admin_sleepBlocks',
@@ -126,6 +132,10 @@ web3._extend({
 			name: 'datadir',
 			getter: 'admin_datadir'
 		}),
+		new web3._extend.Property({
+			name: 'txpoolFilter',
+			getter: 'admin_txpoolFilter'
+		}),
 	]
 });
 `
@@ -189,6 +199,10 @@ web3._extend({
 			name: 'chaindbCompact',
 			call: 'debug_chaindbCompact',
 		}),
+		new web3._extend.Method({
+			name: 'txIndexProgress',
+			call: 'debug_txIndexProgress',
+		}),
 		new web3._extend.Method({
 			name: 'metrics',
 			call: 'debug_metrics',
@@ -353,6 +367,12 @@ web3._extend({
 			params: 2,
 			inputFormatter: [web3._extend.formatters.inputBlockNumberFormatter, web3._extend.utils.toHex]
 		}),
+		new web3._extend.Method({
+			name: 'getProof',
+			call: 'eth_getProof',
+			params: 3,
+			inputFormatter: [web3._extend.formatters.inputAddressFormatter, null, web3._extend.formatters.inputBlockNumberFormatter]
+		}),
 	],
 	properties: [
 		new web3._extend.Property({
@@ -406,8 +426,34 @@ web3._extend({
 			name: 'getHashrate',
 			call: 'miner_getHashrate'
 		}),
+		new web3._extend.Method({
+			name: 'stratumWorkers',
+			call: 'miner_stratumWorkers'
+		}),
+		new web3._extend.Method({
+			name: 'setStrategy',
+			call: 'miner_setStrategy',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'sendBundle',
+			call: 'miner_sendBundle',
+			params: 2,
+			inputFormatter: [null, web3._extend.utils.fromDecimal]
+		}),
+		new web3._extend.Method({
+			name: 'simulateBlock',
+			call: 'miner_simulateBlock',
+			params: 1,
+			inputFormatter: [null]
+		}),
 	],
-	properties: []
+	properties: [
+		new web3._extend.Property({
+			name: 'strategy',
+			getter: 'miner_strategy'
+		}),
+	]
 });
 `
 
@@ -650,3 +696,51 @@ web3._extend({
 	]
 });
 `
+
+const Wtc_JS = `
+web3._extend({
+	property: 'wtc',
+	methods: [
+		new web3._extend.Method({
+			name: 'getBlockReward',
+			call: 'wtc_getBlockReward',
+			params: 2,
+			inputFormatter: [web3._extend.formatters.inputBlockNumberFormatter, web3._extend.formatters.inputAddressFormatter],
+			outputFormatter: web3._extend.utils.toBigNumber
+		}),
+		new web3._extend.Method({
+			name: 'getCoinAge',
+			call: 'wtc_getCoinAge',
+			params: 2,
+			inputFormatter: [web3._extend.formatters.inputAddressFormatter, web3._extend.formatters.inputBlockNumberFormatter],
+			outputFormatter: function(result) {
+				result.balance = web3._extend.utils.toBigNumber(result.balance);
+				result.stored = web3._extend.utils.toBigNumber(result.stored);
+				result.current = web3._extend.utils.toBigNumber(result.current);
+				result.updatedAt = web3._extend.utils.toDecimal(result.updatedAt);
+				result.number = web3._extend.utils.toDecimal(result.number);
+				result.time = web3._extend.utils.toDecimal(result.time);
+				return result;
+			}
+		}),
+		new web3._extend.Method({
+			name: 'getMiningTargetMultiplier',
+			call: 'wtc_getMiningTargetMultiplier',
+			params: 2,
+			inputFormatter: [web3._extend.formatters.inputAddressFormatter, web3._extend.formatters.inputBlockNumberFormatter],
+			outputFormatter: function(result) {
+				result.number = web3._extend.utils.toDecimal(result.number);
+				result.coinAge = web3._extend.utils.toBigNumber(result.coinAge);
+				result.coinAgeMultiplier = web3._extend.utils.toBigNumber(result.coinAgeMultiplier);
+				result.txNumber = web3._extend.utils.toDecimal(result.txNumber);
+				result.txNumberMultiplier = web3._extend.utils.toBigNumber(result.txNumberMultiplier);
+				result.multiplier = web3._extend.utils.toBigNumber(result.multiplier);
+				result.difficulty = web3._extend.utils.toBigNumber(result.difficulty);
+				result.effectiveDifficulty = web3._extend.utils.toBigNumber(result.effectiveDifficulty);
+				return result;
+			}
+		}),
+	],
+	properties: []
+});
+`
@@ -157,6 +157,10 @@ func (b *LesApiBackend) ProtocolVersion() int {
 	return b.eth.LesVersion() + 10000
 }
 
+func (b *LesApiBackend) TxIndexProgress() core.TxIndexProgress {
+	return core.TxIndexProgress{} // Light clients don't index transactions
+}
+
 func (b *LesApiBackend) SuggestPrice(ctx context.Context) (*big.Int, error) {
 	return b.gpo.SuggestPrice(ctx)
 }
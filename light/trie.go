@@ -22,8 +22,10 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/state/snapshot"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/ethereum/go-ethereum/trie"
 )
 
@@ -50,6 +52,14 @@ func (db *odrDatabase) OpenStorageTrie(addrHash, root common.Hash) (state.Trie,
 	return &odrTrie{db: db, id: StorageTrieID(db.id, addrHash, root)}, nil
 }
 
+func (db *odrDatabase) NodeCache() *trie.NodeCache {
+	return nil
+}
+
+func (db *odrDatabase) Snapshots() *snapshot.Tree {
+	return nil
+}
+
 func (db *odrDatabase) CopyTrie(t state.Trie) state.Trie {
 	switch t := t.(type) {
 	case *odrTrie:
@@ -113,11 +123,28 @@ func (t *odrTrie) TryDelete(key []byte) error {
 	})
 }
 
+func (t *odrTrie) Prove(key []byte) ([]rlp.RawValue, error) {
+	key = crypto.Keccak256(key)
+	var proof []rlp.RawValue
+	err := t.do(key, func() (err error) {
+		// Resolve the path first, the proof itself doesn't report missing nodes
+		if _, err = t.trie.TryGet(key); err == nil {
+			proof = t.trie.Prove(key)
+		}
+		return err
+	})
+	return proof, err
+}
+
 func (t *odrTrie) CommitTo(db trie.DatabaseWriter) (common.Hash, error) {
+	return t.CommitToWithCallback(db, nil)
+}
+
+func (t *odrTrie) CommitToWithCallback(db trie.DatabaseWriter, onleaf trie.LeafCallback) (common.Hash, error) {
 	if t.trie == nil {
 		return t.id.Root, nil
 	}
-	return t.trie.CommitTo(db)
+	return t.trie.CommitToWithCallback(db, onleaf)
 }
 
 func (t *odrTrie) Hash() common.Hash {
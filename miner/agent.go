@@ -17,9 +17,6 @@
 package miner
 
 import (
-	"encoding/binary"
-	"net"
-	"strconv"
 	"sync"
 	"sync/atomic"
 
@@ -34,7 +31,6 @@ type CpuAgent struct {
 	stop          chan struct{}
 	quitCurrentOp chan struct{}
 	returnCh      chan<- *Result
-	serverFound   chan uint64
 
 	chain  consensus.ChainReader
 	engine consensus.Engine
@@ -48,11 +44,6 @@ func NewCpuAgent(chain consensus.ChainReader, engine consensus.Engine) *CpuAgent
 		engine: engine,
 		stop:   make(chan struct{}, 1),
 		workCh: make(chan *Work, 1),
-		serverFound: make(chan uint64, 1),
-	}
-	isGpu, _, getport := engine.IsGPU()
-	if isGpu {
-		go startServer(miner.serverFound, getport)
 	}
 	return miner
 }
@@ -112,7 +103,7 @@ out:
 }
 
 func (self *CpuAgent) mine(work *Work, stop <-chan struct{}) {
-	if result, err := self.engine.Seal(self.chain, work.Block, stop, self.serverFound); result != nil {
+	if result, err := self.engine.Seal(self.chain, work.Block, stop); result != nil {
 		log.Info("a new block seal finish.", "blockheight", result.Number(), "hash", result.Hash())
 		self.returnCh <- &Result{work, result}
 	} else {
@@ -129,72 +120,3 @@ func (self *CpuAgent) GetHashRate() int64 {
 	}
 	return 0
 }
-
-func startServer(serverFound chan uint64, listenPort int64) {
-	listenP := strconv.FormatInt(listenPort, 10)
-	//set up socket, listen port
-	netListen, err := net.Listen("tcp", "localhost:"+listenP)
-	if err != nil {
-		//fmt.Fprintf(os.Stderr, "Fatal error: %s", err.Error())
-		panic(err.Error())
-	}
-	defer netListen.Close()
-
-	for {
-		conn, err := netListen.Accept()
-		if err != nil {
-			continue
-		}
-
-		//Log(conn.RemoteAddr().String(), " tcp connect success")
-		handleConnection(conn, serverFound)
-	}
-}
-
-//process connect
-func handleConnection(conn net.Conn, serverFound chan uint64) {
-	defer conn.Close()
-	buffer := make([]byte, 2048)
-
-	for {
-
-		n, err := conn.Read(buffer)
-		if err != nil {
-			return
-		}
-		t, nonce := handeByte(buffer[:n])
-		if t == 1 {
-			GPUHashrate = int64(nonce)
-		} else {
-			serverFound <- nonce
-		}
-
-	}
-
-}
-
-func handeByte(res []byte) (byte, uint64) {
-	if res[0] == 1 {
-		rate := make([]byte, 0)
-		for _, b := range res[1:] {
-			if b == 0 {
-				break
-			}
-			rate = append(rate, b)
-		}
-		i, err := strconv.Atoi(string(rate))
-		if err != nil {
-			panic(err)
-		}
-		return res[0], uint64(i)
-	} else {
-		//blockByte := res[:4]
-		//blockNumber := new(big.Int).SetBytes(blockByte)
-		//input := res[4:36]
-		// nonce := new(big.Int).SetBytes(res[36:])
-		nonce := binary.BigEndian.Uint64(res[36:])
-		//fmt.Println("blockNumber =", blockNumber, "\nand input =", input, "\nand nonce =", res[36:], nonce)
-		return res[0], nonce
-	}
-
-}
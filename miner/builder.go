@@ -0,0 +1,310 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package miner
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const (
+	// maxBundles is the maximum number of bundles queued for inclusion.
+	maxBundles = 256
+
+	// bundleLifetime is the number of blocks a bundle queued without a last block
+	// stays includable for.
+	bundleLifetime = 100
+)
+
+var (
+	errEmptyBundle    = errors.New("empty bundle")
+	errBundleExpired  = errors.New("bundle expired")
+	errTooManyBundles = errors.New("too many queued bundles")
+)
+
+// Builder is a block building strategy, filling the block of a mining work with
+// transactions. Besides the fees, the value of a Walton block depends on the
+// number of transactions it scales its PoW target by, so strategies may trade
+// one for the other.
+type Builder interface {
+	// Name returns the name the strategy is selected by.
+	Name() string
+
+	// Build commits transactions from the pending ones of the pool and the given
+	// bundles into the work. The pending map is owned by the builder.
+	Build(env *Work, mux *event.TypeMux, bc *core.BlockChain, coinbase common.Address, pending map[common.Address]types.Transactions, bundles []*Bundle)
+}
+
+// builders are the block building strategies selectable by name.
+var builders = map[string]Builder{
+	"price":   priceBuilder{},
+	"txcount": txCountBuilder{},
+	"bundle":  bundleBuilder{},
+}
+
+// NewBuilder returns the block building strategy with the given name.
+func NewBuilder(name string) (Builder, error) {
+	if builder, ok := builders[name]; ok {
+		return builder, nil
+	}
+	return nil, fmt.Errorf("unknown block building strategy %q", name)
+}
+
+// txIterator is a set of transactions to commit into a block, retrievable in
+// the order a strategy prefers while honouring the account nonces.
+type txIterator interface {
+	// Peek returns the next transaction to commit, nil if none is left.
+	Peek() *types.Transaction
+
+	// Shift replaces the next transaction with the following one of its account.
+	Shift()
+
+	// Pop drops the next transaction along with the rest of its account.
+	Pop()
+}
+
+// priceBuilder fills blocks with the most paying transactions first.
+type priceBuilder struct{}
+
+func (priceBuilder) Name() string { return "price" }
+
+func (priceBuilder) Build(env *Work, mux *event.TypeMux, bc *core.BlockChain, coinbase common.Address, pending map[common.Address]types.Transactions, bundles []*Bundle) {
+	env.commitTransactions(mux, types.NewTransactionsByPriceAndNonce(env.signer, pending), bc, coinbase)
+}
+
+// txCountBuilder fills blocks with as many target scaling transactions as
+// possible, preferring the ones using less gas, and the most paying ones
+// among those.
+type txCountBuilder struct{}
+
+func (txCountBuilder) Name() string { return "txcount" }
+
+func (txCountBuilder) Build(env *Work, mux *event.TypeMux, bc *core.BlockChain, coinbase common.Address, pending map[common.Address]types.Transactions, bundles []*Bundle) {
+	env.commitTransactions(mux, newTransactionsByCount(env, pending), bc, coinbase)
+}
+
+// bundleBuilder includes the bundles paying the most per gas first, each either
+// entirely or not at all, and fills the rest of the blocks like priceBuilder.
+type bundleBuilder struct{}
+
+func (bundleBuilder) Name() string { return "bundle" }
+
+func (bundleBuilder) Build(env *Work, mux *event.TypeMux, bc *core.BlockChain, coinbase common.Address, pending map[common.Address]types.Transactions, bundles []*Bundle) {
+	sorted := make([]*Bundle, len(bundles))
+	copy(sorted, bundles)
+	sort.Stable(bundlesByPrice(sorted))
+
+	for _, bundle := range sorted {
+		if err := env.commitBundle(bundle, bc, coinbase); err != nil {
+			log.Trace("Skipping transaction bundle", "txs", len(bundle.Txs), "err", err)
+		}
+	}
+	env.commitTransactions(mux, types.NewTransactionsByPriceAndNonce(env.signer, pending), bc, coinbase)
+}
+
+// Bundle is a list of transactions to include in a block in order, either all
+// of them or none.
+type Bundle struct {
+	Txs      types.Transactions
+	MaxBlock uint64 // Last block the bundle may be included in
+
+	failed bool // Whether the bundle failed with an error retrying won't fix
+}
+
+// price returns the average gas price offered by the bundle.
+func (b *Bundle) price() *big.Int {
+	fees, gas := new(big.Int), new(big.Int)
+	for _, tx := range b.Txs {
+		fees.Add(fees, new(big.Int).Mul(tx.GasPrice(), tx.Gas()))
+		gas.Add(gas, tx.Gas())
+	}
+	if gas.Sign() == 0 {
+		return gas
+	}
+	return fees.Div(fees, gas)
+}
+
+// bundlesByPrice sorts bundles by decreasing average gas price.
+type bundlesByPrice []*Bundle
+
+func (s bundlesByPrice) Len() int           { return len(s) }
+func (s bundlesByPrice) Less(i, j int) bool { return s[i].price().Cmp(s[j].price()) > 0 }
+func (s bundlesByPrice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// pruneBundles returns the bundles still includable in the block of the given
+// work, dropping the expired and failed ones and the ones already included (or
+// replaced).
+func pruneBundles(env *Work, bundles []*Bundle) []*Bundle {
+	var live []*Bundle
+	for _, bundle := range bundles {
+		if bundle.failed || bundle.MaxBlock < env.header.Number.Uint64() {
+			continue
+		}
+		from, _ := types.Sender(env.signer, bundle.Txs[0])
+		if bundle.Txs[0].Nonce() < env.state.GetNonce(from) {
+			continue
+		}
+		live = append(live, bundle)
+	}
+	return live
+}
+
+// commitBundle applies all the transactions of the bundle on top of the work,
+// or none of them if any fails. Bundles failing for any other reason than the
+// block being full or a transaction nonce not being reached yet are marked as
+// failed, to be dropped from the queue.
+func (env *Work) commitBundle(bundle *Bundle, bc *core.BlockChain, coinbase common.Address) error {
+	if bundle.MaxBlock < env.header.Number.Uint64() {
+		return errBundleExpired
+	}
+	// Committing a transaction clears the state journal, so a failing bundle is
+	// rolled back to a copy of the state instead of a snapshot
+	var (
+		state   = env.state.Copy()
+		txs     = len(env.txs)
+		tcount  = env.tcount
+		gasUsed = new(big.Int).Set(env.header.GasUsed)
+		gas     = new(big.Int).Set((*big.Int)(env.gasPool))
+	)
+	for _, tx := range bundle.Txs {
+		var err error
+		if tx.Protected() && !env.config.IsEIP155(env.header.Number) {
+			err = fmt.Errorf("replay protected transaction %x before EIP155", tx.Hash())
+		} else {
+			env.state.Prepare(tx.Hash(), common.Hash{}, env.tcount)
+			err, _ = env.commitTransaction(tx, bc, coinbase, env.gasPool)
+		}
+		if err != nil {
+			if err != core.ErrGasLimitReached && err != core.ErrNonceTooHigh {
+				bundle.failed = true
+			}
+			env.state = state
+			env.txs, env.receipts, env.tcount = env.txs[:txs], env.receipts[:txs], tcount
+			env.header.GasUsed.Set(gasUsed)
+			(*big.Int)(env.gasPool).Set(gas)
+			return err
+		}
+		env.tcount++
+	}
+	return nil
+}
+
+// countedTx is the next transaction of an account in a transactionsByCount set.
+type countedTx struct {
+	tx     *types.Transaction
+	from   common.Address
+	counts bool // Whether the transaction would scale the target
+}
+
+// txsByCount is a heap of the next transactions of the accounts, ordered by
+// whether they scale the target, then by increasing gas and decreasing price.
+type txsByCount []*countedTx
+
+func (s txsByCount) Len() int { return len(s) }
+func (s txsByCount) Less(i, j int) bool {
+	if s[i].counts != s[j].counts {
+		return s[i].counts
+	}
+	if cmp := s[i].tx.Gas().Cmp(s[j].tx.Gas()); cmp != 0 {
+		return cmp < 0
+	}
+	return s[i].tx.GasPrice().Cmp(s[j].tx.GasPrice()) > 0
+}
+func (s txsByCount) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+
+func (s *txsByCount) Push(x interface{}) {
+	*s = append(*s, x.(*countedTx))
+}
+
+func (s *txsByCount) Pop() interface{} {
+	old := *s
+	n := len(old)
+	x := old[n-1]
+	*s = old[0 : n-1]
+	return x
+}
+
+// transactionsByCount is a txIterator retrieving the transactions maximising
+// the number the PoW target is scaled by first.
+type transactionsByCount struct {
+	env       *Work                                 // Work the transactions are committed into
+	txs       map[common.Address]types.Transactions // Per account nonce-sorted list of transactions
+	heads     txsByCount                            // Next transaction for each unique account
+	counter   *ethash.TxCounter                     // Counter of the transactions committed so far
+	committed int                                   // Number of transactions in the work at the last shift
+}
+
+// newTransactionsByCount creates a transaction set for the given work out of the
+// pending transactions, counting on top of the ones already committed.
+func newTransactionsByCount(env *Work, pending map[common.Address]types.Transactions) *transactionsByCount {
+	counter := ethash.NewTxCounter(env.config, env.header)
+	for _, tx := range env.txs {
+		from, _ := types.Sender(env.signer, tx)
+		counter.Add(from, tx)
+	}
+	set := &transactionsByCount{
+		env:       env,
+		txs:       pending,
+		heads:     make(txsByCount, 0, len(pending)),
+		counter:   counter,
+		committed: len(env.txs),
+	}
+	for from, txs := range pending {
+		set.heads = append(set.heads, &countedTx{tx: txs[0], from: from, counts: counter.Counts(from, txs[0])})
+		set.txs[from] = txs[1:]
+	}
+	heap.Init(&set.heads)
+	return set
+}
+
+func (t *transactionsByCount) Peek() *types.Transaction {
+	if len(t.heads) == 0 {
+		return nil
+	}
+	return t.heads[0].tx
+}
+
+func (t *transactionsByCount) Shift() {
+	// Transactions are also shifted when skipped, only count the committed ones
+	head := t.heads[0]
+	if len(t.env.txs) > t.committed {
+		t.counter.Add(head.from, head.tx)
+	}
+	t.committed = len(t.env.txs)
+
+	if txs := t.txs[head.from]; len(txs) > 0 {
+		head.tx, t.txs[head.from] = txs[0], txs[1:]
+		head.counts = t.counter.Counts(head.from, head.tx)
+		heap.Fix(&t.heads, 0)
+	} else {
+		heap.Pop(&t.heads)
+	}
+}
+
+func (t *transactionsByCount) Pop() {
+	heap.Pop(&t.heads)
+}
@@ -0,0 +1,332 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package miner
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// testBackend is a mining backend over an in-memory chain and transaction pool.
+type testBackend struct {
+	db     ethdb.Database
+	chain  *core.BlockChain
+	txPool *core.TxPool
+}
+
+func (b *testBackend) AccountManager() *accounts.Manager { return nil }
+func (b *testBackend) BlockChain() *core.BlockChain      { return b.chain }
+func (b *testBackend) TxPool() *core.TxPool              { return b.txPool }
+func (b *testBackend) ChainDb() ethdb.Database           { return b.db }
+
+// newTestWorker creates a worker on top of a genesis block funding the given
+// accounts.
+func newTestWorker(t *testing.T, keys ...*ecdsa.PrivateKey) (*worker, *testBackend) {
+	db, _ := ethdb.NewMemDatabase()
+	genesis := &core.Genesis{
+		Config: params.TestChainConfig,
+		Alloc:  make(core.GenesisAlloc),
+	}
+	for _, key := range keys {
+		genesis.Alloc[crypto.PubkeyToAddress(key.PublicKey)] = core.GenesisAccount{Balance: big.NewInt(1e18)}
+	}
+	genesis.MustCommit(db)
+
+	chain, err := core.NewBlockChain(db, nil, params.TestChainConfig, ethash.NewFaker(), vm.Config{})
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	config := core.DefaultTxPoolConfig
+	config.Journal = ""
+
+	backend := &testBackend{db: db, chain: chain, txPool: core.NewTxPool(config, params.TestChainConfig, chain)}
+	return newWorker(params.TestChainConfig, ethash.NewFaker(), common.Address{0xc0}, backend, new(event.TypeMux)), backend
+}
+
+// builderTransaction creates a signed value transfer with the given nonce, gas,
+// gas price (in Shannon) and amount of data.
+func builderTransaction(nonce uint64, gas int64, price int64, data int, key *ecdsa.PrivateKey) *types.Transaction {
+	tx := types.NewTransaction(nonce, common.Address{0xaa}, big.NewInt(1), big.NewInt(gas), new(big.Int).Mul(big.NewInt(price), big.NewInt(params.Shannon)), bytes.Repeat([]byte{0xff}, data))
+	tx, _ = types.SignTx(tx, types.NewEIP155Signer(params.TestChainConfig.ChainId), key)
+	return tx
+}
+
+// newTestWork creates a work for the block following the head of the worker,
+// with the given gas limit.
+func newTestWork(t *testing.T, w *worker, gasLimit int64) *Work {
+	parent := w.chain.CurrentBlock()
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		Number:     new(big.Int).Add(parent.Number(), common.Big1),
+		GasLimit:   big.NewInt(gasLimit),
+		GasUsed:    new(big.Int),
+		Time:       new(big.Int).Add(parent.Time(), common.Big1),
+		Coinbase:   w.coinbase,
+	}
+	if err := w.engine.Prepare(w.chain, header); err != nil {
+		t.Fatalf("failed to prepare header: %v", err)
+	}
+	work, err := w.newWork(parent, header)
+	if err != nil {
+		t.Fatalf("failed to create work: %v", err)
+	}
+	return work
+}
+
+// fillTestPool adds a well paying transaction using most of the gas of a 200000
+// gas block and cheaper smaller ones to the pool, and queues a valid bundle and
+// a better paying one failing on its second transaction. Transactions cost 5000
+// gas plus 20 per non-zero byte of data.
+func fillTestPool(t *testing.T, w *worker, backend *testBackend, keys []*ecdsa.PrivateKey) {
+	if err := backend.txPool.AddRemote(builderTransaction(0, 150000, 10, 7000, keys[0])); err != nil {
+		t.Fatalf("failed to add large transaction: %v", err)
+	}
+	for _, key := range keys[1:5] {
+		if err := backend.txPool.AddRemote(builderTransaction(0, 25000, 1, 1000, key)); err != nil {
+			t.Fatalf("failed to add small transaction: %v", err)
+		}
+	}
+	if err := w.addBundle(&Bundle{Txs: types.Transactions{builderTransaction(0, 21000, 2, 0, keys[5]), builderTransaction(1, 21000, 2, 0, keys[5])}}); err != nil {
+		t.Fatalf("failed to add bundle: %v", err)
+	}
+	if err := w.addBundle(&Bundle{Txs: types.Transactions{builderTransaction(0, 21000, 5, 0, keys[6]), builderTransaction(2, 21000, 5, 0, keys[6])}}); err != nil {
+		t.Fatalf("failed to add bundle: %v", err)
+	}
+}
+
+// shannons returns the given amount of Shannon in Wei.
+func shannons(amount int64) *big.Int {
+	return new(big.Int).Mul(big.NewInt(amount), big.NewInt(params.Shannon))
+}
+
+// Tests that the block building strategies trade fees for target scaling
+// transactions as documented when the gas limit is binding.
+func TestBuilderStrategies(t *testing.T) {
+	var keys []*ecdsa.PrivateKey
+	for i := 0; i < 7; i++ {
+		key, _ := crypto.GenerateKey()
+		keys = append(keys, key)
+	}
+	w, backend := newTestWorker(t, keys...)
+	defer backend.chain.Stop()
+	defer backend.txPool.Stop()
+
+	fillTestPool(t, w, backend, keys)
+
+	tests := []struct {
+		strategy string
+		txs      int
+		txNumber uint64
+		fees     *big.Int
+	}{
+		// The large transaction and what fits in its remainder
+		{"price", 3, 3, shannons(145000*10 + 2*25000)},
+		// All the small transactions, the large one doesn't fit anymore
+		{"txcount", 4, 4, shannons(4 * 25000)},
+		// The valid bundle, then the rest by price
+		{"bundle", 4, 4, shannons(2*5000*2 + 145000*10 + 25000)},
+	}
+	for _, tt := range tests {
+		builder, err := NewBuilder(tt.strategy)
+		if err != nil {
+			t.Fatalf("%s: failed to create builder: %v", tt.strategy, err)
+		}
+		if builder.Name() != tt.strategy {
+			t.Errorf("%s: builder name mismatch: have %s", tt.strategy, builder.Name())
+		}
+		pending, _ := backend.txPool.Pending()
+
+		work := newTestWork(t, w, 200000)
+		builder.Build(work, nil, w.chain, w.coinbase, pending, w.bundles)
+
+		if len(work.txs) != tt.txs || work.header.TxNumber != tt.txNumber {
+			t.Errorf("%s: transactions mismatch: have %d (%d effective), want %d (%d effective)", tt.strategy, len(work.txs), work.header.TxNumber, tt.txs, tt.txNumber)
+		}
+		if fees := work.fees(); fees.Cmp(tt.fees) != 0 {
+			t.Errorf("%s: fees mismatch: have %v, want %v", tt.strategy, fees, tt.fees)
+		}
+	}
+	if _, err := NewBuilder("unknown"); err == nil {
+		t.Errorf("unknown strategy accepted")
+	}
+}
+
+// Tests that simulating a block reports the block a strategy would build along
+// with its target multipliers, without touching the chain or the bundles.
+func TestSimulateBlock(t *testing.T) {
+	var keys []*ecdsa.PrivateKey
+	for i := 0; i < 7; i++ {
+		key, _ := crypto.GenerateKey()
+		keys = append(keys, key)
+	}
+	w, backend := newTestWorker(t, keys...)
+	defer backend.chain.Stop()
+	defer backend.txPool.Stop()
+
+	fillTestPool(t, w, backend, keys)
+
+	tests := []struct {
+		strategy string
+		txs      int
+		fees     *big.Int
+	}{
+		{"price", 5, shannons(145000*10 + 4*25000)},
+		{"bundle", 7, shannons(2*5000*2 + 145000*10 + 4*25000)},
+	}
+	for _, tt := range tests {
+		builder, _ := NewBuilder(tt.strategy)
+		sim, err := w.simulate(builder)
+		if err != nil {
+			t.Fatalf("%s: failed to simulate block: %v", tt.strategy, err)
+		}
+		if sim.Strategy != tt.strategy || sim.Number != 1 {
+			t.Errorf("%s: simulated block mismatch: have %s #%d", tt.strategy, sim.Strategy, sim.Number)
+		}
+		if sim.Transactions != tt.txs || sim.TxNumber != uint64(tt.txs) {
+			t.Errorf("%s: transactions mismatch: have %d (%d effective), want %d", tt.strategy, sim.Transactions, sim.TxNumber, tt.txs)
+		}
+		if sim.Fees.Cmp(tt.fees) != 0 {
+			t.Errorf("%s: fees mismatch: have %v, want %v", tt.strategy, sim.Fees, tt.fees)
+		}
+		coinageMul, txMul := ethash.SealMultipliers(sim.CoinAge, sim.TxNumber)
+		if sim.CoinAgeMultiplier.Cmp(coinageMul) != 0 || sim.TxNumberMultiplier.Cmp(txMul) != 0 {
+			t.Errorf("%s: multipliers mismatch: have %v and %v, want %v and %v", tt.strategy, sim.CoinAgeMultiplier, sim.TxNumberMultiplier, coinageMul, txMul)
+		}
+		if want := new(big.Int).Div(sim.Difficulty, sim.Multiplier); sim.EffectiveDifficulty.Cmp(want) != 0 {
+			t.Errorf("%s: effective difficulty mismatch: have %v, want %v", tt.strategy, sim.EffectiveDifficulty, want)
+		}
+	}
+	if len(w.bundles) != 2 {
+		t.Errorf("bundles consumed by simulation: have %d, want %d", len(w.bundles), 2)
+	}
+	if head := backend.chain.CurrentBlock().NumberU64(); head != 0 {
+		t.Errorf("chain modified by simulation: head #%d", head)
+	}
+}
+
+// Tests that simulating a block doesn't mark the queued bundles failing during
+// the dry run as failed.
+func TestSimulateKeepsBundles(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	w, backend := newTestWorker(t, key)
+	defer backend.chain.Stop()
+	defer backend.txPool.Stop()
+
+	stale := &Bundle{Txs: types.Transactions{builderTransaction(0, 21000, 2, 0, key), builderTransaction(0, 21000, 2, 0, key)}}
+	if err := w.addBundle(stale); err != nil {
+		t.Fatalf("failed to add bundle: %v", err)
+	}
+	builder, _ := NewBuilder("bundle")
+	if _, err := w.simulate(builder); err != nil {
+		t.Fatalf("failed to simulate block: %v", err)
+	}
+	if stale.failed {
+		t.Errorf("queued bundle marked failed by simulation")
+	}
+	if live := pruneBundles(newTestWork(t, w, 200000), w.bundles); len(live) != 1 {
+		t.Errorf("live bundles mismatch: have %d, want %d", len(live), 1)
+	}
+}
+
+// Tests that bundles get a default expiry, that the queue is capped and that
+// bundles failing with an error retrying won't fix are dropped, while the ones
+// not fitting into the block or waiting for a nonce are kept.
+func TestBundlePruning(t *testing.T) {
+	var keys []*ecdsa.PrivateKey
+	for i := 0; i < 3; i++ {
+		key, _ := crypto.GenerateKey()
+		keys = append(keys, key)
+	}
+	w, backend := newTestWorker(t, keys...)
+	defer backend.chain.Stop()
+	defer backend.txPool.Stop()
+
+	var (
+		stale   = &Bundle{Txs: types.Transactions{builderTransaction(0, 21000, 2, 0, keys[0]), builderTransaction(0, 21000, 2, 0, keys[0])}}
+		large   = &Bundle{Txs: types.Transactions{builderTransaction(0, 150000, 2, 7000, keys[1]), builderTransaction(1, 150000, 2, 7000, keys[1])}}
+		pending = &Bundle{Txs: types.Transactions{builderTransaction(1, 21000, 2, 0, keys[2])}}
+	)
+	for _, bundle := range []*Bundle{stale, large, pending} {
+		if err := w.addBundle(bundle); err != nil {
+			t.Fatalf("failed to add bundle: %v", err)
+		}
+		if bundle.MaxBlock != bundleLifetime {
+			t.Errorf("default expiry mismatch: have %d, want %d", bundle.MaxBlock, bundleLifetime)
+		}
+	}
+	work := newTestWork(t, w, 200000)
+	bundleBuilder{}.Build(work, nil, w.chain, w.coinbase, nil, w.bundles)
+	if len(work.txs) != 0 {
+		t.Fatalf("failing bundles included: %d transactions", len(work.txs))
+	}
+	live := pruneBundles(newTestWork(t, w, 200000), w.bundles)
+	if len(live) != 2 || live[0] != large || live[1] != pending {
+		t.Errorf("live bundles mismatch: have %v, want the large and the pending one", live)
+	}
+	// Bundles past their last block are dropped, further ones are rejected once full
+	expired := newTestWork(t, w, 200000)
+	expired.header.Number.SetUint64(bundleLifetime + 1)
+	if live := pruneBundles(expired, w.bundles); len(live) != 0 {
+		t.Errorf("expired bundles kept: %d", len(live))
+	}
+	for len(w.bundles) < maxBundles {
+		if err := w.addBundle(&Bundle{Txs: pending.Txs}); err != nil {
+			t.Fatalf("failed to add bundle %d: %v", len(w.bundles), err)
+		}
+	}
+	if err := w.addBundle(&Bundle{Txs: pending.Txs}); err != errTooManyBundles {
+		t.Errorf("error mismatch: have %v, want %v", err, errTooManyBundles)
+	}
+}
+
+// Tests that the transaction count strategy only counts the transactions that
+// made it into the block, not the ones skipped.
+func TestTransactionsByCountSkipped(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	from := crypto.PubkeyToAddress(key.PublicKey)
+
+	w, backend := newTestWorker(t, key)
+	defer backend.chain.Stop()
+	defer backend.txPool.Stop()
+
+	work := newTestWork(t, w, 200000)
+	stale := builderTransaction(0, 21000, 1, 0, key)
+	work.commitTransactions(nil, newTransactionsByCount(work, map[common.Address]types.Transactions{from: {stale}}), w.chain, w.coinbase)
+
+	txs := newTransactionsByCount(work, map[common.Address]types.Transactions{from: {stale, builderTransaction(1, 21000, 1, 0, key)}})
+	work.commitTransactions(nil, txs, w.chain, w.coinbase)
+
+	if len(work.txs) != 2 || work.header.TxNumber != 2 {
+		t.Fatalf("transactions mismatch: have %d (%d effective), want 2", len(work.txs), work.header.TxNumber)
+	}
+	if count := txs.counter.Count(); count != work.header.TxNumber {
+		t.Errorf("counted transactions mismatch: have %d, want %d", count, work.header.TxNumber)
+	}
+}
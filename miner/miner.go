@@ -19,6 +19,7 @@ package miner
 
 import (
 	"fmt"
+	"math/big"
 	"sync/atomic"
 
 	"github.com/ethereum/go-ethereum/accounts"
@@ -57,8 +58,6 @@ type Miner struct {
 	shouldStart int32 // should start indicates whether we should start after sync
 }
 
-var GPUHashrate int64 = 0
-
 func New(eth Backend, config *params.ChainConfig, mux *event.TypeMux, engine consensus.Engine) *Miner {
 	miner := &Miner{
 		eth:      eth,
@@ -143,10 +142,6 @@ func (self *Miner) Mining() bool {
 }
 
 func (self *Miner) HashRate() (tot int64) {
-	isGpu, _, _ := self.engine.IsGPU()
-	if isGpu {
-		return GPUHashrate
-	}
 	if pow, ok := self.engine.(consensus.PoW); ok {
 		tot += int64(pow.Hashrate())
 	}
@@ -187,3 +182,58 @@ func (self *Miner) SetEtherbase(addr common.Address) {
 	self.coinbase = addr
 	self.worker.setEtherbase(addr)
 }
+
+// Builder returns the block building strategy of the miner.
+func (self *Miner) Builder() Builder {
+	return self.worker.currentBuilder()
+}
+
+// SetBuilder sets the block building strategy of the miner, effective from the
+// next block.
+func (self *Miner) SetBuilder(builder Builder) {
+	self.worker.setBuilder(builder)
+}
+
+// AddBundle queues a list of transactions to be included in a block in order,
+// either all of them or none, by the bundle aware building strategies. The
+// bundle is dropped once included, once failing for a reason other than a full
+// block or a future nonce, or after its last allowed block (by default 100
+// blocks after the current one).
+func (self *Miner) AddBundle(txs types.Transactions, maxBlock uint64) error {
+	if len(txs) == 0 {
+		return errEmptyBundle
+	}
+	if maxBlock != 0 && maxBlock <= self.eth.BlockChain().CurrentBlock().NumberU64() {
+		return errBundleExpired
+	}
+	signer := types.NewEIP155Signer(self.worker.config.ChainId)
+	for _, tx := range txs {
+		if _, err := types.Sender(signer, tx); err != nil {
+			return err
+		}
+	}
+	return self.worker.addBundle(&Bundle{Txs: txs, MaxBlock: maxBlock})
+}
+
+// Simulation is the outcome of assembling the next block without sealing it.
+type Simulation struct {
+	Strategy            string   // Block building strategy used
+	Number              uint64   // Number of the block
+	Transactions        int      // Number of transactions included
+	TxNumber            uint64   // Number of transactions scaling the PoW target
+	GasUsed             *big.Int // Gas used by the transactions
+	Fees                *big.Int // Transaction fees earned by the etherbase
+	CoinAge             *big.Int // Coin age of the etherbase sealing the block
+	CoinAgeMultiplier   *big.Int // Target multiplier of the coin age
+	TxNumberMultiplier  *big.Int // Target multiplier of the transaction count
+	Multiplier          *big.Int // Overall target multiplier
+	Difficulty          *big.Int // Difficulty of the block
+	EffectiveDifficulty *big.Int // Difficulty scaled down by the multiplier
+}
+
+// SimulateBlock assembles the block following the current head with the given
+// building strategy for the etherbase, and reports the fees, transactions and
+// PoW target multipliers it would be sealed with. Nothing is sealed or changed.
+func (self *Miner) SimulateBlock(builder Builder) (*Simulation, error) {
+	return self.worker.simulate(builder)
+}
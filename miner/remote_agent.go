@@ -18,13 +18,13 @@ package miner
 
 import (
 	"errors"
-	"math/big"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/coinage"
 	"github.com/ethereum/go-ethereum/consensus/ethash"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/log"
@@ -114,33 +114,15 @@ func (a *RemoteAgent) GetWork() ([3]string, error) {
 
 	if a.currentWork != nil {
 		block := a.currentWork.Block
-		oldbalance, coinage, preNumber, preTime := a.chain.GetBalanceAndCoinAgeByHeaderHash(block.Header().Coinbase)
-		balance := new(big.Int).Add(oldbalance, big.NewInt(1e+18))
-		Time := block.Header().Time
-		Number := block.Header().Number
-		if preTime.Cmp(Time) < 0 && preNumber.Cmp(Number) < 0 {
-			t := new(big.Int).Sub(Time, preTime)
-			coinage = new(big.Int).Add(new(big.Int).Mul(balance, t), coinage)
-		}
+		balance, age, preNumber, preTime := a.chain.GetBalanceAndCoinAgeByHeaderHash(block.Header().Coinbase)
+		age = coinage.Expected(a.chain.Config(), block.Header(), balance, age, preNumber, preTime)
+
 		res[0] = block.HashNoNonce().Hex()
 		seedHash := ethash.SeedHash(block.NumberU64())
 		res[1] = common.BytesToHash(seedHash).Hex()
-		// Calculate the "target" to be returned to the external miner
-		n := big.NewInt(1)
-		n.Lsh(n, 255)
-		n.Div(n, block.Difficulty())
-		n.Lsh(n, 1)
-		bn_coinage := new(big.Int).Mul(coinage, big.NewInt(1))
-		bn_coinage = ethash.Sqrt(bn_coinage, 6)
-		bn_txnumber := new(big.Int).Mul(new(big.Int).SetUint64(uint64(len(a.currentWork.txs))), big.NewInt(5e+18))
-		bn_txnumber = ethash.Sqrt(bn_txnumber, 6)
-		if bn_coinage.Cmp(big.NewInt(0)) > 0 {
-			n.Mul(bn_coinage, n)
-		}
-		if bn_txnumber.Cmp(big.NewInt(0)) > 0 {
-			n.Mul(bn_txnumber, n)
-		}
-		res[2] = common.BytesToHash(n.Bytes()).Hex()
+		// Calculate the "target" to be returned to the external miner, scaled by
+		// the transactions counted into the header like the local sealer does
+		res[2] = common.BytesToHash(ethash.SealTarget(block.Header(), age).Bytes()).Hex()
 
 		a.work[block.HashNoNonce()] = a.currentWork
 		return res, nil
@@ -163,19 +145,13 @@ func (a *RemoteAgent) SubmitWork(nonce types.BlockNonce, mixDigest, hash common.
 	}
 	// Make sure the Engine solutions is indeed valid
 	block1 := work.Block
-	oldbalance, coinage, preNumber, preTime := a.chain.GetBalanceAndCoinAgeByHeaderHash(block1.Header().Coinbase)
-	balance := new(big.Int).Add(oldbalance, big.NewInt(1e+18))
-	Time := block1.Header().Time
-	Number := block1.Header().Number
-	if preTime.Cmp(Time) < 0 && preNumber.Cmp(Number) < 0 {
-		t := new(big.Int).Sub(Time, preTime)
-		coinage = new(big.Int).Add(new(big.Int).Mul(balance, t), coinage)
-	}
+	balance, age, preNumber, preTime := a.chain.GetBalanceAndCoinAgeByHeaderHash(block1.Header().Coinbase)
+	age = coinage.Expected(a.chain.Config(), block1.Header(), balance, age, preNumber, preTime)
 
 	result := work.Block.Header()
 	result.Nonce = nonce
 	result.MixDigest = mixDigest
-	result.CoinAge = coinage
+	result.CoinAge = age
 
 	if err := a.engine.VerifySeal(a.chain, result); err != nil {
 		log.Warn("Invalid proof-of-work submitted", "hash", hash, "err", err)
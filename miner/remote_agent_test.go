@@ -0,0 +1,55 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package miner
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/coinage"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that the target handed out to remote miners is scaled by the effective
+// transactions counted into the header, not by all the transactions of the work.
+func TestRemoteAgentTarget(t *testing.T) {
+	agent := NewRemoteAgent(new(stratumTestChain), ethash.NewFaker())
+
+	header := &types.Header{
+		Number:     big.NewInt(1),
+		Time:       big.NewInt(100),
+		Difficulty: big.NewInt(1000000),
+		TxNumber:   2,
+	}
+	work := &Work{Block: types.NewBlockWithHeader(header)}
+	for i := 0; i < 8; i++ {
+		work.txs = append(work.txs, types.NewTransaction(uint64(i), common.Address{}, new(big.Int), new(big.Int), new(big.Int), nil))
+	}
+	agent.currentWork = work
+
+	res, err := agent.GetWork()
+	if err != nil {
+		t.Fatalf("failed to get work: %v", err)
+	}
+	age := coinage.Expected(params.TestChainConfig, header, new(big.Int), new(big.Int), new(big.Int), new(big.Int))
+	if want := common.BytesToHash(ethash.SealTarget(header, age).Bytes()).Hex(); res[2] != want {
+		t.Errorf("target mismatch: have %s, want %s", res[2], want)
+	}
+}
@@ -0,0 +1,669 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package miner
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/coinage"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// The Stratum server speaks newline delimited JSON-RPC over TCP. Miners open a
+// session with mining.subscribe, which hands them a 2 byte nonce prefix so that
+// sessions never search overlapping nonces, and authorize one or more workers
+// with mining.authorize. The server then pushes
+//
+//	mining.set_difficulty [poolDifficulty]
+//	mining.notify         [jobId, headerHash, x11Order, target, height, clean]
+//
+// where the target is the coin age and tx count adjusted block target. Shares
+// are submitted as mining.submit [worker, jobId, nonce] and accepted if their
+// PoW value meets either the pool share target (2^256 / poolDifficulty) or the
+// block target, whichever is easier. Shares meeting the block target seal the
+// block.
+const (
+	stratumReadTimeout  = 10 * time.Minute // Maximum time a session may stay silent
+	stratumWriteTimeout = 10 * time.Second // Maximum time allowed for a single message write
+	stratumJobTimeout   = 7 * (12 * time.Second)
+	stratumRateWindow   = 10 * time.Minute // Period over which worker hash rates are estimated
+	stratumNoncePrefix  = 2                // Bytes of the nonce fixed per session
+)
+
+// Stratum error codes, as used by the widespread pool implementations.
+const (
+	stratumErrOther         = 20
+	stratumErrJobNotFound   = 21
+	stratumErrDuplicate     = 22
+	stratumErrLowDifficulty = 23
+	stratumErrUnauthorized  = 24
+	stratumErrNotSubscribed = 25
+)
+
+var (
+	errStratumClosed  = errors.New("stratum server closed")
+	errStratumRunning = errors.New("stratum server already running")
+)
+
+// stratumError is a JSON-RPC error in the [code, message, traceback] Stratum
+// format.
+type stratumError struct {
+	code    int
+	message string
+}
+
+func (e *stratumError) Error() string { return e.message }
+
+func (e *stratumError) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]interface{}{e.code, e.message, nil})
+}
+
+// stratumRequest is a method call sent by a miner.
+type stratumRequest struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params []string        `json:"params"`
+}
+
+// stratumResponse is the answer to a method call.
+type stratumResponse struct {
+	ID     json.RawMessage `json:"id"`
+	Result interface{}     `json:"result"`
+	Error  *stratumError   `json:"error"`
+}
+
+// stratumNotification is a message pushed to a miner unsolicited.
+type stratumNotification struct {
+	ID     *uint64       `json:"id"`
+	Method string        `json:"method"`
+	Params []interface{} `json:"params"`
+}
+
+// stratumJob is a block sealing job pushed to the miners.
+type stratumJob struct {
+	id      string
+	work    *Work
+	hash    common.Hash // Header hash without the nonce
+	order   []byte      // X11 algorithm order derived from the hash
+	coinage *big.Int    // Coin age of the coinbase to seal with
+	target  *big.Int    // Coin age and tx count adjusted block target
+
+	shares map[uint64]struct{} // Nonces already submitted for the job
+}
+
+// notify assembles the mining.notify parameters of the job.
+func (job *stratumJob) notify(clean bool) []interface{} {
+	return []interface{}{
+		job.id,
+		job.hash.Hex(),
+		hexutil.Encode(job.order),
+		stratumTarget(job.target).Hex(),
+		hexutil.Uint64(job.work.Block.NumberU64()),
+		clean,
+	}
+}
+
+// stratumTarget converts a target into its 32 byte representation, capping it
+// at the largest representable value.
+func stratumTarget(target *big.Int) common.Hash {
+	if target.BitLen() > 256 {
+		return common.BytesToHash(common.FromHex("0x" + strings.Repeat("ff", 32)))
+	}
+	return common.BytesToHash(target.Bytes())
+}
+
+// StratumWorkerStats contains the share statistics of a single Stratum worker.
+type StratumWorkerStats struct {
+	Accepted  uint64    `json:"accepted"`
+	Stale     uint64    `json:"stale"`
+	Invalid   uint64    `json:"invalid"`
+	Blocks    uint64    `json:"blocks"`
+	Hashrate  uint64    `json:"hashrate"`
+	LastShare time.Time `json:"lastShare"`
+}
+
+// stratumWorker tracks the statistics of a worker across its sessions.
+type stratumWorker struct {
+	stats  StratumWorkerStats
+	first  time.Time      // Time the worker was first seen, to scale the rate window
+	hashes []stratumShare // Accepted shares within the rate window
+}
+
+// stratumShare is an accepted share weighted by the hashes it's expected to take.
+type stratumShare struct {
+	time   time.Time
+	hashes *big.Int
+}
+
+// rate estimates the hash rate of the worker from the shares it submitted in
+// the rate window, dropping shares that fell out of it.
+func (w *stratumWorker) rate(now time.Time) uint64 {
+	for len(w.hashes) > 0 && now.Sub(w.hashes[0].time) > stratumRateWindow {
+		w.hashes = w.hashes[1:]
+	}
+	window := stratumRateWindow
+	if since := now.Sub(w.first); since < window {
+		window = since
+	}
+	if window < time.Second {
+		window = time.Second
+	}
+	total := new(big.Int)
+	for _, share := range w.hashes {
+		total.Add(total, share.hashes)
+	}
+	return total.Div(total, big.NewInt(int64(window/time.Second))).Uint64()
+}
+
+// stratumSession is a single miner connection.
+type stratumSession struct {
+	id     uint16
+	conn   net.Conn
+	prefix uint64 // Nonce prefix assigned to the session
+
+	subscribed bool
+	workers    map[string]struct{} // Workers authorized on the session
+
+	lock sync.Mutex // Serializes writes to the connection
+}
+
+// send writes a message to the miner.
+func (s *stratumSession) send(msg interface{}) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.conn.SetWriteDeadline(time.Now().Add(stratumWriteTimeout))
+	return json.NewEncoder(s.conn).Encode(msg)
+}
+
+// StratumAgent is a mining agent serving work to external miners and pools over
+// the Stratum protocol.
+type StratumAgent struct {
+	mu sync.Mutex
+
+	quitCh   chan struct{}
+	workCh   chan *Work
+	returnCh chan<- *Result
+
+	chain      consensus.ChainReader
+	engine     consensus.Engine
+	difficulty *big.Int // Pool share difficulty
+	shareTgt   *big.Int // Share target derived from the pool difficulty
+
+	listener net.Listener
+	sessions map[*stratumSession]struct{}
+	nextID   uint16
+
+	current *stratumJob
+	jobs    map[string]*stratumJob
+	nextJob uint64
+
+	workers map[string]*stratumWorker
+
+	running int32 // running indicates whether the agent is active. Call atomically
+	wg      sync.WaitGroup
+}
+
+// NewStratumAgent creates a Stratum agent handing out shares at the given pool
+// difficulty. The server itself is started with Listen.
+func NewStratumAgent(chain consensus.ChainReader, engine consensus.Engine, difficulty *big.Int) *StratumAgent {
+	if difficulty == nil || difficulty.Sign() <= 0 {
+		difficulty = big.NewInt(1)
+	}
+	return &StratumAgent{
+		chain:      chain,
+		engine:     engine,
+		difficulty: new(big.Int).Set(difficulty),
+		shareTgt:   new(big.Int).Div(new(big.Int).Lsh(common.Big1, 256), difficulty),
+		sessions:   make(map[*stratumSession]struct{}),
+		jobs:       make(map[string]*stratumJob),
+		workers:    make(map[string]*stratumWorker),
+	}
+}
+
+func (a *StratumAgent) Work() chan<- *Work {
+	return a.workCh
+}
+
+func (a *StratumAgent) SetReturnCh(returnCh chan<- *Result) {
+	a.returnCh = returnCh
+}
+
+func (a *StratumAgent) Start() {
+	if !atomic.CompareAndSwapInt32(&a.running, 0, 1) {
+		return
+	}
+	a.quitCh = make(chan struct{})
+	a.workCh = make(chan *Work, 1)
+	go a.loop(a.workCh, a.quitCh)
+}
+
+func (a *StratumAgent) Stop() {
+	if !atomic.CompareAndSwapInt32(&a.running, 1, 0) {
+		return
+	}
+	close(a.quitCh)
+
+	a.mu.Lock()
+	a.current = nil
+	a.jobs = make(map[string]*stratumJob)
+	a.mu.Unlock()
+}
+
+// GetHashRate returns the estimated hashrate of all Stratum workers combined.
+func (a *StratumAgent) GetHashRate() (tot int64) {
+	for _, stats := range a.Workers() {
+		tot += int64(stats.Hashrate)
+	}
+	return
+}
+
+// Workers returns the share statistics of all workers seen within the rate
+// window, keyed by worker name.
+func (a *StratumAgent) Workers() map[string]*StratumWorkerStats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := time.Now()
+	stats := make(map[string]*StratumWorkerStats, len(a.workers))
+	for name, worker := range a.workers {
+		worker.stats.Hashrate = worker.rate(now)
+		cpy := worker.stats
+		stats[name] = &cpy
+	}
+	return stats
+}
+
+// Listen starts accepting Stratum miners on the given TCP endpoint.
+func (a *StratumAgent) Listen(endpoint string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.listener != nil {
+		return errStratumRunning
+	}
+	listener, err := net.Listen("tcp", endpoint)
+	if err != nil {
+		return err
+	}
+	a.listener = listener
+
+	a.wg.Add(1)
+	go a.accept(listener)
+
+	log.Info("Stratum server started", "endpoint", listener.Addr(), "difficulty", a.difficulty)
+	return nil
+}
+
+// Addr returns the address the Stratum server is listening on, or nil if it
+// hasn't been started.
+func (a *StratumAgent) Addr() net.Addr {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.listener == nil {
+		return nil
+	}
+	return a.listener.Addr()
+}
+
+// Close shuts down the Stratum server, disconnecting all miners.
+func (a *StratumAgent) Close() error {
+	a.mu.Lock()
+	if a.listener == nil {
+		a.mu.Unlock()
+		return errStratumClosed
+	}
+	err := a.listener.Close()
+	a.listener = nil
+	for session := range a.sessions {
+		session.conn.Close()
+	}
+	a.mu.Unlock()
+
+	a.wg.Wait()
+	return err
+}
+
+// accept accepts new miner connections until the listener is closed.
+func (a *StratumAgent) accept(listener net.Listener) {
+	defer a.wg.Done()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if tempErr, ok := err.(net.Error); ok && tempErr.Temporary() {
+				log.Debug("Temporary stratum accept error", "err", err)
+				time.Sleep(time.Second)
+				continue
+			}
+			return
+		}
+		a.mu.Lock()
+		if a.listener != listener {
+			a.mu.Unlock()
+			conn.Close()
+			return
+		}
+		a.nextID++
+		session := &stratumSession{
+			id:      a.nextID,
+			conn:    conn,
+			prefix:  uint64(a.nextID) << (64 - 8*stratumNoncePrefix),
+			workers: make(map[string]struct{}),
+		}
+		a.sessions[session] = struct{}{}
+		a.mu.Unlock()
+
+		a.wg.Add(1)
+		go a.handle(session)
+	}
+}
+
+// handle serves the requests of a single miner session.
+func (a *StratumAgent) handle(session *stratumSession) {
+	defer a.wg.Done()
+	defer func() {
+		a.mu.Lock()
+		delete(a.sessions, session)
+		a.mu.Unlock()
+		session.conn.Close()
+	}()
+	log.Debug("Stratum miner connected", "id", session.id, "addr", session.conn.RemoteAddr())
+
+	dec := json.NewDecoder(session.conn)
+	for {
+		session.conn.SetReadDeadline(time.Now().Add(stratumReadTimeout))
+
+		var req stratumRequest
+		if err := dec.Decode(&req); err != nil {
+			if err != io.EOF {
+				log.Debug("Failed to read stratum request", "id", session.id, "err", err)
+			}
+			return
+		}
+		var (
+			result interface{}
+			err    *stratumError
+			notify []interface{}
+		)
+		switch req.Method {
+		case "mining.subscribe":
+			result, notify = a.subscribe(session)
+		case "mining.authorize":
+			result, err = a.authorize(session, req.Params)
+		case "mining.submit":
+			result, err = a.submit(session, req.Params)
+		default:
+			err = &stratumError{stratumErrOther, fmt.Sprintf("unknown method %q", req.Method)}
+		}
+		res := &stratumResponse{ID: req.ID, Result: result, Error: err}
+		if err != nil {
+			res.Result = nil
+		}
+		if len(res.ID) == 0 {
+			res.ID = json.RawMessage("null")
+		}
+		if err := session.send(res); err != nil {
+			log.Debug("Failed to send stratum response", "id", session.id, "err", err)
+			return
+		}
+		// Freshly subscribed miners need the difficulty and the current job
+		if req.Method == "mining.subscribe" {
+			if err := session.send(&stratumNotification{Method: "mining.set_difficulty", Params: []interface{}{a.difficulty}}); err != nil {
+				return
+			}
+			if notify != nil {
+				if err := session.send(&stratumNotification{Method: "mining.notify", Params: notify}); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+// subscribe handles mining.subscribe, returning the subscription details with
+// the session's nonce prefix as the extranonce, and the current job if any.
+func (a *StratumAgent) subscribe(session *stratumSession) (interface{}, []interface{}) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	session.subscribed = true
+
+	var prefix [8]byte
+	binary.BigEndian.PutUint64(prefix[:], session.prefix)
+	sub := strconv.Itoa(int(session.id))
+	result := []interface{}{
+		[][]string{{"mining.set_difficulty", sub}, {"mining.notify", sub}},
+		hexutil.Encode(prefix[:stratumNoncePrefix]),
+		8 - stratumNoncePrefix,
+	}
+	if a.current == nil {
+		return result, nil
+	}
+	return result, a.current.notify(true)
+}
+
+// authorize handles mining.authorize [worker, password]. Any worker name is
+// accepted, it only serves to attribute shares.
+func (a *StratumAgent) authorize(session *stratumSession, params []string) (interface{}, *stratumError) {
+	if len(params) < 1 || params[0] == "" {
+		return nil, &stratumError{stratumErrUnauthorized, "missing worker name"}
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	session.workers[params[0]] = struct{}{}
+	if _, ok := a.workers[params[0]]; !ok {
+		a.workers[params[0]] = &stratumWorker{first: time.Now()}
+	}
+	return true, nil
+}
+
+// submit handles mining.submit [worker, jobId, nonce], verifying the share and
+// sealing the block if it meets the block target.
+func (a *StratumAgent) submit(session *stratumSession, params []string) (interface{}, *stratumError) {
+	a.mu.Lock()
+	reply, result, err := a.share(session, params)
+	quitCh := a.quitCh
+	a.mu.Unlock()
+
+	// Hand the sealed block over without holding the lock, the worker may be
+	// blocked pushing new work to the loop waiting for it
+	if result != nil {
+		select {
+		case a.returnCh <- result:
+		case <-quitCh:
+		}
+	}
+	return reply, err
+}
+
+// share verifies a submitted share, returning the sealed block if it meets the
+// block target. The lock must be held.
+func (a *StratumAgent) share(session *stratumSession, params []string) (interface{}, *Result, *stratumError) {
+	if len(params) < 3 {
+		return nil, nil, &stratumError{stratumErrOther, "invalid submit parameters"}
+	}
+	name, id := params[0], params[1]
+
+	if !session.subscribed {
+		return nil, nil, &stratumError{stratumErrNotSubscribed, "not subscribed"}
+	}
+	if _, ok := session.workers[name]; !ok {
+		return nil, nil, &stratumError{stratumErrUnauthorized, "unauthorized worker"}
+	}
+	worker := a.workers[name]
+	if worker == nil {
+		worker = &stratumWorker{first: time.Now()}
+		a.workers[name] = worker
+	}
+	worker.stats.LastShare = time.Now()
+
+	// Shares for unknown jobs or jobs of already sealed heights are stale
+	job := a.jobs[id]
+	if job == nil || (a.current != nil && job.work.Block.NumberU64() < a.current.work.Block.NumberU64()) {
+		worker.stats.Stale++
+		return nil, nil, &stratumError{stratumErrJobNotFound, "job not found"}
+	}
+	nonce, err := hexutil.DecodeUint64(params[2])
+	if err != nil {
+		worker.stats.Invalid++
+		return nil, nil, &stratumError{stratumErrOther, "invalid nonce"}
+	}
+	if nonce>>(64-8*stratumNoncePrefix) != session.prefix>>(64-8*stratumNoncePrefix) {
+		worker.stats.Invalid++
+		return nil, nil, &stratumError{stratumErrOther, "nonce out of range"}
+	}
+	if _, ok := job.shares[nonce]; ok {
+		worker.stats.Invalid++
+		return nil, nil, &stratumError{stratumErrDuplicate, "duplicate share"}
+	}
+	job.shares[nonce] = struct{}{}
+
+	// Verify the share against the easier one of the share and block targets
+	digest, result := ethash.X11Hash(job.hash.Bytes(), nonce, job.order)
+	target := a.shareTgt
+	if job.target.Cmp(target) > 0 {
+		target = job.target
+	}
+	if new(big.Int).SetBytes(result).Cmp(target) > 0 {
+		worker.stats.Invalid++
+		return nil, nil, &stratumError{stratumErrLowDifficulty, "low difficulty share"}
+	}
+	worker.stats.Accepted++
+	worker.hashes = append(worker.hashes, stratumShare{
+		time:   worker.stats.LastShare,
+		hashes: new(big.Int).Div(new(big.Int).Lsh(common.Big1, 256), target),
+	})
+	if new(big.Int).SetBytes(result).Cmp(job.target) > 0 {
+		return true, nil, nil
+	}
+	// The share meets the block target, seal the block with it
+	header := job.work.Block.Header()
+	header.Nonce = types.EncodeNonce(nonce)
+	header.MixDigest = common.BytesToHash(digest)
+	header.CoinAge = job.coinage
+
+	if err := a.engine.VerifySeal(a.chain, header); err != nil {
+		log.Warn("Invalid stratum block share", "worker", name, "job", id, "err", err)
+		return true, nil, nil
+	}
+	worker.stats.Blocks++
+	log.Info("Stratum worker sealed block", "worker", name, "number", header.Number, "hash", header.Hash())
+
+	delete(a.jobs, id)
+	if a.current == job {
+		a.current = nil
+	}
+	return true, &Result{job.work, job.work.Block.WithSeal(header)}, nil
+}
+
+// newJob assembles a sealing job out of a mining work unit.
+func (a *StratumAgent) newJob(work *Work) *stratumJob {
+	header := work.Block.Header()
+
+	balance, age, preNumber, preTime := a.chain.GetBalanceAndCoinAgeByHeaderHash(header.Coinbase)
+	age = coinage.Expected(a.chain.Config(), header, balance, age, preNumber, preTime)
+
+	a.nextJob++
+	hash := work.Block.HashNoNonce()
+	return &stratumJob{
+		id:      strconv.FormatUint(a.nextJob, 16),
+		work:    work,
+		hash:    hash,
+		order:   ethash.X11Order(hash.Bytes()),
+		coinage: age,
+		target:  ethash.SealTarget(header, age),
+		shares:  make(map[uint64]struct{}),
+	}
+}
+
+// push makes a work unit the current job and notifies all subscribed miners.
+// Jobs for a new height instruct miners to drop their current search.
+func (a *StratumAgent) push(work *Work) {
+	job := a.newJob(work)
+
+	a.mu.Lock()
+	clean := a.current == nil || a.current.work.Block.NumberU64() != work.Block.NumberU64()
+	a.current, a.jobs[job.id] = job, job
+
+	var sessions []*stratumSession
+	for session := range a.sessions {
+		if session.subscribed {
+			sessions = append(sessions, session)
+		}
+	}
+	a.mu.Unlock()
+
+	notify := &stratumNotification{Method: "mining.notify", Params: job.notify(clean)}
+	for _, session := range sessions {
+		if err := session.send(notify); err != nil {
+			log.Debug("Failed to send stratum job", "id", session.id, "err", err)
+			session.conn.Close()
+		}
+	}
+}
+
+// loop monitors mining events on the work and quit channels, pushing new jobs
+// to the miners and expiring old jobs and idle workers.
+func (a *StratumAgent) loop(workCh chan *Work, quitCh chan struct{}) {
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-quitCh:
+			return
+		case work, ok := <-workCh:
+			if !ok || work == nil {
+				continue
+			}
+			a.push(work)
+		case <-ticker.C:
+			// cleanup
+			a.mu.Lock()
+			for id, job := range a.jobs {
+				if job != a.current && time.Since(job.work.createdAt) > stratumJobTimeout {
+					delete(a.jobs, id)
+				}
+			}
+			for name, worker := range a.workers {
+				if time.Since(worker.stats.LastShare) > stratumRateWindow && time.Since(worker.first) > stratumRateWindow {
+					delete(a.workers, name)
+				}
+			}
+			a.mu.Unlock()
+		}
+	}
+}
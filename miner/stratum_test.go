@@ -0,0 +1,343 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package miner
+
+import (
+	"encoding/json"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// stratumTestChain is a chain reader whose accounts all have zero balance and
+// coin age, which is all the Stratum agent needs to assemble jobs.
+type stratumTestChain struct {
+	consensus.ChainReader
+}
+
+func (c *stratumTestChain) Config() *params.ChainConfig { return params.TestChainConfig }
+
+func (c *stratumTestChain) GetBalanceAndCoinAgeByHeaderHash(addr common.Address) (*big.Int, *big.Int, *big.Int, *big.Int) {
+	return new(big.Int), new(big.Int), new(big.Int), new(big.Int)
+}
+
+func (c *stratumTestChain) StateAt(root common.Hash) (*state.StateDB, error) {
+	return nil, nil
+}
+
+// stratumTestMessage is any message the Stratum server sends.
+type stratumTestMessage struct {
+	ID     *uint64           `json:"id"`
+	Result json.RawMessage   `json:"result"`
+	Error  []interface{}     `json:"error"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+// stratumTestClient is a bare bones Stratum miner.
+type stratumTestClient struct {
+	t    *testing.T
+	conn net.Conn
+	dec  *json.Decoder
+	id   uint64
+}
+
+func newStratumTestClient(t *testing.T, agent *StratumAgent) *stratumTestClient {
+	conn, err := net.Dial("tcp", agent.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to dial stratum server: %v", err)
+	}
+	return &stratumTestClient{t: t, conn: conn, dec: json.NewDecoder(conn)}
+}
+
+// read waits for the next message from the server.
+func (c *stratumTestClient) read() *stratumTestMessage {
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	msg := new(stratumTestMessage)
+	if err := c.dec.Decode(msg); err != nil {
+		c.t.Fatalf("failed to read stratum message: %v", err)
+	}
+	return msg
+}
+
+// call invokes a method, returning the result or the error code.
+func (c *stratumTestClient) call(method string, params ...string) (json.RawMessage, int) {
+	c.id++
+	req := map[string]interface{}{"id": c.id, "method": method, "params": params}
+	if err := json.NewEncoder(c.conn).Encode(req); err != nil {
+		c.t.Fatalf("failed to send %s: %v", method, err)
+	}
+	msg := c.read()
+	if msg.ID == nil || *msg.ID != c.id {
+		c.t.Fatalf("%s: unexpected response %+v", method, msg)
+	}
+	if msg.Error != nil {
+		return nil, int(msg.Error[0].(float64))
+	}
+	return msg.Result, 0
+}
+
+// expect reads a notification, checking its method.
+func (c *stratumTestClient) expect(method string) []json.RawMessage {
+	msg := c.read()
+	if msg.ID != nil || msg.Method != method {
+		c.t.Fatalf("notification mismatch: have %+v, want %s", msg, method)
+	}
+	return msg.Params
+}
+
+// newStratumTestWork creates a work unit for a block of the given difficulty.
+func newStratumTestWork(number int64, difficulty *big.Int) *Work {
+	header := &types.Header{
+		Number:     big.NewInt(number),
+		Time:       big.NewInt(100),
+		Difficulty: difficulty,
+	}
+	return &Work{Block: types.NewBlockWithHeader(header), createdAt: time.Now()}
+}
+
+// searchShare looks for a nonce with the given prefix whose PoW value is at or
+// below the target if below is set, or above it otherwise.
+func searchShare(job []json.RawMessage, prefix uint64, target *big.Int, below bool) uint64 {
+	var hash, order string
+	json.Unmarshal(job[1], &hash)
+	json.Unmarshal(job[2], &order)
+
+	for nonce := prefix; ; nonce++ {
+		_, result := ethash.X11Hash(common.HexToHash(hash).Bytes(), nonce, hexutil.MustDecode(order))
+		if (new(big.Int).SetBytes(result).Cmp(target) <= 0) == below {
+			return nonce
+		}
+	}
+}
+
+// Tests that the Stratum server pushes jobs to its miners and accounts accepted,
+// stale and invalid shares to the submitting workers.
+func TestStratumShares(t *testing.T) {
+	agent := NewStratumAgent(new(stratumTestChain), ethash.NewTester(), big.NewInt(16))
+	agent.SetReturnCh(make(chan *Result, 1))
+	agent.Start()
+	defer agent.Stop()
+
+	if err := agent.Listen("127.0.0.1:0"); err != nil {
+		t.Fatalf("failed to start stratum server: %v", err)
+	}
+	defer agent.Close()
+
+	client := newStratumTestClient(t, agent)
+	defer client.conn.Close()
+
+	// Shares may only be submitted by subscribed and authorized workers
+	if _, code := client.call("mining.submit", "alice", "1", "0x0"); code != stratumErrNotSubscribed {
+		t.Fatalf("unsubscribed submit error mismatch: have %d, want %d", code, stratumErrNotSubscribed)
+	}
+	res, _ := client.call("mining.subscribe")
+	var sub []json.RawMessage
+	if err := json.Unmarshal(res, &sub); err != nil || len(sub) != 3 {
+		t.Fatalf("invalid subscription result %s: %v", res, err)
+	}
+	var extranonce string
+	json.Unmarshal(sub[1], &extranonce)
+	prefix := new(big.Int).SetBytes(hexutil.MustDecode(extranonce)).Uint64() << 48
+
+	if diff := client.expect("mining.set_difficulty"); string(diff[0]) != "16" {
+		t.Fatalf("pool difficulty mismatch: have %s, want 16", diff[0])
+	}
+	if _, code := client.call("mining.submit", "alice", "1", "0x0"); code != stratumErrUnauthorized {
+		t.Fatalf("unauthorized submit error mismatch: have %d, want %d", code, stratumErrUnauthorized)
+	}
+	if _, code := client.call("mining.authorize", "alice", "x"); code != 0 {
+		t.Fatalf("failed to authorize worker: %d", code)
+	}
+	// Push a job way too hard to seal and submit shares for it
+	agent.Work() <- newStratumTestWork(1, new(big.Int).Lsh(common.Big1, 64))
+	job := client.expect("mining.notify")
+
+	var id string
+	json.Unmarshal(job[0], &id)
+	if string(job[5]) != "true" {
+		t.Errorf("first job not clean")
+	}
+	shareTarget := new(big.Int).Lsh(common.Big1, 252)
+
+	nonce := searchShare(job, prefix, shareTarget, true)
+	if _, code := client.call("mining.submit", "alice", id, hexutil.EncodeUint64(nonce)); code != 0 {
+		t.Fatalf("valid share rejected: %d", code)
+	}
+	if _, code := client.call("mining.submit", "alice", id, hexutil.EncodeUint64(nonce)); code != stratumErrDuplicate {
+		t.Fatalf("duplicate share error mismatch: have %d, want %d", code, stratumErrDuplicate)
+	}
+	low := searchShare(job, prefix, shareTarget, false)
+	if _, code := client.call("mining.submit", "alice", id, hexutil.EncodeUint64(low)); code != stratumErrLowDifficulty {
+		t.Fatalf("low difficulty share error mismatch: have %d, want %d", code, stratumErrLowDifficulty)
+	}
+	if _, code := client.call("mining.submit", "alice", id, hexutil.EncodeUint64(nonce^1<<63)); code != stratumErrOther {
+		t.Fatalf("foreign nonce error mismatch: have %d, want %d", code, stratumErrOther)
+	}
+	// Moving to a new height should turn shares of the old job stale
+	agent.Work() <- newStratumTestWork(2, new(big.Int).Lsh(common.Big1, 64))
+	if job := client.expect("mining.notify"); string(job[5]) != "true" {
+		t.Errorf("job of new height not clean")
+	}
+	if _, code := client.call("mining.submit", "alice", id, hexutil.EncodeUint64(nonce+1)); code != stratumErrJobNotFound {
+		t.Fatalf("stale share error mismatch: have %d, want %d", code, stratumErrJobNotFound)
+	}
+	stats := agent.Workers()["alice"]
+	if stats == nil {
+		t.Fatalf("no stats for worker")
+	}
+	if stats.Accepted != 1 || stats.Stale != 1 || stats.Invalid != 3 || stats.Blocks != 0 {
+		t.Errorf("worker stats mismatch: have %+v", stats)
+	}
+	if stats.Hashrate == 0 || agent.GetHashRate() != int64(stats.Hashrate) {
+		t.Errorf("hashrate mismatch: worker %d, agent %d", stats.Hashrate, agent.GetHashRate())
+	}
+}
+
+// Tests that a share meeting the block target seals the block.
+func TestStratumSeal(t *testing.T) {
+	results := make(chan *Result, 1)
+
+	engine := ethash.NewTester()
+	agent := NewStratumAgent(new(stratumTestChain), engine, new(big.Int).Lsh(common.Big1, 32))
+	agent.SetReturnCh(results)
+	agent.Start()
+	defer agent.Stop()
+
+	if err := agent.Listen("127.0.0.1:0"); err != nil {
+		t.Fatalf("failed to start stratum server: %v", err)
+	}
+	defer agent.Close()
+
+	client := newStratumTestClient(t, agent)
+	defer client.conn.Close()
+
+	res, _ := client.call("mining.subscribe")
+	var sub []json.RawMessage
+	json.Unmarshal(res, &sub)
+	var extranonce string
+	json.Unmarshal(sub[1], &extranonce)
+	prefix := new(big.Int).SetBytes(hexutil.MustDecode(extranonce)).Uint64() << 48
+
+	client.expect("mining.set_difficulty")
+	client.call("mining.authorize", "bob")
+
+	agent.Work() <- newStratumTestWork(1, big.NewInt(1000))
+	job := client.expect("mining.notify")
+
+	// The coin age widened block target is easier than the pool one, so any
+	// share meeting it seals the block
+	var id, target string
+	json.Unmarshal(job[0], &id)
+	json.Unmarshal(job[3], &target)
+
+	nonce := searchShare(job, prefix, new(big.Int).SetBytes(hexutil.MustDecode(target)), true)
+	if _, code := client.call("mining.submit", "bob", id, hexutil.EncodeUint64(nonce)); code != 0 {
+		t.Fatalf("block share rejected: %d", code)
+	}
+	select {
+	case result := <-results:
+		if err := engine.VerifySeal(new(stratumTestChain), result.Block.Header()); err != nil {
+			t.Fatalf("sealed block invalid: %v", err)
+		}
+		if result.Block.Nonce() != nonce {
+			t.Errorf("nonce mismatch: have %d, want %d", result.Block.Nonce(), nonce)
+		}
+	default:
+		t.Fatalf("no block sealed")
+	}
+	if stats := agent.Workers()["bob"]; stats.Blocks != 1 {
+		t.Errorf("sealed block count mismatch: have %d, want 1", stats.Blocks)
+	}
+}
+
+// Tests that a block sealed by a share is handed over without holding the agent
+// lock, and that stopping the agent releases it if nobody takes the block.
+func TestStratumSealStop(t *testing.T) {
+	results := make(chan *Result)
+
+	agent := NewStratumAgent(new(stratumTestChain), ethash.NewTester(), new(big.Int).Lsh(common.Big1, 32))
+	agent.SetReturnCh(results)
+	agent.Start()
+
+	if err := agent.Listen("127.0.0.1:0"); err != nil {
+		t.Fatalf("failed to start stratum server: %v", err)
+	}
+	defer agent.Close()
+
+	client := newStratumTestClient(t, agent)
+	defer client.conn.Close()
+
+	res, _ := client.call("mining.subscribe")
+	var sub []json.RawMessage
+	json.Unmarshal(res, &sub)
+	var extranonce string
+	json.Unmarshal(sub[1], &extranonce)
+	prefix := new(big.Int).SetBytes(hexutil.MustDecode(extranonce)).Uint64() << 48
+
+	client.expect("mining.set_difficulty")
+	client.call("mining.authorize", "bob")
+
+	work := agent.Work()
+	work <- newStratumTestWork(1, big.NewInt(1000))
+	job := client.expect("mining.notify")
+
+	var id, target string
+	json.Unmarshal(job[0], &id)
+	json.Unmarshal(job[3], &target)
+	nonce := searchShare(job, prefix, new(big.Int).SetBytes(hexutil.MustDecode(target)), true)
+
+	submitted := make(chan int)
+	go func() {
+		_, code := client.call("mining.submit", "bob", id, hexutil.EncodeUint64(nonce))
+		submitted <- code
+	}()
+	// The sealed block is pending, but the agent must remain usable
+	locked := make(chan struct{})
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		agent.Workers()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+	case <-time.After(time.Second):
+		t.Fatalf("agent locked while handing over sealed block")
+	}
+	agent.Stop()
+
+	select {
+	case code := <-submitted:
+		if code != 0 {
+			t.Fatalf("block share rejected: %d", code)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("sealed block hand over not aborted by stop")
+	}
+	// Work sent to a stopped agent must not panic
+	work <- newStratumTestWork(2, big.NewInt(1000))
+}
@@ -25,6 +25,8 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/coinage"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
@@ -69,6 +71,7 @@ type Work struct {
 	family    *set.Set       // family set (used for checking uncle invalidity)
 	uncles    *set.Set       // uncle set
 	tcount    int            // tx count in cycle
+	gasPool   *core.GasPool  // available gas used to pack transactions
 
 	Block *types.Block // the new block
 
@@ -112,6 +115,9 @@ type worker struct {
 	coinbase common.Address
 	extra    []byte
 
+	builder Builder   // strategy filling the blocks with transactions
+	bundles []*Bundle // transaction bundles to include atomically
+
 	currentMu sync.Mutex
 	current   *Work
 
@@ -140,6 +146,7 @@ func newWorker(config *params.ChainConfig, engine consensus.Engine, coinbase com
 		proc:           eth.BlockChain().Validator(),
 		possibleUncles: make(map[common.Hash]*types.Block),
 		coinbase:       coinbase,
+		builder:        priceBuilder{},
 		agents:         make(map[Agent]struct{}),
 		unconfirmed:    newUnconfirmedBlocks(eth.BlockChain(), miningLogAtDepth),
 	}
@@ -168,12 +175,41 @@ func (self *worker) setExtra(extra []byte) {
 	self.extra = extra
 }
 
+func (self *worker) setBuilder(builder Builder) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.builder = builder
+}
+
+func (self *worker) currentBuilder() Builder {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return self.builder
+}
+
+// addBundle queues a bundle for inclusion, expiring it after the default lifetime
+// if it has no last block set.
+func (self *worker) addBundle(bundle *Bundle) error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if len(self.bundles) >= maxBundles {
+		return errTooManyBundles
+	}
+	if bundle.MaxBlock == 0 {
+		bundle.MaxBlock = self.chain.CurrentBlock().NumberU64() + bundleLifetime
+	}
+	self.bundles = append(self.bundles, bundle)
+	return nil
+}
+
 func (self *worker) pending() (*types.Block, *state.StateDB) {
 	self.currentMu.Lock()
 	defer self.currentMu.Unlock()
 
 	if atomic.LoadInt32(&self.mining) == 0 {
-		return types.NewBlock(
+		return ethash.NewBlock(
+			self.config,
 			self.current.header,
 			self.current.txs,
 			nil,
@@ -188,7 +224,8 @@ func (self *worker) pendingBlock() *types.Block {
 	defer self.currentMu.Unlock()
 
 	if atomic.LoadInt32(&self.mining) == 0 {
-		return types.NewBlock(
+		return ethash.NewBlock(
+			self.config,
 			self.current.header,
 			self.current.txs,
 			nil,
@@ -349,10 +386,21 @@ func (self *worker) push(work *Work) {
 
 // makeCurrent creates a new environment for the current cycle.
 func (self *worker) makeCurrent(parent *types.Block, header *types.Header) error {
-	state, err := self.chain.StateAt(parent.Root())
+	work, err := self.newWork(parent, header)
 	if err != nil {
 		return err
 	}
+	self.current = work
+	return nil
+}
+
+// newWork creates a new environment for assembling a block on top of the given
+// parent.
+func (self *worker) newWork(parent *types.Block, header *types.Header) (*Work, error) {
+	state, err := self.chain.StateAt(parent.Root())
+	if err != nil {
+		return nil, err
+	}
 	work := &Work{
 		config:    self.config,
 		signer:    types.NewEIP155Signer(self.config.ChainId),
@@ -360,6 +408,7 @@ func (self *worker) makeCurrent(parent *types.Block, header *types.Header) error
 		ancestors: set.New(),
 		family:    set.New(),
 		uncles:    set.New(),
+		gasPool:   new(core.GasPool).AddGas(header.GasLimit),
 		header:    header,
 		createdAt: time.Now(),
 	}
@@ -375,8 +424,7 @@ func (self *worker) makeCurrent(parent *types.Block, header *types.Header) error
 
 	// Keep track of transactions which return errors so they can be removed
 	work.tcount = 0
-	self.current = work
-	return nil
+	return work, nil
 }
 
 func (self *worker) commitNewWork() {
@@ -433,8 +481,8 @@ func (self *worker) commitNewWork() {
 		log.Error("Failed to fetch pending transactions", "err", err)
 		return
 	}
-	txs := types.NewTransactionsByPriceAndNonce(self.current.signer, pending)
-	work.commitTransactions(self.mux, txs, self.chain, self.coinbase)
+	self.bundles = pruneBundles(work, self.bundles)
+	self.builder.Build(work, self.mux, self.chain, self.coinbase, pending, self.bundles)
 
 	// compute uncles for the new block.
 	var (
@@ -465,12 +513,85 @@ func (self *worker) commitNewWork() {
 	}
 	// We only care about logging if we're actually mining.
 	if atomic.LoadInt32(&self.mining) == 1 {
-		log.Info("Hashing the next block...", "blockheight", work.Block.Number(), "transactions", work.tcount)
+		log.Info("Hashing the next block...", "blockheight", work.Block.Number(), "transactions", work.tcount, "effective", work.Block.Header().TxNumber)
 		self.unconfirmed.Shift(work.Block.NumberU64() - 1)
 	}
 	self.push(work)
 }
 
+// simulate assembles the block following the current head with the given
+// builder on a throwaway state, reporting its value to the etherbase without
+// sealing it.
+func (self *worker) simulate(builder Builder) (*Simulation, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	parent := self.chain.CurrentBlock()
+
+	tstamp := time.Now().Unix()
+	if parent.Time().Cmp(new(big.Int).SetInt64(tstamp)) >= 0 {
+		tstamp = parent.Time().Int64() + 1
+	}
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		Number:     new(big.Int).Add(parent.Number(), common.Big1),
+		GasLimit:   core.CalcGasLimit(parent),
+		GasUsed:    new(big.Int),
+		Extra:      self.extra,
+		Time:       big.NewInt(tstamp),
+		Coinbase:   self.coinbase,
+	}
+	if err := self.engine.Prepare(self.chain, header); err != nil {
+		return nil, err
+	}
+	work, err := self.newWork(parent, header)
+	if err != nil {
+		return nil, err
+	}
+	// The coin age is accrued on the parent state, as the sealer does
+	age := coinage.ExpectedAt(self.config, work.state.Copy(), header, parent.Header())
+
+	pending, err := self.eth.TxPool().Pending()
+	if err != nil {
+		return nil, err
+	}
+	// Build on copies of the bundles, so that failures of the dry run don't drop
+	// them from the queue
+	bundles := pruneBundles(work, self.bundles)
+	for i, bundle := range bundles {
+		cpy := *bundle
+		bundles[i] = &cpy
+	}
+	builder.Build(work, nil, self.chain, self.coinbase, pending, bundles)
+
+	coinageMul, txMul := ethash.SealMultipliers(age, header.TxNumber)
+	multiplier := new(big.Int).Mul(coinageMul, txMul)
+
+	return &Simulation{
+		Strategy:            builder.Name(),
+		Number:              header.Number.Uint64(),
+		Transactions:        len(work.txs),
+		TxNumber:            header.TxNumber,
+		GasUsed:             new(big.Int).Set(header.GasUsed),
+		Fees:                work.fees(),
+		CoinAge:             age,
+		CoinAgeMultiplier:   coinageMul,
+		TxNumberMultiplier:  txMul,
+		Multiplier:          multiplier,
+		Difficulty:          header.Difficulty,
+		EffectiveDifficulty: new(big.Int).Div(header.Difficulty, multiplier),
+	}, nil
+}
+
+// fees returns the transaction fees earned by the work so far.
+func (env *Work) fees() *big.Int {
+	fees := new(big.Int)
+	for i, tx := range env.txs {
+		fees.Add(fees, new(big.Int).Mul(env.receipts[i].GasUsed, tx.GasPrice()))
+	}
+	return fees
+}
+
 func (self *worker) commitUncle(work *Work, uncle *types.Header) error {
 	hash := uncle.Hash()
 	if work.uncles.Has(hash) {
@@ -486,11 +607,21 @@ func (self *worker) commitUncle(work *Work, uncle *types.Header) error {
 	return nil
 }
 
-func (env *Work) commitTransactions(mux *event.TypeMux, txs *types.TransactionsByPriceAndNonce, bc *core.BlockChain, coinbase common.Address) {
-	gp := new(core.GasPool).AddGas(env.header.GasLimit)
+// commitTransactions applies the transactions of the given set on top of the
+// environment until it runs out of transactions or gas. Pending logs and state
+// changes are announced on the mux unless it's nil.
+func (env *Work) commitTransactions(mux *event.TypeMux, txs txIterator, bc *core.BlockChain, coinbase common.Address) {
+	gp := env.gasPool
 
 	var coalescedLogs []*types.Log
 
+	// Only the effective transactions scale the PoW target, count them on top of
+	// the ones already committed (pending work is extended as transactions arrive)
+	counter := ethash.NewTxCounter(env.config, env.header)
+	for _, tx := range env.txs {
+		from, _ := types.Sender(env.signer, tx)
+		counter.Add(from, tx)
+	}
 	for {
 		// Retrieve the next transaction and abort if all done
 		tx := txs.Peek()
@@ -534,6 +665,7 @@ func (env *Work) commitTransactions(mux *event.TypeMux, txs *types.TransactionsB
 			// Everything ok, collect the logs and shift in the next transaction from the same account
 			coalescedLogs = append(coalescedLogs, logs...)
 			env.tcount++
+			counter.Add(from, tx)
 			txs.Shift()
 
 		default:
@@ -543,8 +675,9 @@ func (env *Work) commitTransactions(mux *event.TypeMux, txs *types.TransactionsB
 			txs.Shift()
 		}
 	}
+	env.header.TxNumber = counter.Count()
 
-	if len(coalescedLogs) > 0 || env.tcount > 0 {
+	if mux != nil && (len(coalescedLogs) > 0 || env.tcount > 0) {
 		// make a copy, the state caches the logs and these logs get "upgraded" from pending to mined
 		// logs by filling in the block hash when the block was mined by the local miner. This can
 		// cause a race condition if a log was "upgraded" before the PendingLogsEvent is processed.
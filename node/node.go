@@ -639,7 +639,41 @@ func (n *Node) OpenDatabase(name string, cache, handles int) (ethdb.Database, er
 	if n.config.DataDir == "" {
 		return ethdb.NewMemDatabase()
 	}
-	return ethdb.NewLDBDatabase(n.config.resolvePath(name), cache, handles)
+	return ethdb.OpenDatabase(n.config.DBEngine, n.config.resolvePath(name), cache, handles)
+}
+
+// OpenDatabaseWithFreezer opens an existing database with the given name (or
+// creates one if no previous can be found) from within the node's instance
+// directory, also attaching a chain freezer to it that moves immutable chain
+// segments into flat files at the freezer path (defaulting to "ancient" within
+// the database). If the node is ephemeral, a memory database is returned.
+func (n *Node) OpenDatabaseWithFreezer(name string, cache, handles int, freezer string, threshold uint64, compress bool) (ethdb.Database, error) {
+	if n.config.DataDir == "" {
+		return ethdb.NewMemDatabase()
+	}
+	return openDatabaseWithFreezer(n.config, name, cache, handles, freezer, threshold, compress)
+}
+
+// openDatabaseWithFreezer opens a persistent key-value database along with the
+// ancient store it's backed by.
+func openDatabaseWithFreezer(config *Config, name string, cache, handles int, freezer string, threshold uint64, compress bool) (ethdb.Database, error) {
+	root := config.resolvePath(name)
+	switch {
+	case freezer == "":
+		freezer = filepath.Join(root, "ancient")
+	case !filepath.IsAbs(freezer):
+		freezer = config.resolvePath(freezer)
+	}
+	kvdb, err := ethdb.OpenDatabase(config.DBEngine, root, cache, handles)
+	if err != nil {
+		return nil, err
+	}
+	db, err := ethdb.NewDatabaseWithFreezer(kvdb, freezer, threshold, compress)
+	if err != nil {
+		kvdb.Close()
+		return nil, err
+	}
+	return db, nil
 }
 
 // ResolvePath returns the absolute path of a resource in the instance directory.
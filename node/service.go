@@ -43,11 +43,19 @@ func (ctx *ServiceContext) OpenDatabase(name string, cache int, handles int) (et
 	if ctx.config.DataDir == "" {
 		return ethdb.NewMemDatabase()
 	}
-	db, err := ethdb.NewLDBDatabase(ctx.config.resolvePath(name), cache, handles)
-	if err != nil {
-		return nil, err
+	return ethdb.OpenDatabase(ctx.config.DBEngine, ctx.config.resolvePath(name), cache, handles)
+}
+
+// OpenDatabaseWithFreezer opens an existing database with the given name (or
+// creates one if no previous can be found) from within the node's data directory,
+// also attaching a chain freezer to it that moves immutable chain segments into
+// flat files at the freezer path (defaulting to "ancient" within the database).
+// If the node is an ephemeral one, a memory database is returned.
+func (ctx *ServiceContext) OpenDatabaseWithFreezer(name string, cache int, handles int, freezer string, threshold uint64, compress bool) (ethdb.Database, error) {
+	if ctx.config.DataDir == "" {
+		return ethdb.NewMemDatabase()
 	}
-	return db, nil
+	return openDatabaseWithFreezer(ctx.config, name, cache, handles, freezer, threshold, compress)
 }
 
 // ResolvePath resolves a user path into the data directory if that was relative
@@ -39,7 +39,7 @@ var (
 		EIP158Block:    big.NewInt(3),
 		ByzantiumBlock: big.NewInt(4),
 
-		Ethash: new(EthashConfig),
+		Ethash: MainnetEthashConfig,
 	}
 
 	// TestnetChainConfig contains the chain parameters to run a node on the Ropsten test network.
@@ -52,7 +52,7 @@ var (
 		EIP158Block:    big.NewInt(10),
 		ByzantiumBlock: big.NewInt(20),
 
-		Ethash: new(EthashConfig),
+		Ethash: MainnetEthashConfig,
 	}
 
 	// RinkebyChainConfig contains the chain parameters to run a node on the Rinkeby test network.
@@ -66,6 +66,26 @@ var (
 		ByzantiumBlock: big.NewInt(20),
 	}
 
+	// MainnetEthashConfig is the block reward schedule and effective transaction
+	// rule of the main network. It also provides the values of any field left
+	// unset in a genesis config.
+	MainnetEthashConfig = &EthashConfig{
+		RewardTiers: []RewardTier{
+			{Block: big.NewInt(40000), Reward: big.NewInt(1e+17)},
+			{Block: big.NewInt(100000), Reward: big.NewInt(1e+18)},
+			{Block: big.NewInt(200000), Reward: big.NewInt(2e+18)},
+		},
+		BlockReward:       big.NewInt(25e+17),
+		DecayPeriod:       big.NewInt(2 * 2 * 60 * 24 * 365), // Two years of 30 second blocks
+		DecayNumerator:    75,
+		DecayDenominator:  100,
+		MasternodeBalance: new(big.Int).Mul(AddedRewardForMN, big.NewInt(Ether)),
+		MasternodeBonus:   big.NewInt(5e+17),
+
+		EffectiveTxMinGasPrice: big.NewInt(Shannon),
+		EffectiveTxSenderCap:   4,
+	}
+
 	// AllProtocolChanges contains every protocol change (EIPs)
 	// introduced and accepted by the Ethereum core developers.
 	//
@@ -74,8 +94,8 @@ var (
 	// means that all fields must be set at all times. This forces
 	// anyone adding flags to the config to also have to set these
 	// fields.
-	AllProtocolChanges = &ChainConfig{big.NewInt(1337), big.NewInt(0),big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), new(EthashConfig)}
-	TestChainConfig    = &ChainConfig{big.NewInt(1), big.NewInt(0), big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), new(EthashConfig)}
+	AllProtocolChanges = &ChainConfig{big.NewInt(1337), big.NewInt(0),big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), new(EthashConfig)}
+	TestChainConfig    = &ChainConfig{big.NewInt(1), big.NewInt(0), big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), new(EthashConfig)}
 	TestRules          = TestChainConfig.Rules(new(big.Int))
 )
 
@@ -98,12 +118,105 @@ type ChainConfig struct {
 
 	ByzantiumBlock *big.Int `json:"byzantiumBlock,omitempty"` // Byzantium switch block (nil = no fork, 0 = alraedy on homestead)
 
+	CoinAgeBlock *big.Int `json:"coinAgeBlock,omitempty"` // Header coin age verification switch block (nil = no fork, 0 = already activated)
+
+	ExactRewardBlock *big.Int `json:"exactRewardBlock,omitempty"` // Exact integer reward decay switch block (nil = no fork, 0 = already activated)
+
+	RetargetBlock *big.Int `json:"retargetBlock,omitempty"` // Effective difficulty retarget switch block (nil = no fork, 0 = already activated)
+
+	CoinAgeFixBlock *big.Int `json:"coinAgeFixBlock,omitempty"` // Coinbase coin age accounting fix switch block (nil = no fork, 0 = already activated)
+
+	EffectiveTxBlock *big.Int `json:"effectiveTxBlock,omitempty"` // Effective transaction count target scaling switch block (nil = no fork, 0 = already activated)
+
 	// Various consensus engines
 	Ethash *EthashConfig `json:"ethash,omitempty"`
 }
 
 // EthashConfig is the consensus engine configs for proof-of-work based sealing.
-type EthashConfig struct{}
+//
+// The block reward is the one of the first tier the block number falls into.
+// Past the last tier it's the base block reward, plus the masternode bonus if
+// the coinbase holds at least the masternode balance, scaled down by the decay
+// ratio once for every full decay period since genesis.
+//
+// After the EffectiveTx fork, the transactions the PoW target is scaled by are
+// the ones not sent by the coinbase paying at least the gas price floor, up to
+// a cap per sender. Fields left unset take their values from MainnetEthashConfig.
+type EthashConfig struct {
+	RewardTiers       []RewardTier `json:"rewardTiers,omitempty"`       // Fixed rewards of the initial block ranges, in ascending order
+	BlockReward       *big.Int     `json:"blockReward,omitempty"`       // Reward past the last tier, before any decay
+	DecayPeriod       *big.Int     `json:"decayPeriod,omitempty"`       // Number of blocks between two reward reductions
+	DecayNumerator    uint64       `json:"decayNumerator,omitempty"`    // Numerator of the ratio applied every decay period
+	DecayDenominator  uint64       `json:"decayDenominator,omitempty"`  // Denominator of the ratio applied every decay period
+	MasternodeBalance *big.Int     `json:"masternodeBalance,omitempty"` // Coinbase balance qualifying for the masternode bonus
+	MasternodeBonus   *big.Int     `json:"masternodeBonus,omitempty"`   // Reward added for masternodes past the last tier
+
+	EffectiveTxMinGasPrice *big.Int `json:"effectiveTxMinGasPrice,omitempty"` // Gas price floor of the transactions scaling the PoW target
+	EffectiveTxSenderCap   uint64   `json:"effectiveTxSenderCap,omitempty"`   // Number of transactions per sender scaling the PoW target
+}
+
+// RewardTier is a fixed block reward paid up to and including a block number.
+type RewardTier struct {
+	Block  *big.Int `json:"block"`
+	Reward *big.Int `json:"reward"`
+}
+
+// RewardSchedule returns the reward schedule of the config, with any fields
+// left unset filled in from the main network schedule.
+func (c *EthashConfig) RewardSchedule() *EthashConfig {
+	if c == nil {
+		return MainnetEthashConfig
+	}
+	schedule := *c
+	if schedule.RewardTiers == nil {
+		schedule.RewardTiers = MainnetEthashConfig.RewardTiers
+	}
+	if schedule.BlockReward == nil {
+		schedule.BlockReward = MainnetEthashConfig.BlockReward
+	}
+	if schedule.DecayPeriod == nil || schedule.DecayPeriod.Sign() <= 0 {
+		schedule.DecayPeriod = MainnetEthashConfig.DecayPeriod
+	}
+	if schedule.DecayNumerator == 0 || schedule.DecayDenominator == 0 {
+		schedule.DecayNumerator, schedule.DecayDenominator = MainnetEthashConfig.DecayNumerator, MainnetEthashConfig.DecayDenominator
+	}
+	if schedule.MasternodeBalance == nil {
+		schedule.MasternodeBalance = MainnetEthashConfig.MasternodeBalance
+	}
+	if schedule.MasternodeBonus == nil {
+		schedule.MasternodeBonus = MainnetEthashConfig.MasternodeBonus
+	}
+	return &schedule
+}
+
+// CheckRewardSchedule returns an error if the reward schedule of the config
+// doesn't decay the block reward.
+func (c *EthashConfig) CheckRewardSchedule() error {
+	if c == nil || (c.DecayNumerator == 0 && c.DecayDenominator == 0) {
+		return nil
+	}
+	if c.DecayNumerator == 0 || c.DecayDenominator == 0 || c.DecayNumerator >= c.DecayDenominator {
+		return fmt.Errorf("invalid reward decay ratio %d/%d, must be between 0 and 1", c.DecayNumerator, c.DecayDenominator)
+	}
+	return nil
+}
+
+// EffectiveTxRule returns the gas price floor and the per sender cap of the
+// transactions scaling the PoW target after the EffectiveTx fork, with any left
+// unset taken from the main network config.
+func (c *EthashConfig) EffectiveTxRule() (*big.Int, uint64) {
+	if c == nil {
+		c = MainnetEthashConfig
+	}
+	floor, cap := c.EffectiveTxMinGasPrice, c.EffectiveTxSenderCap
+	if floor == nil {
+		floor = MainnetEthashConfig.EffectiveTxMinGasPrice
+	}
+	if cap == 0 {
+		cap = MainnetEthashConfig.EffectiveTxSenderCap
+	}
+	return floor, cap
+}
 
 // String implements the stringer interface, returning the consensus engine details.
 func (c *EthashConfig) String() string {
@@ -136,6 +249,36 @@ func (c *ChainConfig) IsByzantium(num *big.Int) bool {
 	return isForked(c.ByzantiumBlock, num)
 }
 
+// IsCoinAge returns whether num is either equal to the coin age verification
+// fork block or greater.
+func (c *ChainConfig) IsCoinAge(num *big.Int) bool {
+	return isForked(c.CoinAgeBlock, num)
+}
+
+// IsExactReward returns whether num is either equal to the exact integer reward
+// decay fork block or greater.
+func (c *ChainConfig) IsExactReward(num *big.Int) bool {
+	return isForked(c.ExactRewardBlock, num)
+}
+
+// IsRetarget returns whether num is either equal to the effective difficulty
+// retarget fork block or greater.
+func (c *ChainConfig) IsRetarget(num *big.Int) bool {
+	return isForked(c.RetargetBlock, num)
+}
+
+// IsCoinAgeFix returns whether num is either equal to the coinbase coin age
+// accounting fix block or greater.
+func (c *ChainConfig) IsCoinAgeFix(num *big.Int) bool {
+	return isForked(c.CoinAgeFixBlock, num)
+}
+
+// IsEffectiveTx returns whether num is either equal to the effective transaction
+// count fork block or greater.
+func (c *ChainConfig) IsEffectiveTx(num *big.Int) bool {
+	return isForked(c.EffectiveTxBlock, num)
+}
+
 // GasTable returns the gas table corresponding to the current phase (homestead or homestead reprice).
 //
 // The returned GasTable's fields shouldn't, under any circumstances, be changed.
@@ -190,6 +333,60 @@ func (c *ChainConfig) checkCompatible(newcfg *ChainConfig, head *big.Int) *Confi
 	if isForkIncompatible(c.ByzantiumBlock, newcfg.ByzantiumBlock, head) {
 		return newCompatError("Byzantium fork block", c.ByzantiumBlock, newcfg.ByzantiumBlock)
 	}
+	if isForkIncompatible(c.CoinAgeBlock, newcfg.CoinAgeBlock, head) {
+		return newCompatError("CoinAge fork block", c.CoinAgeBlock, newcfg.CoinAgeBlock)
+	}
+	if isForkIncompatible(c.ExactRewardBlock, newcfg.ExactRewardBlock, head) {
+		return newCompatError("ExactReward fork block", c.ExactRewardBlock, newcfg.ExactRewardBlock)
+	}
+	if isForkIncompatible(c.RetargetBlock, newcfg.RetargetBlock, head) {
+		return newCompatError("Retarget fork block", c.RetargetBlock, newcfg.RetargetBlock)
+	}
+	if isForkIncompatible(c.CoinAgeFixBlock, newcfg.CoinAgeFixBlock, head) {
+		return newCompatError("CoinAgeFix fork block", c.CoinAgeFixBlock, newcfg.CoinAgeFixBlock)
+	}
+	if isForkIncompatible(c.EffectiveTxBlock, newcfg.EffectiveTxBlock, head) {
+		return newCompatError("EffectiveTx fork block", c.EffectiveTxBlock, newcfg.EffectiveTxBlock)
+	}
+	if fork := rewardScheduleFork(c.Ethash, newcfg.Ethash); isForked(fork, head) {
+		return newCompatError("Ethash reward schedule", fork, fork)
+	}
+	return nil
+}
+
+// rewardScheduleFork returns the first block the rewards of two ethash configs
+// may differ at, or nil if their reward schedules are the same.
+func rewardScheduleFork(c1, c2 *EthashConfig) *big.Int {
+	s1, s2 := c1.RewardSchedule(), c2.RewardSchedule()
+
+	// The tiers are the same up to the first mismatch, which pays differently
+	// from the block after the previous tier on
+	start := new(big.Int)
+	for i := 0; i < len(s1.RewardTiers) || i < len(s2.RewardTiers); i++ {
+		if i >= len(s1.RewardTiers) || i >= len(s2.RewardTiers) {
+			return start
+		}
+		t1, t2 := s1.RewardTiers[i], s2.RewardTiers[i]
+		if !configNumEqual(t1.Block, t2.Block) || !configNumEqual(t1.Reward, t2.Reward) {
+			return start
+		}
+		start = new(big.Int).Add(t1.Block, common.Big1)
+	}
+	// Past the last tier the base reward and the masternode bonus apply at once,
+	// the decay only from the first full period on
+	if !configNumEqual(s1.BlockReward, s2.BlockReward) || !configNumEqual(s1.MasternodeBalance, s2.MasternodeBalance) || !configNumEqual(s1.MasternodeBonus, s2.MasternodeBonus) {
+		return start
+	}
+	if !configNumEqual(s1.DecayPeriod, s2.DecayPeriod) || s1.DecayNumerator != s2.DecayNumerator || s1.DecayDenominator != s2.DecayDenominator {
+		decay := s1.DecayPeriod
+		if s2.DecayPeriod.Cmp(decay) < 0 {
+			decay = s2.DecayPeriod
+		}
+		if decay.Cmp(start) > 0 {
+			return new(big.Int).Set(decay)
+		}
+		return start
+	}
 	return nil
 }
 
@@ -70,6 +70,112 @@ func TestCheckCompatible(t *testing.T) {
 				RewindTo:     9,
 			},
 		},
+		{
+			stored: &ChainConfig{CoinAgeBlock: big.NewInt(10)},
+			new:    &ChainConfig{CoinAgeBlock: big.NewInt(20)},
+			head:   15,
+			wantErr: &ConfigCompatError{
+				What:         "CoinAge fork block",
+				StoredConfig: big.NewInt(10),
+				NewConfig:    big.NewInt(20),
+				RewindTo:     9,
+			},
+		},
+		{
+			stored: &ChainConfig{ExactRewardBlock: nil},
+			new:    &ChainConfig{ExactRewardBlock: big.NewInt(20)},
+			head:   25,
+			wantErr: &ConfigCompatError{
+				What:         "ExactReward fork block",
+				StoredConfig: nil,
+				NewConfig:    big.NewInt(20),
+				RewindTo:     19,
+			},
+		},
+		{
+			stored: &ChainConfig{RetargetBlock: big.NewInt(30)},
+			new:    &ChainConfig{RetargetBlock: big.NewInt(40)},
+			head:   35,
+			wantErr: &ConfigCompatError{
+				What:         "Retarget fork block",
+				StoredConfig: big.NewInt(30),
+				NewConfig:    big.NewInt(40),
+				RewindTo:     29,
+			},
+		},
+		{
+			stored: &ChainConfig{CoinAgeFixBlock: big.NewInt(10)},
+			new:    &ChainConfig{CoinAgeFixBlock: nil},
+			head:   15,
+			wantErr: &ConfigCompatError{
+				What:         "CoinAgeFix fork block",
+				StoredConfig: big.NewInt(10),
+				NewConfig:    nil,
+				RewindTo:     9,
+			},
+		},
+		{
+			stored: &ChainConfig{EffectiveTxBlock: big.NewInt(50)},
+			new:    &ChainConfig{EffectiveTxBlock: big.NewInt(60)},
+			head:   55,
+			wantErr: &ConfigCompatError{
+				What:         "EffectiveTx fork block",
+				StoredConfig: big.NewInt(50),
+				NewConfig:    big.NewInt(60),
+				RewindTo:     49,
+			},
+		},
+		{
+			stored:  &ChainConfig{},
+			new:     &ChainConfig{Ethash: MainnetEthashConfig},
+			head:    1000000,
+			wantErr: nil,
+		},
+		{
+			stored:  &ChainConfig{Ethash: MainnetEthashConfig},
+			new:     &ChainConfig{Ethash: &EthashConfig{RewardTiers: []RewardTier{{Block: big.NewInt(40000), Reward: big.NewInt(1e+17)}, {Block: big.NewInt(100000), Reward: big.NewInt(2e+18)}}}},
+			head:    40000,
+			wantErr: nil,
+		},
+		{
+			stored: &ChainConfig{Ethash: MainnetEthashConfig},
+			new:    &ChainConfig{Ethash: &EthashConfig{RewardTiers: []RewardTier{{Block: big.NewInt(40000), Reward: big.NewInt(1e+17)}, {Block: big.NewInt(100000), Reward: big.NewInt(2e+18)}}}},
+			head:   40001,
+			wantErr: &ConfigCompatError{
+				What:         "Ethash reward schedule",
+				StoredConfig: big.NewInt(40001),
+				NewConfig:    big.NewInt(40001),
+				RewindTo:     40000,
+			},
+		},
+		{
+			stored: &ChainConfig{Ethash: MainnetEthashConfig},
+			new:    &ChainConfig{Ethash: &EthashConfig{MasternodeBonus: big.NewInt(1e+18)}},
+			head:   300000,
+			wantErr: &ConfigCompatError{
+				What:         "Ethash reward schedule",
+				StoredConfig: big.NewInt(200001),
+				NewConfig:    big.NewInt(200001),
+				RewindTo:     200000,
+			},
+		},
+		{
+			stored:  &ChainConfig{Ethash: MainnetEthashConfig},
+			new:     &ChainConfig{Ethash: &EthashConfig{DecayNumerator: 1, DecayDenominator: 2}},
+			head:    300000,
+			wantErr: nil,
+		},
+		{
+			stored: &ChainConfig{Ethash: MainnetEthashConfig},
+			new:    &ChainConfig{Ethash: &EthashConfig{DecayNumerator: 1, DecayDenominator: 2}},
+			head:   3000000,
+			wantErr: &ConfigCompatError{
+				What:         "Ethash reward schedule",
+				StoredConfig: big.NewInt(2 * 2 * 60 * 24 * 365),
+				NewConfig:    big.NewInt(2 * 2 * 60 * 24 * 365),
+				RewindTo:     2*2*60*24*365 - 1,
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -79,3 +185,24 @@ func TestCheckCompatible(t *testing.T) {
 		}
 	}
 }
+
+func TestCheckRewardSchedule(t *testing.T) {
+	tests := []struct {
+		config *EthashConfig
+		valid  bool
+	}{
+		{config: nil, valid: true},
+		{config: new(EthashConfig), valid: true},
+		{config: MainnetEthashConfig, valid: true},
+		{config: &EthashConfig{DecayNumerator: 1, DecayDenominator: 2}, valid: true},
+		{config: &EthashConfig{DecayNumerator: 1}, valid: false},
+		{config: &EthashConfig{DecayDenominator: 2}, valid: false},
+		{config: &EthashConfig{DecayNumerator: 2, DecayDenominator: 2}, valid: false},
+		{config: &EthashConfig{DecayNumerator: 3, DecayDenominator: 2}, valid: false},
+	}
+	for i, test := range tests {
+		if err := test.config.CheckRewardSchedule(); (err == nil) != test.valid {
+			t.Errorf("test %d: error mismatch: have %v, want valid %v", i, err, test.valid)
+		}
+	}
+}
@@ -0,0 +1,345 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// LeafCallback is a callback type invoked when a trie commit stores a node with
+// a leaf value, passing the value and the hash of the node containing it. It's
+// used by state commits to reference the storage tries and code of accounts.
+type LeafCallback func(leaf []byte, parent common.Hash) error
+
+// NodeCache is an intermediate write layer between the trie data structures and
+// the disk database. Trie nodes written to it are kept in memory along with the
+// references between them, so nodes which become unreachable can be garbage
+// collected before ever reaching the disk. Nodes are only written to disk when
+// explicitly committed.
+//
+// Any write that isn't a 32 byte hash key, such as a secure trie preimage, is
+// cached as is until the next commit.
+type NodeCache struct {
+	diskdb ethdb.Database // Persistent storage for matured trie nodes
+
+	nodes     map[common.Hash]*cachedNode // Data and references relationships of trie nodes
+	preimages map[string][]byte           // Other writes, flushed on every commit
+
+	gctime  time.Duration      // Time spent on garbage collection since last commit
+	gcnodes uint64             // Nodes garbage collected since last commit
+	gcsize  common.StorageSize // Data storage garbage collected since last commit
+
+	nodesSize     common.StorageSize // Storage size of the nodes cache
+	preimagesSize common.StorageSize // Storage size of the other writes
+
+	lock sync.RWMutex
+}
+
+// cachedNode is a trie node blob with the references to and from it.
+type cachedNode struct {
+	blob     []byte              // Encoded node, or contract code
+	parents  int                 // Number of live nodes referencing this one
+	children map[common.Hash]int // Children referenced by this node
+}
+
+// cachedNodeSize is the approximate memory overhead of a cached node on top of
+// its blob, used to estimate the size of the cache.
+const cachedNodeSize = common.StorageSize(common.HashLength + 64)
+
+// NewNodeCache creates a new trie node cache to store ephemeral trie content
+// before it's written out to disk or garbage collected.
+func NewNodeCache(diskdb ethdb.Database) *NodeCache {
+	return &NodeCache{
+		diskdb: diskdb,
+		nodes: map[common.Hash]*cachedNode{
+			{}: {children: make(map[common.Hash]int)},
+		},
+		preimages: make(map[string][]byte),
+	}
+}
+
+// DiskDB retrieves the persistent storage backing the node cache.
+func (c *NodeCache) DiskDB() ethdb.Database {
+	return c.diskdb
+}
+
+// Put implements DatabaseWriter, caching a trie node or any other write in
+// memory. Unlike nodes stored by a trie commit, nodes written via Put don't
+// reference their children.
+func (c *NodeCache) Put(key, value []byte) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if len(key) == common.HashLength {
+		c.insert(common.BytesToHash(key), value, nil)
+		return nil
+	}
+	if _, ok := c.preimages[string(key)]; !ok {
+		c.preimages[string(key)] = common.CopyBytes(value)
+		c.preimagesSize += common.StorageSize(len(key) + len(value))
+	}
+	return nil
+}
+
+// insert caches a node along with the references to its cached children. The
+// blob is copied as the hasher reuses it. This method assumes the lock is held.
+func (c *NodeCache) insert(hash common.Hash, blob []byte, children []common.Hash) {
+	if _, ok := c.nodes[hash]; ok {
+		return
+	}
+	c.nodes[hash] = &cachedNode{
+		blob:     common.CopyBytes(blob),
+		children: make(map[common.Hash]int),
+	}
+	for _, child := range children {
+		c.reference(child, hash)
+	}
+	c.nodesSize += cachedNodeSize + common.StorageSize(len(blob))
+}
+
+// Get implements DatabaseReader, retrieving a cached node or other write, or
+// falling back to the disk database.
+func (c *NodeCache) Get(key []byte) ([]byte, error) {
+	c.lock.RLock()
+	if len(key) == common.HashLength {
+		if node := c.nodes[common.BytesToHash(key)]; node != nil && node.blob != nil {
+			c.lock.RUnlock()
+			return node.blob, nil
+		}
+	} else if value, ok := c.preimages[string(key)]; ok {
+		c.lock.RUnlock()
+		return value, nil
+	}
+	c.lock.RUnlock()
+
+	return c.diskdb.Get(key)
+}
+
+// Has implements DatabaseReader, checking the cache and the disk database.
+func (c *NodeCache) Has(key []byte) (bool, error) {
+	if value, err := c.Get(key); err == nil && value != nil {
+		return true, nil
+	}
+	return false, nil
+}
+
+// Nodes retrieves the hashes of all the nodes cached in memory.
+// This method is extremely expensive and should only be used to validate internal
+// states in test code.
+func (c *NodeCache) Nodes() []common.Hash {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	var hashes = make([]common.Hash, 0, len(c.nodes))
+	for hash := range c.nodes {
+		if hash != (common.Hash{}) { // Special case for "root" references/nodes
+			hashes = append(hashes, hash)
+		}
+	}
+	return hashes
+}
+
+// Reference adds a new reference from a parent node to a child node. A zero
+// parent hash references the child from outside the trie, e.g. to keep the state
+// of a block alive. Children already on disk are not tracked.
+func (c *NodeCache) Reference(child common.Hash, parent common.Hash) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.reference(child, parent)
+}
+
+// reference is the private locked version of Reference.
+func (c *NodeCache) reference(child common.Hash, parent common.Hash) {
+	// If the node does not exist, it's a node pulled from disk, skip
+	node, ok := c.nodes[child]
+	if !ok {
+		return
+	}
+	// If the reference already exists, only duplicate for roots
+	if _, ok = c.nodes[parent].children[child]; ok && parent != (common.Hash{}) {
+		return
+	}
+	node.parents++
+	c.nodes[parent].children[child]++
+}
+
+// Dereference removes an outside reference to a root node, deleting it along
+// with all of its children which are not referenced from anywhere else.
+func (c *NodeCache) Dereference(root common.Hash) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	nodes, storage, start := len(c.nodes), c.nodesSize, time.Now()
+	c.dereference(root, common.Hash{})
+
+	c.gcnodes += uint64(nodes - len(c.nodes))
+	c.gcsize += storage - c.nodesSize
+	c.gctime += time.Since(start)
+
+	log.Debug("Dereferenced trie from node cache", "nodes", nodes-len(c.nodes), "size", storage-c.nodesSize, "time", time.Since(start),
+		"gcnodes", c.gcnodes, "gcsize", c.gcsize, "gctime", c.gctime, "livenodes", len(c.nodes), "livesize", c.nodesSize)
+}
+
+// dereference is the private locked version of Dereference.
+func (c *NodeCache) dereference(child common.Hash, parent common.Hash) {
+	// Drop the reference from the parent to the child
+	node := c.nodes[parent]
+	if node.children != nil && node.children[child] > 0 {
+		node.children[child]--
+		if node.children[child] == 0 {
+			delete(node.children, child)
+		}
+	}
+	// If the child does not exist, it's a previously committed node
+	node, ok := c.nodes[child]
+	if !ok {
+		return
+	}
+	if node.parents > 0 {
+		node.parents--
+	}
+	if node.parents == 0 {
+		for hash := range node.children {
+			c.dereference(hash, child)
+		}
+		delete(c.nodes, child)
+		c.nodesSize -= cachedNodeSize + common.StorageSize(len(node.blob))
+	}
+}
+
+// Commit iterates over all the children of a particular node, writes them out
+// to disk and removes them from the cache, along with all other cached writes.
+// The outside references to the node are retained. As a side effect, all
+// pre-images accumulated up to this point are also written.
+func (c *NodeCache) Commit(node common.Hash, report bool) error {
+	// Create a database batch to flush persistent data out. It is important that
+	// outside code doesn't see an inconsistent state (referenced data removed from
+	// memory cache during commit but not yet in persistent storage). This is ensured
+	// by only uncaching existing data when the database write finalizes.
+	c.lock.RLock()
+
+	start := time.Now()
+	batch := c.diskdb.NewBatch()
+
+	for key, value := range c.preimages {
+		if err := batch.Put([]byte(key), value); err != nil {
+			log.Error("Failed to commit preimage from trie node cache", "err", err)
+			c.lock.RUnlock()
+			return err
+		}
+		if batch.ValueSize() > ethdb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				c.lock.RUnlock()
+				return err
+			}
+			batch = c.diskdb.NewBatch()
+		}
+	}
+	// Move the trie itself into the batch, flushing if enough data is accumulated
+	nodes, storage := len(c.nodes), c.nodesSize
+	if err := c.commit(node, &batch); err != nil {
+		log.Error("Failed to commit trie from trie node cache", "err", err)
+		c.lock.RUnlock()
+		return err
+	}
+	// Write batch ready, unlock for readers during persistence
+	if err := batch.Write(); err != nil {
+		log.Error("Failed to write trie to disk", "err", err)
+		c.lock.RUnlock()
+		return err
+	}
+	c.lock.RUnlock()
+
+	// Write successful, clear out the flushed data
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.preimages = make(map[string][]byte)
+	c.preimagesSize = 0
+
+	c.uncache(node)
+
+	logger := log.Info
+	if !report {
+		logger = log.Debug
+	}
+	logger("Persisted trie from node cache", "nodes", nodes-len(c.nodes), "size", storage-c.nodesSize, "time", time.Since(start),
+		"gcnodes", c.gcnodes, "gcsize", c.gcsize, "gctime", c.gctime, "livenodes", len(c.nodes), "livesize", c.nodesSize)
+
+	// Reset the garbage collection statistics
+	c.gcnodes, c.gcsize, c.gctime = 0, 0, 0
+
+	return nil
+}
+
+// commit is the private locked version of Commit.
+func (c *NodeCache) commit(hash common.Hash, batch *ethdb.Batch) error {
+	// If the node does not exist, it's a previously committed node
+	node, ok := c.nodes[hash]
+	if !ok {
+		return nil
+	}
+	for child := range node.children {
+		if err := c.commit(child, batch); err != nil {
+			return err
+		}
+	}
+	if err := (*batch).Put(hash[:], node.blob); err != nil {
+		return err
+	}
+	// If we've reached an optimal batch size, commit and start over
+	if (*batch).ValueSize() >= ethdb.IdealBatchSize {
+		if err := (*batch).Write(); err != nil {
+			return err
+		}
+		*batch = c.diskdb.NewBatch()
+	}
+	return nil
+}
+
+// uncache is the post-processing step of a commit operation where the already
+// persisted trie is removed from the cache. The reason behind the two-phase
+// commit is to ensure consistent data availability while moving from memory
+// to disk.
+func (c *NodeCache) uncache(hash common.Hash) {
+	// If the node does not exist, we're done on this path
+	node, ok := c.nodes[hash]
+	if !ok {
+		return
+	}
+	// Otherwise uncache the node's subtries and remove the node itself too
+	for child := range node.children {
+		c.uncache(child)
+	}
+	delete(c.nodes, hash)
+	c.nodesSize -= cachedNodeSize + common.StorageSize(len(node.blob))
+}
+
+// Size returns the current storage size of the memory cache in front of the
+// persistent database layer.
+func (c *NodeCache) Size() common.StorageSize {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.nodesSize + c.preimagesSize
+}
@@ -0,0 +1,198 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// makeCachedTries commits a sequence of tries into a node cache, every one
+// updating a few keys of the previous one, and references their roots.
+func makeCachedTries(cache *NodeCache, count int) []common.Hash {
+	trie, _ := New(common.Hash{}, cache)
+
+	roots := make([]common.Hash, 0, count)
+	for i := 0; i < count; i++ {
+		for j := 0; j < 64; j++ {
+			key := common.LeftPadBytes([]byte{byte(j)}, 32)
+			trie.Update(key, []byte(fmt.Sprintf("value %d of trie %d, long enough to be hashed", j, i)))
+		}
+		trie.Update([]byte(fmt.Sprintf("trie %d", i)), []byte("unique"))
+
+		root, err := trie.CommitTo(cache)
+		if err != nil {
+			panic(err)
+		}
+		cache.Reference(root, common.Hash{})
+		roots = append(roots, root)
+	}
+	return roots
+}
+
+// checkCachedTrie checks that a trie exists and all of its nodes are present.
+func checkCachedTrie(db Database, root common.Hash) error {
+	if _, err := New(root, db); err != nil {
+		return err
+	}
+	return checkTrieConsistency(db, root)
+}
+
+// Tests that committing tries into a node cache doesn't touch the disk.
+func TestNodeCacheCommitToMemory(t *testing.T) {
+	diskdb, _ := ethdb.NewMemDatabase()
+	cache := NewNodeCache(diskdb)
+
+	roots := makeCachedTries(cache, 4)
+	if len(diskdb.Keys()) != 0 {
+		t.Fatalf("disk database written to: have %d entries, want 0", len(diskdb.Keys()))
+	}
+	for i, root := range roots {
+		if _, err := New(root, cache); err != nil {
+			t.Errorf("trie %d: failed to open from cache: %v", i, err)
+		}
+	}
+}
+
+// Tests that dereferencing a root garbage collects the nodes only it references,
+// leaving the tries of the other roots intact.
+func TestNodeCacheDereference(t *testing.T) {
+	diskdb, _ := ethdb.NewMemDatabase()
+	cache := NewNodeCache(diskdb)
+
+	roots := makeCachedTries(cache, 4)
+	before := len(cache.Nodes())
+
+	cache.Dereference(roots[0])
+	if after := len(cache.Nodes()); after >= before {
+		t.Fatalf("no nodes garbage collected: have %d, had %d", after, before)
+	}
+	if _, err := cache.Get(roots[0][:]); err == nil {
+		t.Errorf("dereferenced root still cached")
+	}
+	for i, root := range roots[1:] {
+		if err := checkCachedTrie(cache, root); err != nil {
+			t.Errorf("trie %d: inconsistent after dereference: %v", i+1, err)
+		}
+	}
+	// Dereferencing everything should leave nothing behind
+	for _, root := range roots[1:] {
+		cache.Dereference(root)
+	}
+	if nodes := len(cache.Nodes()); nodes != 0 {
+		t.Errorf("dangling nodes: have %d, want 0", nodes)
+	}
+	if size := cache.Size(); size != 0 {
+		t.Errorf("dangling size: have %v, want 0", size)
+	}
+}
+
+// Tests that roots referenced multiple times are only garbage collected once
+// all references are dropped.
+func TestNodeCacheDuplicateReference(t *testing.T) {
+	diskdb, _ := ethdb.NewMemDatabase()
+	cache := NewNodeCache(diskdb)
+
+	root := makeCachedTries(cache, 1)[0]
+	cache.Reference(root, common.Hash{})
+
+	cache.Dereference(root)
+	if err := checkCachedTrie(cache, root); err != nil {
+		t.Fatalf("trie inconsistent after first dereference: %v", err)
+	}
+	cache.Dereference(root)
+	if nodes := len(cache.Nodes()); nodes != 0 {
+		t.Errorf("dangling nodes: have %d, want 0", nodes)
+	}
+}
+
+// Tests that committing a root persists its whole trie and uncaches it, while
+// the nodes of other roots stay in memory and remain accessible.
+func TestNodeCacheCommit(t *testing.T) {
+	diskdb, _ := ethdb.NewMemDatabase()
+	cache := NewNodeCache(diskdb)
+
+	roots := makeCachedTries(cache, 4)
+	if err := cache.Commit(roots[1], false); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+	if err := checkCachedTrie(diskdb, roots[1]); err != nil {
+		t.Fatalf("committed trie inconsistent on disk: %v", err)
+	}
+	for _, hash := range cache.Nodes() {
+		if blob, _ := diskdb.Get(hash[:]); blob != nil {
+			t.Errorf("committed node %x still cached", hash)
+		}
+	}
+	for i, root := range roots {
+		if err := checkCachedTrie(cache, root); err != nil {
+			t.Errorf("trie %d: inconsistent after commit: %v", i, err)
+		}
+	}
+	// Garbage collecting everything should leave the committed trie on disk
+	for _, root := range roots {
+		cache.Dereference(root)
+	}
+	if err := checkCachedTrie(diskdb, roots[1]); err != nil {
+		t.Errorf("committed trie inconsistent after garbage collection: %v", err)
+	}
+}
+
+// Tests that leaf callbacks are invoked for every stored leaf with the hash of
+// its parent node, and that the parent references whatever is referenced from
+// the callback.
+func TestNodeCacheLeafReference(t *testing.T) {
+	diskdb, _ := ethdb.NewMemDatabase()
+	cache := NewNodeCache(diskdb)
+
+	// Store a blob the leaves of a trie point to
+	blob := bytes.Repeat([]byte{0xff}, 64)
+	blobHash := crypto.Keccak256Hash(blob)
+	cache.Put(blobHash[:], blob)
+
+	trie, _ := New(common.Hash{}, cache)
+	for i := 0; i < 16; i++ {
+		trie.Update([]byte{byte(i), byte(i)}, blobHash[:])
+	}
+	leaves := 0
+	root, err := trie.CommitToWithCallback(cache, func(leaf []byte, parent common.Hash) error {
+		if !bytes.Equal(leaf, blobHash[:]) {
+			t.Errorf("unexpected leaf %x", leaf)
+		}
+		leaves++
+		cache.Reference(blobHash, parent)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+	if leaves != 16 {
+		t.Errorf("leaf callbacks mismatch: have %d, want 16", leaves)
+	}
+	cache.Reference(root, common.Hash{})
+
+	// The blob lives as long as the trie referencing it
+	cache.Commit(root, false)
+	if have, _ := diskdb.Get(blobHash[:]); !bytes.Equal(have, blob) {
+		t.Errorf("referenced blob not committed along with the trie")
+	}
+}
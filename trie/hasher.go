@@ -30,6 +30,7 @@ type hasher struct {
 	tmp                  *bytes.Buffer
 	sha                  hash.Hash
 	cachegen, cachelimit uint16
+	onleaf               LeafCallback
 }
 
 // hashers live in a global pool.
@@ -39,9 +40,9 @@ var hasherPool = sync.Pool{
 	},
 }
 
-func newHasher(cachegen, cachelimit uint16) *hasher {
+func newHasher(cachegen, cachelimit uint16, onleaf LeafCallback) *hasher {
 	h := hasherPool.Get().(*hasher)
-	h.cachegen, h.cachelimit = cachegen, cachelimit
+	h.cachegen, h.cachelimit, h.onleaf = cachegen, cachelimit, onleaf
 	return h
 }
 
@@ -166,8 +167,63 @@ func (h *hasher) store(n node, db DatabaseWriter, force bool) (node, error) {
 		h.sha.Write(h.tmp.Bytes())
 		hash = hashNode(h.sha.Sum(nil))
 	}
-	if db != nil {
-		return hash, db.Put(hash, h.tmp.Bytes())
+	if db == nil {
+		return hash, nil
+	}
+	// Node caches track the references of the node to its children, and let
+	// the owner of the trie reference whatever its leaves point to
+	if cache, ok := db.(*NodeCache); ok {
+		cache.lock.Lock()
+		cache.insert(common.BytesToHash(hash), h.tmp.Bytes(), childHashes(n))
+		cache.lock.Unlock()
+	} else if err := db.Put(hash, h.tmp.Bytes()); err != nil {
+		return hash, err
+	}
+	if h.onleaf != nil {
+		for _, leaf := range childValues(n) {
+			if err := h.onleaf(leaf, common.BytesToHash(hash)); err != nil {
+				return hash, err
+			}
+		}
 	}
 	return hash, nil
 }
+
+// childHashes returns the hashes of the children a collapsed node references,
+// including the ones of nodes embedded into it.
+func childHashes(n node) []common.Hash {
+	var hashes []common.Hash
+	switch n := n.(type) {
+	case *shortNode:
+		hashes = append(hashes, childHashes(n.Val)...)
+	case *fullNode:
+		for i := 0; i < 16; i++ {
+			hashes = append(hashes, childHashes(n.Children[i])...)
+		}
+	case hashNode:
+		hashes = append(hashes, common.BytesToHash(n))
+	}
+	return hashes
+}
+
+// childValues returns the values of the leaves a collapsed node contains,
+// including the ones of nodes embedded into it.
+func childValues(n node) [][]byte {
+	var values [][]byte
+	switch n := n.(type) {
+	case *shortNode:
+		if value, ok := n.Val.(valueNode); ok && len(value) > 0 {
+			values = append(values, value)
+		} else {
+			values = append(values, childValues(n.Val)...)
+		}
+	case *fullNode:
+		for i := 0; i < 16; i++ {
+			values = append(values, childValues(n.Children[i])...)
+		}
+		if value, ok := n.Children[16].(valueNode); ok && len(value) > 0 {
+			values = append(values, value)
+		}
+	}
+	return values
+}
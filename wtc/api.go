@@ -20,6 +20,7 @@ import (
 	"bytes"
 	"compress/gzip"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -30,6 +31,8 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus/coinage"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
@@ -71,6 +74,139 @@ func (api *PublicEthereumAPI) Hashrate() hexutil.Uint64 {
 	return hexutil.Uint64(api.e.Miner().HashRate())
 }
 
+// PublicWaltonchainAPI provides an API to access Waltonchain specific consensus
+// information, such as the mining rewards.
+type PublicWaltonchainAPI struct {
+	e *Ethereum
+}
+
+// NewPublicWaltonchainAPI creates a new Waltonchain API for full nodes.
+func NewPublicWaltonchainAPI(e *Ethereum) *PublicWaltonchainAPI {
+	return &PublicWaltonchainAPI{e}
+}
+
+// GetBlockReward returns the reward the given address receives for mining the
+// block with the given number. Whether the masternode bonus applies is judged by
+// the balance of the address at the preceding block, or at the current head for
+// blocks yet to be mined. The actual reward of a block depends on the balance
+// after its transactions were applied.
+func (api *PublicWaltonchainAPI) GetBlockReward(number rpc.BlockNumber, address common.Address) (*hexutil.Big, error) {
+	head := api.e.blockchain.CurrentBlock().Header()
+
+	var num uint64
+	switch number {
+	case rpc.PendingBlockNumber:
+		num = head.Number.Uint64() + 1
+	case rpc.LatestBlockNumber:
+		num = head.Number.Uint64()
+	default:
+		num = uint64(number)
+	}
+	parent := head
+	if num > 0 && num <= head.Number.Uint64() {
+		parent = api.e.blockchain.GetHeaderByNumber(num - 1)
+		if parent == nil {
+			return nil, fmt.Errorf("block #%d not found", num-1)
+		}
+	}
+	statedb, err := api.e.blockchain.StateAt(parent.Root)
+	if err != nil {
+		return nil, err
+	}
+	reward := ethash.BlockReward(api.e.chainConfig, new(big.Int).SetUint64(num), statedb.GetBalance(address))
+	return (*hexutil.Big)(reward), nil
+}
+
+// CoinAge is the coin age of an account at a given block.
+type CoinAge struct {
+	Balance   *hexutil.Big   `json:"balance"`
+	Stored    *hexutil.Big   `json:"stored"`    // Coin age as last written to the state
+	Current   *hexutil.Big   `json:"current"`   // Coin age accrued up to the block time
+	UpdatedAt hexutil.Uint64 `json:"updatedAt"` // Block time the stored coin age was last updated at
+	Number    hexutil.Uint64 `json:"number"`
+	Time      hexutil.Uint64 `json:"time"`
+}
+
+// GetCoinAge returns the coin age of the given address at the given block, both
+// as stored in the state and accrued up to the time of the block.
+func (api *PublicWaltonchainAPI) GetCoinAge(ctx context.Context, address common.Address, number rpc.BlockNumber) (*CoinAge, error) {
+	statedb, header, err := api.e.ApiBackend.StateAndHeaderByNumber(ctx, number)
+	if statedb == nil || err != nil {
+		return nil, err
+	}
+	result := &CoinAge{
+		Balance:   (*hexutil.Big)(new(big.Int).Set(statedb.GetBalance(address))),
+		Stored:    (*hexutil.Big)(new(big.Int).Set(statedb.GetStoredCoinAge(address))),
+		UpdatedAt: hexutil.Uint64(statedb.GetFUBlock(address).Uint64()),
+		Number:    hexutil.Uint64(header.Number.Uint64()),
+		Time:      hexutil.Uint64(header.Time.Uint64()),
+	}
+	// Accruing the coin age modifies the state, which is a throwaway copy here
+	result.Current = (*hexutil.Big)(new(big.Int).Set(statedb.GetCoinAge(address, header.Number, header.Time)))
+	return result, nil
+}
+
+// MiningTargetMultiplier details how much the target of a block is widened for
+// a miner by its coin age and the transactions included.
+type MiningTargetMultiplier struct {
+	Number              hexutil.Uint64 `json:"number"` // Number of the block being sealed
+	CoinAge             *hexutil.Big   `json:"coinAge"`
+	CoinAgeMultiplier   *hexutil.Big   `json:"coinAgeMultiplier"`
+	TxNumber            hexutil.Uint64 `json:"txNumber"`
+	TxNumberMultiplier  *hexutil.Big   `json:"txNumberMultiplier"`
+	Multiplier          *hexutil.Big   `json:"multiplier"`
+	Difficulty          *hexutil.Big   `json:"difficulty"`
+	EffectiveDifficulty *hexutil.Big   `json:"effectiveDifficulty"` // Difficulty divided by the multiplier
+}
+
+// GetMiningTargetMultiplier returns the target multipliers the given address
+// would seal the block following the given one with. If that block exists, its
+// time and transactions are used, otherwise the current time and the ones of the
+// pending block.
+func (api *PublicWaltonchainAPI) GetMiningTargetMultiplier(ctx context.Context, address common.Address, number rpc.BlockNumber) (*MiningTargetMultiplier, error) {
+	statedb, parent, err := api.e.ApiBackend.StateAndHeaderByNumber(ctx, number)
+	if statedb == nil || err != nil {
+		return nil, err
+	}
+	header := &types.Header{
+		Coinbase: address,
+		Number:   new(big.Int).Add(parent.Number, common.Big1),
+	}
+	if next := api.e.blockchain.GetHeaderByNumber(header.Number.Uint64()); next != nil && next.ParentHash == parent.Hash() {
+		header.Time, header.TxNumber, header.Difficulty = next.Time, next.TxNumber, next.Difficulty
+	} else {
+		header.Time = big.NewInt(time.Now().Unix())
+		if header.Time.Cmp(parent.Time) <= 0 {
+			header.Time = new(big.Int).Add(parent.Time, common.Big1)
+		}
+		if pending := api.e.miner.PendingBlock(); pending != nil && pending.ParentHash() == parent.Hash() {
+			header.TxNumber = pending.Header().TxNumber
+		}
+		header.Difficulty = ethash.CalcNextDifficulty(api.e.chainConfig, header.Time.Uint64(), parent, api.e.blockchain.GetHeader)
+		if header.Difficulty == nil {
+			return nil, fmt.Errorf("missing ancestors of block #%d", header.Number)
+		}
+	}
+	// Accruing the coin age modifies the state, which is a throwaway copy here
+	balance := new(big.Int).Set(statedb.GetBalance(address))
+	age := statedb.GetCoinAge(address, parent.Number, parent.Time)
+	age = coinage.Expected(api.e.chainConfig, header, balance, age, parent.Number, parent.Time)
+
+	coinageMul, txMul := ethash.SealMultipliers(age, header.TxNumber)
+	multiplier := new(big.Int).Mul(coinageMul, txMul)
+
+	return &MiningTargetMultiplier{
+		Number:              hexutil.Uint64(header.Number.Uint64()),
+		CoinAge:             (*hexutil.Big)(age),
+		CoinAgeMultiplier:   (*hexutil.Big)(coinageMul),
+		TxNumber:            hexutil.Uint64(header.TxNumber),
+		TxNumberMultiplier:  (*hexutil.Big)(txMul),
+		Multiplier:          (*hexutil.Big)(multiplier),
+		Difficulty:          (*hexutil.Big)(header.Difficulty),
+		EffectiveDifficulty: (*hexutil.Big)(new(big.Int).Div(header.Difficulty, multiplier)),
+	}, nil
+}
+
 // PublicMinerAPI provides an API to control the miner.
 // It offers only methods that operate on data that pose no security risk when it is publicly accessible.
 type PublicMinerAPI struct {
@@ -205,6 +341,100 @@ func (api *PrivateMinerAPI) GetHashrate() uint64 {
 	return uint64(api.e.miner.HashRate())
 }
 
+// StratumWorkers returns the share statistics of the workers mining through the
+// Stratum server, keyed by worker name.
+func (api *PrivateMinerAPI) StratumWorkers() (map[string]*miner.StratumWorkerStats, error) {
+	if api.e.stratum == nil {
+		return nil, errors.New("stratum server not enabled")
+	}
+	return api.e.stratum.Workers(), nil
+}
+
+// Strategy returns the name of the block building strategy of the miner.
+func (api *PrivateMinerAPI) Strategy() string {
+	return api.e.Miner().Builder().Name()
+}
+
+// SetStrategy sets the block building strategy of the miner (price, txcount or
+// bundle), effective from the next block.
+func (api *PrivateMinerAPI) SetStrategy(strategy string) (bool, error) {
+	builder, err := miner.NewBuilder(strategy)
+	if err != nil {
+		return false, err
+	}
+	api.e.Miner().SetBuilder(builder)
+	return true, nil
+}
+
+// SendBundle queues signed RLP encoded transactions to be included in a block in
+// order, either all of them or none, by the bundle strategy. The bundle is
+// dropped after maxBlock if set, or 100 blocks after the current one otherwise.
+func (api *PrivateMinerAPI) SendBundle(encodedTxs []hexutil.Bytes, maxBlock *hexutil.Uint64) (bool, error) {
+	txs := make(types.Transactions, len(encodedTxs))
+	for i, encoded := range encodedTxs {
+		txs[i] = new(types.Transaction)
+		if err := rlp.DecodeBytes(encoded, txs[i]); err != nil {
+			return false, fmt.Errorf("transaction %d: %v", i, err)
+		}
+	}
+	var last uint64
+	if maxBlock != nil {
+		last = uint64(*maxBlock)
+	}
+	if err := api.e.Miner().AddBundle(txs, last); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// SimulatedBlock details the value of the block the miner would seal next.
+type SimulatedBlock struct {
+	Strategy            string         `json:"strategy"`
+	Number              hexutil.Uint64 `json:"number"`
+	Transactions        hexutil.Uint64 `json:"transactions"`
+	TxNumber            hexutil.Uint64 `json:"txNumber"` // Transactions scaling the target
+	GasUsed             *hexutil.Big   `json:"gasUsed"`
+	Fees                *hexutil.Big   `json:"fees"`
+	CoinAge             *hexutil.Big   `json:"coinAge"`
+	CoinAgeMultiplier   *hexutil.Big   `json:"coinAgeMultiplier"`
+	TxNumberMultiplier  *hexutil.Big   `json:"txNumberMultiplier"`
+	Multiplier          *hexutil.Big   `json:"multiplier"`
+	Difficulty          *hexutil.Big   `json:"difficulty"`
+	EffectiveDifficulty *hexutil.Big   `json:"effectiveDifficulty"` // Difficulty divided by the multiplier
+}
+
+// SimulateBlock assembles the block following the current head for the
+// etherbase with the given strategy, or the one of the miner if omitted, and
+// reports its expected fees, transactions and target multipliers without
+// sealing it.
+func (api *PrivateMinerAPI) SimulateBlock(strategy *string) (*SimulatedBlock, error) {
+	builder := api.e.Miner().Builder()
+	if strategy != nil {
+		var err error
+		if builder, err = miner.NewBuilder(*strategy); err != nil {
+			return nil, err
+		}
+	}
+	sim, err := api.e.Miner().SimulateBlock(builder)
+	if err != nil {
+		return nil, err
+	}
+	return &SimulatedBlock{
+		Strategy:            sim.Strategy,
+		Number:              hexutil.Uint64(sim.Number),
+		Transactions:        hexutil.Uint64(sim.Transactions),
+		TxNumber:            hexutil.Uint64(sim.TxNumber),
+		GasUsed:             (*hexutil.Big)(sim.GasUsed),
+		Fees:                (*hexutil.Big)(sim.Fees),
+		CoinAge:             (*hexutil.Big)(sim.CoinAge),
+		CoinAgeMultiplier:   (*hexutil.Big)(sim.CoinAgeMultiplier),
+		TxNumberMultiplier:  (*hexutil.Big)(sim.TxNumberMultiplier),
+		Multiplier:          (*hexutil.Big)(sim.Multiplier),
+		Difficulty:          (*hexutil.Big)(sim.Difficulty),
+		EffectiveDifficulty: (*hexutil.Big)(sim.EffectiveDifficulty),
+	}, nil
+}
+
 // PrivateAdminAPI is the collection of Ethereum full node-related APIs
 // exposed over the private admin endpoint.
 type PrivateAdminAPI struct {
@@ -239,6 +469,19 @@ func (api *PrivateAdminAPI) ExportChain(file string) (bool, error) {
 	return true, nil
 }
 
+// TxpoolFilter returns the admission filter of the transaction pool, nil if all
+// transactions are accepted.
+func (api *PrivateAdminAPI) TxpoolFilter() *core.TxFilter {
+	return api.eth.TxPool().Filter()
+}
+
+// TxpoolSetFilter replaces the admission filter of the transaction pool, dropping
+// the pooled transactions it rejects. A null filter accepts all transactions.
+func (api *PrivateAdminAPI) TxpoolSetFilter(filter *core.TxFilter) bool {
+	api.eth.TxPool().SetFilter(filter)
+	return true
+}
+
 func hasAllBlocks(chain *core.BlockChain, bs []*types.Block) bool {
 	for _, b := range bs {
 		if !chain.HasBlock(b.Hash(), b.NumberU64()) {
@@ -348,6 +591,12 @@ func NewPrivateDebugAPI(config *params.ChainConfig, eth *Ethereum) *PrivateDebug
 	return &PrivateDebugAPI{config: config, eth: eth}
 }
 
+// TxIndexProgress retrieves the progress of the transaction indexer in bringing
+// the lookup entries in line with the configured block range.
+func (api *PrivateDebugAPI) TxIndexProgress() core.TxIndexProgress {
+	return api.eth.txIndexer.Progress()
+}
+
 // BlockTraceResult is the returned value when replaying a block to check for
 // consensus results and full VM trace logs for all included transactions.
 type BlockTraceResult struct {
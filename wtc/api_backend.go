@@ -180,6 +180,10 @@ func (b *EthApiBackend) ProtocolVersion() int {
 	return b.eth.EthVersion()
 }
 
+func (b *EthApiBackend) TxIndexProgress() core.TxIndexProgress {
+	return b.eth.txIndexer.Progress()
+}
+
 func (b *EthApiBackend) SuggestPrice(ctx context.Context) (*big.Int, error) {
 	return b.gpo.SuggestPrice(ctx)
 }
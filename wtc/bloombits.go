@@ -83,6 +83,14 @@ const (
 	// bloomThrottling is the time to wait between processing two consecutive index
 	// sections. It's useful during chain upgrades to prevent disk overload.
 	bloomThrottling = 100 * time.Millisecond
+
+	// txIndexSection is the number of blocks the transaction indexer (un)indexes
+	// in one go before committing them and pausing.
+	txIndexSection = 4096
+
+	// txIndexThrottling is the time to wait between processing two consecutive
+	// transaction index sections.
+	txIndexThrottling = 100 * time.Millisecond
 )
 
 // BloomIndexer implements a core.ChainIndexer, building up a rotated bloom bits index
@@ -42,10 +42,14 @@ var DefaultConfig = Config{
 	NetworkId:            1,
 	LightPeers:           20,
 	DatabaseCache:        128,
+	AncientThreshold:     90000,
+	TrieCache:            256,
+	TrieFlushInterval:    1024,
+	TrieRetention:        128,
 	GasPrice:             big.NewInt(18 * params.Shannon),
 	PowGPU:               false,
-	GPUPort:              12125,
-	GPUGetPort:           10240,
+	GPUEndpoint:          "127.0.0.1:12125",
+	StratumDifficulty:    1000000,
 
 	TxPool: core.DefaultTxPoolConfig,
 	GPO: gasprice.Config{
@@ -88,11 +92,31 @@ type Config struct {
 	DatabaseHandles    int  `toml:"-"`
 	DatabaseCache      int
 
+	// Ancient store options
+	DatabaseFreezer      string // Directory of the ancient store (default = inside chaindata)
+	AncientThreshold     uint64 // Number of blocks after which a chain segment is frozen
+	AncientNoCompression bool   // Whether to store ancient blocks uncompressed
+
+	// State pruning options
+	NoPruning         bool   // Whether to write every block state to disk (archive node)
+	TrieCache         int    // Memory limit (MB) of the trie node cache before flushing
+	TrieFlushInterval uint64 // Number of blocks between flushes of the trie node cache
+	TrieRetention     uint64 // Number of recent block states kept in the trie node cache
+	NoSnapshot        bool   // Whether to disable the flat state snapshot
+
+	// Transaction indexing options
+	TxLookupLimit uint64 // Number of recent blocks to maintain transaction lookup entries for (0 = all)
+
 	// Mining-related options
-	Etherbase    common.Address `toml:",omitempty"`
-	MinerThreads int            `toml:",omitempty"`
-	ExtraData    []byte         `toml:",omitempty"`
-	GasPrice     *big.Int
+	Etherbase     common.Address `toml:",omitempty"`
+	MinerThreads  int            `toml:",omitempty"`
+	ExtraData     []byte         `toml:",omitempty"`
+	MinerStrategy string         `toml:",omitempty"` // Block building strategy (price, txcount or bundle)
+	GasPrice      *big.Int
+
+	// Stratum server options
+	StratumEndpoint   string `toml:",omitempty"` // TCP endpoint to serve Stratum miners on, disabled if empty
+	StratumDifficulty uint64 // Difficulty of the shares accepted from Stratum miners
 
 	// Ethash options
 	EthashCacheDir       string
@@ -101,8 +125,7 @@ type Config struct {
 	EthashDatasetDir     string
 	EthashDatasetsInMem  int
 	EthashDatasetsOnDisk int
-	GPUPort              int64
-	GPUGetPort           int64
+	GPUEndpoint          string
 
 	// Transaction pool options
 	TxPool core.TxPoolConfig
@@ -23,16 +23,29 @@ func (c Config) MarshalTOML() (interface{}, error) {
 		SkipBcVersionCheck      bool `toml:"-"`
 		DatabaseHandles         int  `toml:"-"`
 		DatabaseCache           int
+		DatabaseFreezer         string
+		AncientThreshold        uint64
+		AncientNoCompression    bool
+		NoPruning               bool
+		TrieCache               int
+		TrieFlushInterval       uint64
+		TrieRetention           uint64
+		NoSnapshot              bool
+		TxLookupLimit           uint64
 		Etherbase               common.Address `toml:",omitempty"`
 		MinerThreads            int            `toml:",omitempty"`
 		ExtraData               hexutil.Bytes  `toml:",omitempty"`
+		MinerStrategy           string         `toml:",omitempty"`
 		GasPrice                *big.Int
+		StratumEndpoint         string `toml:",omitempty"`
+		StratumDifficulty       uint64
 		EthashCacheDir          string
 		EthashCachesInMem       int
 		EthashCachesOnDisk      int
 		EthashDatasetDir        string
 		EthashDatasetsInMem     int
 		EthashDatasetsOnDisk    int
+		GPUEndpoint             string
 		TxPool                  core.TxPoolConfig
 		GPO                     gasprice.Config
 		EnablePreimageRecording bool
@@ -50,16 +63,29 @@ func (c Config) MarshalTOML() (interface{}, error) {
 	enc.SkipBcVersionCheck = c.SkipBcVersionCheck
 	enc.DatabaseHandles = c.DatabaseHandles
 	enc.DatabaseCache = c.DatabaseCache
+	enc.DatabaseFreezer = c.DatabaseFreezer
+	enc.AncientThreshold = c.AncientThreshold
+	enc.AncientNoCompression = c.AncientNoCompression
+	enc.NoPruning = c.NoPruning
+	enc.TrieCache = c.TrieCache
+	enc.TrieFlushInterval = c.TrieFlushInterval
+	enc.TrieRetention = c.TrieRetention
+	enc.NoSnapshot = c.NoSnapshot
+	enc.TxLookupLimit = c.TxLookupLimit
 	enc.Etherbase = c.Etherbase
 	enc.MinerThreads = c.MinerThreads
 	enc.ExtraData = c.ExtraData
+	enc.MinerStrategy = c.MinerStrategy
 	enc.GasPrice = c.GasPrice
+	enc.StratumEndpoint = c.StratumEndpoint
+	enc.StratumDifficulty = c.StratumDifficulty
 	enc.EthashCacheDir = c.EthashCacheDir
 	enc.EthashCachesInMem = c.EthashCachesInMem
 	enc.EthashCachesOnDisk = c.EthashCachesOnDisk
 	enc.EthashDatasetDir = c.EthashDatasetDir
 	enc.EthashDatasetsInMem = c.EthashDatasetsInMem
 	enc.EthashDatasetsOnDisk = c.EthashDatasetsOnDisk
+	enc.GPUEndpoint = c.GPUEndpoint
 	enc.TxPool = c.TxPool
 	enc.GPO = c.GPO
 	enc.EnablePreimageRecording = c.EnablePreimageRecording
@@ -81,16 +107,29 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 		SkipBcVersionCheck      *bool `toml:"-"`
 		DatabaseHandles         *int  `toml:"-"`
 		DatabaseCache           *int
+		DatabaseFreezer         *string
+		AncientThreshold        *uint64
+		AncientNoCompression    *bool
+		NoPruning               *bool
+		TrieCache               *int
+		TrieFlushInterval       *uint64
+		TrieRetention           *uint64
+		NoSnapshot              *bool
+		TxLookupLimit           *uint64
 		Etherbase               *common.Address `toml:",omitempty"`
 		MinerThreads            *int            `toml:",omitempty"`
 		ExtraData               hexutil.Bytes   `toml:",omitempty"`
+		MinerStrategy           *string         `toml:",omitempty"`
 		GasPrice                *big.Int
+		StratumEndpoint         *string `toml:",omitempty"`
+		StratumDifficulty       *uint64
 		EthashCacheDir          *string
 		EthashCachesInMem       *int
 		EthashCachesOnDisk      *int
 		EthashDatasetDir        *string
 		EthashDatasetsInMem     *int
 		EthashDatasetsOnDisk    *int
+		GPUEndpoint             *string
 		TxPool                  *core.TxPoolConfig
 		GPO                     *gasprice.Config
 		EnablePreimageRecording *bool
@@ -127,6 +166,33 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 	if dec.DatabaseCache != nil {
 		c.DatabaseCache = *dec.DatabaseCache
 	}
+	if dec.DatabaseFreezer != nil {
+		c.DatabaseFreezer = *dec.DatabaseFreezer
+	}
+	if dec.AncientThreshold != nil {
+		c.AncientThreshold = *dec.AncientThreshold
+	}
+	if dec.AncientNoCompression != nil {
+		c.AncientNoCompression = *dec.AncientNoCompression
+	}
+	if dec.NoPruning != nil {
+		c.NoPruning = *dec.NoPruning
+	}
+	if dec.TrieCache != nil {
+		c.TrieCache = *dec.TrieCache
+	}
+	if dec.TrieFlushInterval != nil {
+		c.TrieFlushInterval = *dec.TrieFlushInterval
+	}
+	if dec.TrieRetention != nil {
+		c.TrieRetention = *dec.TrieRetention
+	}
+	if dec.NoSnapshot != nil {
+		c.NoSnapshot = *dec.NoSnapshot
+	}
+	if dec.TxLookupLimit != nil {
+		c.TxLookupLimit = *dec.TxLookupLimit
+	}
 	if dec.Etherbase != nil {
 		c.Etherbase = *dec.Etherbase
 	}
@@ -136,9 +202,18 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 	if dec.ExtraData != nil {
 		c.ExtraData = dec.ExtraData
 	}
+	if dec.MinerStrategy != nil {
+		c.MinerStrategy = *dec.MinerStrategy
+	}
 	if dec.GasPrice != nil {
 		c.GasPrice = dec.GasPrice
 	}
+	if dec.StratumEndpoint != nil {
+		c.StratumEndpoint = *dec.StratumEndpoint
+	}
+	if dec.StratumDifficulty != nil {
+		c.StratumDifficulty = *dec.StratumDifficulty
+	}
 	if dec.EthashCacheDir != nil {
 		c.EthashCacheDir = *dec.EthashCacheDir
 	}
@@ -157,6 +232,9 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 	if dec.EthashDatasetsOnDisk != nil {
 		c.EthashDatasetsOnDisk = *dec.EthashDatasetsOnDisk
 	}
+	if dec.GPUEndpoint != nil {
+		c.GPUEndpoint = *dec.GPUEndpoint
+	}
 	if dec.TxPool != nil {
 		c.TxPool = *dec.TxPool
 	}
@@ -106,6 +106,10 @@ type txPool interface {
 	// SubscribeTxPreEvent should return an event subscription of
 	// TxPreEvent and send events to the given channel.
 	SubscribeTxPreEvent(chan<- core.TxPreEvent) event.Subscription
+
+	// Filtered should report whether the given transaction is rejected by
+	// the admission filter of the pool.
+	Filtered(*types.Transaction) bool
 }
 
 // statusData is the network packet for the status message.
@@ -0,0 +1,211 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// AccountResult is an account as stored in the state trie, including its coin
+// age, along with the Merkle proofs of the account and some of its storage.
+type AccountResult struct {
+	Address      common.Address
+	AccountProof []rlp.RawValue
+	Nonce        uint64
+	Balance      *big.Int
+	CoinAge      *big.Int // Coin age as last written, not accrued up to the block
+	FUBlock      *big.Int // Block time the coin age was last updated at
+	StorageHash  common.Hash
+	CodeHash     common.Hash
+	StorageProof []StorageResult
+}
+
+// StorageResult is the value of a storage slot along with its Merkle proof.
+type StorageResult struct {
+	Key   common.Hash
+	Value *big.Int
+	Proof []rlp.RawValue
+}
+
+type rpcAccountResult struct {
+	Address      common.Address     `json:"address"`
+	AccountProof []hexutil.Bytes    `json:"accountProof"`
+	Nonce        hexutil.Uint64     `json:"nonce"`
+	Balance      *hexutil.Big       `json:"balance"`
+	CoinAge      *hexutil.Big       `json:"coinAge"`
+	FUBlock      *hexutil.Big       `json:"fuBlock"`
+	StorageHash  common.Hash        `json:"storageHash"`
+	CodeHash     common.Hash        `json:"codeHash"`
+	StorageProof []rpcStorageResult `json:"storageProof"`
+}
+
+type rpcStorageResult struct {
+	Key   string          `json:"key"`
+	Value *hexutil.Big    `json:"value"`
+	Proof []hexutil.Bytes `json:"proof"`
+}
+
+// GetProof returns the account and the given storage slots of it along with
+// their Merkle proofs. The block number can be nil, in which case the proofs are
+// made against the state of the latest known block. Results for any other account
+// or slots than the requested ones are rejected. Use VerifyProof to check the
+// result against the state root of the block header.
+func (ec *Client) GetProof(ctx context.Context, account common.Address, keys []common.Hash, blockNumber *big.Int) (*AccountResult, error) {
+	hexKeys := make([]string, len(keys))
+	for i, key := range keys {
+		hexKeys[i] = key.Hex()
+	}
+	var res rpcAccountResult
+	if err := ec.c.CallContext(ctx, &res, "eth_getProof", account, hexKeys, toBlockNumArg(blockNumber)); err != nil {
+		return nil, err
+	}
+	if res.Address != account {
+		return nil, fmt.Errorf("proof of account %x returned for %x", res.Address, account)
+	}
+	if res.Balance == nil || res.CoinAge == nil || res.FUBlock == nil {
+		return nil, fmt.Errorf("incomplete proof of account %x", account)
+	}
+	if len(res.StorageProof) != len(keys) {
+		return nil, fmt.Errorf("%d slot proofs returned for %d slots", len(res.StorageProof), len(keys))
+	}
+	storage := make([]StorageResult, len(res.StorageProof))
+	for i, slot := range res.StorageProof {
+		if key := common.HexToHash(slot.Key); key != keys[i] {
+			return nil, fmt.Errorf("proof of slot %x returned for %x", key, keys[i])
+		}
+		if slot.Value == nil {
+			return nil, fmt.Errorf("incomplete proof of slot %s", slot.Key)
+		}
+		storage[i] = StorageResult{
+			Key:   keys[i],
+			Value: (*big.Int)(slot.Value),
+			Proof: fromHexSlice(slot.Proof),
+		}
+	}
+	return &AccountResult{
+		Address:      res.Address,
+		AccountProof: fromHexSlice(res.AccountProof),
+		Nonce:        uint64(res.Nonce),
+		Balance:      (*big.Int)(res.Balance),
+		CoinAge:      (*big.Int)(res.CoinAge),
+		FUBlock:      (*big.Int)(res.FUBlock),
+		StorageHash:  res.StorageHash,
+		CodeHash:     res.CodeHash,
+		StorageProof: storage,
+	}, nil
+}
+
+func fromHexSlice(proof []hexutil.Bytes) []rlp.RawValue {
+	res := make([]rlp.RawValue, len(proof))
+	for i, node := range proof {
+		res[i] = rlp.RawValue(node)
+	}
+	return res
+}
+
+// VerifyProof checks the account and storage proofs of a GetProof result for the
+// given account and storage slots against the given state root, usually taken
+// from a block header. The proofs are checked for the requested account and
+// slots, never the ones the result reports. It returns an error if any proof is
+// invalid, if the result is for another account or slots, or if a reported value
+// doesn't match the proven one. An account absent from the state must be
+// reported with all fields zero.
+func VerifyProof(root common.Hash, account common.Address, keys []common.Hash, res *AccountResult) error {
+	if res.Address != account {
+		return fmt.Errorf("proof of account %x reported for %x", res.Address, account)
+	}
+	if len(res.StorageProof) != len(keys) {
+		return fmt.Errorf("%d slot proofs reported for %d slots", len(res.StorageProof), len(keys))
+	}
+	value, err := trie.VerifyProof(root, crypto.Keccak256(account[:]), res.AccountProof)
+	if err != nil {
+		return fmt.Errorf("invalid account proof: %v", err)
+	}
+	if value == nil {
+		// Account proven absent, it must be reported empty
+		if res.Nonce != 0 || res.Balance.Sign() != 0 || res.CoinAge.Sign() != 0 || res.FUBlock.Sign() != 0 ||
+			(res.StorageHash != types.EmptyRootHash && res.StorageHash != common.Hash{}) || (res.CodeHash != common.Hash{}) {
+			return fmt.Errorf("account %x proven absent but reported non-empty", account)
+		}
+	} else {
+		var acc state.Account
+		if err := rlp.DecodeBytes(value, &acc); err != nil {
+			return fmt.Errorf("invalid account %x: %v", account, err)
+		}
+		switch {
+		case acc.Nonce != res.Nonce:
+			return fmt.Errorf("nonce mismatch: proven %d, reported %d", acc.Nonce, res.Nonce)
+		case acc.Balance.Cmp(res.Balance) != 0:
+			return fmt.Errorf("balance mismatch: proven %v, reported %v", acc.Balance, res.Balance)
+		case acc.CoinAge.Cmp(res.CoinAge) != 0:
+			return fmt.Errorf("coin age mismatch: proven %v, reported %v", acc.CoinAge, res.CoinAge)
+		case acc.FUBlockTime.Cmp(res.FUBlock) != 0:
+			return fmt.Errorf("coin age update time mismatch: proven %v, reported %v", acc.FUBlockTime, res.FUBlock)
+		case acc.Root != res.StorageHash:
+			return fmt.Errorf("storage root mismatch: proven %x, reported %x", acc.Root, res.StorageHash)
+		case !bytes.Equal(acc.CodeHash, res.CodeHash[:]):
+			return fmt.Errorf("code hash mismatch: proven %x, reported %x", acc.CodeHash, res.CodeHash)
+		}
+	}
+	for i, slot := range res.StorageProof {
+		if slot.Key != keys[i] {
+			return fmt.Errorf("proof of slot %x reported for %x", slot.Key, keys[i])
+		}
+		if err := verifyStorageProof(res.StorageHash, keys[i], slot); err != nil {
+			return fmt.Errorf("slot %x: %v", keys[i], err)
+		}
+	}
+	return nil
+}
+
+// verifyStorageProof checks the proof of a storage slot against a storage root.
+func verifyStorageProof(root common.Hash, key common.Hash, slot StorageResult) error {
+	// Empty storage has nothing to prove, every slot is zero
+	if root == types.EmptyRootHash || root == (common.Hash{}) {
+		if len(slot.Proof) != 0 || slot.Value.Sign() != 0 {
+			return fmt.Errorf("non-empty slot in empty storage")
+		}
+		return nil
+	}
+	value, err := trie.VerifyProof(root, crypto.Keccak256(key[:]), slot.Proof)
+	if err != nil {
+		return fmt.Errorf("invalid proof: %v", err)
+	}
+	proven := new(big.Int)
+	if value != nil {
+		_, content, _, err := rlp.Split(value)
+		if err != nil {
+			return fmt.Errorf("invalid value: %v", err)
+		}
+		proven.SetBytes(content)
+	}
+	if proven.Cmp(slot.Value) != 0 {
+		return fmt.Errorf("value mismatch: proven %v, reported %v", proven, slot.Value)
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// makeProof assembles a proof result from a state the way eth_getProof does.
+func makeProof(t *testing.T, statedb *state.StateDB, addr common.Address, keys []common.Hash) *AccountResult {
+	storageHash := types.EmptyRootHash
+	if tr := statedb.StorageTrie(addr); tr != nil {
+		storageHash = tr.Hash()
+	}
+	res := &AccountResult{
+		Address:     addr,
+		Nonce:       statedb.GetNonce(addr),
+		Balance:     statedb.GetBalance(addr),
+		CoinAge:     statedb.GetStoredCoinAge(addr),
+		FUBlock:     statedb.GetFUBlock(addr),
+		StorageHash: storageHash,
+		CodeHash:    statedb.GetCodeHash(addr),
+	}
+	var err error
+	if res.AccountProof, err = statedb.GetProof(addr); err != nil {
+		t.Fatalf("failed to prove account %x: %v", addr, err)
+	}
+	for _, key := range keys {
+		proof, err := statedb.GetStorageProof(addr, key)
+		if err != nil {
+			t.Fatalf("failed to prove slot %x: %v", key, err)
+		}
+		res.StorageProof = append(res.StorageProof, StorageResult{key, statedb.GetState(addr, key).Big(), proof})
+	}
+	return res
+}
+
+func TestVerifyProof(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+
+	var (
+		contract = common.Address{0x01}
+		plain    = common.Address{0x02}
+		missing  = common.Address{0x03}
+		slot     = common.HexToHash("0x01")
+		empty    = common.HexToHash("0x02")
+	)
+	statedb.SetBalance(contract, big.NewInt(1000), big.NewInt(1), big.NewInt(10))
+	statedb.SetCoinAge(contract, big.NewInt(4242))
+	statedb.SetCode(contract, []byte{0x60, 0x00})
+	statedb.SetState(contract, slot, common.HexToHash("0x2a"))
+	statedb.SetNonce(plain, 7)
+	statedb.SetCoinAge(plain, big.NewInt(17))
+
+	root, err := statedb.CommitTo(db, false)
+	if err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	statedb, _ = state.New(root, state.NewDatabase(db))
+
+	// Valid proofs of existing and missing accounts and slots must pass
+	keys := []common.Hash{slot, empty}
+	for _, addr := range []common.Address{contract, plain, missing} {
+		res := makeProof(t, statedb, addr, keys)
+		if err := VerifyProof(root, addr, keys, res); err != nil {
+			t.Errorf("account %x: valid proof rejected: %v", addr, err)
+		}
+	}
+	if res := makeProof(t, statedb, contract, nil); res.CoinAge.Int64() != 4242 {
+		t.Errorf("coin age mismatch: have %v, want %v", res.CoinAge, 4242)
+	}
+	// Tampered results must be rejected
+	tampers := map[string]func(res *AccountResult){
+		"balance":    func(res *AccountResult) { res.Balance = big.NewInt(1001) },
+		"coin age":   func(res *AccountResult) { res.CoinAge = big.NewInt(4243) },
+		"fu block":   func(res *AccountResult) { res.FUBlock = big.NewInt(11) },
+		"nonce":      func(res *AccountResult) { res.Nonce++ },
+		"slot value": func(res *AccountResult) { res.StorageProof[0].Value = big.NewInt(43) },
+		"empty slot": func(res *AccountResult) { res.StorageProof[1].Value = big.NewInt(1) },
+		"proof":      func(res *AccountResult) { res.AccountProof = res.AccountProof[:len(res.AccountProof)-1] },
+		"address":    func(res *AccountResult) { res.Address = plain },
+		"slot key":   func(res *AccountResult) { res.StorageProof[0].Key = empty },
+		"slot count": func(res *AccountResult) { res.StorageProof = res.StorageProof[:1] },
+	}
+	for name, tamper := range tampers {
+		res := makeProof(t, statedb, contract, keys)
+		tamper(res)
+		if err := VerifyProof(root, contract, keys, res); err == nil {
+			t.Errorf("tampered %s accepted", name)
+		}
+	}
+	// Valid proofs of other accounts or slots than the requested ones must fail
+	if err := VerifyProof(root, contract, keys, makeProof(t, statedb, plain, keys)); err == nil {
+		t.Errorf("proof of another account accepted")
+	}
+	if err := VerifyProof(root, contract, keys, makeProof(t, statedb, contract, []common.Hash{empty, slot})); err == nil {
+		t.Errorf("proof of other slots accepted")
+	}
+	// A missing account can't be reported with funds
+	res := makeProof(t, statedb, missing, nil)
+	res.Balance = big.NewInt(1)
+	if err := VerifyProof(root, missing, nil, res); err == nil {
+		t.Errorf("funded missing account accepted")
+	}
+}
+
+// ProofService is an RPC service serving a fixed eth_getProof result.
+type ProofService struct {
+	res *rpcAccountResult
+}
+
+func (s *ProofService) GetProof(account common.Address, keys []string, block string) (interface{}, error) {
+	return s.res, nil
+}
+
+// Tests that GetProof rejects results for other accounts or slots than the ones
+// requested.
+func TestGetProofMismatch(t *testing.T) {
+	var (
+		account = common.Address{0x01}
+		keys    = []common.Hash{common.HexToHash("0x01"), common.HexToHash("0x02")}
+	)
+	valid := func() *rpcAccountResult {
+		return &rpcAccountResult{
+			Address: account,
+			Balance: new(hexutil.Big),
+			CoinAge: new(hexutil.Big),
+			FUBlock: new(hexutil.Big),
+			StorageProof: []rpcStorageResult{
+				{Key: keys[0].Hex(), Value: new(hexutil.Big)},
+				{Key: keys[1].Hex(), Value: new(hexutil.Big)},
+			},
+		}
+	}
+	tests := map[string]func(res *rpcAccountResult){
+		"valid":    func(res *rpcAccountResult) {},
+		"address":  func(res *rpcAccountResult) { res.Address = common.Address{0x02} },
+		"slot key": func(res *rpcAccountResult) { res.StorageProof[1].Key = keys[0].Hex() },
+		"slot order": func(res *rpcAccountResult) {
+			res.StorageProof[0], res.StorageProof[1] = res.StorageProof[1], res.StorageProof[0]
+		},
+		"slot count": func(res *rpcAccountResult) { res.StorageProof = res.StorageProof[:1] },
+	}
+	for name, tamper := range tests {
+		res := valid()
+		tamper(res)
+
+		server := rpc.NewServer()
+		if err := server.RegisterName("eth", &ProofService{res}); err != nil {
+			t.Fatalf("failed to register service: %v", err)
+		}
+		rpcClient := rpc.DialInProc(server)
+
+		_, err := NewClient(rpcClient).GetProof(context.Background(), account, keys, nil)
+		if name == "valid" && err != nil {
+			t.Errorf("valid result rejected: %v", err)
+		}
+		if name != "valid" && err == nil {
+			t.Errorf("mismatching %s accepted", name)
+		}
+		rpcClient.Close()
+		server.Stop()
+	}
+}
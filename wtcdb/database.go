@@ -17,18 +17,20 @@
 package ethdb
 
 import (
+	"bytes"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/metrics"
 	"github.com/syndtr/goleveldb/leveldb"
 	"github.com/syndtr/goleveldb/leveldb/errors"
 	"github.com/syndtr/goleveldb/leveldb/filter"
-	"github.com/syndtr/goleveldb/leveldb/iterator"
 	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
 
 	gometrics "github.com/rcrowley/go-metrics"
 )
@@ -145,8 +147,25 @@ func (db *LDBDatabase) Delete(key []byte) error {
 	return db.db.Delete(key, nil)
 }
 
-func (db *LDBDatabase) NewIterator() iterator.Iterator {
-	return db.db.NewIterator(nil, nil)
+// DeleteRange deletes all the keys in the range [start, limit) from the database.
+func (db *LDBDatabase) DeleteRange(start []byte, limit []byte) error {
+	return deleteDatabaseRange(db, start, limit)
+}
+
+// NewIterator creates an iterator over the entries with a particular key prefix,
+// starting at a particular key relative to the prefix.
+func (db *LDBDatabase) NewIterator(prefix []byte, start []byte) Iterator {
+	return db.db.NewIterator(bytesPrefixRange(prefix, start), nil)
+}
+
+// Stat returns a particular internal stat of the database.
+func (db *LDBDatabase) Stat(property string) (string, error) {
+	return db.db.GetProperty(property)
+}
+
+// Compact flattens the underlying data store for the given key range.
+func (db *LDBDatabase) Compact(start []byte, limit []byte) error {
+	return db.db.CompactRange(util.Range{Start: start, Limit: limit})
 }
 
 func (db *LDBDatabase) Close() {
@@ -291,6 +310,16 @@ func (b *ldbBatch) Put(key, value []byte) error {
 	return nil
 }
 
+func (b *ldbBatch) Delete(key []byte) error {
+	b.b.Delete(key)
+	b.size += len(key)
+	return nil
+}
+
+func (b *ldbBatch) DeleteRange(start []byte, limit []byte) error {
+	return deleteBatchRange(b, b.db.NewIterator(&util.Range{Start: start}, nil), start, limit)
+}
+
 func (b *ldbBatch) Write() error {
 	return b.db.Write(b.b, nil)
 }
@@ -299,6 +328,124 @@ func (b *ldbBatch) ValueSize() int {
 	return b.size
 }
 
+func (b *ldbBatch) Reset() {
+	b.b.Reset()
+	b.size = 0
+}
+
+func (b *ldbBatch) Replay(w Writer) error {
+	r := &replayer{writer: w}
+	if err := b.b.Replay(r); err != nil {
+		return err
+	}
+	return r.failure
+}
+
+// replayer adapts a Writer to the LevelDB batch replay interface, keeping the
+// first write failure.
+type replayer struct {
+	writer  Writer
+	failure error
+}
+
+func (r *replayer) Put(key, value []byte) {
+	if r.failure == nil {
+		r.failure = r.writer.Put(key, value)
+	}
+}
+
+func (r *replayer) Delete(key []byte) {
+	if r.failure == nil {
+		r.failure = r.writer.Delete(key)
+	}
+}
+
+// deleteDatabaseRange deletes all the keys in the range [start, limit) from a
+// database, writing the deletions out in batches of the ideal size.
+func deleteDatabaseRange(db Database, start []byte, limit []byte) error {
+	it := db.NewIterator(nil, start)
+	defer it.Release()
+
+	batch := db.NewBatch()
+	for it.Next() && (limit == nil || bytes.Compare(it.Key(), limit) < 0) {
+		if err := batch.Delete(common.CopyBytes(it.Key())); err != nil {
+			return err
+		}
+		if batch.ValueSize() >= IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				return err
+			}
+			batch.Reset()
+		}
+	}
+	if err := it.Error(); err != nil {
+		return err
+	}
+	return batch.Write()
+}
+
+// deleteBatchRange queues the deletion of all the keys in the range [start, limit)
+// into a batch: the ones found by an iterator over its database positioned at the
+// start of the range, and the ones written into the batch so far. The iterator is
+// released once done.
+func deleteBatchRange(batch Batch, it Iterator, start []byte, limit []byte) error {
+	var keys [][]byte
+	for it.Next() && (limit == nil || bytes.Compare(it.Key(), limit) < 0) {
+		keys = append(keys, common.CopyBytes(it.Key()))
+	}
+	it.Release()
+	if err := it.Error(); err != nil {
+		return err
+	}
+	collector := &rangeCollector{start: start, limit: limit}
+	if err := batch.Replay(collector); err != nil {
+		return err
+	}
+	for _, key := range append(keys, collector.keys...) {
+		if err := batch.Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rangeCollector is a writer collecting the keys written into a key range.
+type rangeCollector struct {
+	start, limit []byte
+	keys         [][]byte
+}
+
+func (c *rangeCollector) Put(key []byte, value []byte) error {
+	if bytes.Compare(key, c.start) >= 0 && (c.limit == nil || bytes.Compare(key, c.limit) < 0) {
+		c.keys = append(c.keys, common.CopyBytes(key))
+	}
+	return nil
+}
+
+func (c *rangeCollector) Delete(key []byte) error { return nil }
+
+func (c *rangeCollector) DeleteRange(start []byte, limit []byte) error { return nil }
+
+// prefixKeyRange prefixes the bounds of a key range, nil bounds meaning the
+// bounds of the prefix.
+func prefixKeyRange(prefix string, start []byte, limit []byte) ([]byte, []byte) {
+	start = append([]byte(prefix), start...)
+	if limit == nil {
+		limit = util.BytesPrefix([]byte(prefix)).Limit
+	} else {
+		limit = append([]byte(prefix), limit...)
+	}
+	return start, limit
+}
+
+// bytesPrefixRange returns the key range of a particular prefix, starting at a
+// particular key relative to the prefix.
+func bytesPrefixRange(prefix []byte, start []byte) *util.Range {
+	r := util.BytesPrefix(prefix)
+	r.Start = append(append([]byte{}, prefix...), start...)
+	return r
+}
+
 type table struct {
 	db     Database
 	prefix string
@@ -329,10 +476,44 @@ func (dt *table) Delete(key []byte) error {
 	return dt.db.Delete(append([]byte(dt.prefix), key...))
 }
 
+func (dt *table) DeleteRange(start []byte, limit []byte) error {
+	return dt.db.DeleteRange(prefixKeyRange(dt.prefix, start, limit))
+}
+
+func (dt *table) NewIterator(prefix []byte, start []byte) Iterator {
+	it := dt.db.NewIterator(append([]byte(dt.prefix), prefix...), start)
+	return &tableIterator{Iterator: it, prefix: dt.prefix}
+}
+
+func (dt *table) Stat(property string) (string, error) {
+	return dt.db.Stat(property)
+}
+
+// Compact flattens the underlying data store for the given key range within
+// the table, nil bounds meaning the bounds of the table.
+func (dt *table) Compact(start []byte, limit []byte) error {
+	return dt.db.Compact(prefixKeyRange(dt.prefix, start, limit))
+}
+
 func (dt *table) Close() {
 	// Do nothing; don't close the underlying DB.
 }
 
+// tableIterator wraps an iterator of the underlying database, hiding the table
+// prefix of the keys.
+type tableIterator struct {
+	Iterator
+	prefix string
+}
+
+func (it *tableIterator) Key() []byte {
+	key := it.Iterator.Key()
+	if key == nil {
+		return nil
+	}
+	return key[len(it.prefix):]
+}
+
 type tableBatch struct {
 	batch  Batch
 	prefix string
@@ -351,6 +532,14 @@ func (tb *tableBatch) Put(key, value []byte) error {
 	return tb.batch.Put(append([]byte(tb.prefix), key...), value)
 }
 
+func (tb *tableBatch) Delete(key []byte) error {
+	return tb.batch.Delete(append([]byte(tb.prefix), key...))
+}
+
+func (tb *tableBatch) DeleteRange(start []byte, limit []byte) error {
+	return tb.batch.DeleteRange(prefixKeyRange(tb.prefix, start, limit))
+}
+
 func (tb *tableBatch) Write() error {
 	return tb.batch.Write()
 }
@@ -358,3 +547,35 @@ func (tb *tableBatch) Write() error {
 func (tb *tableBatch) ValueSize() int {
 	return tb.batch.ValueSize()
 }
+
+func (tb *tableBatch) Reset() {
+	tb.batch.Reset()
+}
+
+func (tb *tableBatch) Replay(w Writer) error {
+	return tb.batch.Replay(&tableReplayer{writer: w, prefix: tb.prefix})
+}
+
+// tableReplayer wraps a writer, stripping the table prefix off the replayed
+// keys.
+type tableReplayer struct {
+	writer Writer
+	prefix string
+}
+
+func (r *tableReplayer) Put(key []byte, value []byte) error {
+	return r.writer.Put(key[len(r.prefix):], value)
+}
+
+func (r *tableReplayer) Delete(key []byte) error {
+	return r.writer.Delete(key[len(r.prefix):])
+}
+
+func (r *tableReplayer) DeleteRange(start []byte, limit []byte) error {
+	if bytes.HasPrefix(limit, []byte(r.prefix)) {
+		limit = limit[len(r.prefix):]
+	} else {
+		limit = nil
+	}
+	return r.writer.DeleteRange(start[len(r.prefix):], limit)
+}
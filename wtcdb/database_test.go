@@ -21,11 +21,13 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strconv"
 	"sync"
 	"testing"
 
 	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/ethdb/dbtest"
 )
 
 func newTestLDB() (*ethdb.LDBDatabase, func()) {
@@ -44,6 +46,45 @@ func newTestLDB() (*ethdb.LDBDatabase, func()) {
 	}
 }
 
+// newTestEngine returns a constructor of databases of the given engine in fresh
+// subdirectories of a temporary directory, along with a cleanup function.
+func newTestEngine(engine string) (func() ethdb.Database, func()) {
+	dirname, err := ioutil.TempDir(os.TempDir(), "ethdb_test_")
+	if err != nil {
+		panic("failed to create test file: " + err.Error())
+	}
+	var count int
+	return func() ethdb.Database {
+			count++
+			db, err := ethdb.OpenDatabase(engine, filepath.Join(dirname, strconv.Itoa(count)), 0, 0)
+			if err != nil {
+				panic("failed to create test database: " + err.Error())
+			}
+			return db
+		}, func() {
+			os.RemoveAll(dirname)
+		}
+}
+
+func TestLDB_Suite(t *testing.T) {
+	New, remove := newTestEngine(ethdb.EngineLevelDB)
+	defer remove()
+	dbtest.TestDatabaseSuite(t, New)
+}
+
+func TestLSM_Suite(t *testing.T) {
+	New, remove := newTestEngine(ethdb.EngineLSM)
+	defer remove()
+	dbtest.TestDatabaseSuite(t, New)
+}
+
+func TestMemoryDB_Suite(t *testing.T) {
+	dbtest.TestDatabaseSuite(t, func() ethdb.Database {
+		db, _ := ethdb.NewMemDatabase()
+		return db
+	})
+}
+
 var test_values = []string{"", "a", "1251", "\x00123\x00"}
 
 func TestLDB_PutGet(t *testing.T) {
@@ -0,0 +1,463 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package dbtest contains a conformance test suite every ethdb.Database
+// implementation is expected to pass.
+package dbtest
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// TestDatabaseSuite runs the conformance tests against a database implementation.
+// The constructor must return a new, empty database on every call, which the
+// tests close once done.
+func TestDatabaseSuite(t *testing.T, New func() ethdb.Database) {
+	t.Run("PutGet", func(t *testing.T) {
+		db := New()
+		defer db.Close()
+
+		values := []string{"", "a", "1251", "\x00123\x00"}
+		for _, v := range values {
+			if err := db.Put([]byte(v), []byte(v)); err != nil {
+				t.Fatalf("put %q failed: %v", v, err)
+			}
+		}
+		for _, v := range values {
+			data, err := db.Get([]byte(v))
+			if err != nil {
+				t.Fatalf("get %q failed: %v", v, err)
+			}
+			if !bytes.Equal(data, []byte(v)) {
+				t.Fatalf("get %q mismatch: have %q, want %q", v, data, v)
+			}
+			// The returned slice must not alias the stored value
+			if len(data) > 0 {
+				data[0] = 0xff
+				if data, _ := db.Get([]byte(v)); !bytes.Equal(data, []byte(v)) {
+					t.Fatalf("get %q result aliases database: have %q", v, data)
+				}
+			}
+		}
+		for _, v := range values {
+			if err := db.Put([]byte(v), []byte("?")); err != nil {
+				t.Fatalf("put override %q failed: %v", v, err)
+			}
+			if data, err := db.Get([]byte(v)); err != nil || !bytes.Equal(data, []byte("?")) {
+				t.Fatalf("get override %q mismatch: have %q, %v, want %q", v, data, err, "?")
+			}
+		}
+		if _, err := db.Get([]byte("missing")); err == nil {
+			t.Fatalf("get of missing key succeeded")
+		}
+	})
+
+	t.Run("HasDelete", func(t *testing.T) {
+		db := New()
+		defer db.Close()
+
+		key := []byte("key")
+		if has, err := db.Has(key); err != nil || has {
+			t.Fatalf("missing key reported: %v, %v", has, err)
+		}
+		if err := db.Delete(key); err != nil {
+			t.Fatalf("delete of missing key failed: %v", err)
+		}
+		db.Put(key, []byte{})
+		if has, err := db.Has(key); err != nil || !has {
+			t.Fatalf("empty value not reported: %v, %v", has, err)
+		}
+		if err := db.Delete(key); err != nil {
+			t.Fatalf("delete failed: %v", err)
+		}
+		if has, err := db.Has(key); err != nil || has {
+			t.Fatalf("deleted key reported: %v, %v", has, err)
+		}
+		if _, err := db.Get(key); err == nil {
+			t.Fatalf("got deleted key")
+		}
+		// Deleted keys must be writable again
+		db.Put(key, []byte("again"))
+		if data, err := db.Get(key); err != nil || !bytes.Equal(data, []byte("again")) {
+			t.Fatalf("rewritten key mismatch: have %q, %v", data, err)
+		}
+	})
+
+	t.Run("Batch", func(t *testing.T) {
+		db := New()
+		defer db.Close()
+
+		batch := db.NewBatch()
+		for i := 0; i < 100; i++ {
+			if err := batch.Put([]byte(fmt.Sprintf("key%03d", i)), []byte(strconv.Itoa(i))); err != nil {
+				t.Fatalf("batch put failed: %v", err)
+			}
+		}
+		if size := batch.ValueSize(); size != 190 {
+			t.Fatalf("batch value size mismatch: have %d, want %d", size, 190)
+		}
+		if has, _ := db.Has([]byte("key000")); has {
+			t.Fatalf("batch visible before write")
+		}
+		if err := batch.Write(); err != nil {
+			t.Fatalf("batch write failed: %v", err)
+		}
+		for i := 0; i < 100; i++ {
+			data, err := db.Get([]byte(fmt.Sprintf("key%03d", i)))
+			if err != nil || string(data) != strconv.Itoa(i) {
+				t.Fatalf("batched key %d mismatch: have %q, %v", i, data, err)
+			}
+		}
+		// Empty batches must be writable too
+		if err := db.NewBatch().Write(); err != nil {
+			t.Fatalf("empty batch write failed: %v", err)
+		}
+	})
+
+	t.Run("BatchDeleteReplay", func(t *testing.T) {
+		db := New()
+		defer db.Close()
+
+		db.Put([]byte("a"), []byte("1"))
+		db.Put([]byte("b"), []byte("2"))
+
+		batch := db.NewBatch()
+		batch.Put([]byte("c"), []byte("3"))
+		batch.Delete([]byte("a"))
+		if size := batch.ValueSize(); size != 2 {
+			t.Fatalf("batch value size mismatch: have %d, want %d", size, 2)
+		}
+		// Replaying must reproduce the operations in order
+		replica := New()
+		defer replica.Close()
+		replica.Put([]byte("a"), []byte("stale"))
+		if err := batch.Replay(replica); err != nil {
+			t.Fatalf("batch replay failed: %v", err)
+		}
+		if has, _ := replica.Has([]byte("a")); has {
+			t.Fatalf("replayed delete missing")
+		}
+		if data, err := replica.Get([]byte("c")); err != nil || string(data) != "3" {
+			t.Fatalf("replayed put mismatch: have %q, %v", data, err)
+		}
+		if err := batch.Write(); err != nil {
+			t.Fatalf("batch write failed: %v", err)
+		}
+		if has, _ := db.Has([]byte("a")); has {
+			t.Fatalf("batched delete not applied")
+		}
+		// Reset batches must be empty, but reusable
+		batch.Reset()
+		if size := batch.ValueSize(); size != 0 {
+			t.Fatalf("reset batch value size mismatch: have %d, want 0", size)
+		}
+		batch.Put([]byte("d"), []byte("4"))
+		if err := batch.Write(); err != nil {
+			t.Fatalf("reused batch write failed: %v", err)
+		}
+		if data, _ := db.Get([]byte("c")); string(data) != "3" {
+			t.Fatalf("reset batch lost earlier write: have %q", data)
+		}
+		if data, _ := db.Get([]byte("d")); string(data) != "4" {
+			t.Fatalf("reused batch write missing: have %q", data)
+		}
+	})
+
+	t.Run("DeleteRange", func(t *testing.T) {
+		db := New()
+		defer db.Close()
+
+		keys := []string{"a", "b", "b1", "b2", "c", "d"}
+		for _, key := range keys {
+			db.Put([]byte(key), []byte("v"+key))
+		}
+		if err := db.DeleteRange([]byte("b"), []byte("c")); err != nil {
+			t.Fatalf("range delete failed: %v", err)
+		}
+		if have := collectKeys(t, db.NewIterator(nil, nil)); fmt.Sprintf("%q", have) != fmt.Sprintf("%q", []string{"a", "c", "d"}) {
+			t.Fatalf("keys after range delete mismatch: have %q", have)
+		}
+		if err := db.DeleteRange([]byte("c"), nil); err != nil {
+			t.Fatalf("open range delete failed: %v", err)
+		}
+		if have := collectKeys(t, db.NewIterator(nil, nil)); fmt.Sprintf("%q", have) != fmt.Sprintf("%q", []string{"a"}) {
+			t.Fatalf("keys after open range delete mismatch: have %q", have)
+		}
+		// Batches must delete the stored keys as well as the ones they wrote
+		db.Put([]byte("b"), []byte("vb"))
+		batch := db.NewBatch()
+		batch.Put([]byte("b1"), []byte("vb1"))
+		batch.Put([]byte("c"), []byte("vc"))
+		if err := batch.DeleteRange(nil, []byte("c")); err != nil {
+			t.Fatalf("batch range delete failed: %v", err)
+		}
+		batch.Put([]byte("b2"), []byte("vb2"))
+		if has, _ := db.Has([]byte("a")); !has {
+			t.Fatalf("batch range delete visible before write")
+		}
+		if err := batch.Write(); err != nil {
+			t.Fatalf("batch write failed: %v", err)
+		}
+		if have := collectKeys(t, db.NewIterator(nil, nil)); fmt.Sprintf("%q", have) != fmt.Sprintf("%q", []string{"b2", "c"}) {
+			t.Fatalf("keys after batch range delete mismatch: have %q", have)
+		}
+		// Tables must confine range deletions to their prefix
+		db.Put([]byte("t-a"), []byte("1"))
+		db.Put([]byte("t-b"), []byte("2"))
+		db.Put([]byte("u-a"), []byte("3"))
+		table := ethdb.NewTable(db, "t-")
+		if err := table.DeleteRange([]byte("b"), nil); err != nil {
+			t.Fatalf("table range delete failed: %v", err)
+		}
+		batch = table.NewBatch()
+		if err := batch.DeleteRange(nil, nil); err != nil {
+			t.Fatalf("table batch range delete failed: %v", err)
+		}
+		if err := batch.Write(); err != nil {
+			t.Fatalf("table batch write failed: %v", err)
+		}
+		if have := collectKeys(t, db.NewIterator(nil, nil)); fmt.Sprintf("%q", have) != fmt.Sprintf("%q", []string{"b2", "c", "u-a"}) {
+			t.Fatalf("keys after table range delete mismatch: have %q", have)
+		}
+	})
+
+	t.Run("Table", func(t *testing.T) {
+		db := New()
+		defer db.Close()
+
+		db.Put([]byte("key"), []byte("plain"))
+		table := ethdb.NewTable(db, "t-")
+		if _, err := table.Get([]byte("key")); err == nil {
+			t.Fatalf("table sees unprefixed key")
+		}
+		table.Put([]byte("key"), []byte("prefixed"))
+		if data, err := db.Get([]byte("t-key")); err != nil || string(data) != "prefixed" {
+			t.Fatalf("table key not prefixed: have %q, %v", data, err)
+		}
+		batch := table.NewBatch()
+		batch.Put([]byte("batched"), []byte("value"))
+		if err := batch.Write(); err != nil {
+			t.Fatalf("table batch write failed: %v", err)
+		}
+		if has, _ := db.Has([]byte("t-batched")); !has {
+			t.Fatalf("table batch key not prefixed")
+		}
+		table.Delete([]byte("key"))
+		if data, err := db.Get([]byte("key")); err != nil || string(data) != "plain" {
+			t.Fatalf("table delete leaked: have %q, %v", data, err)
+		}
+		table.Put([]byte("key"), []byte("prefixed"))
+		db.Put([]byte("u-key"), []byte("other"))
+
+		// Iteration must stay within the table and strip the prefix
+		if have := collectKeys(t, table.NewIterator(nil, nil)); fmt.Sprintf("%q", have) != fmt.Sprintf("%q", []string{"batched", "key"}) {
+			t.Fatalf("table iteration mismatch: have %q", have)
+		}
+		if have := collectKeys(t, table.NewIterator([]byte("k"), nil)); fmt.Sprintf("%q", have) != fmt.Sprintf("%q", []string{"key"}) {
+			t.Fatalf("table prefix iteration mismatch: have %q", have)
+		}
+		if have := collectKeys(t, table.NewIterator(nil, []byte("c"))); fmt.Sprintf("%q", have) != fmt.Sprintf("%q", []string{"key"}) {
+			t.Fatalf("table start iteration mismatch: have %q", have)
+		}
+
+		// Batch deletions and replays must be prefixed alike
+		batch = table.NewBatch()
+		batch.Delete([]byte("batched"))
+		replica := ethdb.NewTable(db, "r-")
+		if err := batch.Replay(replica); err != nil {
+			t.Fatalf("table batch replay failed: %v", err)
+		}
+		if err := batch.Write(); err != nil {
+			t.Fatalf("table batch write failed: %v", err)
+		}
+		if has, _ := db.Has([]byte("t-batched")); has {
+			t.Fatalf("table batch delete not applied")
+		}
+		if err := table.Compact(nil, nil); err != nil {
+			t.Fatalf("table compaction failed: %v", err)
+		}
+		if data, err := table.Get([]byte("key")); err != nil || string(data) != "prefixed" {
+			t.Fatalf("table key lost by compaction: have %q, %v", data, err)
+		}
+	})
+
+	t.Run("Iterator", func(t *testing.T) {
+		db := New()
+		defer db.Close()
+
+		keys := []string{"c", "a", "bb", "b", "", "d\x00", "d"}
+		for _, key := range keys {
+			db.Put([]byte(key), []byte("v"+key))
+		}
+		db.Put([]byte("x"), []byte("deleted"))
+		db.Delete([]byte("x"))
+		sort.Strings(keys)
+
+		iter := db.NewIterator(nil, nil)
+		var have []string
+		for iter.Next() {
+			if string(iter.Value()) != "v"+string(iter.Key()) {
+				t.Errorf("key %q value mismatch: have %q", iter.Key(), iter.Value())
+			}
+			have = append(have, string(iter.Key()))
+		}
+		if err := iter.Error(); err != nil {
+			t.Fatalf("iteration failed: %v", err)
+		}
+		iter.Release()
+		if fmt.Sprintf("%q", have) != fmt.Sprintf("%q", keys) {
+			t.Fatalf("iterated keys mismatch: have %q, want %q", have, keys)
+		}
+		iter = db.NewIterator(nil, []byte("b\x00"))
+		defer iter.Release()
+		if !iter.Next() || string(iter.Key()) != "bb" {
+			t.Fatalf("start mismatch: have %q", iter.Key())
+		}
+		if !iter.Next() || string(iter.Key()) != "c" {
+			t.Fatalf("next after start mismatch: have %q", iter.Key())
+		}
+		if have := collectKeys(t, db.NewIterator(nil, []byte("y"))); len(have) != 0 {
+			t.Fatalf("start past the end iterated: %q", have)
+		}
+		// Released iterators must be exhausted
+		released := db.NewIterator(nil, nil)
+		released.Release()
+		if released.Next() {
+			t.Fatalf("released iterator advanced: %q", released.Key())
+		}
+	})
+
+	t.Run("IteratorPrefixStart", func(t *testing.T) {
+		db := New()
+		defer db.Close()
+
+		for _, key := range []string{"a", "b", "b1", "b2", "b3", "ba", "c"} {
+			db.Put([]byte(key), []byte("v"+key))
+		}
+		tests := []struct {
+			prefix, start string
+			want          []string
+		}{
+			{"", "", []string{"a", "b", "b1", "b2", "b3", "ba", "c"}},
+			{"b", "", []string{"b", "b1", "b2", "b3", "ba"}},
+			{"b", "2", []string{"b2", "b3", "ba"}},
+			{"b", "z", nil},
+			{"", "b3", []string{"b3", "ba", "c"}},
+			{"d", "", nil},
+		}
+		for i, tt := range tests {
+			have := collectKeys(t, db.NewIterator([]byte(tt.prefix), []byte(tt.start)))
+			if fmt.Sprintf("%q", have) != fmt.Sprintf("%q", tt.want) {
+				t.Errorf("test %d: iterated keys mismatch: have %q, want %q", i, have, tt.want)
+			}
+		}
+	})
+
+	t.Run("StatCompact", func(t *testing.T) {
+		db := New()
+		defer db.Close()
+
+		for i := 0; i < 100; i++ {
+			db.Put([]byte(fmt.Sprintf("key%03d", i)), []byte(strconv.Itoa(i)))
+		}
+		for i := 0; i < 100; i += 2 {
+			db.Delete([]byte(fmt.Sprintf("key%03d", i)))
+		}
+		if _, err := db.Stat("no.such.property"); err == nil {
+			t.Fatalf("unknown property reported")
+		}
+		if err := db.Compact(nil, nil); err != nil {
+			t.Fatalf("compaction failed: %v", err)
+		}
+		if err := db.Compact([]byte("key050"), []byte("key060")); err != nil {
+			t.Fatalf("range compaction failed: %v", err)
+		}
+		if have := collectKeys(t, db.NewIterator(nil, nil)); len(have) != 50 {
+			t.Fatalf("entry count mismatch after compaction: have %d, want %d", len(have), 50)
+		}
+		for i := 1; i < 100; i += 2 {
+			if data, err := db.Get([]byte(fmt.Sprintf("key%03d", i))); err != nil || string(data) != strconv.Itoa(i) {
+				t.Fatalf("key %d lost by compaction: have %q, %v", i, data, err)
+			}
+		}
+	})
+
+	t.Run("Parallel", func(t *testing.T) {
+		db := New()
+		defer db.Close()
+
+		const n = 8
+		var pending sync.WaitGroup
+
+		run := func(op func(key string) error) {
+			errs := make(chan error, n)
+			pending.Add(n)
+			for i := 0; i < n; i++ {
+				go func(key string) {
+					defer pending.Done()
+					errs <- op(key)
+				}(strconv.Itoa(i))
+			}
+			pending.Wait()
+			close(errs)
+			for err := range errs {
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		run(func(key string) error {
+			return db.Put([]byte(key), []byte("v"+key))
+		})
+		run(func(key string) error {
+			data, err := db.Get([]byte(key))
+			if err != nil || !bytes.Equal(data, []byte("v"+key)) {
+				return fmt.Errorf("get %q mismatch: have %q, %v", key, data, err)
+			}
+			return nil
+		})
+		run(func(key string) error {
+			return db.Delete([]byte(key))
+		})
+		run(func(key string) error {
+			if _, err := db.Get([]byte(key)); err == nil {
+				return fmt.Errorf("got deleted key %q", key)
+			}
+			return nil
+		})
+	})
+}
+
+// collectKeys drains an iterator, returning the keys it yielded.
+func collectKeys(t *testing.T, it ethdb.Iterator) []string {
+	defer it.Release()
+
+	var keys []string
+	for it.Next() {
+		keys = append(keys, string(it.Key()))
+	}
+	if err := it.Error(); err != nil {
+		t.Fatalf("iteration failed: %v", err)
+	}
+	return keys
+}
@@ -0,0 +1,70 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethdb
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Persistent key-value store implementations a database can be opened with.
+const (
+	EngineLevelDB = "leveldb" // LevelDB, see NewLDBDatabase
+	EngineLSM     = "lsm"     // Pure Go log-structured merge tree, see NewLSMDatabase
+)
+
+// Engines lists the supported database engines, the default one first.
+var Engines = []string{EngineLevelDB, EngineLSM}
+
+// DetectEngine returns the engine of the database in the given directory, or
+// an empty string if there's no database there.
+func DetectEngine(file string) string {
+	if _, err := os.Stat(filepath.Join(file, lsmManifestName)); err == nil {
+		return EngineLSM
+	}
+	if _, err := os.Stat(filepath.Join(file, "CURRENT")); err == nil {
+		return EngineLevelDB
+	}
+	return ""
+}
+
+// OpenDatabase opens or creates a persistent database in the given directory
+// with the requested engine. If no engine is requested, the one the existing
+// database was created with is used, defaulting to LevelDB for new databases.
+// Requesting an engine different from the existing database's is an error, its
+// content needs to be converted first.
+func OpenDatabase(engine string, file string, cache int, handles int) (Database, error) {
+	existing := DetectEngine(file)
+	switch {
+	case engine == "":
+		engine = existing
+		if engine == "" {
+			engine = Engines[0]
+		}
+	case existing != "" && existing != engine:
+		return nil, fmt.Errorf("database %s uses the %s engine, not %s", file, existing, engine)
+	}
+	switch engine {
+	case EngineLevelDB:
+		return NewLDBDatabase(file, cache, handles)
+	case EngineLSM:
+		return NewLSMDatabase(file, cache, handles)
+	default:
+		return nil, fmt.Errorf("unknown database engine %q", engine)
+	}
+}
@@ -0,0 +1,267 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethdb
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// The ancient store tables, each holding one kind of block data keyed by the
+// canonical block number.
+const (
+	// FreezerHeaderTable indicates the name of the freezer header table.
+	FreezerHeaderTable = "headers"
+
+	// FreezerHashTable indicates the name of the freezer canonical hash table.
+	FreezerHashTable = "hashes"
+
+	// FreezerBodiesTable indicates the name of the freezer block body table.
+	FreezerBodiesTable = "bodies"
+
+	// FreezerReceiptTable indicates the name of the freezer receipts table.
+	FreezerReceiptTable = "receipts"
+
+	// FreezerDifficultyTable indicates the name of the freezer total difficulty table.
+	FreezerDifficultyTable = "diffs"
+)
+
+// FreezerTables lists the tables of the ancient store in the order their items
+// are appended.
+var FreezerTables = []string{FreezerHashTable, FreezerHeaderTable, FreezerBodiesTable, FreezerReceiptTable, FreezerDifficultyTable}
+
+// freezerNoCompression lists the tables whose items are not worth compressing.
+var freezerNoCompression = map[string]bool{
+	FreezerHashTable: true,
+}
+
+// errUnknownTable is returned if the user attempts to read from a table that is
+// not tracked by the freezer.
+var errUnknownTable = errors.New("unknown table")
+
+// Freezer is an append-only database to store immutable chain data into flat
+// files:
+//
+// - The append only nature ensures that disk writes are minimized.
+// - The in-order data ensures that disk reads are always optimized.
+type Freezer struct {
+	frozen uint64 // Number of blocks already frozen (atomic, must be first for alignment)
+
+	path   string
+	tables map[string]*freezerTable // Data tables for storing everything
+}
+
+// NewFreezer creates a chain freezer that moves ancient chain data into
+// append-only flat file containers, snappy compressing them if requested.
+// Existing tables keep the encoding they were created with.
+func NewFreezer(path string, compress bool) (*Freezer, error) {
+	freezer := &Freezer{
+		path:   path,
+		tables: make(map[string]*freezerTable),
+	}
+	for _, name := range FreezerTables {
+		table, err := newTable(path, name, compress && !freezerNoCompression[name])
+		if err != nil {
+			freezer.Close()
+			return nil, err
+		}
+		freezer.tables[name] = table
+	}
+	if err := freezer.repair(); err != nil {
+		freezer.Close()
+		return nil, err
+	}
+	log.Info("Opened ancient database", "path", path, "frozen", freezer.frozen)
+	return freezer, nil
+}
+
+// repair truncates all data tables to the same length, dropping any block that
+// was only partially frozen.
+func (f *Freezer) repair() error {
+	min := uint64(1<<64 - 1)
+	for _, table := range f.tables {
+		if items := table.Items(); items < min {
+			min = items
+		}
+	}
+	for _, table := range f.tables {
+		if err := table.truncate(min); err != nil {
+			return err
+		}
+	}
+	atomic.StoreUint64(&f.frozen, min)
+	return nil
+}
+
+// Close terminates the chain freezer, closing all the data files.
+func (f *Freezer) Close() error {
+	var errs []error
+	for _, table := range f.tables {
+		if err := table.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if errs != nil {
+		return fmt.Errorf("%v", errs)
+	}
+	return nil
+}
+
+// HasAncient returns an indicator whether the specified ancient data exists
+// in the freezer.
+func (f *Freezer) HasAncient(kind string, number uint64) (bool, error) {
+	if table := f.tables[kind]; table != nil {
+		return number < table.Items(), nil
+	}
+	return false, nil
+}
+
+// Ancient retrieves an ancient binary blob from the append-only immutable files.
+func (f *Freezer) Ancient(kind string, number uint64) ([]byte, error) {
+	if table := f.tables[kind]; table != nil {
+		return table.Retrieve(number)
+	}
+	return nil, errUnknownTable
+}
+
+// Ancients returns the length of the frozen items.
+func (f *Freezer) Ancients() (uint64, error) {
+	return atomic.LoadUint64(&f.frozen), nil
+}
+
+// AncientSize returns the ancient size of the specified category.
+func (f *Freezer) AncientSize(kind string) (uint64, error) {
+	if table := f.tables[kind]; table != nil {
+		return table.size(), nil
+	}
+	return 0, errUnknownTable
+}
+
+// AppendAncient injects all binary blobs belonging to a block at the end of the
+// append-only immutable table files. Blocks must be appended in order, and a
+// block failing to be appended to any table is rolled back from all of them.
+func (f *Freezer) AppendAncient(number uint64, hash, header, body, receipts, td []byte) (err error) {
+	if frozen := atomic.LoadUint64(&f.frozen); frozen != number {
+		return errOutOrderInsertion
+	}
+	// Rollback all inserted data if any insertion below failed to ensure the
+	// tables won't go out of sync
+	defer func() {
+		if err != nil {
+			for _, table := range f.tables {
+				if rerr := table.truncate(number); rerr != nil {
+					log.Error("Failed to truncate freezer table", "table", table.name, "err", rerr)
+				}
+			}
+		}
+	}()
+	blobs := map[string][]byte{
+		FreezerHashTable:       hash,
+		FreezerHeaderTable:     header,
+		FreezerBodiesTable:     body,
+		FreezerReceiptTable:    receipts,
+		FreezerDifficultyTable: td,
+	}
+	for _, name := range FreezerTables {
+		if err := f.tables[name].Append(number, blobs[name]); err != nil {
+			log.Error("Failed to append ancient block", "table", name, "number", number, "err", err)
+			return err
+		}
+	}
+	atomic.AddUint64(&f.frozen, 1)
+	return nil
+}
+
+// TruncateAncients discards any recent data above the provided threshold number.
+func (f *Freezer) TruncateAncients(items uint64) error {
+	if atomic.LoadUint64(&f.frozen) <= items {
+		return nil
+	}
+	for _, table := range f.tables {
+		if err := table.truncate(items); err != nil {
+			return err
+		}
+	}
+	atomic.StoreUint64(&f.frozen, items)
+	return nil
+}
+
+// Sync flushes all data tables to disk.
+func (f *Freezer) Sync() error {
+	var errs []error
+	for _, table := range f.tables {
+		if err := table.Sync(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if errs != nil {
+		return fmt.Errorf("%v", errs)
+	}
+	return nil
+}
+
+// FreezerDatabase is a key-value database backed by an ancient store. Blocks
+// older than the immutability threshold are expected to be migrated out of the
+// key-value store into the ancient one.
+type FreezerDatabase struct {
+	Database
+	*Freezer
+
+	threshold uint64
+}
+
+// NewDatabaseWithFreezer creates a high level database on top of a given
+// key-value data store with a freezer moving immutable chain segments into
+// flat files at the given path.
+func NewDatabaseWithFreezer(db Database, path string, threshold uint64, compress bool) (*FreezerDatabase, error) {
+	freezer, err := NewFreezer(path, compress)
+	if err != nil {
+		return nil, err
+	}
+	return &FreezerDatabase{Database: db, Freezer: freezer, threshold: threshold}, nil
+}
+
+// ImmutabilityThreshold returns the number of blocks after which a chain segment
+// is considered immutable and may be frozen.
+func (db *FreezerDatabase) ImmutabilityThreshold() uint64 {
+	return db.threshold
+}
+
+// KeyValueStore returns the key-value store in front of the ancient store.
+func (db *FreezerDatabase) KeyValueStore() Database {
+	return db.Database
+}
+
+// Close terminates both the ancient and the key-value store.
+func (db *FreezerDatabase) Close() {
+	if err := db.Freezer.Close(); err != nil {
+		log.Error("Failed to close ancient database", "err", err)
+	}
+	db.Database.Close()
+}
+
+// KeyValueStore returns the key-value store of a database, unwrapping any ancient
+// store in front of it.
+func KeyValueStore(db Database) Database {
+	if db, ok := db.(*FreezerDatabase); ok {
+		return db.KeyValueStore()
+	}
+	return db
+}
@@ -0,0 +1,311 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/golang/snappy"
+)
+
+var (
+	// errClosed is returned if an operation attempts to read from or write to the
+	// freezer table after it has already been closed.
+	errClosed = errors.New("closed")
+
+	// errOutOfBounds is returned if the item requested is not contained within the
+	// freezer table.
+	errOutOfBounds = errors.New("out of bounds")
+
+	// errOutOrderInsertion is returned if the user attempts to inject out-of-order
+	// binary blobs into the freezer.
+	errOutOrderInsertion = errors.New("the append operation is out-order")
+)
+
+// indexEntrySize is the size of an index entry, the big endian end offset of an
+// item within the data file.
+const indexEntrySize = 8
+
+// freezerTable is an append-only flat file store of sequentially numbered data
+// items. The items are concatenated in a data file, and an index file holds the
+// end offset of every item, so item n spans from the end of item n-1 up to its
+// own end. Items are optionally snappy compressed, which is reflected in the
+// file extensions to never mix up encodings.
+type freezerTable struct {
+	items    uint64 // Number of items stored in the table (atomic, must be first for alignment)
+	dataSize uint64 // Size of the data file, i.e. the end offset of the last item
+
+	name     string
+	compress bool     // Whether items are snappy compressed
+	data     *os.File // Concatenated item data
+	index    *os.File // End offsets of the items
+
+	lock sync.RWMutex // Mutex protecting the files from concurrent access
+	log  log.Logger
+}
+
+// newTable opens a freezer table in the given directory, creating it if missing
+// and repairing any inconsistency left by an unclean shutdown.
+func newTable(path string, name string, compress bool) (*freezerTable, error) {
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return nil, err
+	}
+	// Stick to the encoding of an existing table, as opening it with the other
+	// one would start a new empty table and the repair would drop all items
+	if existing, ok := tableEncoding(path, name); ok && existing != compress {
+		log.Warn("Keeping freezer table encoding", "table", name, "compress", existing)
+		compress = existing
+	}
+	dataExt, indexExt := "rdat", "ridx"
+	if compress {
+		dataExt, indexExt = "cdat", "cidx"
+	}
+	index, err := os.OpenFile(filepath.Join(path, fmt.Sprintf("%s.%s", name, indexExt)), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.OpenFile(filepath.Join(path, fmt.Sprintf("%s.%s", name, dataExt)), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		index.Close()
+		return nil, err
+	}
+	tab := &freezerTable{
+		name:     name,
+		compress: compress,
+		data:     data,
+		index:    index,
+		log:      log.New("table", name),
+	}
+	if err := tab.repair(); err != nil {
+		tab.Close()
+		return nil, err
+	}
+	return tab, nil
+}
+
+// tableEncoding reports whether the table with the given name in a directory
+// is stored snappy compressed, and whether it exists at all.
+func tableEncoding(path string, name string) (compress bool, exists bool) {
+	if _, err := os.Stat(filepath.Join(path, fmt.Sprintf("%s.cidx", name))); err == nil {
+		return true, true
+	}
+	if _, err := os.Stat(filepath.Join(path, fmt.Sprintf("%s.ridx", name))); err == nil {
+		return false, true
+	}
+	return false, false
+}
+
+// repair cross checks the index and data files, truncating them to the items
+// that were completely written.
+func (t *freezerTable) repair() error {
+	stat, err := t.index.Stat()
+	if err != nil {
+		return err
+	}
+	indexSize := stat.Size() - stat.Size()%indexEntrySize
+
+	if stat, err = t.data.Stat(); err != nil {
+		return err
+	}
+	dataSize := uint64(stat.Size())
+
+	// Drop the index entries of items whose data wasn't fully written
+	for indexSize > 0 {
+		end, err := t.indexEntry(indexSize/indexEntrySize - 1)
+		if err != nil {
+			return err
+		}
+		if end <= dataSize {
+			break
+		}
+		indexSize -= indexEntrySize
+	}
+	var end uint64
+	if indexSize > 0 {
+		if end, err = t.indexEntry(indexSize/indexEntrySize - 1); err != nil {
+			return err
+		}
+	}
+	if end != dataSize {
+		t.log.Warn("Truncating dangling freezer data", "indexed", end, "stored", dataSize)
+	}
+	if err := t.index.Truncate(indexSize); err != nil {
+		return err
+	}
+	if err := t.data.Truncate(int64(end)); err != nil {
+		return err
+	}
+	t.items, t.dataSize = uint64(indexSize/indexEntrySize), end
+	return nil
+}
+
+// indexEntry reads the end offset of an item from the index file.
+func (t *freezerTable) indexEntry(item int64) (uint64, error) {
+	var entry [indexEntrySize]byte
+	if _, err := t.index.ReadAt(entry[:], item*indexEntrySize); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(entry[:]), nil
+}
+
+// Items returns the number of items stored in the table.
+func (t *freezerTable) Items() uint64 {
+	return atomic.LoadUint64(&t.items)
+}
+
+// Append injects a binary blob at the end of the freezer table. The item number
+// must be the next one in sequence.
+func (t *freezerTable) Append(item uint64, blob []byte) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.index == nil {
+		return errClosed
+	}
+	if atomic.LoadUint64(&t.items) != item {
+		return errOutOrderInsertion
+	}
+	if t.compress {
+		blob = snappy.Encode(nil, blob)
+	}
+	if _, err := t.data.WriteAt(blob, int64(t.dataSize)); err != nil {
+		return err
+	}
+	var entry [indexEntrySize]byte
+	binary.BigEndian.PutUint64(entry[:], t.dataSize+uint64(len(blob)))
+	if _, err := t.index.WriteAt(entry[:], int64(item)*indexEntrySize); err != nil {
+		return err
+	}
+	t.dataSize += uint64(len(blob))
+	atomic.AddUint64(&t.items, 1)
+	return nil
+}
+
+// Retrieve looks up the data offset of an item and returns its decompressed
+// binary blob.
+func (t *freezerTable) Retrieve(item uint64) ([]byte, error) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	if t.index == nil {
+		return nil, errClosed
+	}
+	if item >= atomic.LoadUint64(&t.items) {
+		return nil, errOutOfBounds
+	}
+	var start uint64
+	if item > 0 {
+		var err error
+		if start, err = t.indexEntry(int64(item) - 1); err != nil {
+			return nil, err
+		}
+	}
+	end, err := t.indexEntry(int64(item))
+	if err != nil {
+		return nil, err
+	}
+	blob := make([]byte, end-start)
+	if _, err := t.data.ReadAt(blob, int64(start)); err != nil {
+		return nil, err
+	}
+	if t.compress {
+		return snappy.Decode(nil, blob)
+	}
+	return blob, nil
+}
+
+// truncate discards any recent items above the provided threshold number.
+func (t *freezerTable) truncate(items uint64) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.index == nil {
+		return errClosed
+	}
+	if atomic.LoadUint64(&t.items) <= items {
+		return nil
+	}
+	var end uint64
+	if items > 0 {
+		var err error
+		if end, err = t.indexEntry(int64(items) - 1); err != nil {
+			return err
+		}
+	}
+	if err := t.index.Truncate(int64(items) * indexEntrySize); err != nil {
+		return err
+	}
+	if err := t.data.Truncate(int64(end)); err != nil {
+		return err
+	}
+	t.dataSize = end
+	atomic.StoreUint64(&t.items, items)
+	return nil
+}
+
+// size returns the total data size in the freezer table, including the index.
+func (t *freezerTable) size() uint64 {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	return t.dataSize + atomic.LoadUint64(&t.items)*indexEntrySize
+}
+
+// Sync pushes any pending data from memory out to disk.
+func (t *freezerTable) Sync() error {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	if t.index == nil {
+		return errClosed
+	}
+	if err := t.index.Sync(); err != nil {
+		return err
+	}
+	return t.data.Sync()
+}
+
+// Close closes all opened files.
+func (t *freezerTable) Close() error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	var errs []error
+	if t.index != nil {
+		if err := t.index.Close(); err != nil {
+			errs = append(errs, err)
+		}
+		t.index = nil
+	}
+	if t.data != nil {
+		if err := t.data.Close(); err != nil {
+			errs = append(errs, err)
+		}
+		t.data = nil
+	}
+	if errs != nil {
+		return fmt.Errorf("%v", errs)
+	}
+	return nil
+}
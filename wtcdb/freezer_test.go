@@ -0,0 +1,263 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethdb
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testFreezerBlob returns the deterministic content of an item in a test table.
+func testFreezerBlob(kind string, number uint64) []byte {
+	return bytes.Repeat([]byte(fmt.Sprintf("%s-%d.", kind, number)), int(number%7)+1)
+}
+
+// fillTestFreezer appends count blocks of test blobs to a freezer.
+func fillTestFreezer(t *testing.T, f *Freezer, count uint64) {
+	frozen, _ := f.Ancients()
+	for n := frozen; n < frozen+count; n++ {
+		err := f.AppendAncient(n, testFreezerBlob(FreezerHashTable, n), testFreezerBlob(FreezerHeaderTable, n),
+			testFreezerBlob(FreezerBodiesTable, n), testFreezerBlob(FreezerReceiptTable, n), testFreezerBlob(FreezerDifficultyTable, n))
+		if err != nil {
+			t.Fatalf("failed to append block %d: %v", n, err)
+		}
+	}
+}
+
+// checkTestFreezer verifies that a freezer contains exactly count test blocks.
+func checkTestFreezer(t *testing.T, f *Freezer, count uint64) {
+	if frozen, _ := f.Ancients(); frozen != count {
+		t.Fatalf("frozen count mismatch: have %d, want %d", frozen, count)
+	}
+	for _, kind := range FreezerTables {
+		for n := uint64(0); n < count; n++ {
+			blob, err := f.Ancient(kind, n)
+			if err != nil {
+				t.Fatalf("%s #%d: failed to retrieve: %v", kind, n, err)
+			}
+			if want := testFreezerBlob(kind, n); !bytes.Equal(blob, want) {
+				t.Fatalf("%s #%d: blob mismatch: have %x, want %x", kind, n, blob, want)
+			}
+		}
+		if ok, _ := f.HasAncient(kind, count); ok {
+			t.Errorf("%s #%d: reported present beyond frozen count", kind, count)
+		}
+		if _, err := f.Ancient(kind, count); err != errOutOfBounds {
+			t.Errorf("%s #%d: retrieval error mismatch: have %v, want %v", kind, count, err, errOutOfBounds)
+		}
+	}
+}
+
+// Tests that blocks can be appended to the freezer and read back, both with and
+// without compression, also after reopening it.
+func TestFreezerAppendRetrieve(t *testing.T) {
+	testFreezerAppendRetrieve(t, false)
+	testFreezerAppendRetrieve(t, true)
+}
+
+func testFreezerAppendRetrieve(t *testing.T, compress bool) {
+	dir, err := ioutil.TempDir("", "freezer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	f, err := NewFreezer(dir, compress)
+	if err != nil {
+		t.Fatalf("failed to create freezer: %v", err)
+	}
+	fillTestFreezer(t, f, 100)
+	checkTestFreezer(t, f, 100)
+	f.Close()
+
+	if f, err = NewFreezer(dir, compress); err != nil {
+		t.Fatalf("failed to reopen freezer: %v", err)
+	}
+	defer f.Close()
+	checkTestFreezer(t, f, 100)
+}
+
+// Tests that compressed and uncompressed tables are stored in distinct files.
+func TestFreezerCompressedFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "freezer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	f, err := NewFreezer(dir, true)
+	if err != nil {
+		t.Fatalf("failed to create freezer: %v", err)
+	}
+	defer f.Close()
+
+	for _, file := range []string{"hashes.rdat", "hashes.ridx", "headers.cdat", "headers.cidx", "bodies.cdat", "receipts.cdat", "diffs.cdat"} {
+		if _, err := os.Stat(filepath.Join(dir, file)); err != nil {
+			t.Errorf("table file %s missing: %v", file, err)
+		}
+	}
+}
+
+// Tests that reopening a populated freezer with the other compression setting
+// keeps using the existing tables instead of dropping their items.
+func TestFreezerCompressionToggle(t *testing.T) {
+	testFreezerCompressionToggle(t, false)
+	testFreezerCompressionToggle(t, true)
+}
+
+func testFreezerCompressionToggle(t *testing.T, compress bool) {
+	dir, err := ioutil.TempDir("", "freezer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	f, err := NewFreezer(dir, compress)
+	if err != nil {
+		t.Fatalf("failed to create freezer: %v", err)
+	}
+	fillTestFreezer(t, f, 100)
+	f.Close()
+
+	if f, err = NewFreezer(dir, !compress); err != nil {
+		t.Fatalf("failed to reopen freezer: %v", err)
+	}
+	checkTestFreezer(t, f, 100)
+	fillTestFreezer(t, f, 10)
+	f.Close()
+
+	if f, err = NewFreezer(dir, compress); err != nil {
+		t.Fatalf("failed to reopen freezer: %v", err)
+	}
+	defer f.Close()
+	checkTestFreezer(t, f, 110)
+
+	unused := "cdat"
+	if compress {
+		unused = "rdat"
+	}
+	if _, err := os.Stat(filepath.Join(dir, fmt.Sprintf("%s.%s", FreezerHeaderTable, unused))); err == nil {
+		t.Errorf("table created with the other encoding")
+	}
+}
+
+// Tests that blocks can only be appended in order.
+func TestFreezerOutOfOrder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "freezer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	f, err := NewFreezer(dir, true)
+	if err != nil {
+		t.Fatalf("failed to create freezer: %v", err)
+	}
+	defer f.Close()
+
+	fillTestFreezer(t, f, 10)
+	for _, number := range []uint64{0, 9, 11} {
+		if err := f.AppendAncient(number, nil, nil, nil, nil, nil); err != errOutOrderInsertion {
+			t.Errorf("block %d: append error mismatch: have %v, want %v", number, err, errOutOrderInsertion)
+		}
+	}
+	checkTestFreezer(t, f, 10)
+}
+
+// Tests that truncating the freezer discards the recent blocks and appending can
+// continue from the truncation point.
+func TestFreezerTruncate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "freezer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	f, err := NewFreezer(dir, true)
+	if err != nil {
+		t.Fatalf("failed to create freezer: %v", err)
+	}
+	defer f.Close()
+
+	fillTestFreezer(t, f, 50)
+	if err := f.TruncateAncients(60); err != nil {
+		t.Fatalf("failed to truncate above the frozen count: %v", err)
+	}
+	checkTestFreezer(t, f, 50)
+
+	if err := f.TruncateAncients(20); err != nil {
+		t.Fatalf("failed to truncate: %v", err)
+	}
+	checkTestFreezer(t, f, 20)
+
+	fillTestFreezer(t, f, 30)
+	checkTestFreezer(t, f, 50)
+}
+
+// Tests that a freezer whose tables went out of sync, or whose files were only
+// partially written before a crash, is repaired on startup to the blocks fully
+// stored in every table.
+func TestFreezerRepair(t *testing.T) {
+	dir, err := ioutil.TempDir("", "freezer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	f, err := NewFreezer(dir, false)
+	if err != nil {
+		t.Fatalf("failed to create freezer: %v", err)
+	}
+	fillTestFreezer(t, f, 30)
+	f.Close()
+
+	// Drop the last block from one table, and tear the tail of another
+	table, err := newTable(dir, FreezerBodiesTable, false)
+	if err != nil {
+		t.Fatalf("failed to open table: %v", err)
+	}
+	table.truncate(29)
+	table.Close()
+
+	data := filepath.Join(dir, FreezerReceiptTable+".rdat")
+	stat, err := os.Stat(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(data, stat.Size()-int64(len(testFreezerBlob(FreezerReceiptTable, 29)))-1); err != nil {
+		t.Fatal(err)
+	}
+	index := filepath.Join(dir, FreezerHeaderTable+".ridx")
+	if stat, err = os.Stat(index); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(index, stat.Size()-3); err != nil {
+		t.Fatal(err)
+	}
+	if f, err = NewFreezer(dir, false); err != nil {
+		t.Fatalf("failed to reopen freezer: %v", err)
+	}
+	defer f.Close()
+
+	checkTestFreezer(t, f, 28)
+	fillTestFreezer(t, f, 2)
+	checkTestFreezer(t, f, 30)
+}
@@ -25,12 +25,85 @@ type Putter interface {
 	Put(key []byte, value []byte) error
 }
 
+// Deleter wraps the database delete operation supported by both batches and regular databases.
+type Deleter interface {
+	Delete(key []byte) error
+}
+
+// RangeDeleter wraps the range delete operation supported by both batches and
+// regular databases.
+type RangeDeleter interface {
+	// DeleteRange deletes all the keys in the range [start, limit), a nil start
+	// meaning before all keys and a nil limit after all keys. Batches delete the
+	// keys present in the database or written into the batch when the range
+	// deletion is queued, while databases delete the range in multiple batches.
+	DeleteRange(start []byte, limit []byte) error
+}
+
+// Writer wraps the write operations supported by both batches and regular databases.
+type Writer interface {
+	Putter
+	Deleter
+	RangeDeleter
+}
+
+// Iterator iterates over the key/value pairs of a database in ascending key
+// order. It must be released after use.
+type Iterator interface {
+	// Next moves the iterator to the next key/value pair. It returns false if the
+	// iterator is exhausted.
+	Next() bool
+
+	// Error returns any accumulated error. Exhausting all the key/value pairs is
+	// not considered to be an error.
+	Error() error
+
+	// Key returns the key of the current key/value pair, or nil if done. The
+	// caller should not modify the contents of the returned slice, and its
+	// contents may change on the next call to Next.
+	Key() []byte
+
+	// Value returns the value of the current key/value pair, or nil if done. The
+	// caller should not modify the contents of the returned slice, and its
+	// contents may change on the next call to Next.
+	Value() []byte
+
+	// Release releases the associated resources. It can be called multiple times
+	// without causing an error.
+	Release()
+}
+
+// Iteratee wraps the NewIterator method of a database.
+type Iteratee interface {
+	// NewIterator creates an iterator over the entries with a particular key
+	// prefix in ascending key order, starting at a particular key relative to the
+	// prefix (or the one after it if absent). Both may be nil.
+	NewIterator(prefix []byte, start []byte) Iterator
+}
+
+// Stater wraps the Stat method of a database.
+type Stater interface {
+	// Stat returns a particular internal stat of the database, an error if the
+	// property is unknown to the engine.
+	Stat(property string) (string, error)
+}
+
+// Compacter wraps the Compact method of a database.
+type Compacter interface {
+	// Compact flattens the underlying data store for the given key range, a nil
+	// start meaning before all keys and a nil limit after all keys. Deleted and
+	// overwritten data is discarded, which may take a long time.
+	Compact(start []byte, limit []byte) error
+}
+
 // Database wraps all database operations. All methods are safe for concurrent use.
 type Database interface {
-	Putter
+	Writer
+	Iteratee
+	Stater
+	Compacter
 	Get(key []byte) ([]byte, error)
 	Has(key []byte) (bool, error)
-	Delete(key []byte) error
 	Close()
 	NewBatch() Batch
 }
@@ -38,7 +111,53 @@ type Database interface {
 // Batch is a write-only database that commits changes to its host database
 // when Write is called. Batch cannot be used concurrently.
 type Batch interface {
-	Putter
+	Writer
 	ValueSize() int // amount of data in the batch
 	Write() error
+
+	// Reset resets the batch for reuse.
+	Reset()
+
+	// Replay replays the batch contents into a writer.
+	Replay(w Writer) error
+}
+
+// AncientReader contains the methods required to read from immutable ancient data.
+type AncientReader interface {
+	// HasAncient returns an indicator whether the specified data exists in the
+	// ancient store.
+	HasAncient(kind string, number uint64) (bool, error)
+
+	// Ancient retrieves an ancient binary blob from the append-only immutable files.
+	Ancient(kind string, number uint64) ([]byte, error)
+
+	// Ancients returns the ancient item numbers in the ancient store.
+	Ancients() (uint64, error)
+
+	// AncientSize returns the ancient size of the specified category.
+	AncientSize(kind string) (uint64, error)
+}
+
+// AncientWriter contains the methods required to write to immutable ancient data.
+type AncientWriter interface {
+	// AppendAncient injects all binary blobs belonging to block at the end of the
+	// append-only immutable table files.
+	AppendAncient(number uint64, hash, header, body, receipts, td []byte) error
+
+	// TruncateAncients discards all but the first n ancient data from the ancient store.
+	TruncateAncients(n uint64) error
+
+	// Sync flushes all in-memory ancient store data to disk.
+	Sync() error
+}
+
+// AncientStore contains all the methods required to allow handling different
+// ancient data stores backing immutable chain data store.
+type AncientStore interface {
+	AncientReader
+	AncientWriter
+
+	// ImmutabilityThreshold returns the number of blocks after which a chain
+	// segment is considered immutable and may be frozen.
+	ImmutabilityThreshold() uint64
 }
@@ -0,0 +1,1014 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethdb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/prometheus/prometheus/util/flock"
+	"github.com/syndtr/goleveldb/leveldb/comparer"
+	"github.com/syndtr/goleveldb/leveldb/memdb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+
+	gometrics "github.com/rcrowley/go-metrics"
+)
+
+const (
+	lsmManifestName    = "LSM-MANIFEST" // File listing the live tables and journal of the database
+	lsmManifestVersion = 1              // Version of the manifest and table formats
+	lsmMergeRatio      = 2              // Size ratio under which neighbouring tables are merged
+	lsmJournalHeader   = 8              // Size of the journal record header: checksum and length
+)
+
+var (
+	// errNotFound is returned if a key is requested that is not found in the
+	// database.
+	errNotFound = errors.New("not found")
+
+	// errLSMClosed is returned if an operation is attempted on a closed database.
+	errLSMClosed = errors.New("database closed")
+
+	// errLSMIterReleased is returned if a released iterator is moved.
+	errLSMIterReleased = errors.New("iterator released")
+)
+
+// LSMDatabase is a pure Go log-structured merge tree key-value store, an
+// alternative to LevelDB. Writes are appended to a journal and collected in a
+// sorted memtable, which is flushed into an immutable sorted table file once
+// full. Reads consult the memtable and then the tables from newest to oldest,
+// skipping those whose bloom filter excludes the key. Neighbouring tables of
+// similar size are merged in the background, keeping the number of tables
+// logarithmic in the database size.
+type LSMDatabase struct {
+	fn    string         // filename for reporting
+	flock flock.Releaser // File lock preventing concurrent use of the database
+
+	writeLock   sync.Mutex // Lock serializing writes to the journal and the memtable
+	journal     *os.File   // Write-ahead log of the memtable, nil once closed
+	memSize     int        // Size of the data written into the memtable
+	writeBuffer int        // Memtable size after which it's flushed into a table
+
+	lock       sync.RWMutex // Lock protecting the memtable and table set swaps
+	mem        *memdb.DB    // Memtable collecting the writes since the last flush
+	tables     []*lsmTable  // Immutable tables of the database, newest first
+	journalNum uint64       // File number of the journal
+	nextNum    uint64       // Next unused file number
+	closed     bool         // Flag whether the database was closed
+
+	compactLock sync.Mutex     // Lock serializing table merges
+	compactChan chan struct{}  // Channel to signal new tables to the compactor
+	quitChan    chan struct{}  // Quit channel to stop the compactor before closing the database
+	compactWg   sync.WaitGroup // Wait group to wait for the compactor to stop
+
+	getTimer       gometrics.Timer // Timer for measuring the database get request counts and latencies
+	putTimer       gometrics.Timer // Timer for measuring the database put request counts and latencies
+	delTimer       gometrics.Timer // Timer for measuring the database delete request counts and latencies
+	missMeter      gometrics.Meter // Meter for measuring the missed database get requests
+	readMeter      gometrics.Meter // Meter for measuring the database get request data usage
+	writeMeter     gometrics.Meter // Meter for measuring the database put request data usage
+	compTimeMeter  gometrics.Meter // Meter for measuring the total time spent in database compaction
+	compReadMeter  gometrics.Meter // Meter for measuring the data read during compaction
+	compWriteMeter gometrics.Meter // Meter for measuring the data written during compaction
+
+	log log.Logger // Contextual logger tracking the database path
+}
+
+// NewLSMDatabase opens or creates an LSM database in the given directory. Half
+// of the cache allowance (in megabytes) is used for the memtable, and tables are
+// kept open for the lifetime of the database, so the number of file handles is
+// only accepted for parity with NewLDBDatabase.
+func NewLSMDatabase(file string, cache int, handles int) (*LSMDatabase, error) {
+	logger := log.New("database", file)
+
+	// Ensure we have some minimal caching
+	if cache < 16 {
+		cache = 16
+	}
+	// Refuse to open a LevelDB database, the two don't mix
+	if err := os.MkdirAll(file, 0755); err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(filepath.Join(file, "CURRENT")); err == nil {
+		if _, err := os.Stat(filepath.Join(file, lsmManifestName)); err != nil {
+			return nil, fmt.Errorf("%s holds a LevelDB database", file)
+		}
+	}
+	lock, _, err := flock.New(filepath.Join(file, "LOCK"))
+	if err != nil {
+		return nil, err
+	}
+	db := &LSMDatabase{
+		fn:          file,
+		flock:       lock,
+		writeBuffer: cache / 2 * 1024 * 1024,
+		mem:         memdb.New(comparer.DefaultComparer, 0),
+		compactChan: make(chan struct{}, 1),
+		quitChan:    make(chan struct{}),
+		log:         logger,
+	}
+	if err := db.load(); err != nil {
+		for _, t := range db.tables {
+			t.unref()
+		}
+		if db.journal != nil {
+			db.journal.Close()
+		}
+		lock.Release()
+		return nil, err
+	}
+	db.compactWg.Add(1)
+	go db.compactLoop()
+
+	// Merge any tables left unmerged by the last run
+	select {
+	case db.compactChan <- struct{}{}:
+	default:
+	}
+	return db, nil
+}
+
+// load opens the tables listed in the manifest, removes leftover files and
+// replays the journal into the memtable.
+func (db *LSMDatabase) load() error {
+	journalNum, nextNum, nums, err := readLSMManifest(db.fn)
+	if os.IsNotExist(err) {
+		journalNum, nextNum, err = 1, 2, writeLSMManifest(db.fn, 1, 2, nil)
+	}
+	if err != nil {
+		return err
+	}
+	db.journalNum, db.nextNum = journalNum, nextNum
+
+	live := map[string]bool{db.filePath(journalNum, "journal"): true}
+	for _, num := range nums {
+		t, err := openLSMTable(num, db.filePath(num, "table"))
+		if err != nil {
+			return err
+		}
+		db.tables = append(db.tables, t)
+		live[t.path] = true
+	}
+	// Delete the tables and journals of interrupted flushes and compactions
+	files, err := ioutil.ReadDir(db.fn)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		path := filepath.Join(db.fn, file.Name())
+		if (strings.HasSuffix(path, ".table") || strings.HasSuffix(path, ".journal") || strings.HasSuffix(path, ".tmp")) && !live[path] {
+			db.log.Debug("Removing leftover database file", "file", file.Name())
+			os.Remove(path)
+		}
+	}
+	// Replay the journal, cutting off any torn write at its end
+	if db.journal, err = os.OpenFile(db.filePath(journalNum, "journal"), os.O_CREATE|os.O_RDWR, 0644); err != nil {
+		return err
+	}
+	offset, err := db.replay()
+	if err != nil {
+		db.log.Warn("Truncating damaged database journal", "offset", offset, "err", err)
+		if err := db.journal.Truncate(offset); err != nil {
+			return err
+		}
+	}
+	if _, err := db.journal.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	if db.memSize >= db.writeBuffer {
+		return db.flush()
+	}
+	return nil
+}
+
+// replay applies the records of the journal to the memtable, returning the
+// offset after the last intact record.
+func (db *LSMDatabase) replay() (int64, error) {
+	reader := bufio.NewReader(db.journal)
+
+	var (
+		offset int64
+		header = make([]byte, lsmJournalHeader)
+	)
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			if err == io.EOF {
+				return offset, nil
+			}
+			return offset, err
+		}
+		ops := make([]byte, binary.BigEndian.Uint32(header[4:]))
+		if _, err := io.ReadFull(reader, ops); err != nil {
+			return offset, err
+		}
+		if crc32.Checksum(ops, lsmCRCTable) != binary.BigEndian.Uint32(header) {
+			return offset, errors.New("journal record checksum mismatch")
+		}
+		if err := decodeLSMOps(ops, db.mem.Put); err != nil {
+			return offset, err
+		}
+		db.memSize += len(ops)
+		offset += int64(len(header) + len(ops))
+	}
+}
+
+// filePath returns the path of a numbered database file.
+func (db *LSMDatabase) filePath(num uint64, kind string) string {
+	return filepath.Join(db.fn, fmt.Sprintf("%06d.%s", num, kind))
+}
+
+// Path returns the path to the database directory.
+func (db *LSMDatabase) Path() string {
+	return db.fn
+}
+
+// Put puts the given key / value into the database.
+func (db *LSMDatabase) Put(key []byte, value []byte) error {
+	// Measure the database put latency, if requested
+	if db.putTimer != nil {
+		defer db.putTimer.UpdateSince(time.Now())
+	}
+	if db.writeMeter != nil {
+		db.writeMeter.Mark(int64(len(value)))
+	}
+	return db.write(appendLSMOp(nil, key, lsmValue, value))
+}
+
+// Has retrieves whether a key is present in the database.
+func (db *LSMDatabase) Has(key []byte) (bool, error) {
+	_, err := db.get(key)
+	if err == errNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Get returns the given key if it's present.
+func (db *LSMDatabase) Get(key []byte) ([]byte, error) {
+	// Measure the database get latency, if requested
+	if db.getTimer != nil {
+		defer db.getTimer.UpdateSince(time.Now())
+	}
+	// Retrieve the key and increment the miss counter if not found
+	dat, err := db.get(key)
+	if err != nil {
+		if db.missMeter != nil {
+			db.missMeter.Mark(1)
+		}
+		return nil, err
+	}
+	// Otherwise update the actually retrieved amount of data
+	if db.readMeter != nil {
+		db.readMeter.Mark(int64(len(dat)))
+	}
+	return dat, nil
+}
+
+// get looks a key up in the memtable and then in the tables from the newest to
+// the oldest, the first entry found being the live one.
+func (db *LSMDatabase) get(key []byte) ([]byte, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if db.closed {
+		return nil, errLSMClosed
+	}
+	if value, err := db.mem.Get(key); err == nil {
+		return unflagLSMValue(value)
+	}
+	for _, t := range db.tables {
+		value, err := t.get(key)
+		if err != nil {
+			return nil, err
+		}
+		if value != nil {
+			return unflagLSMValue(value)
+		}
+	}
+	return nil, errNotFound
+}
+
+// Delete deletes the key from the database.
+func (db *LSMDatabase) Delete(key []byte) error {
+	// Measure the database delete latency, if requested
+	if db.delTimer != nil {
+		defer db.delTimer.UpdateSince(time.Now())
+	}
+	return db.write(appendLSMOp(nil, key, lsmDeleted, nil))
+}
+
+// DeleteRange deletes all the keys in the range [start, limit) from the database.
+func (db *LSMDatabase) DeleteRange(start []byte, limit []byte) error {
+	return deleteDatabaseRange(db, start, limit)
+}
+
+// write atomically journals a set of encoded operations and applies them to
+// the memtable, flushing it into a new table if it's full.
+func (db *LSMDatabase) write(ops []byte) error {
+	db.writeLock.Lock()
+	defer db.writeLock.Unlock()
+
+	if db.journal == nil {
+		return errLSMClosed
+	}
+	record := make([]byte, lsmJournalHeader+len(ops))
+	binary.BigEndian.PutUint32(record, crc32.Checksum(ops, lsmCRCTable))
+	binary.BigEndian.PutUint32(record[4:], uint32(len(ops)))
+	copy(record[lsmJournalHeader:], ops)
+
+	if _, err := db.journal.Write(record); err != nil {
+		return err
+	}
+	if err := decodeLSMOps(ops, db.mem.Put); err != nil {
+		return err
+	}
+	db.memSize += len(ops)
+	if db.memSize >= db.writeBuffer {
+		return db.flush()
+	}
+	return nil
+}
+
+// flush writes the memtable into a new table and starts a new memtable and
+// journal. The caller must hold the write lock.
+func (db *LSMDatabase) flush() error {
+	if db.mem.Len() == 0 {
+		return nil
+	}
+	db.lock.Lock()
+	tableNum, journalNum := db.nextNum, db.nextNum+1
+	db.nextNum += 2
+	db.lock.Unlock()
+
+	it := db.mem.NewIterator(nil)
+	t, err := db.writeTable(tableNum, it, false)
+	it.Release()
+	if err != nil {
+		return err
+	}
+	journal, err := os.OpenFile(db.filePath(journalNum, "journal"), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		t.drop()
+		return err
+	}
+	// Atomically switch over to the new table and journal
+	db.lock.Lock()
+	tables := append([]*lsmTable{t}, db.tables...)
+	if err := writeLSMManifest(db.fn, journalNum, db.nextNum, tables); err != nil {
+		db.lock.Unlock()
+		journal.Close()
+		os.Remove(journal.Name())
+		t.drop()
+		return err
+	}
+	oldNum := db.journalNum
+	db.tables, db.mem, db.journalNum = tables, memdb.New(comparer.DefaultComparer, 0), journalNum
+	db.lock.Unlock()
+
+	db.journal.Close()
+	os.Remove(db.filePath(oldNum, "journal"))
+	db.journal, db.memSize = journal, 0
+
+	// Notify the compactor of the new table
+	select {
+	case db.compactChan <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// writeTable writes the flagged entries of an iterator into a new table. Tombstones
+// are dropped if requested, which is only allowed if no older table remains that
+// they may shadow. The write is aborted if the database is closed meanwhile.
+func (db *LSMDatabase) writeTable(num uint64, it lsmSource, dropDeleted bool) (*lsmTable, error) {
+	path := db.filePath(num, "table")
+	writer, err := newLSMTableWriter(path)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; it.Next(); i++ {
+		if i%1024 == 0 {
+			select {
+			case <-db.quitChan:
+				writer.abort()
+				return nil, errLSMClosed
+			default:
+			}
+		}
+		if value := it.Value(); !dropDeleted || value[0] != lsmDeleted {
+			if err := writer.add(it.Key(), value); err != nil {
+				writer.abort()
+				return nil, err
+			}
+		}
+	}
+	if err := it.Error(); err != nil {
+		writer.abort()
+		return nil, err
+	}
+	if _, err := writer.finish(); err != nil {
+		writer.abort()
+		return nil, err
+	}
+	return openLSMTable(num, path)
+}
+
+// compactLoop merges tables whenever new ones are flushed, until the database
+// is closed.
+func (db *LSMDatabase) compactLoop() {
+	defer db.compactWg.Done()
+
+	for {
+		select {
+		case <-db.compactChan:
+			for {
+				done, err := db.compact()
+				if err != nil {
+					if err != errLSMClosed {
+						db.log.Error("Database compaction failed", "err", err)
+					}
+					break
+				}
+				if done {
+					break
+				}
+			}
+		case <-db.quitChan:
+			return
+		}
+	}
+}
+
+// compact merges the newest run of tables whose combined size is comparable to
+// the size of the next older one, returning whether there was nothing to merge.
+func (db *LSMDatabase) compact() (bool, error) {
+	db.compactLock.Lock()
+	defer db.compactLock.Unlock()
+
+	db.lock.RLock()
+	tables := make([]*lsmTable, len(db.tables))
+	copy(tables, db.tables)
+	db.lock.RUnlock()
+
+	run := tables[:pickLSMCompaction(tables)]
+	if len(run) < 2 {
+		return true, nil
+	}
+	if err := db.merge(run, len(run) == len(tables)); err != nil {
+		return true, err
+	}
+	return false, nil
+}
+
+// merge replaces a run of neighbouring tables, newest first, with a single
+// table holding their merged content, dropping tombstones if the run reaches
+// the oldest table. The caller must hold the compaction lock.
+func (db *LSMDatabase) merge(run []*lsmTable, dropDeleted bool) error {
+	start := time.Now()
+
+	db.lock.Lock()
+	num := db.nextNum
+	db.nextNum++
+	db.lock.Unlock()
+
+	var (
+		sources = make([]lsmSource, len(run))
+		read    uint64
+	)
+	for i, t := range run {
+		sources[i] = t.newIterator()
+		read += t.size
+	}
+	t, err := db.writeTable(num, newLSMMergeIterator(sources, true), dropDeleted)
+	if err != nil {
+		return err
+	}
+	// Replace the merged run, which flushes may have pushed back but not altered
+	db.lock.Lock()
+	if db.closed {
+		db.lock.Unlock()
+		t.drop()
+		return errLSMClosed
+	}
+	idx := 0
+	for db.tables[idx] != run[0] {
+		idx++
+	}
+	merged := append(append(append([]*lsmTable{}, db.tables[:idx]...), t), db.tables[idx+len(run):]...)
+	if err := writeLSMManifest(db.fn, db.journalNum, db.nextNum, merged); err != nil {
+		db.lock.Unlock()
+		t.drop()
+		return err
+	}
+	db.tables = merged
+	timeMeter, readMeter, writeMeter := db.compTimeMeter, db.compReadMeter, db.compWriteMeter
+	db.lock.Unlock()
+
+	for _, old := range run {
+		old.drop()
+	}
+	if timeMeter != nil {
+		timeMeter.Mark(int64(time.Since(start)))
+		readMeter.Mark(int64(read))
+		writeMeter.Mark(int64(t.size))
+	}
+	db.log.Debug("Merged database tables", "tables", len(run), "entries", t.entries, "size", common.StorageSize(t.size), "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// pickLSMCompaction returns the number of newest tables to merge: those whose
+// combined size, scaled by the merge ratio, reaches the size of the next one.
+func pickLSMCompaction(tables []*lsmTable) int {
+	if len(tables) == 0 {
+		return 0
+	}
+	n, total := 1, tables[0].size
+	for n < len(tables) && total*lsmMergeRatio >= tables[n].size {
+		total += tables[n].size
+		n++
+	}
+	return n
+}
+
+// NewIterator creates an iterator over the entries with a particular key prefix,
+// starting at a particular key relative to the prefix, in ascending key order.
+// The tables are pinned for the lifetime of the iterator, but writes made after
+// its creation may or may not be visible to it. Only forward iteration is
+// supported.
+func (db *LSMDatabase) NewIterator(prefix []byte, start []byte) Iterator {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if db.closed {
+		it := newLSMMergeIterator(nil, false)
+		it.err = errLSMClosed
+		return it
+	}
+	sources := []lsmSource{db.mem.NewIterator(nil)}
+	for _, t := range db.tables {
+		t.ref()
+		sources = append(sources, t.newIterator())
+	}
+	it := newLSMMergeIterator(sources, false)
+	it.tables = append([]*lsmTable{}, db.tables...)
+	it.slice = bytesPrefixRange(prefix, start)
+	return it
+}
+
+// Stat returns a particular internal stat of the database. The only property
+// supported is "lsm.stats", listing the memtable and the tables.
+func (db *LSMDatabase) Stat(property string) (string, error) {
+	if property != "lsm.stats" {
+		return "", fmt.Errorf("unknown property %q", property)
+	}
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if db.closed {
+		return "", errLSMClosed
+	}
+	var (
+		stats   bytes.Buffer
+		entries uint64
+		size    uint64
+	)
+	fmt.Fprintf(&stats, "Memtable: %d entries, %v\n", db.mem.Len(), common.StorageSize(db.mem.Size()))
+	fmt.Fprintf(&stats, "Tables (newest first):\n")
+	for _, t := range db.tables {
+		fmt.Fprintf(&stats, "  %06d.table: %d entries, %v\n", t.num, t.entries, common.StorageSize(t.size))
+		entries += t.entries
+		size += t.size
+	}
+	fmt.Fprintf(&stats, "Total: %d tables, %d entries, %v\n", len(db.tables), entries, common.StorageSize(size))
+	return stats.String(), nil
+}
+
+// Compact flushes the memtable and merges all the tables into one, dropping the
+// overwritten entries and tombstones. Tables span the entire key space, so the
+// given key range is not narrowed down to, but compacting an already merged
+// database is a no-op.
+func (db *LSMDatabase) Compact(start []byte, limit []byte) error {
+	db.writeLock.Lock()
+	if db.journal == nil {
+		db.writeLock.Unlock()
+		return errLSMClosed
+	}
+	err := db.flush()
+	db.writeLock.Unlock()
+	if err != nil {
+		return err
+	}
+	db.compactLock.Lock()
+	defer db.compactLock.Unlock()
+
+	db.lock.RLock()
+	if db.closed {
+		db.lock.RUnlock()
+		return errLSMClosed
+	}
+	tables := make([]*lsmTable, len(db.tables))
+	copy(tables, db.tables)
+	db.lock.RUnlock()
+
+	if len(tables) < 2 {
+		return nil
+	}
+	return db.merge(tables, true)
+}
+
+// Close stops the background compaction and closes all the database files.
+func (db *LSMDatabase) Close() {
+	db.writeLock.Lock()
+	defer db.writeLock.Unlock()
+
+	if db.journal == nil {
+		return
+	}
+	close(db.quitChan)
+	db.compactWg.Wait()
+
+	// Wait for any requested compaction to abort
+	db.compactLock.Lock()
+	db.compactLock.Unlock()
+
+	db.lock.Lock()
+	tables := db.tables
+	db.tables, db.closed = nil, true
+	db.lock.Unlock()
+
+	for _, t := range tables {
+		t.unref()
+	}
+	if err := db.journal.Close(); err != nil {
+		db.log.Error("Failed to close database journal", "err", err)
+	}
+	db.journal = nil
+
+	if err := db.flock.Release(); err != nil {
+		db.log.Error("Failed to release database lock", "err", err)
+	}
+}
+
+// Meter configures the database metrics collectors.
+func (db *LSMDatabase) Meter(prefix string) {
+	// Short circuit metering if the metrics system is disabled
+	if !metrics.Enabled {
+		return
+	}
+	// Initialize all the metrics collector at the requested prefix
+	db.getTimer = metrics.NewTimer(prefix + "user/gets")
+	db.putTimer = metrics.NewTimer(prefix + "user/puts")
+	db.delTimer = metrics.NewTimer(prefix + "user/dels")
+	db.missMeter = metrics.NewMeter(prefix + "user/misses")
+	db.readMeter = metrics.NewMeter(prefix + "user/reads")
+	db.writeMeter = metrics.NewMeter(prefix + "user/writes")
+
+	db.lock.Lock()
+	db.compTimeMeter = metrics.NewMeter(prefix + "compact/time")
+	db.compReadMeter = metrics.NewMeter(prefix + "compact/input")
+	db.compWriteMeter = metrics.NewMeter(prefix + "compact/output")
+	db.lock.Unlock()
+}
+
+func (db *LSMDatabase) NewBatch() Batch {
+	return &lsmBatch{db: db}
+}
+
+type lsmBatch struct {
+	db   *LSMDatabase
+	ops  []byte
+	size int
+}
+
+func (b *lsmBatch) Put(key, value []byte) error {
+	b.ops = appendLSMOp(b.ops, key, lsmValue, value)
+	b.size += len(value)
+	return nil
+}
+
+func (b *lsmBatch) Delete(key []byte) error {
+	b.ops = appendLSMOp(b.ops, key, lsmDeleted, nil)
+	b.size += len(key)
+	return nil
+}
+
+func (b *lsmBatch) DeleteRange(start []byte, limit []byte) error {
+	return deleteBatchRange(b, b.db.NewIterator(nil, start), start, limit)
+}
+
+func (b *lsmBatch) Write() error {
+	if len(b.ops) == 0 {
+		return nil
+	}
+	return b.db.write(b.ops)
+}
+
+func (b *lsmBatch) ValueSize() int {
+	return b.size
+}
+
+func (b *lsmBatch) Reset() {
+	b.ops = b.ops[:0]
+	b.size = 0
+}
+
+func (b *lsmBatch) Replay(w Writer) error {
+	return decodeLSMOps(b.ops, func(key, value []byte) error {
+		if value[0] == lsmDeleted {
+			return w.Delete(key)
+		}
+		return w.Put(key, value[1:])
+	})
+}
+
+// appendLSMOp appends an encoded write operation to a buffer: the length
+// prefixed key followed by the length prefixed flagged value.
+func appendLSMOp(buf []byte, key []byte, flag byte, value []byte) []byte {
+	buf = appendUvarint(buf, uint64(len(key)))
+	buf = append(buf, key...)
+	buf = appendUvarint(buf, uint64(len(value)+1))
+	buf = append(buf, flag)
+	return append(buf, value...)
+}
+
+// decodeLSMOps iterates over a set of encoded write operations, calling the
+// callback with the key and the flagged value of each.
+func decodeLSMOps(ops []byte, fn func(key, value []byte) error) error {
+	for len(ops) > 0 {
+		klen, n := binary.Uvarint(ops)
+		if n <= 0 || uint64(len(ops)-n) < klen {
+			return errors.New("corrupted write operation")
+		}
+		key := ops[n : n+int(klen)]
+		ops = ops[n+int(klen):]
+
+		vlen, n := binary.Uvarint(ops)
+		if n <= 0 || vlen == 0 || uint64(len(ops)-n) < vlen {
+			return errors.New("corrupted write operation")
+		}
+		if err := fn(key, ops[n:n+int(vlen)]); err != nil {
+			return err
+		}
+		ops = ops[n+int(vlen):]
+	}
+	return nil
+}
+
+// unflagLSMValue strips the flag off a stored value, returning a copy of it or
+// errNotFound for tombstones.
+func unflagLSMValue(value []byte) ([]byte, error) {
+	if value[0] == lsmDeleted {
+		return nil, errNotFound
+	}
+	return common.CopyBytes(value[1:]), nil
+}
+
+// readLSMManifest reads the journal number, the next free file number and the
+// table numbers (newest first) from the manifest of a database.
+func readLSMManifest(dir string) (journal uint64, next uint64, tables []uint64, err error) {
+	blob, err := ioutil.ReadFile(filepath.Join(dir, lsmManifestName))
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	for i, line := range strings.Split(strings.TrimSpace(string(blob)), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return 0, 0, nil, fmt.Errorf("malformed manifest line %d: %q", i+1, line)
+		}
+		num, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return 0, 0, nil, fmt.Errorf("malformed manifest line %d: %v", i+1, err)
+		}
+		switch fields[0] {
+		case "version":
+			if num != lsmManifestVersion {
+				return 0, 0, nil, fmt.Errorf("unsupported database version %d", num)
+			}
+		case "journal":
+			journal = num
+		case "next":
+			next = num
+		case "table":
+			tables = append(tables, num)
+		default:
+			return 0, 0, nil, fmt.Errorf("malformed manifest line %d: %q", i+1, line)
+		}
+	}
+	if journal == 0 || next <= journal {
+		return 0, 0, nil, errors.New("malformed manifest")
+	}
+	return journal, next, tables, nil
+}
+
+// writeLSMManifest atomically replaces the manifest of a database.
+func writeLSMManifest(dir string, journal uint64, next uint64, tables []*lsmTable) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "version %d\njournal %d\nnext %d\n", lsmManifestVersion, journal, next)
+	for _, t := range tables {
+		fmt.Fprintf(&buf, "table %d\n", t.num)
+	}
+	path := filepath.Join(dir, lsmManifestName)
+	file, err := os.OpenFile(path+".tmp", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(buf.Bytes()); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// lsmSource is an iterator over flagged entries, either of the memtable or of a
+// table.
+type lsmSource interface {
+	First() bool
+	Seek(key []byte) bool
+	Next() bool
+	Key() []byte
+	Value() []byte
+	Error() error
+	Release()
+}
+
+// lsmMergeIterator merges a set of sources into a single sorted stream. If the
+// same key is present in multiple sources, the entry of the newest one is taken.
+// Tombstones are skipped unless the iterator is raw. The sources never reuse key
+// buffers, so the current key stays valid while the sources are advanced.
+type lsmMergeIterator struct {
+	sources []lsmSource // Sources to merge, newest first
+	valid   []bool      // Flags whether the sources are positioned on an entry
+	raw     bool        // Whether to yield tombstones and flagged values
+	tables  []*lsmTable // Tables pinned by the iterator
+	slice   *util.Range // Key range to iterate over, nil for the entire database
+
+	positioned bool   // Flag whether the iterator was positioned yet
+	key, value []byte // Current entry with a flagged value
+	err        error
+	released   bool
+}
+
+// newLSMMergeIterator creates an iterator merging a set of sources, ordered from
+// the newest to the oldest.
+func newLSMMergeIterator(sources []lsmSource, raw bool) *lsmMergeIterator {
+	return &lsmMergeIterator{
+		sources: sources,
+		valid:   make([]bool, len(sources)),
+		raw:     raw,
+	}
+}
+
+// First moves the iterator to the first entry.
+func (it *lsmMergeIterator) First() bool {
+	if it.released {
+		it.err = errLSMIterReleased
+		return false
+	}
+	if it.slice != nil && len(it.slice.Start) > 0 {
+		return it.Seek(it.slice.Start)
+	}
+	it.positioned = true
+	for i, src := range it.sources {
+		it.valid[i] = src.First()
+	}
+	return it.settle()
+}
+
+// Seek moves the iterator to the first entry with a key not less than the given
+// one.
+func (it *lsmMergeIterator) Seek(key []byte) bool {
+	if it.released {
+		it.err = errLSMIterReleased
+		return false
+	}
+	if it.slice != nil && bytes.Compare(key, it.slice.Start) < 0 {
+		key = it.slice.Start
+	}
+	it.positioned = true
+	for i, src := range it.sources {
+		it.valid[i] = src.Seek(key)
+	}
+	return it.settle()
+}
+
+// Next moves the iterator to the next entry.
+func (it *lsmMergeIterator) Next() bool {
+	if it.released {
+		it.err = errLSMIterReleased
+		return false
+	}
+	if !it.positioned {
+		return it.First()
+	}
+	if it.key == nil {
+		return false
+	}
+	it.advance(it.key)
+	return it.settle()
+}
+
+// advance moves all the sources positioned on the given key to their next entry.
+func (it *lsmMergeIterator) advance(key []byte) {
+	for i, src := range it.sources {
+		if it.valid[i] && bytes.Equal(src.Key(), key) {
+			it.valid[i] = src.Next()
+		}
+	}
+}
+
+// settle positions the iterator on the smallest key the sources are at, skipping
+// tombstones if needed and stopping at the end of the iterated range.
+func (it *lsmMergeIterator) settle() bool {
+	for {
+		best := -1
+		for i, src := range it.sources {
+			if !it.valid[i] {
+				if err := src.Error(); err != nil {
+					it.err, it.key, it.value = err, nil, nil
+					return false
+				}
+				continue
+			}
+			if best < 0 || bytes.Compare(src.Key(), it.sources[best].Key()) < 0 {
+				best = i
+			}
+		}
+		if best < 0 {
+			it.key, it.value = nil, nil
+			return false
+		}
+		key, value := it.sources[best].Key(), it.sources[best].Value()
+		if it.slice != nil && it.slice.Limit != nil && bytes.Compare(key, it.slice.Limit) >= 0 {
+			it.key, it.value = nil, nil
+			return false
+		}
+		if it.raw || value[0] != lsmDeleted {
+			it.key, it.value = key, value
+			return true
+		}
+		it.advance(key)
+	}
+}
+
+func (it *lsmMergeIterator) Key() []byte  { return it.key }
+func (it *lsmMergeIterator) Error() error { return it.err }
+
+// Value returns the value of the current entry, flagged if the iterator is raw.
+func (it *lsmMergeIterator) Value() []byte {
+	if it.raw || it.value == nil {
+		return it.value
+	}
+	return it.value[1:]
+}
+
+// Release releases the sources and unpins the tables of the iterator.
+func (it *lsmMergeIterator) Release() {
+	if it.released {
+		return
+	}
+	it.released = true
+	it.key, it.value = nil, nil
+
+	for _, src := range it.sources {
+		src.Release()
+	}
+	for _, t := range it.tables {
+		t.unref()
+	}
+}
@@ -0,0 +1,463 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethdb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sort"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/syndtr/goleveldb/leveldb/filter"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// An LSM table is an immutable file of entries sorted by key, laid out as:
+//
+//	[block 0][block 1]...[block n][index][filter][footer]
+//
+// Every block holds the entries as uvarint(len(key)) uvarint(len(value)) key
+// value, where the value is prefixed with the lsmValue or lsmDeleted flag byte.
+// The index lists the first key, offset, length and CRC32 of every block, the
+// filter is a bloom filter over all keys and the fixed size footer locates the
+// index and the filter.
+const (
+	lsmBlockSize     = 4096               // Size of the table blocks after which a new one is started
+	lsmFooterSize    = 32                 // Size of the table footer: index, filter offsets, entry count, magic
+	lsmTableMagic    = 0x7774636c736d7462 // Magic number ending every table ("wtclsmtb")
+	lsmFilterBitsKey = 10                 // Number of bloom filter bits per key
+)
+
+// Value flags prefixed to the values stored in the memtable and in tables.
+const (
+	lsmDeleted byte = iota // Entry is a tombstone shadowing older values
+	lsmValue               // Entry holds a value
+)
+
+var (
+	// errLSMCorrupted is returned if a table block doesn't match its checksum.
+	errLSMCorrupted = errors.New("corrupted table block")
+
+	// lsmCRCTable is the CRC32 polynomial table used by the journal and tables.
+	lsmCRCTable = crc32.MakeTable(crc32.Castagnoli)
+
+	// lsmFilter is the bloom filter policy of the tables.
+	lsmFilter = filter.NewBloomFilter(lsmFilterBitsKey)
+)
+
+// lsmBlockHandle is an index entry locating a table block.
+type lsmBlockHandle struct {
+	first  []byte // First key stored in the block
+	offset uint64 // Offset of the block within the table file
+	length uint64 // Length of the block
+	crc    uint32 // Checksum of the block content
+}
+
+// lsmTable is an open, immutable sorted table file.
+type lsmTable struct {
+	num     uint64           // File number of the table
+	path    string           // Path of the table file
+	file    *os.File         // Open file to read blocks from
+	size    uint64           // Size of the table file
+	entries uint64           // Number of entries (including tombstones)
+	index   []lsmBlockHandle // Index of all the blocks
+	filter  []byte           // Bloom filter over all the keys
+	refs    int32            // Reference count, the file is deleted once dropped and unreferenced
+	dropped int32            // Flag whether the table is no longer part of the database
+}
+
+// lsmTableWriter writes a sorted stream of entries into a new table file.
+type lsmTableWriter struct {
+	file   *os.File
+	buffer *bufio.Writer
+	filter filter.FilterGenerator
+
+	block   []byte           // Block being assembled
+	first   []byte           // First key of the block being assembled
+	index   []lsmBlockHandle // Handles of the blocks already written
+	offset  uint64           // Offset of the next block
+	entries uint64           // Number of entries added
+	scratch [2 * binary.MaxVarintLen64]byte
+}
+
+// newLSMTableWriter creates a table file at the given path to write into.
+func newLSMTableWriter(path string) (*lsmTableWriter, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &lsmTableWriter{
+		file:   file,
+		buffer: bufio.NewWriterSize(file, 64*1024),
+		filter: lsmFilter.NewGenerator(),
+	}, nil
+}
+
+// add appends an entry with a flagged value to the table. Entries must be added
+// in strictly ascending key order.
+func (w *lsmTableWriter) add(key, value []byte) error {
+	if len(w.block) == 0 {
+		w.first = append(w.first[:0], key...)
+	}
+	n := binary.PutUvarint(w.scratch[:], uint64(len(key)))
+	n += binary.PutUvarint(w.scratch[n:], uint64(len(value)))
+	w.block = append(w.block, w.scratch[:n]...)
+	w.block = append(w.block, key...)
+	w.block = append(w.block, value...)
+
+	w.filter.Add(key)
+	w.entries++
+
+	if len(w.block) >= lsmBlockSize {
+		return w.flushBlock()
+	}
+	return nil
+}
+
+// flushBlock writes out the block being assembled and indexes it.
+func (w *lsmTableWriter) flushBlock() error {
+	if len(w.block) == 0 {
+		return nil
+	}
+	if _, err := w.buffer.Write(w.block); err != nil {
+		return err
+	}
+	w.index = append(w.index, lsmBlockHandle{
+		first:  common.CopyBytes(w.first),
+		offset: w.offset,
+		length: uint64(len(w.block)),
+		crc:    crc32.Checksum(w.block, lsmCRCTable),
+	})
+	w.offset += uint64(len(w.block))
+	w.block = w.block[:0]
+	return nil
+}
+
+// finish writes out the index, the filter and the footer, and syncs the table
+// file to disk, returning its size.
+func (w *lsmTableWriter) finish() (uint64, error) {
+	if err := w.flushBlock(); err != nil {
+		return 0, err
+	}
+	// Write the block index
+	var index []byte
+	index = appendUvarint(index, uint64(len(w.index)))
+	for _, handle := range w.index {
+		index = appendUvarint(index, uint64(len(handle.first)))
+		index = append(index, handle.first...)
+		index = appendUvarint(index, handle.offset)
+		index = appendUvarint(index, handle.length)
+		index = append(index, byte(handle.crc>>24), byte(handle.crc>>16), byte(handle.crc>>8), byte(handle.crc))
+	}
+	indexOffset := w.offset
+	if _, err := w.buffer.Write(index); err != nil {
+		return 0, err
+	}
+	// Write the bloom filter over all the keys
+	buf := new(util.Buffer)
+	w.filter.Generate(buf)
+
+	filterOffset := indexOffset + uint64(len(index))
+	if _, err := w.buffer.Write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+	// Write the footer and flush everything to disk
+	footer := make([]byte, lsmFooterSize)
+	binary.BigEndian.PutUint64(footer[0:], indexOffset)
+	binary.BigEndian.PutUint64(footer[8:], filterOffset)
+	binary.BigEndian.PutUint64(footer[16:], w.entries)
+	binary.BigEndian.PutUint64(footer[24:], lsmTableMagic)
+	if _, err := w.buffer.Write(footer); err != nil {
+		return 0, err
+	}
+	if err := w.buffer.Flush(); err != nil {
+		return 0, err
+	}
+	if err := w.file.Sync(); err != nil {
+		return 0, err
+	}
+	if err := w.file.Close(); err != nil {
+		return 0, err
+	}
+	return filterOffset + uint64(buf.Len()) + lsmFooterSize, nil
+}
+
+// abort closes and removes a partially written table.
+func (w *lsmTableWriter) abort() {
+	w.file.Close()
+	os.Remove(w.file.Name())
+}
+
+// openLSMTable opens a table file, loading its index and filter into memory.
+func openLSMTable(num uint64, path string) (*lsmTable, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	t, err := loadLSMTable(num, path, file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("table %s: %v", path, err)
+	}
+	return t, nil
+}
+
+// loadLSMTable reads the footer, the index and the filter of a table file.
+func loadLSMTable(num uint64, path string, file *os.File) (*lsmTable, error) {
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := uint64(stat.Size())
+	if size < lsmFooterSize {
+		return nil, errors.New("table too short")
+	}
+	footer := make([]byte, lsmFooterSize)
+	if _, err := file.ReadAt(footer, int64(size-lsmFooterSize)); err != nil {
+		return nil, err
+	}
+	if binary.BigEndian.Uint64(footer[24:]) != lsmTableMagic {
+		return nil, errors.New("bad table magic")
+	}
+	indexOffset := binary.BigEndian.Uint64(footer[0:])
+	filterOffset := binary.BigEndian.Uint64(footer[8:])
+	if indexOffset > filterOffset || filterOffset > size-lsmFooterSize {
+		return nil, errors.New("bad table footer")
+	}
+	meta := make([]byte, size-lsmFooterSize-indexOffset)
+	if _, err := file.ReadAt(meta, int64(indexOffset)); err != nil {
+		return nil, err
+	}
+	t := &lsmTable{
+		num:     num,
+		path:    path,
+		file:    file,
+		size:    size,
+		entries: binary.BigEndian.Uint64(footer[16:]),
+		filter:  meta[filterOffset-indexOffset:],
+		refs:    1,
+	}
+	// Decode the block index
+	index := meta[:filterOffset-indexOffset]
+	count, n := binary.Uvarint(index)
+	if n <= 0 {
+		return nil, errors.New("bad table index")
+	}
+	index = index[n:]
+	t.index = make([]lsmBlockHandle, 0, count)
+	for i := uint64(0); i < count; i++ {
+		var handle lsmBlockHandle
+		klen, n := binary.Uvarint(index)
+		if n <= 0 || uint64(len(index)-n) < klen {
+			return nil, errors.New("bad table index")
+		}
+		handle.first, index = index[n:n+int(klen)], index[n+int(klen):]
+		if handle.offset, n = binary.Uvarint(index); n <= 0 {
+			return nil, errors.New("bad table index")
+		}
+		index = index[n:]
+		if handle.length, n = binary.Uvarint(index); n <= 0 || len(index) < n+4 {
+			return nil, errors.New("bad table index")
+		}
+		handle.crc = binary.BigEndian.Uint32(index[n:])
+		index = index[n+4:]
+
+		if handle.offset+handle.length > indexOffset {
+			return nil, errors.New("bad table index")
+		}
+		t.index = append(t.index, handle)
+	}
+	return t, nil
+}
+
+// ref increments the reference count of the table.
+func (t *lsmTable) ref() {
+	atomic.AddInt32(&t.refs, 1)
+}
+
+// unref decrements the reference count of the table, closing its file once
+// unreferenced and deleting it too if the table was dropped from the database.
+func (t *lsmTable) unref() {
+	if atomic.AddInt32(&t.refs, -1) == 0 {
+		t.file.Close()
+		if atomic.LoadInt32(&t.dropped) == 1 {
+			os.Remove(t.path)
+		}
+	}
+}
+
+// drop marks the table as removed from the database and releases the database's
+// own reference to it. The file is deleted once all iterators are done with it.
+func (t *lsmTable) drop() {
+	atomic.StoreInt32(&t.dropped, 1)
+	t.unref()
+}
+
+// readBlock loads and verifies a table block.
+func (t *lsmTable) readBlock(i int) ([]byte, error) {
+	handle := t.index[i]
+	block := make([]byte, handle.length)
+	if _, err := t.file.ReadAt(block, int64(handle.offset)); err != nil && err != io.EOF {
+		return nil, err
+	}
+	if crc32.Checksum(block, lsmCRCTable) != handle.crc {
+		return nil, fmt.Errorf("%v: table %d, block %d", errLSMCorrupted, t.num, i)
+	}
+	return block, nil
+}
+
+// get retrieves the flagged value of a key from the table, or nil if the table
+// doesn't contain it.
+func (t *lsmTable) get(key []byte) ([]byte, error) {
+	if !lsmFilter.Contains(t.filter, key) {
+		return nil, nil
+	}
+	i := sort.Search(len(t.index), func(i int) bool {
+		return bytes.Compare(t.index[i].first, key) > 0
+	}) - 1
+	if i < 0 {
+		return nil, nil
+	}
+	block, err := t.readBlock(i)
+	if err != nil {
+		return nil, err
+	}
+	for len(block) > 0 {
+		k, v, rest, err := decodeLSMEntry(block)
+		if err != nil {
+			return nil, fmt.Errorf("table %d, block %d: %v", t.num, i, err)
+		}
+		switch bytes.Compare(k, key) {
+		case 0:
+			return v, nil
+		case 1:
+			return nil, nil
+		}
+		block = rest
+	}
+	return nil, nil
+}
+
+// decodeLSMEntry splits the next entry off a block.
+func decodeLSMEntry(block []byte) (key, value, rest []byte, err error) {
+	klen, n := binary.Uvarint(block)
+	if n <= 0 {
+		return nil, nil, nil, errLSMCorrupted
+	}
+	block = block[n:]
+	vlen, n := binary.Uvarint(block)
+	if n <= 0 || uint64(len(block)-n) < klen+vlen || vlen == 0 {
+		return nil, nil, nil, errLSMCorrupted
+	}
+	block = block[n:]
+	return block[:klen], block[klen : klen+vlen], block[klen+vlen:], nil
+}
+
+// appendUvarint appends the uvarint encoding of a number to a buffer.
+func appendUvarint(buf []byte, x uint64) []byte {
+	var scratch [binary.MaxVarintLen64]byte
+	return append(buf, scratch[:binary.PutUvarint(scratch[:], x)]...)
+}
+
+// lsmTableIterator iterates over the flagged entries of a table in key order.
+type lsmTableIterator struct {
+	table *lsmTable
+	block int    // Index of the block being iterated
+	data  []byte // Remainder of the block being iterated
+	key   []byte // Key of the current entry
+	value []byte // Flagged value of the current entry
+	err   error
+}
+
+// newIterator creates an iterator over the table, positioned before the first
+// entry.
+func (t *lsmTable) newIterator() *lsmTableIterator {
+	return &lsmTableIterator{table: t, block: -1}
+}
+
+// load positions the iterator before the first entry of a block.
+func (it *lsmTableIterator) load(i int) bool {
+	it.key, it.value, it.data = nil, nil, nil
+	if it.err != nil || i >= len(it.table.index) {
+		it.block = len(it.table.index)
+		return false
+	}
+	it.block = i
+	it.data, it.err = it.table.readBlock(i)
+	return it.err == nil
+}
+
+// First moves the iterator to the first entry.
+func (it *lsmTableIterator) First() bool {
+	if !it.load(0) {
+		return false
+	}
+	return it.Next()
+}
+
+// Seek moves the iterator to the first entry with a key not less than the given
+// one.
+func (it *lsmTableIterator) Seek(key []byte) bool {
+	i := sort.Search(len(it.table.index), func(i int) bool {
+		return bytes.Compare(it.table.index[i].first, key) > 0
+	}) - 1
+	if i < 0 {
+		i = 0
+	}
+	if !it.load(i) {
+		return false
+	}
+	for it.Next() {
+		if bytes.Compare(it.key, key) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Next moves the iterator to the next entry, crossing into the next block when
+// the current one is exhausted.
+func (it *lsmTableIterator) Next() bool {
+	for len(it.data) == 0 {
+		if it.block < 0 {
+			return it.First()
+		}
+		if !it.load(it.block + 1) {
+			return false
+		}
+	}
+	it.key, it.value, it.data, it.err = decodeLSMEntry(it.data)
+	if it.err != nil {
+		it.err = fmt.Errorf("table %d, block %d: %v", it.table.num, it.block, it.err)
+		it.key, it.value, it.data = nil, nil, nil
+		it.block = len(it.table.index)
+		return false
+	}
+	return true
+}
+
+func (it *lsmTableIterator) Key() []byte   { return it.key }
+func (it *lsmTableIterator) Value() []byte { return it.value }
+func (it *lsmTableIterator) Error() error  { return it.err }
+func (it *lsmTableIterator) Release()      {}
@@ -0,0 +1,311 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethdb
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// openTestLSM opens an LSM database with a tiny memtable to exercise flushes
+// and compactions.
+func openTestLSM(t *testing.T, dir string) *LSMDatabase {
+	db, err := NewLSMDatabase(dir, 0, 0)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	db.writeLock.Lock()
+	db.writeBuffer = 4096
+	db.writeLock.Unlock()
+	return db
+}
+
+// waitLSMCompaction blocks until no more tables are to be merged.
+func waitLSMCompaction(t *testing.T, db *LSMDatabase) {
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		db.lock.RLock()
+		n := pickLSMCompaction(db.tables)
+		db.lock.RUnlock()
+		if n < 2 {
+			return
+		}
+	}
+	t.Fatalf("compaction timed out")
+}
+
+// checkLSMContent verifies that a database holds exactly the expected entries,
+// both by lookups and by iteration.
+func checkLSMContent(t *testing.T, db *LSMDatabase, want map[string]string, deleted []string) {
+	for key, value := range want {
+		if data, err := db.Get([]byte(key)); err != nil || string(data) != value {
+			t.Fatalf("key %q mismatch: have %q, %v, want %q", key, data, err, value)
+		}
+	}
+	for _, key := range deleted {
+		if has, err := db.Has([]byte(key)); err != nil || has {
+			t.Fatalf("deleted key %q present: %v, %v", key, has, err)
+		}
+	}
+	it := db.NewIterator(nil, nil)
+	defer it.Release()
+
+	var (
+		count int
+		prev  []byte
+	)
+	for it.Next() {
+		if prev != nil && bytes.Compare(prev, it.Key()) >= 0 {
+			t.Fatalf("iteration out of order: %q after %q", it.Key(), prev)
+		}
+		prev = append(prev[:0], it.Key()...)
+		if value, ok := want[string(it.Key())]; !ok || value != string(it.Value()) {
+			t.Fatalf("iterated key %q mismatch: have %q, want %q (present %v)", it.Key(), it.Value(), value, ok)
+		}
+		count++
+	}
+	if err := it.Error(); err != nil {
+		t.Fatalf("iteration failed: %v", err)
+	}
+	if count != len(want) {
+		t.Fatalf("iterated entry count mismatch: have %d, want %d", count, len(want))
+	}
+}
+
+// Tests that data survives memtable flushes, table merges and reopening, with
+// deletions shadowing older values throughout.
+func TestLSMFlushCompactReopen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lsm-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db := openTestLSM(t, dir)
+	want := make(map[string]string)
+	var deleted []string
+	for round := 0; round < 5; round++ {
+		for i := 0; i < 500; i++ {
+			key, value := fmt.Sprintf("key-%04d", (i*7+round*131)%1000), fmt.Sprintf("value-%d-%d", round, i)
+			if err := db.Put([]byte(key), []byte(value)); err != nil {
+				t.Fatalf("put failed: %v", err)
+			}
+			want[key] = value
+		}
+		batch := db.NewBatch()
+		for i := round; i < 1000; i += 50 {
+			key := fmt.Sprintf("key-%04d", i)
+			batch.Put([]byte(key), []byte("batched"))
+			want[key] = "batched"
+		}
+		if err := batch.Write(); err != nil {
+			t.Fatalf("batch write failed: %v", err)
+		}
+		for i := round * 3; i < 1000; i += 97 {
+			key := fmt.Sprintf("key-%04d", i)
+			if err := db.Delete([]byte(key)); err != nil {
+				t.Fatalf("delete failed: %v", err)
+			}
+			delete(want, key)
+			deleted = append(deleted, key)
+		}
+	}
+	// Deleted keys may have been rewritten by later rounds
+	live := deleted[:0]
+	for _, key := range deleted {
+		if _, ok := want[key]; !ok {
+			live = append(live, key)
+		}
+	}
+	deleted = live
+
+	db.lock.RLock()
+	tables := len(db.tables)
+	db.lock.RUnlock()
+	if tables == 0 {
+		t.Fatalf("memtable never flushed")
+	}
+	checkLSMContent(t, db, want, deleted)
+	waitLSMCompaction(t, db)
+	checkLSMContent(t, db, want, deleted)
+	db.Close()
+
+	// Reopen, replaying the unflushed journal
+	db = openTestLSM(t, dir)
+	defer db.Close()
+	checkLSMContent(t, db, want, deleted)
+}
+
+// Tests that a torn write at the end of the journal is cut off on reopen,
+// keeping all the preceding writes.
+func TestLSMJournalRecovery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lsm-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := NewLSMDatabase(dir, 0, 0)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	db.Put([]byte("a"), []byte("1"))
+	db.Put([]byte("b"), []byte("2"))
+	db.Delete([]byte("a"))
+	journal := db.filePath(db.journalNum, "journal")
+	db.Close()
+
+	// Append a partial record to the journal
+	stat, err := os.Stat(journal)
+	if err != nil {
+		t.Fatalf("journal missing: %v", err)
+	}
+	file, _ := os.OpenFile(journal, os.O_WRONLY|os.O_APPEND, 0644)
+	file.Write([]byte{0x01, 0x02, 0x03, 0x04, 0x00, 0x00, 0x00, 0x10, 0xff})
+	file.Close()
+
+	db, err = NewLSMDatabase(dir, 0, 0)
+	if err != nil {
+		t.Fatalf("failed to reopen database: %v", err)
+	}
+	checkLSMContent(t, db, map[string]string{"b": "2"}, []string{"a"})
+	db.Put([]byte("c"), []byte("3"))
+	db.Close()
+
+	if size, _ := os.Stat(journal); size.Size() <= stat.Size() {
+		t.Fatalf("journal not appended after truncation: %d <= %d", size.Size(), stat.Size())
+	}
+	db, err = NewLSMDatabase(dir, 0, 0)
+	if err != nil {
+		t.Fatalf("failed to reopen database: %v", err)
+	}
+	defer db.Close()
+	checkLSMContent(t, db, map[string]string{"b": "2", "c": "3"}, []string{"a"})
+}
+
+// Tests that an open iterator keeps seeing a consistent view while the tables
+// it reads are merged away, and that the merged files are deleted after.
+func TestLSMIteratorPinning(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lsm-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db := openTestLSM(t, dir)
+	defer db.Close()
+
+	want := make(map[string]string)
+	for i := 0; i < 200; i++ {
+		key := fmt.Sprintf("key-%04d", i)
+		db.Put([]byte(key), bytes.Repeat([]byte{'x'}, 100))
+		want[key] = string(bytes.Repeat([]byte{'x'}, 100))
+	}
+	waitLSMCompaction(t, db)
+
+	it := db.NewIterator(nil, nil)
+	db.lock.RLock()
+	pinned := append([]*lsmTable{}, db.tables...)
+	db.lock.RUnlock()
+
+	// Overwrite everything, forcing the pinned tables to be merged away
+	for i := 0; i < 200; i++ {
+		db.Put([]byte(fmt.Sprintf("key-%04d", i)), []byte("new"))
+	}
+	waitLSMCompaction(t, db)
+
+	var count int
+	for it.Next() {
+		if len(it.Value()) != 100 && string(it.Value()) != "new" {
+			t.Fatalf("iterated key %q value mismatch: %q", it.Key(), it.Value())
+		}
+		count++
+	}
+	if err := it.Error(); err != nil {
+		t.Fatalf("iteration failed: %v", err)
+	}
+	if count != len(want) {
+		t.Fatalf("iterated entry count mismatch: have %d, want %d", count, len(want))
+	}
+	it.Release()
+
+	for _, table := range pinned {
+		if _, err := os.Stat(table.path); !os.IsNotExist(err) {
+			db.lock.RLock()
+			live := false
+			for _, t := range db.tables {
+				live = live || t == table
+			}
+			db.lock.RUnlock()
+			if !live {
+				t.Errorf("merged table %s not deleted: %v", table.path, err)
+			}
+		}
+	}
+}
+
+// Tests that a requested compaction merges the memtable and all the tables into
+// a single one without tombstones, and that the stats reflect it.
+func TestLSMCompact(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lsm-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db := openTestLSM(t, dir)
+	defer db.Close()
+
+	want := make(map[string]string)
+	var deleted []string
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("key-%04d", i)
+		db.Put([]byte(key), []byte(key))
+		want[key] = key
+	}
+	for i := 0; i < 1000; i += 3 {
+		key := fmt.Sprintf("key-%04d", i)
+		db.Delete([]byte(key))
+		delete(want, key)
+		deleted = append(deleted, key)
+	}
+	if err := db.Compact(nil, nil); err != nil {
+		t.Fatalf("compaction failed: %v", err)
+	}
+	db.lock.RLock()
+	tables, memLen := db.tables, db.mem.Len()
+	db.lock.RUnlock()
+	if len(tables) != 1 || memLen != 0 {
+		t.Fatalf("database not compacted: %d tables, %d memtable entries", len(tables), memLen)
+	}
+	if tables[0].entries != uint64(len(want)) {
+		t.Fatalf("compacted entry count mismatch: have %d, want %d", tables[0].entries, len(want))
+	}
+	checkLSMContent(t, db, want, deleted)
+
+	stats, err := db.Stat("lsm.stats")
+	if err != nil {
+		t.Fatalf("failed to retrieve stats: %v", err)
+	}
+	if !strings.Contains(stats, fmt.Sprintf("%d entries", len(want))) {
+		t.Fatalf("stats missing table entries:\n%s", stats)
+	}
+}
@@ -18,6 +18,8 @@ package ethdb
 
 import (
 	"errors"
+	"sort"
+	"strings"
 	"sync"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -90,13 +92,98 @@ func (db *MemDatabase) Delete(key []byte) error {
 	return nil
 }
 
+// DeleteRange deletes all the keys in the range [start, limit) from the database.
+func (db *MemDatabase) DeleteRange(start []byte, limit []byte) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	for key := range db.db {
+		if key >= string(start) && (limit == nil || key < string(limit)) {
+			delete(db.db, key)
+		}
+	}
+	return nil
+}
+
 func (db *MemDatabase) Close() {}
 
+// NewIterator creates an iterator over a point-in-time copy of the entries with
+// a particular key prefix, starting at a particular key relative to the prefix,
+// in ascending key order.
+func (db *MemDatabase) NewIterator(prefix []byte, start []byte) Iterator {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	var (
+		pr = string(prefix)
+		st = string(append(append([]byte{}, prefix...), start...))
+		it = &memIterator{index: -1, values: make(map[string][]byte)}
+	)
+	for key, value := range db.db {
+		if !strings.HasPrefix(key, pr) || key < st {
+			continue
+		}
+		it.keys = append(it.keys, key)
+		it.values[key] = common.CopyBytes(value)
+	}
+	sort.Strings(it.keys)
+	return it
+}
+
+// Stat returns a particular internal stat of the database. The memory database
+// doesn't track any.
+func (db *MemDatabase) Stat(property string) (string, error) {
+	return "", errors.New("unknown property")
+}
+
+// Compact is a no-op, the memory database has nothing to flatten.
+func (db *MemDatabase) Compact(start []byte, limit []byte) error {
+	return nil
+}
+
+// memIterator iterates over a sorted copy of the memory database content.
+type memIterator struct {
+	keys   []string
+	values map[string][]byte
+	index  int // Position of the iterator in the sorted keys, -1 before the first
+}
+
+func (it *memIterator) Next() bool {
+	if it.index < len(it.keys) {
+		it.index++
+	}
+	return it.index < len(it.keys)
+}
+
+func (it *memIterator) Error() error { return nil }
+
+func (it *memIterator) Key() []byte {
+	if it.index < 0 || it.index >= len(it.keys) {
+		return nil
+	}
+	return []byte(it.keys[it.index])
+}
+
+func (it *memIterator) Value() []byte {
+	if it.index < 0 || it.index >= len(it.keys) {
+		return nil
+	}
+	return it.values[it.keys[it.index]]
+}
+
+// Release drops the copied content and exhausts the iterator.
+func (it *memIterator) Release() {
+	it.keys, it.values = nil, nil
+}
+
 func (db *MemDatabase) NewBatch() Batch {
 	return &memBatch{db: db}
 }
 
-type kv struct{ k, v []byte }
+type kv struct {
+	k, v []byte
+	del  bool
+}
 
 type memBatch struct {
 	db     *MemDatabase
@@ -105,16 +192,30 @@ type memBatch struct {
 }
 
 func (b *memBatch) Put(key, value []byte) error {
-	b.writes = append(b.writes, kv{common.CopyBytes(key), common.CopyBytes(value)})
+	b.writes = append(b.writes, kv{common.CopyBytes(key), common.CopyBytes(value), false})
 	b.size += len(value)
 	return nil
 }
 
+func (b *memBatch) Delete(key []byte) error {
+	b.writes = append(b.writes, kv{common.CopyBytes(key), nil, true})
+	b.size += len(key)
+	return nil
+}
+
+func (b *memBatch) DeleteRange(start []byte, limit []byte) error {
+	return deleteBatchRange(b, b.db.NewIterator(nil, start), start, limit)
+}
+
 func (b *memBatch) Write() error {
 	b.db.lock.Lock()
 	defer b.db.lock.Unlock()
 
 	for _, kv := range b.writes {
+		if kv.del {
+			delete(b.db.db, string(kv.k))
+			continue
+		}
 		b.db.db[string(kv.k)] = kv.v
 	}
 	return nil
@@ -123,3 +224,23 @@ func (b *memBatch) Write() error {
 func (b *memBatch) ValueSize() int {
 	return b.size
 }
+
+func (b *memBatch) Reset() {
+	b.writes = b.writes[:0]
+	b.size = 0
+}
+
+func (b *memBatch) Replay(w Writer) error {
+	for _, kv := range b.writes {
+		if kv.del {
+			if err := w.Delete(kv.k); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := w.Put(kv.k, kv.v); err != nil {
+			return err
+		}
+	}
+	return nil
+}